@@ -60,3 +60,9 @@ func (ap AddressFamilyAndProtocol) toByte() byte {
 
 	return byte(UNSPEC)
 }
+
+// isKnown returns true if the address family and transport protocol are
+// one of the combinations defined by the spec, including UNSPEC.
+func (ap AddressFamilyAndProtocol) isKnown() bool {
+	return byte(ap) == ap.toByte()
+}
@@ -0,0 +1,175 @@
+package proxyproto
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// AuditRecord is the record of a connection written by an AuditLog once the
+// connection is closed, as a line of JSON.
+type AuditRecord struct {
+	// Accepted is the time the connection was accepted at.
+	Accepted time.Time `json:"accepted"`
+	// SocketSource and SocketDestination are the addresses of the
+	// underlying connection.
+	SocketSource      string `json:"socket_src"`
+	SocketDestination string `json:"socket_dst"`
+	// HeaderSource and HeaderDestination are the addresses of the header
+	// used, if any.
+	HeaderSource      string `json:"header_src,omitempty"`
+	HeaderDestination string `json:"header_dst,omitempty"`
+	// Version is the version of the header used, if any.
+	Version byte `json:"version,omitempty"`
+	// Command is the command of the header used, if any, "PROXY" or
+	// "LOCAL".
+	Command string `json:"command,omitempty"`
+	// TLVTypes lists the types of the TLVs of the header used, in order of
+	// appearance, see HeaderStats.
+	TLVTypes []PP2Type `json:"tlv_types,omitempty"`
+	// Policy is the policy of the connection, e.g. "USE" or "REQUIRE".
+	Policy string `json:"policy"`
+	// Outcome is what became of the header, see the AuditOutcome constants.
+	Outcome AuditOutcome `json:"outcome"`
+	// Error is the error the header failed with, if any, and Reason its
+	// reason if it failed to parse, see ParseError.
+	Error  string           `json:"error,omitempty"`
+	Reason ParseErrorReason `json:"reason,omitempty"`
+	// HeaderLatency is the time taken to receive the header, see
+	// Conn.HeaderLatency, and Duration the lifetime of the connection.
+	HeaderLatency time.Duration `json:"header_latency_ns,omitempty"`
+	Duration      time.Duration `json:"duration_ns"`
+	// HeaderBytes is the size of the header, and BytesRead and
+	// BytesWritten the traffic of the connection, see ConnStats.
+	HeaderBytes  int    `json:"header_bytes,omitempty"`
+	BytesRead    uint64 `json:"bytes_read"`
+	BytesWritten uint64 `json:"bytes_written"`
+}
+
+// AuditOutcome is what became of the header of an audited connection.
+type AuditOutcome string
+
+const (
+	// AuditUsed means the addresses of the header were used.
+	AuditUsed AuditOutcome = "used"
+	// AuditIgnored means a header was received, but not used, e.g. because
+	// of the IGNORE policy.
+	AuditIgnored AuditOutcome = "ignored"
+	// AuditNoHeader means no header was received, nor required.
+	AuditNoHeader AuditOutcome = "no_header"
+	// AuditFailed means the header was missing, malformed or disallowed.
+	AuditFailed AuditOutcome = "failed"
+	// AuditUnread means the connection was closed before its header was
+	// looked for.
+	AuditUnread AuditOutcome = "unread"
+)
+
+var policyNames = map[Policy]string{
+	USE:     "USE",
+	IGNORE:  "IGNORE",
+	REJECT:  "REJECT",
+	REQUIRE: "REQUIRE",
+	SKIP:    "SKIP",
+}
+
+// AuditLog writes a record of each connection it audits to a writer, one
+// line of JSON per connection, e.g. for compliance. It is safe for
+// concurrent use, and can be shared by several listeners, see
+// Listener.AuditLog.
+type AuditLog struct {
+	mu      sync.Mutex
+	enc     *json.Encoder
+	onError func(error)
+}
+
+// NewAuditLog returns an AuditLog writing to w. Write errors are passed to
+// onError, if not nil, and otherwise dropped, so that a failing log doesn't
+// fail connections.
+func NewAuditLog(w io.Writer, onError func(error)) *AuditLog {
+	return &AuditLog{enc: json.NewEncoder(w), onError: onError}
+}
+
+// write writes the record, as a single write to the underlying writer.
+func (l *AuditLog) write(record *AuditRecord) {
+	l.mu.Lock()
+	err := l.enc.Encode(record)
+	l.mu.Unlock()
+	if err != nil && l.onError != nil {
+		l.onError(err)
+	}
+}
+
+// WithAuditLog makes the connection write its record to the audit log once
+// closed, when passed as option to NewConn(). It enables the traffic
+// counters of the connection, see WithStats. Connections which aren't
+// closed aren't recorded.
+func WithAuditLog(l *AuditLog) func(*Conn) {
+	return func(c *Conn) {
+		c.auditLog = l
+		if c.counters == nil {
+			c.counters = &connCounters{}
+		}
+	}
+}
+
+// audit writes the record of the closed connection to its audit log. It
+// waits for a header being read concurrently, unblocked by the closing of
+// the connection.
+func (p *Conn) audit() {
+	unread := false
+	p.once.Do(func() { unread = true })
+
+	stats := p.Stats()
+	record := &AuditRecord{
+		Accepted:          p.acceptedAt,
+		SocketSource:      addrString(p.conn.RemoteAddr()),
+		SocketDestination: addrString(p.conn.LocalAddr()),
+		Policy:            policyNames[p.ProxyHeaderPolicy],
+		Duration:          p.now().Sub(p.acceptedAt),
+		HeaderBytes:       p.headerBytes,
+		BytesRead:         stats.BytesRead,
+		BytesWritten:      stats.BytesWritten,
+	}
+	if p.headerParsed {
+		record.HeaderLatency = p.headerLatency
+	}
+
+	switch {
+	case unread:
+		record.Outcome = AuditUnread
+	case p.readErr != nil:
+		record.Outcome = AuditFailed
+		record.Error = p.readErr.Error()
+		var pe *ParseError
+		if errors.As(p.readErr, &pe) {
+			record.Reason = pe.Reason
+		}
+	case p.header != nil:
+		record.Outcome = AuditUsed
+		record.HeaderSource = addrString(p.header.SourceAddr)
+		record.HeaderDestination = addrString(p.header.DestinationAddr)
+		record.Version = p.header.Version
+		record.Command = "PROXY"
+		if p.header.Command.IsLocal() {
+			record.Command = "LOCAL"
+		}
+		record.TLVTypes = headerStats(p.header).TLVTypes
+	case p.headerParsed:
+		record.Outcome = AuditIgnored
+	default:
+		record.Outcome = AuditNoHeader
+	}
+
+	p.auditLog.write(record)
+}
+
+// addrString returns the string form of addr, or an empty string if nil.
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
@@ -0,0 +1,140 @@
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestConnWithAuditLog(t *testing.T) {
+	header := HeaderProxyFromAddrs(2, v4addr, v4addr)
+	if err := header.SetTLVs([]TLV{{Type: PP2_TYPE_AUTHORITY, Value: []byte("example.org")}}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	size, err := header.Format()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var buf bytes.Buffer
+	log := NewAuditLog(&buf, nil)
+
+	server, client := net.Pipe()
+	defer client.Close()
+	go func() {
+		_, _ = WriteHeaderAndPayload(client, header, []byte("ping"))
+		_, _ = io.ReadFull(client, make([]byte, 4))
+	}()
+
+	conn := NewConn(server, WithPolicy(REQUIRE), WithAuditLog(log))
+	if _, err := io.ReadFull(conn, make([]byte, 4)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := conn.Write([]byte("pong")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	conn.Close()
+	conn.Close()
+
+	lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+	if len(lines) != 1 {
+		t.Fatalf("expected a single record, got %q", buf.String())
+	}
+	var record AuditRecord
+	if err := json.Unmarshal(lines[0], &record); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if record.Outcome != AuditUsed || record.Policy != "REQUIRE" {
+		t.Fatalf("unexpected outcome %q and policy %q", record.Outcome, record.Policy)
+	}
+	if record.SocketSource != "pipe" || record.HeaderSource != v4addr.String() || record.HeaderDestination != v4addr.String() {
+		t.Fatalf("unexpected addresses %+v", record)
+	}
+	if record.Version != 2 || record.Command != "PROXY" {
+		t.Fatalf("unexpected version %d and command %q", record.Version, record.Command)
+	}
+	if len(record.TLVTypes) != 1 || record.TLVTypes[0] != PP2_TYPE_AUTHORITY {
+		t.Fatalf("unexpected TLV types %v", record.TLVTypes)
+	}
+	if record.HeaderBytes != len(size) || record.BytesRead != 4 || record.BytesWritten != 4 {
+		t.Fatalf("unexpected byte counts %+v", record)
+	}
+	if record.Accepted.IsZero() || record.Duration <= 0 {
+		t.Fatalf("unexpected times %+v", record)
+	}
+}
+
+func TestConnWithAuditLogOutcomes(t *testing.T) {
+	var cases = []struct {
+		name    string
+		policy  Policy
+		header  *Header
+		read    bool
+		outcome AuditOutcome
+	}{
+		{"unread", USE, nil, false, AuditUnread},
+		{"ignored", IGNORE, HeaderProxyFromAddrs(1, v4addr, v4addr), true, AuditIgnored},
+		{"no header", USE, nil, true, AuditNoHeader},
+		{"failed", REQUIRE, nil, true, AuditFailed},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			server, client := net.Pipe()
+			defer client.Close()
+
+			raw := []byte("ping")
+			if tc.header != nil {
+				var err error
+				if raw, err = tc.header.Format(); err != nil {
+					t.Fatalf("err: %v", err)
+				}
+				raw = append(raw, "ping"...)
+			}
+			go func() {
+				_, _ = client.Write(raw)
+			}()
+
+			conn := NewConn(server, WithPolicy(tc.policy), WithAuditLog(NewAuditLog(&buf, nil)))
+			if tc.read {
+				_, _ = conn.Read(make([]byte, 4))
+			}
+			conn.Close()
+
+			var record AuditRecord
+			if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if record.Outcome != tc.outcome {
+				t.Fatalf("expected outcome %q, got %q", tc.outcome, record.Outcome)
+			}
+			if tc.outcome == AuditFailed && record.Error == "" {
+				t.Fatal("expected the error to be recorded")
+			}
+			if record.HeaderSource != "" {
+				t.Fatalf("expected no header address, got %q", record.HeaderSource)
+			}
+		})
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestAuditLogError(t *testing.T) {
+	var logErr error
+	log := NewAuditLog(failingWriter{}, func(err error) { logErr = err })
+
+	server, client := net.Pipe()
+	defer client.Close()
+	NewConn(server, WithAuditLog(log)).Close()
+
+	if logErr == nil || logErr.Error() != "disk full" {
+		t.Fatalf("expected the write error, got %v", logErr)
+	}
+}
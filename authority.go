@@ -0,0 +1,62 @@
+package proxyproto
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrAuthorityNotAllowed is returned when the PP2_TYPE_AUTHORITY TLV of a
+// header doesn't match the hostnames allowed with AllowAuthorities.
+var ErrAuthorityNotAllowed = errors.New("proxyproto: header authority not allowed")
+
+// AllowAuthorities rejects the headers whose PP2_TYPE_AUTHORITY TLV, when
+// present, matches none of the given patterns with ErrAuthorityNotAllowed,
+// when passed as option to NewConn(). This prevents a shared edge from
+// routing the traffic of one tenant to the service of another.
+//
+// A pattern is either a hostname, or a wildcard such as "*.example.com"
+// matching exactly one label in place of the asterisk, as in TLS
+// certificates. Matching is case-insensitive and ignores a trailing dot.
+// Without patterns, any header carrying an authority is rejected. The
+// patterns replace the ones of a previous AllowAuthorities option.
+func AllowAuthorities(patterns ...string) func(*Conn) {
+	return func(c *Conn) {
+		c.allowedAuthorities = make([]string, 0, len(patterns))
+		for _, pattern := range patterns {
+			c.allowedAuthorities = append(c.allowedAuthorities, normalizeHostname(pattern))
+		}
+	}
+}
+
+// checkAuthority makes sure the authority of the header, if any, matches
+// one of the normalized patterns.
+func checkAuthority(header *Header, patterns []string) error {
+	value, ok := findTLV(header.rawTLVs, PP2_TYPE_AUTHORITY)
+	if !ok {
+		return nil
+	}
+
+	authority := normalizeHostname(string(value))
+	for _, pattern := range patterns {
+		if matchHostname(pattern, authority) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrAuthorityNotAllowed, value)
+}
+
+// matchHostname tells whether the normalized hostname matches the pattern.
+func matchHostname(pattern, hostname string) bool {
+	suffix, wildcard := strings.CutPrefix(pattern, "*.")
+	if !wildcard {
+		return pattern == hostname
+	}
+	label, rest, found := strings.Cut(hostname, ".")
+	return found && label != "" && rest == suffix
+}
+
+// normalizeHostname lowercases the hostname and drops its trailing dot.
+func normalizeHostname(hostname string) string {
+	return strings.ToLower(strings.TrimSuffix(hostname, "."))
+}
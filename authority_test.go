@@ -0,0 +1,139 @@
+package proxyproto
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestAllowAuthorities(t *testing.T) {
+	var cases = []struct {
+		name      string
+		authority string
+		err       error
+	}{
+		{"exact", "api.example.com", nil},
+		{"case and trailing dot", "API.Example.com.", nil},
+		{"wildcard", "tenant.example.org", nil},
+		{"wildcard single label", "a.b.example.org", ErrAuthorityNotAllowed},
+		{"wildcard apex", "example.org", ErrAuthorityNotAllowed},
+		{"mismatch", "other.example.com", ErrAuthorityNotAllowed},
+		{"absent", "", nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			header := &Header{
+				Version:           2,
+				Command:           PROXY,
+				TransportProtocol: TCPv4,
+				SourceAddr:        v4addr,
+				DestinationAddr:   v4addr,
+			}
+			if tc.authority != "" {
+				if err := header.SetTLVs([]TLV{{Type: PP2_TYPE_AUTHORITY, Value: []byte(tc.authority)}}); err != nil {
+					t.Fatalf("err: %v", err)
+				}
+			}
+
+			server, client := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+
+			go func() {
+				_, _ = WriteHeaderAndPayload(client, header, []byte("ping"))
+			}()
+
+			conn := NewConn(server, AllowAuthorities("api.example.com", "*.example.org"))
+			recv := make([]byte, 4)
+			if _, err := io.ReadFull(conn, recv); !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestAllowAuthoritiesEmpty(t *testing.T) {
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr:        v4addr,
+		DestinationAddr:   v4addr,
+	}
+	if err := header.SetTLVs([]TLV{{Type: PP2_TYPE_AUTHORITY, Value: []byte("evil.example")}}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	config := &Config{AllowedAuthorities: []string{}}
+	for name, opts := range map[string][]func(*Conn){
+		"option": {AllowAuthorities()},
+		"config": config.connOptions(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+
+			go func() {
+				_, _ = WriteHeaderAndPayload(client, header, []byte("ping"))
+			}()
+
+			conn := NewConn(server, opts...)
+			if _, err := io.ReadFull(conn, make([]byte, 4)); !errors.Is(err, ErrAuthorityNotAllowed) {
+				t.Fatalf("expected error %v, got %v", ErrAuthorityNotAllowed, err)
+			}
+		})
+	}
+}
+
+func TestListenerAuthoritiesOverrideConfig(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pl := &Listener{
+		Listener:           l,
+		Config:             &Config{AllowedAuthorities: []string{"a.example.com"}},
+		AllowedAuthorities: []string{"b.example.com"},
+	}
+	defer pl.Close()
+
+	for authority, want := range map[string]error{
+		"a.example.com": ErrAuthorityNotAllowed,
+		"b.example.com": nil,
+	} {
+		t.Run(authority, func(t *testing.T) {
+			header := &Header{
+				Version:           2,
+				Command:           PROXY,
+				TransportProtocol: TCPv4,
+				SourceAddr:        v4addr,
+				DestinationAddr:   v4addr,
+			}
+			if err := header.SetTLVs([]TLV{{Type: PP2_TYPE_AUTHORITY, Value: []byte(authority)}}); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+
+			go func() {
+				client, err := net.Dial("tcp", pl.Addr().String())
+				if err != nil {
+					return
+				}
+				defer client.Close()
+				_, _ = WriteHeaderAndPayload(client, header, []byte("ping"))
+				_, _ = io.Copy(io.Discard, client)
+			}()
+
+			conn, err := pl.Accept()
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			defer conn.Close()
+			if _, err := io.ReadFull(conn, make([]byte, 4)); !errors.Is(err, want) {
+				t.Fatalf("expected error %v, got %v", want, err)
+			}
+		})
+	}
+}
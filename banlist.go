@@ -0,0 +1,166 @@
+package proxyproto
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxBanListEntries bounds the number of upstreams tracked by a BanList, so
+// that a flood of distinct addresses can't exhaust memory.
+const maxBanListEntries = 1 << 16
+
+// BanList tracks the upstreams repeatedly sending malformed or disallowed
+// headers, and bans them for a cooldown period during which their
+// connections are handled with a fixed policy, e.g. SKIP or REJECT. This
+// sheds abusive traffic cheaply. It is safe for concurrent use, and can be
+// shared by several listeners, see Listener.BanList.
+type BanList struct {
+	// OnBan, if set, is called when an upstream gets banned, along with the
+	// time the ban lasts until.
+	OnBan func(upstream net.IP, until time.Time)
+	// OnUnban, if set, is called when the ban of an upstream is found to be
+	// over, on its next connection.
+	OnUnban func(upstream net.IP)
+
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+	policy    Policy
+	now       func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*banEntry
+}
+
+// banEntry holds the recent failures of an upstream and its ban, if any.
+type banEntry struct {
+	failures    int
+	windowStart time.Time
+	bannedUntil time.Time
+}
+
+// NewBanList returns a BanList banning for the cooldown period the upstreams
+// whose headers failed threshold times within window. A threshold below 1
+// is taken as 1, banning upstreams on their first failure. The connections
+// of banned upstreams are handled with the given policy, the SKIP policy
+// letting them through as regular connections.
+func NewBanList(threshold int, window, cooldown time.Duration, policy Policy) *BanList {
+	return &BanList{
+		threshold: max(threshold, 1),
+		window:    window,
+		cooldown:  cooldown,
+		policy:    policy,
+		now:       time.Now,
+		entries:   make(map[string]*banEntry),
+	}
+}
+
+// Banned reports whether the upstream is currently banned, along with the
+// policy its connections are to be handled with.
+func (b *BanList) Banned(upstream net.Addr) (Policy, bool) {
+	ip, err := IPFromAddr(upstream)
+	if err != nil {
+		return USE, false
+	}
+
+	b.mu.Lock()
+	entry, ok := b.entries[ip.String()]
+	if !ok || entry.bannedUntil.IsZero() {
+		b.mu.Unlock()
+		return USE, false
+	}
+	if b.now().Before(entry.bannedUntil) {
+		b.mu.Unlock()
+		return b.policy, true
+	}
+	delete(b.entries, ip.String())
+	b.mu.Unlock()
+
+	if b.OnUnban != nil {
+		b.OnUnban(ip)
+	}
+	return USE, false
+}
+
+// Fail records a header failure of the upstream, banning it once the
+// threshold is reached. Connections configured with the list, see
+// WithBanList, record their failures themselves.
+func (b *BanList) Fail(upstream net.Addr) {
+	ip, err := IPFromAddr(upstream)
+	if err != nil {
+		return
+	}
+
+	now := b.now()
+	b.mu.Lock()
+	entry, ok := b.entries[ip.String()]
+	if !ok {
+		if len(b.entries) >= maxBanListEntries {
+			b.prune(now)
+			if len(b.entries) >= maxBanListEntries {
+				b.mu.Unlock()
+				return
+			}
+		}
+		entry = &banEntry{windowStart: now}
+		b.entries[ip.String()] = entry
+	}
+	if !entry.bannedUntil.IsZero() {
+		// Already banned, e.g. a connection accepted before the ban.
+		b.mu.Unlock()
+		return
+	}
+	if now.Sub(entry.windowStart) > b.window {
+		entry.failures, entry.windowStart = 0, now
+	}
+	entry.failures++
+	if entry.failures < b.threshold {
+		b.mu.Unlock()
+		return
+	}
+	entry.bannedUntil = now.Add(b.cooldown)
+	until := entry.bannedUntil
+	b.mu.Unlock()
+
+	if b.OnBan != nil {
+		b.OnBan(ip, until)
+	}
+}
+
+// prune drops the entries whose window and ban are over.
+func (b *BanList) prune(now time.Time) {
+	for ip, entry := range b.entries {
+		if entry.bannedUntil.IsZero() && now.Sub(entry.windowStart) > b.window ||
+			!entry.bannedUntil.IsZero() && !now.Before(entry.bannedUntil) {
+			delete(b.entries, ip)
+		}
+	}
+}
+
+// WithBanList makes the connection record the failure of its header, be it
+// malformed or disallowed by the policy, the checks or the validator of the
+// connection, in the ban list when passed as option to NewConn(). Missing,
+// truncated or late headers aren't recorded, as they are as well the doing
+// of health checks and slow clients behind the upstream. Listeners also
+// consult the list before accepting connections, see Listener.BanList.
+func WithBanList(b *BanList) func(*Conn) {
+	return func(c *Conn) {
+		c.banList = b
+	}
+}
+
+// malformed tells whether the header failed to parse for a reason of its
+// own, rather than by being missing, cut short or late.
+func malformed(err error) bool {
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		return false
+	}
+	if pe.Reason == ReasonTruncated || pe.Reason == ReasonTimeout {
+		return false
+	}
+	var netErr net.Error
+	return !errors.As(err, &netErr) || !netErr.Timeout()
+}
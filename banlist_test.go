@@ -0,0 +1,142 @@
+package proxyproto
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBanList(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := NewBanList(2, time.Minute, time.Hour, REJECT)
+	b.now = func() time.Time { return now }
+
+	var banned, unbanned []string
+	b.OnBan = func(upstream net.IP, until time.Time) {
+		banned = append(banned, upstream.String())
+		if !until.Equal(now.Add(time.Hour)) {
+			t.Errorf("unexpected ban end %v", until)
+		}
+	}
+	b.OnUnban = func(upstream net.IP) {
+		unbanned = append(unbanned, upstream.String())
+	}
+
+	upstream := &net.TCPAddr{IP: net.ParseIP("10.1.1.1"), Port: 1000}
+	other := &net.TCPAddr{IP: net.ParseIP("10.1.1.2"), Port: 1000}
+
+	// Failures spread over more than the window don't add up.
+	b.Fail(upstream)
+	now = now.Add(2 * time.Minute)
+	b.Fail(upstream)
+	if _, ok := b.Banned(upstream); ok {
+		t.Fatal("expected the upstream not to be banned yet")
+	}
+
+	b.Fail(upstream)
+	if policy, ok := b.Banned(upstream); !ok || policy != REJECT {
+		t.Fatalf("expected the upstream to be banned with REJECT, got %v %v", policy, ok)
+	}
+	if _, ok := b.Banned(other); ok {
+		t.Fatal("expected another upstream not to be banned")
+	}
+
+	now = now.Add(time.Hour)
+	if _, ok := b.Banned(upstream); ok {
+		t.Fatal("expected the ban to be over")
+	}
+	if len(banned) != 1 || len(unbanned) != 1 || banned[0] != "10.1.1.1" || unbanned[0] != "10.1.1.1" {
+		t.Fatalf("unexpected hook calls, banned %v, unbanned %v", banned, unbanned)
+	}
+}
+
+func TestListenerBanList(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	bans := make(chan net.IP, 1)
+	b := NewBanList(1, time.Minute, time.Hour, SKIP)
+	b.OnBan = func(upstream net.IP, until time.Time) { bans <- upstream }
+
+	pl := &Listener{Listener: l, BanList: b}
+	defer pl.Close()
+
+	for i := 0; i < 2; i++ {
+		go func() {
+			conn, err := net.Dial("tcp", pl.Addr().String())
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			_, _ = conn.Write([]byte("PROXY garbage\r\n"))
+		}()
+
+		conn, err := pl.Accept()
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+
+		_, isProxyConn := conn.(*Conn)
+		if i == 0 {
+			if !isProxyConn {
+				t.Fatal("expected the first connection to be wrapped")
+			}
+			if _, err := conn.Read(make([]byte, 1)); err == nil {
+				t.Fatal("expected the invalid header to fail the read")
+			}
+			if ip := <-bans; !ip.IsLoopback() {
+				t.Fatalf("expected the loopback upstream to be banned, got %v", ip)
+			}
+		} else if isProxyConn {
+			t.Fatal("expected the connection of the banned upstream to be skipped")
+		}
+		conn.Close()
+	}
+}
+
+// upstreamConn overrides the remote address of a connection.
+type upstreamConn struct {
+	net.Conn
+	upstream net.Addr
+}
+
+func (c *upstreamConn) RemoteAddr() net.Addr { return c.upstream }
+
+func TestConnBanListFailures(t *testing.T) {
+	var cases = []struct {
+		name   string
+		policy Policy
+		data   string
+		banned bool
+	}{
+		{"empty", REQUIRE, "", false},
+		{"missing", REQUIRE, "GET / HTTP/1.1\r\n\r\n", false},
+		{"truncated", USE, "PROXY TCP4 10.1.1.1", false},
+		{"malformed", USE, "PROXY garbage\r\n", true},
+		{"disallowed", REJECT, "PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\n", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := NewBanList(0, time.Minute, time.Hour, REJECT)
+			server, client := net.Pipe()
+			defer server.Close()
+
+			go func() {
+				_, _ = client.Write([]byte(tc.data))
+				client.Close()
+			}()
+
+			upstream := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000}
+			conn := NewConn(&upstreamConn{Conn: server, upstream: upstream}, WithPolicy(tc.policy), WithBanList(b))
+			if _, err := conn.Read(make([]byte, 1)); err == nil {
+				t.Fatal("expected the header to fail")
+			}
+			if _, banned := b.Banned(upstream); banned != tc.banned {
+				t.Fatalf("expected banned %v, got %v (%v)", tc.banned, banned, conn.HeaderError())
+			}
+		})
+	}
+}
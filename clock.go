@@ -0,0 +1,50 @@
+package proxyproto
+
+import "time"
+
+// Clock is the source of the time of connections, see WithClock. Tests
+// inject a fake clock, e.g. proxyprototest.FakeClock, to exercise header
+// timeouts deterministically, without waiting for them to expire.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// AfterFunc calls f once d has elapsed, unless the returned timer is
+	// stopped first. f must not be called before AfterFunc returns.
+	AfterFunc(d time.Duration, f func()) ClockTimer
+}
+
+// ClockTimer is a timer created by a Clock, as *time.Timer is.
+type ClockTimer interface {
+	// Stop prevents the timer from firing, and returns false if it already
+	// fired or was stopped.
+	Stop() bool
+}
+
+// realClock is the clock of the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	return time.AfterFunc(d, f)
+}
+
+// WithClock makes the connection tell time with clock, when passed as option
+// to NewConn(). The header deadlines, e.g. the ReadHeaderTimeout, expire when
+// clock says so rather than being enforced by the underlying connection,
+// and the header latency is measured with clock.
+func WithClock(clock Clock) func(*Conn) {
+	return func(c *Conn) {
+		c.clock = clock
+		c.deadlines.clock = clock
+		c.acceptedAt = clock.Now()
+	}
+}
+
+// now returns the current time, as told by the clock of the connection.
+func (p *Conn) now() time.Time {
+	if p.clock == nil {
+		return time.Now()
+	}
+	return p.clock.Now()
+}
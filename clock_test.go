@@ -0,0 +1,108 @@
+package proxyproto
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// manualClock is a clock whose time is set by tests, and whose timers fire
+// when told to.
+type manualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	armed  chan struct{}
+	timers []*manualTimer
+}
+
+type manualTimer struct {
+	f       func()
+	stopped bool
+}
+
+func (t *manualTimer) Stop() bool {
+	stopped := t.stopped
+	t.stopped = true
+	return !stopped
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+func (c *manualClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &manualTimer{f: f}
+	c.timers = append(c.timers, t)
+	c.armed <- struct{}{}
+	return t
+}
+
+func TestConnWithClock(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	start := time.Unix(1000, 0)
+	clock := &manualClock{now: start, armed: make(chan struct{}, 1)}
+	conn := NewConn(server, WithClock(clock), SetReadHeaderTimeout(time.Second))
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- conn.SetHeaderDeadline(start.Add(time.Minute))
+		_, err := conn.Read(make([]byte, 4))
+		errc <- err
+	}()
+	if err := <-errc; err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	<-clock.armed
+
+	// The header latency is measured with the clock.
+	clock.set(start.Add(40 * time.Millisecond))
+	go func() {
+		_, _ = WriteHeaderAndPayload(client, HeaderProxyFromAddrs(2, v4addr, v4addr), []byte("ping"))
+	}()
+	if err := <-errc; err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if latency, ok := conn.HeaderLatency(); !ok || latency != 40*time.Millisecond {
+		t.Fatalf("expected a latency of 40ms, got %v", latency)
+	}
+	if !clock.timers[0].stopped {
+		t.Fatal("expected the header deadline to be disarmed")
+	}
+}
+
+func TestConnWithClockExpiry(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	clock := &manualClock{now: time.Unix(1000, 0), armed: make(chan struct{}, 1)}
+	conn := NewConn(server, WithClock(clock), WithPolicy(REQUIRE), SetReadHeaderTimeout(time.Second))
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 4))
+		errc <- err
+	}()
+	<-clock.armed
+	clock.timers[0].f()
+
+	err := <-errc
+	if !errors.Is(err, ErrHeaderReadTimeout) || !errors.Is(err, ErrNoProxyProtocol) {
+		t.Fatalf("expected %v, got %v", ErrHeaderReadTimeout, err)
+	}
+}
@@ -0,0 +1,206 @@
+// Command ppbench is a load generator for servers accepting PROXY protocol
+// connections, to benchmark listener configurations.
+//
+// Usage:
+//
+//	ppbench [flags] host:port
+//
+// It opens -n connections, -c at a time. On each, it writes a header of the
+// given -version, carrying the -tlv TLVs and padded with -tlv-size bytes of
+// NOOP TLVs, followed by -payload bytes, then waits for the first byte of the response, e.g. from an echo
+// server, unless -no-reply is set. It reports the percentiles of the connect
+// latency and of the header processing latency, i.e. the time between the
+// header being written and the first byte of the response being received.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func main() {
+	var (
+		n        = flag.Int("n", 1000, "number of connections")
+		c        = flag.Int("c", 10, "number of concurrent connections")
+		version  = flag.Int("version", 2, "protocol version of the headers, 1 or 2")
+		tlvSize  = flag.Int("tlv-size", 0, "size in bytes of the NOOP TLVs added to version 2 headers")
+		payload  = flag.Int("payload", 16, "size in bytes of the payload written after the header")
+		noReply  = flag.Bool("no-reply", false, "don't wait for a response, measuring the header write only")
+		timeout  = flag.Duration("timeout", 5*time.Second, "timeout of each connection")
+		srcAddr  = flag.String("src", "10.0.0.1:1000", "source address announced in the headers")
+		destAddr = flag.String("dst", "10.0.0.2:2000", "destination address announced in the headers")
+	)
+	var tlvs []proxyproto.TLV
+	flag.Func("tlv", "TLV added to version 2 headers, as type=value, e.g. 0x05=id (repeatable)", func(s string) error {
+		typ, value, ok := strings.Cut(s, "=")
+		if !ok {
+			return fmt.Errorf("expected type=value")
+		}
+		t, err := strconv.ParseUint(typ, 0, 8)
+		if err != nil {
+			return err
+		}
+		tlvs = append(tlvs, proxyproto.TLV{Type: proxyproto.PP2Type(t), Value: []byte(value)})
+		return nil
+	})
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] host:port\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *c < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	header, err := buildHeader(byte(*version), *srcAddr, *destAddr, tlvs, *tlvSize)
+	if err != nil {
+		log.Fatalf("couldn't build the header: %v", err)
+	}
+	raw, err := header.Format()
+	if err != nil {
+		log.Fatalf("couldn't format the header: %v", err)
+	}
+	data := append(raw, make([]byte, *payload)...)
+
+	b := &bench{
+		target:  flag.Arg(0),
+		data:    data,
+		reply:   !*noReply,
+		timeout: *timeout,
+	}
+	start := time.Now()
+	b.run(*n, *c)
+	elapsed := time.Since(start)
+
+	fmt.Printf("%d connections in %v (%.0f conn/s), %d errors, %d-byte headers\n",
+		*n, elapsed.Round(time.Millisecond), float64(*n)/elapsed.Seconds(), b.errors, len(raw))
+	report("connect", b.connect)
+	report("header", b.header)
+}
+
+// buildHeader builds the header written on every connection.
+func buildHeader(version byte, src, dst string, tlvs []proxyproto.TLV, tlvSize int) (*proxyproto.Header, error) {
+	srcAddr, err := net.ResolveTCPAddr("tcp", src)
+	if err != nil {
+		return nil, err
+	}
+	dstAddr, err := net.ResolveTCPAddr("tcp", dst)
+	if err != nil {
+		return nil, err
+	}
+	header := proxyproto.HeaderProxyFromAddrs(version, srcAddr, dstAddr)
+
+	for tlvSize > 0 {
+		size := max(min(tlvSize, 0xffff+3)-3, 0)
+		tlvs = append(tlvs, proxyproto.TLV{Type: proxyproto.PP2_TYPE_NOOP, Value: make([]byte, size)})
+		tlvSize -= size + 3
+	}
+	if len(tlvs) > 0 {
+		if version == 1 {
+			return nil, fmt.Errorf("version 1 headers can't carry TLVs")
+		}
+		if err := header.SetTLVs(tlvs); err != nil {
+			return nil, err
+		}
+	}
+	return header, nil
+}
+
+// bench runs the connections and gathers their latencies.
+type bench struct {
+	target  string
+	data    []byte
+	reply   bool
+	timeout time.Duration
+
+	mu      sync.Mutex
+	connect []time.Duration
+	header  []time.Duration
+	errors  int
+}
+
+func (b *bench) run(n, c int) {
+	jobs := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < c; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				b.one()
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// one opens a connection and measures its latencies.
+func (b *bench) one() {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", b.target, b.timeout)
+	if err != nil {
+		b.fail(err)
+		return
+	}
+	defer conn.Close()
+	connected := time.Now()
+
+	if err := conn.SetDeadline(connected.Add(b.timeout)); err != nil {
+		b.fail(err)
+		return
+	}
+	if _, err := conn.Write(b.data); err != nil {
+		b.fail(err)
+		return
+	}
+	if b.reply {
+		if _, err := conn.Read(make([]byte, 1)); err != nil {
+			b.fail(err)
+			return
+		}
+	}
+	done := time.Now()
+
+	b.mu.Lock()
+	b.connect = append(b.connect, connected.Sub(start))
+	b.header = append(b.header, done.Sub(connected))
+	b.mu.Unlock()
+}
+
+func (b *bench) fail(err error) {
+	b.mu.Lock()
+	if b.errors == 0 {
+		log.Printf("first error: %v", err)
+	}
+	b.errors++
+	b.mu.Unlock()
+}
+
+// report prints the percentiles of the latencies.
+func report(name string, latencies []time.Duration) {
+	if len(latencies) == 0 {
+		fmt.Printf("%-8s no successful connection\n", name)
+		return
+	}
+	slices.Sort(latencies)
+	percentile := func(p float64) time.Duration {
+		return latencies[int(p*float64(len(latencies)-1))]
+	}
+	fmt.Printf("%-8s p50 %-10v p90 %-10v p99 %-10v max %v\n", name,
+		percentile(0.5), percentile(0.9), percentile(0.99), latencies[len(latencies)-1])
+}
@@ -0,0 +1,46 @@
+// Command ppconform runs PROXY protocol conformance scenarios against a
+// server, whatever the language it is written in, and reports which ones
+// passed.
+//
+// Usage:
+//
+//	ppconform [-timeout duration] host:port
+//
+// A server is deemed to accept a connection if it keeps it open for the
+// timeout, and to reject it if it closes it before. The exit status is 1 if
+// any scenario failed.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/pires/go-proxyproto/proxyprototest"
+)
+
+func main() {
+	timeout := flag.Duration("timeout", 2*time.Second, "time a connection is watched for before deeming it accepted")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-timeout duration] host:port\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	suite := &proxyprototest.ConformanceSuite{Timeout: *timeout}
+	results := suite.Run(context.Background(), flag.Arg(0))
+	ok, err := proxyprototest.WriteConformanceReport(os.Stdout, results)
+	if err != nil {
+		log.Fatalf("couldn't write the report: %v", err)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
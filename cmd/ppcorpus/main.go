@@ -0,0 +1,39 @@
+// Command ppcorpus writes a seed corpus of valid and adversarial PROXY
+// protocol headers, to bootstrap fuzzing of PROXY protocol parsers.
+//
+// Usage:
+//
+//	ppcorpus [-go] dir
+//
+// With -go, the seeds are written in the corpus format of native Go fuzz
+// tests, e.g. to testdata/fuzz/FuzzParse, for fuzz functions taking a single
+// []byte argument. Otherwise, the raw seeds are written.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/pires/go-proxyproto/proxyprototest"
+)
+
+func main() {
+	goFormat := flag.Bool("go", false, "write the seeds in the corpus format of native Go fuzz tests")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-go] dir\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dir := flag.Arg(0)
+	if err := proxyprototest.WriteCorpus(dir, *goFormat); err != nil {
+		log.Fatalf("couldn't write the corpus to %q: %v", dir, err)
+	}
+	log.Printf("wrote %d seeds to %q", len(proxyprototest.Corpus()), dir)
+}
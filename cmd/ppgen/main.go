@@ -0,0 +1,149 @@
+// Command ppgen writes the raw bytes of a PROXY protocol header built from
+// its flags, for manual testing with netcat-style tools, e.g.:
+//
+//	ppgen -v2 -src 10.0.0.1:1234 -dst 10.0.0.2:443 | cat - payload | nc host 443
+//
+// Usage:
+//
+//	ppgen [-v1 | -v2] [-local] [-net network] [-src addr] [-dst addr] [-tlv type=value]... [-o file]
+//
+// The header is written to the standard output, or to the file given with
+// -o. The addresses are parsed for the network given with -net, i.e. tcp,
+// udp, unix or unixgram, and are required unless -local is set. TLVs are
+// only carried by version 2 headers. Their type is a number, e.g. 0xE0, or
+// one of alpn, authority, unique_id and netns, and their value is a string,
+// or hex-encoded bytes if prefixed with 0x.
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// tlvTypes maps the names accepted by -tlv to their type.
+var tlvTypes = map[string]proxyproto.PP2Type{
+	"alpn":      proxyproto.PP2_TYPE_ALPN,
+	"authority": proxyproto.PP2_TYPE_AUTHORITY,
+	"unique_id": proxyproto.PP2_TYPE_UNIQUE_ID,
+	"netns":     proxyproto.PP2_TYPE_NETNS,
+}
+
+// tlvFlag collects the TLVs given with -tlv.
+type tlvFlag []proxyproto.TLV
+
+func (f *tlvFlag) String() string {
+	return fmt.Sprint(len(*f), " TLVs")
+}
+
+func (f *tlvFlag) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return errors.New("expected type=value")
+	}
+
+	t, ok := tlvTypes[strings.ToLower(name)]
+	if !ok {
+		n, err := strconv.ParseUint(name, 0, 8)
+		if err != nil {
+			return fmt.Errorf("invalid TLV type %q", name)
+		}
+		t = proxyproto.PP2Type(n)
+	}
+
+	b := []byte(value)
+	if hexValue, ok := strings.CutPrefix(value, "0x"); ok {
+		var err error
+		if b, err = hex.DecodeString(hexValue); err != nil {
+			return fmt.Errorf("invalid TLV value %q: %v", value, err)
+		}
+	}
+	*f = append(*f, proxyproto.TLV{Type: t, Value: b})
+	return nil
+}
+
+func main() {
+	v1 := flag.Bool("v1", false, "write a version 1 header")
+	v2 := flag.Bool("v2", false, "write a version 2 header (default)")
+	local := flag.Bool("local", false, "write a header with the LOCAL command, without addresses")
+	network := flag.String("net", "tcp", "network of the addresses: tcp, udp, unix or unixgram")
+	src := flag.String("src", "", "source address")
+	dst := flag.String("dst", "", "destination address")
+	out := flag.String("o", "", "file to write the header to, instead of the standard output")
+	var tlvs tlvFlag
+	flag.Var(&tlvs, "tlv", "TLV as type=value, may be repeated")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-v1 | -v2] [-local] [-net network] [-src addr] [-dst addr] [-tlv type=value]... [-o file]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 0 || *v1 && *v2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	version := byte(2)
+	if *v1 {
+		version = 1
+	}
+
+	var header *proxyproto.Header
+	if *local {
+		header = proxyproto.HeaderProxyFromAddrs(version, nil, nil)
+	} else {
+		if *src == "" || *dst == "" {
+			log.Fatal("-src and -dst are required unless -local is set")
+		}
+		sourceAddr, err := resolve(*network, *src)
+		if err != nil {
+			log.Fatalf("invalid source address: %v", err)
+		}
+		destAddr, err := resolve(*network, *dst)
+		if err != nil {
+			log.Fatalf("invalid destination address: %v", err)
+		}
+		header = proxyproto.HeaderProxyFromAddrs(version, sourceAddr, destAddr)
+	}
+	if len(tlvs) > 0 {
+		if version != 2 {
+			log.Fatal("only version 2 headers can carry TLVs")
+		}
+		if err := header.SetTLVs(tlvs); err != nil {
+			log.Fatalf("invalid TLVs: %v", err)
+		}
+	}
+
+	buf, err := header.Format()
+	if err != nil {
+		log.Fatalf("couldn't format the header: %v", err)
+	}
+	if *out != "" {
+		err = os.WriteFile(*out, buf, 0o644)
+	} else {
+		_, err = os.Stdout.Write(buf)
+	}
+	if err != nil {
+		log.Fatalf("couldn't write the header: %v", err)
+	}
+}
+
+// resolve parses the address for the network.
+func resolve(network, address string) (net.Addr, error) {
+	switch network {
+	case "tcp":
+		return net.ResolveTCPAddr(network, address)
+	case "udp":
+		return net.ResolveUDPAddr(network, address)
+	case "unix", "unixgram":
+		return net.ResolveUnixAddr(network, address)
+	}
+	return nil, fmt.Errorf("unsupported network %q", network)
+}
@@ -0,0 +1,216 @@
+// Command pptap sits between a load balancer and a backend, passing bytes
+// through unchanged, and logs every PROXY header it observes as a JSON line,
+// which is a low-risk way to audit what the edge is actually sending.
+//
+// Usage:
+//
+//	pptap [-timeout d] listen-addr backend-addr
+//
+// Each accepted connection is relayed to the backend. A line is written to
+// the standard output for each header found, or failing to parse, at the
+// start of a connection. Connections without a header are relayed silently.
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func main() {
+	timeout := flag.Duration("timeout", time.Second, "time given to connections to send their header")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-timeout d] listen-addr backend-addr\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	l, err := net.Listen("tcp", flag.Arg(0))
+	if err != nil {
+		log.Fatalf("couldn't listen on %q: %v", flag.Arg(0), err)
+	}
+
+	t := &tap{
+		backend: flag.Arg(1),
+		timeout: *timeout,
+		out:     json.NewEncoder(os.Stdout),
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			log.Fatalf("couldn't accept: %v", err)
+		}
+		go t.relay(conn)
+	}
+}
+
+// tap relays connections to the backend, logging their headers.
+type tap struct {
+	backend string
+	timeout time.Duration
+
+	mu  sync.Mutex
+	out *json.Encoder
+}
+
+// record is the JSON line logged for each header observed.
+type record struct {
+	Time        time.Time `json:"time"`
+	Upstream    string    `json:"upstream"`
+	Version     byte      `json:"version,omitempty"`
+	Command     string    `json:"command,omitempty"`
+	Transport   string    `json:"transport,omitempty"`
+	Source      string    `json:"source,omitempty"`
+	Destination string    `json:"destination,omitempty"`
+	TLVs        []tlv     `json:"tlvs,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+type tlv struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// relay reads the header of conn, if any, and relays the connection to the
+// backend, the header included.
+func (t *tap) relay(conn net.Conn) {
+	defer conn.Close()
+
+	// Record the bytes read off the connection while parsing the header,
+	// so that they are relayed as is whatever the outcome.
+	rec := &recorder{r: conn}
+	if err := conn.SetReadDeadline(time.Now().Add(t.timeout)); err != nil {
+		return
+	}
+	header, err := proxyproto.Read(bufio.NewReaderSize(rec, 1<<17))
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return
+	}
+
+	var netErr net.Error
+	switch {
+	case err == nil:
+		t.log(conn.RemoteAddr(), header, nil)
+	case errors.Is(err, proxyproto.ErrNoProxyProtocol), errors.As(err, &netErr) && netErr.Timeout():
+	default:
+		t.log(conn.RemoteAddr(), nil, err)
+	}
+
+	backend, err := net.Dial("tcp", t.backend)
+	if err != nil {
+		log.Printf("couldn't connect to the backend: %v", err)
+		return
+	}
+	defer backend.Close()
+
+	if _, err := backend.Write(rec.buf); err != nil {
+		return
+	}
+	rec.buf = nil
+
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(conn, backend)
+		closeWrite(conn)
+		close(done)
+	}()
+	_, _ = io.Copy(backend, conn)
+	closeWrite(backend)
+	<-done
+}
+
+// log writes the record of a header, or of the error it failed with.
+func (t *tap) log(upstream net.Addr, header *proxyproto.Header, err error) {
+	r := record{
+		Time:     time.Now().UTC(),
+		Upstream: upstream.String(),
+	}
+	if err != nil {
+		r.Error = err.Error()
+	} else {
+		r.Version = header.Version
+		r.Command = command(header.Command)
+		r.Transport = transport(header.TransportProtocol)
+		if header.SourceAddr != nil {
+			r.Source = header.SourceAddr.String()
+		}
+		if header.DestinationAddr != nil {
+			r.Destination = header.DestinationAddr.String()
+		}
+		tlvs, tlvErr := header.TLVs()
+		if tlvErr != nil {
+			r.Error = tlvErr.Error()
+		}
+		for _, t := range tlvs {
+			r.TLVs = append(r.TLVs, tlv{Type: fmt.Sprintf("%#02x", byte(t.Type)), Value: hex.EncodeToString(t.Value)})
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.out.Encode(r); err != nil {
+		log.Printf("couldn't log the header: %v", err)
+	}
+}
+
+func command(c proxyproto.ProtocolVersionAndCommand) string {
+	if c.IsLocal() {
+		return "LOCAL"
+	}
+	return "PROXY"
+}
+
+func transport(tp proxyproto.AddressFamilyAndProtocol) string {
+	switch tp {
+	case proxyproto.TCPv4:
+		return "TCP4"
+	case proxyproto.UDPv4:
+		return "UDP4"
+	case proxyproto.TCPv6:
+		return "TCP6"
+	case proxyproto.UDPv6:
+		return "UDP6"
+	case proxyproto.UnixStream:
+		return "UNIX_STREAM"
+	case proxyproto.UnixDatagram:
+		return "UNIX_DGRAM"
+	case proxyproto.UNSPEC:
+		return "UNSPEC"
+	}
+	return fmt.Sprintf("%#02x", byte(tp))
+}
+
+// closeWrite shuts down the writing side of TCP connections, so that the
+// end of the stream is relayed.
+func closeWrite(conn net.Conn) {
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		_ = tcpConn.CloseWrite()
+	}
+}
+
+// recorder records the bytes read from r.
+type recorder struct {
+	r   io.Reader
+	buf []byte
+}
+
+func (r *recorder) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.buf = append(r.buf, b[:n]...)
+	return n, err
+}
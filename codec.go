@@ -0,0 +1,45 @@
+package proxyproto
+
+import "bufio"
+
+// ProxyHeaderCodec parses and formats the preamble announcing the client of
+// a proxied connection, so that formats other than the PROXY protocol, e.g.
+// proprietary or future ones, can be spoken by a Listener or a Dialer
+// without forking the accept and dial paths.
+type ProxyHeaderCodec interface {
+	// Parse reads the header at the start of the stream. If the stream
+	// doesn't start with a header of the format, it returns
+	// ErrNoProxyProtocol without consuming anything, so that the policy of
+	// the connection applies as for the PROXY protocol.
+	Parse(reader *bufio.Reader) (*Header, error)
+	// Format returns the bytes of the header.
+	Format(header *Header) ([]byte, error)
+}
+
+// StandardCodec is the codec of versions 1 and 2 of the PROXY protocol, as
+// used when no codec is set.
+var StandardCodec ProxyHeaderCodec = standardCodec{}
+
+type standardCodec struct{}
+
+func (standardCodec) Parse(reader *bufio.Reader) (*Header, error) {
+	return Read(reader)
+}
+
+func (standardCodec) Format(header *Header) ([]byte, error) {
+	return header.Format()
+}
+
+// WithCodec makes the connection parse its header with the codec rather
+// than as a PROXY protocol header, when passed as option to NewConn(). The
+// options tuning the parsing of PROXY protocol headers, e.g.
+// WithMaxHeaderSize or WithPeekDetection, don't apply to other codecs.
+// StandardCodec is the same as no codec, so that they still apply.
+func WithCodec(codec ProxyHeaderCodec) func(*Conn) {
+	return func(c *Conn) {
+		if codec == StandardCodec {
+			codec = nil
+		}
+		c.codec = codec
+	}
+}
@@ -0,0 +1,119 @@
+package proxyproto
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// clientCodec is a line based format announcing the source address only,
+// e.g. "CLIENT 10.1.1.1:1000\r\n".
+type clientCodec struct{}
+
+func (clientCodec) Parse(reader *bufio.Reader) (*Header, error) {
+	if b, err := reader.Peek(len("CLIENT ")); err != nil || string(b) != "CLIENT " {
+		return nil, ErrNoProxyProtocol
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	addr, err := net.ResolveTCPAddr("tcp", strings.TrimSpace(strings.TrimPrefix(line, "CLIENT ")))
+	if err != nil {
+		return nil, ErrInvalidAddress
+	}
+	return &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr:        addr,
+		DestinationAddr:   addr,
+	}, nil
+}
+
+func (clientCodec) Format(header *Header) ([]byte, error) {
+	return []byte("CLIENT " + header.SourceAddr.String() + "\r\n"), nil
+}
+
+func TestCodec(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pl := &Listener{Listener: l, Codec: clientCodec{}}
+	defer pl.Close()
+
+	go func() {
+		d := &Dialer{
+			Header: HeaderProxyFromAddrs(2, v4addr, v4addr),
+			Codec:  clientCodec{},
+		}
+		conn, err := d.DialContext(context.Background(), "tcp", l.Addr().String())
+		if err != nil {
+			t.Errorf("err: %v", err)
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write([]byte("ping"))
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	recv := make([]byte, 4)
+	if _, err := io.ReadFull(conn, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(recv) != "ping" {
+		t.Fatalf("expected ping, got %q", recv)
+	}
+	if conn.RemoteAddr().String() != v4addr.String() {
+		t.Fatalf("expected %v, got %v", v4addr, conn.RemoteAddr())
+	}
+}
+
+func TestCodecNoHeader(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		_, _ = client.Write([]byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\n"))
+	}()
+
+	// A PROXY protocol header isn't a header of the codec.
+	conn := NewConn(server, WithCodec(clientCodec{}), WithPolicy(USE))
+	defer conn.Close()
+	recv := make([]byte, 5)
+	if _, err := io.ReadFull(conn, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(recv) != "PROXY" {
+		t.Fatalf("expected PROXY, got %q", recv)
+	}
+	if conn.ProxyHeader() != nil {
+		t.Fatalf("expected no header, got %v", conn.ProxyHeader())
+	}
+}
+
+func TestStandardCodecParseOptions(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		_, _ = client.Write([]byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\n"))
+	}()
+
+	// The standard codec parses as no codec does, honouring the options.
+	conn := NewConn(server, WithCodec(StandardCodec), WithMaxHeaderSize(16))
+	defer conn.Close()
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, ErrHeaderTooLarge) {
+		t.Fatalf("expected %v, got %v", ErrHeaderTooLarge, err)
+	}
+}
@@ -0,0 +1,157 @@
+package proxyproto
+
+import "time"
+
+// Config gathers the settings shared by inbound and outbound connections, so
+// that a Listener and a Dialer can be configured consistently from one place.
+// Settings which only make sense in one direction are ignored by the other.
+//
+// Settings set directly on a Listener or a Dialer take precedence over the
+// ones of their Config.
+type Config struct {
+	// Version is the protocol version of the headers built by a Dialer. If
+	// zero, the latest version is used.
+	Version byte
+	// ReadHeaderTimeout bounds the time an accepted connection is given to
+	// send its header, see Listener.ReadHeaderTimeout.
+	ReadHeaderTimeout time.Duration
+	// MaxHeaderSize, if positive, bounds the size in bytes of the headers
+	// received by a Listener, see WithMaxHeaderSize, and of the headers
+	// written by a Dialer.
+	MaxHeaderSize int
+	// MaxTLVCount, if positive, bounds the number of TLVs of the headers
+	// received by a Listener, see WithMaxTLVCount, and of the headers
+	// written by a Dialer.
+	MaxTLVCount int
+	// ValidateHeader is called on the headers received by a Listener and
+	// on the headers about to be written by a Dialer. If it returns an
+	// error, the connection is rejected.
+	ValidateHeader Validator
+	// ValidationFallback, if set, makes the connections accepted by a
+	// Listener whose header is rejected by ValidateHeader carry on with
+	// their socket addresses, see FallbackOnInvalidHeader.
+	ValidationFallback ValidationFallbackFunc
+	// RequiredTLVs lists the TLV types the headers received by a Listener
+	// must carry, see RequireTLVs.
+	RequiredTLVs []PP2Type
+	// AllowedAuthorities, if set, lists the hostnames the PP2_TYPE_AUTHORITY
+	// TLV of the headers received by a Listener must match, see
+	// AllowAuthorities. An empty, non-nil list rejects any authority.
+	AllowedAuthorities []string
+	// RetainRawHeader keeps the exact bytes of received headers, see
+	// Header.Raw.
+	RetainRawHeader bool
+	// SkipMalformedTLVs drops malformed TLVs of received headers instead of
+	// failing on them, see the SkipMalformedTLVs option.
+	SkipMalformedTLVs bool
+	// OnWarning is called for recoverable anomalies of received headers,
+	// see the OnWarning option.
+	OnWarning WarningFunc
+	// ZonePolicy tells how IPv6 addresses with a zone are handled in
+	// received version 1 headers, see WithZonePolicy.
+	ZonePolicy ZonePolicy
+	// MappedIPv4Policy tells how IPv4-mapped IPv6 addresses of received
+	// headers are handled, see WithMappedIPv4Policy.
+	MappedIPv4Policy MappedIPv4Policy
+	// OnHeaderLatency is called with the time taken by each accepted
+	// connection to send its header, see the OnHeaderLatency option.
+	OnHeaderLatency HeaderLatencyFunc
+	// OnHeaderStats is called with the stats of each header received by a
+	// Listener, see the OnHeaderStats option.
+	OnHeaderStats HeaderStatsFunc
+	// HeaderHMACKey, if set, is the shared key with which a Dialer signs the
+	// headers it writes and a Listener verifies the headers it receives,
+	// see SignHeader and WithHeaderHMAC.
+	HeaderHMACKey []byte
+	// HeaderSigner, if set, signs the headers written by a Dialer, see
+	// SignHeaderWith.
+	HeaderSigner Signer
+	// HeaderKeyring, if set, holds the keys trusted to sign the headers
+	// received by a Listener, see WithHeaderVerifier.
+	HeaderKeyring *Keyring
+}
+
+// connOptions returns the options applying the configuration to an accepted
+// connection. A nil configuration yields no options.
+func (c *Config) connOptions() []func(*Conn) {
+	if c == nil {
+		return nil
+	}
+
+	var opts []func(*Conn)
+	if c.ValidateHeader != nil {
+		opts = append(opts, ValidateHeader(c.ValidateHeader))
+	}
+	if len(c.RequiredTLVs) > 0 {
+		opts = append(opts, RequireTLVs(c.RequiredTLVs...))
+	}
+	if c.AllowedAuthorities != nil {
+		opts = append(opts, AllowAuthorities(c.AllowedAuthorities...))
+	}
+	if c.ValidationFallback != nil {
+		opts = append(opts, FallbackOnInvalidHeader(c.ValidationFallback))
+	}
+	if c.MaxHeaderSize > 0 {
+		opts = append(opts, WithMaxHeaderSize(c.MaxHeaderSize))
+	}
+	if c.MaxTLVCount > 0 {
+		opts = append(opts, WithMaxTLVCount(c.MaxTLVCount))
+	}
+	if c.RetainRawHeader {
+		opts = append(opts, RetainRawHeader())
+	}
+	if c.SkipMalformedTLVs {
+		opts = append(opts, SkipMalformedTLVs())
+	}
+	if c.OnWarning != nil {
+		opts = append(opts, OnWarning(c.OnWarning))
+	}
+	if c.OnHeaderLatency != nil {
+		opts = append(opts, OnHeaderLatency(c.OnHeaderLatency))
+	}
+	if c.OnHeaderStats != nil {
+		opts = append(opts, OnHeaderStats(c.OnHeaderStats))
+	}
+	if c.ZonePolicy != ZoneStrip {
+		opts = append(opts, WithZonePolicy(c.ZonePolicy))
+	}
+	if c.MappedIPv4Policy != MappedIPv4Keep {
+		opts = append(opts, WithMappedIPv4Policy(c.MappedIPv4Policy))
+	}
+	if c.HeaderHMACKey != nil {
+		opts = append(opts, WithHeaderHMAC(c.HeaderHMACKey))
+	}
+	if c.HeaderKeyring != nil {
+		opts = append(opts, WithHeaderVerifier(c.HeaderKeyring))
+	}
+	return opts
+}
+
+// checkHeader makes sure an outbound header complies with the configuration.
+// A nil configuration accepts any header.
+func (c *Config) checkHeader(header *Header) error {
+	if c == nil {
+		return nil
+	}
+
+	if c.MaxHeaderSize > 0 {
+		buf, err := header.Format()
+		if err != nil {
+			return err
+		}
+		if len(buf) > c.MaxHeaderSize {
+			return ErrHeaderTooLarge
+		}
+	}
+	if c.MaxTLVCount > 0 {
+		if _, err := checkTLVCount(header.rawTLVs, c.MaxTLVCount); err != nil {
+			return err
+		}
+	}
+	if c.ValidateHeader != nil {
+		if err := c.ValidateHeader(header); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package proxyproto
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestConfigSharedByListenerAndDialer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var validated []byte
+	config := &Config{
+		Version: 1,
+		ValidateHeader: func(h *Header) error {
+			validated = append(validated, h.Version)
+			return nil
+		},
+	}
+
+	pl := &Listener{Listener: l, Config: config}
+	defer pl.Close()
+
+	cliResult := make(chan error)
+	go func() {
+		d := &Dialer{Config: config}
+		conn, err := d.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			cliResult <- err
+			return
+		}
+		defer conn.Close()
+
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			cliResult <- err
+			return
+		}
+		close(cliResult)
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	recv := make([]byte, 4)
+	if _, err := conn.Read(recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := <-cliResult; err != nil {
+		t.Fatalf("client error: %v", err)
+	}
+
+	if header := conn.(*Conn).ProxyHeader(); header.Version != 1 {
+		t.Fatalf("expected version 1 header, got %v", header)
+	}
+	if len(validated) != 2 || validated[0] != 1 || validated[1] != 1 {
+		t.Fatalf("expected the header to be validated on both sides, got %v", validated)
+	}
+}
+
+func TestConfigListenerOverrides(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	configErr := errors.New("config validator")
+	pl := &Listener{
+		Listener:       l,
+		ValidateHeader: func(*Header) error { return nil },
+		Config: &Config{
+			MaxHeaderSize:  16,
+			ValidateHeader: func(*Header) error { return configErr },
+		},
+	}
+	defer pl.Close()
+
+	cliResult := make(chan error)
+	go func() {
+		conn, err := net.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			cliResult <- err
+			return
+		}
+		defer conn.Close()
+
+		if _, err := conn.Write([]byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\nping")); err != nil {
+			cliResult <- err
+			return
+		}
+		close(cliResult)
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	// The validator of the listener wins, but the size limit of the config
+	// still applies.
+	recv := make([]byte, 4)
+	if _, err := conn.Read(recv); !errors.Is(err, ErrHeaderTooLarge) {
+		t.Fatalf("expected %v, got %v", ErrHeaderTooLarge, err)
+	}
+	if err := <-cliResult; err != nil {
+		t.Fatalf("client error: %v", err)
+	}
+}
+
+func TestConfigDialerRejectsHeader(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer l.Close()
+
+	validationErr := errors.New("validation failed")
+	var cases = []struct {
+		name   string
+		config *Config
+		err    error
+	}{
+		{"too large", &Config{MaxHeaderSize: 16}, ErrHeaderTooLarge},
+		{"invalid", &Config{ValidateHeader: func(*Header) error { return validationErr }}, validationErr},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &Dialer{Config: tc.config}
+			if _, err := d.Dial("tcp", l.Addr().String()); err != tc.err {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestListenerSetConfig(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{Listener: l, Config: &Config{MaxHeaderSize: 16}}
+	defer pl.Close()
+
+	acceptHeader := func() error {
+		t.Helper()
+		cliResult := make(chan error)
+		go func() {
+			conn, err := net.Dial("tcp", pl.Addr().String())
+			if err != nil {
+				cliResult <- err
+				return
+			}
+			defer conn.Close()
+
+			if _, err := conn.Write([]byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\nping")); err != nil {
+				cliResult <- err
+				return
+			}
+			close(cliResult)
+		}()
+
+		conn, err := pl.Accept()
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		defer conn.Close()
+
+		recv := make([]byte, 4)
+		_, err = conn.Read(recv)
+		if err := <-cliResult; err != nil {
+			t.Fatalf("client error: %v", err)
+		}
+		return err
+	}
+
+	if err := acceptHeader(); !errors.Is(err, ErrHeaderTooLarge) {
+		t.Fatalf("expected %v, got %v", ErrHeaderTooLarge, err)
+	}
+
+	pl.SetConfig(&Config{MaxHeaderSize: 128})
+	if err := acceptHeader(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
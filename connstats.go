@@ -0,0 +1,52 @@
+package proxyproto
+
+import "sync/atomic"
+
+// ConnStats holds the traffic counters of a connection, see WithStats.
+type ConnStats struct {
+	// BytesRead is the number of payload bytes read from the connection,
+	// the header excluded, see Conn.HeaderBytes.
+	BytesRead uint64
+	// BytesWritten is the number of bytes written to the connection.
+	BytesWritten uint64
+}
+
+// connCounters holds the atomic traffic counters of a connection.
+type connCounters struct {
+	read    atomic.Uint64
+	written atomic.Uint64
+}
+
+// WithStats makes the connection count the bytes read from and written to
+// it, available through Conn.Stats, when passed as option to NewConn(). This
+// spares wrapping the connection yet again for per-connection traffic
+// accounting.
+func WithStats() func(*Conn) {
+	return func(c *Conn) {
+		c.counters = &connCounters{}
+	}
+}
+
+// Stats returns the traffic counters of the connection. They stay at zero
+// unless enabled with the WithStats option.
+func (p *Conn) Stats() ConnStats {
+	if p.counters == nil {
+		return ConnStats{}
+	}
+	return ConnStats{
+		BytesRead:    p.counters.read.Load(),
+		BytesWritten: p.counters.written.Load(),
+	}
+}
+
+func (p *Conn) countRead(n int64) {
+	if p.counters != nil && n > 0 {
+		p.counters.read.Add(uint64(n))
+	}
+}
+
+func (p *Conn) countWritten(n int64) {
+	if p.counters != nil && n > 0 {
+		p.counters.written.Add(uint64(n))
+	}
+}
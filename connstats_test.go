@@ -0,0 +1,39 @@
+package proxyproto
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestConnStats(t *testing.T) {
+	const header = "PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\n"
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go func() {
+		_, _ = client.Write([]byte(header + "ping"))
+		_, _ = io.ReadFull(client, make([]byte, 9))
+		client.Close()
+	}()
+
+	conn := NewConn(server, WithStats())
+	if _, err := io.ReadFull(conn, make([]byte, 4)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := conn.Write([]byte("pong")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := conn.ReadFrom(bytes.NewReader([]byte("done!"))); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if stats := conn.Stats(); stats.BytesRead != 4 || stats.BytesWritten != 9 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if stats := NewConn(server).Stats(); stats != (ConnStats{}) {
+		t.Fatalf("expected no stats without the option, got %+v", stats)
+	}
+}
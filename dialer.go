@@ -0,0 +1,468 @@
+package proxyproto
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ContextDialer dials connections, e.g. a net.Dialer.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Dialer is used to establish outbound connections speaking the PROXY
+// protocol. A header is written on each connection right after it's
+// established, before any other byte.
+//
+// Hostnames resolving to both IPv6 and IPv4 addresses are dialed as the
+// underlying dialer does, e.g. net.Dialer races both families (Happy
+// Eyeballs, see net.Dialer.FallbackDelay). The header is only written on the
+// winning connection, once it's established, and headers built from
+// connection addresses announce the family of that connection.
+type Dialer struct {
+	// Dialer establishes the underlying connections. If nil, a zero
+	// net.Dialer is used.
+	Dialer ContextDialer
+	// Header is written on every connection. If nil, a header is built from
+	// the addresses of the established connection, see HeaderProxyFromAddrs.
+	Header *Header
+	// Version is the protocol version of the headers built from connection
+	// addresses, when Header is nil. If zero, the latest version is used.
+	// Version 1 can't carry unix socket addresses, so such connections are
+	// announced as UNKNOWN.
+	Version byte
+	// LocalForUnix makes headers built for connections to unix sockets, when
+	// Header is nil, use the LOCAL command (UNKNOWN in version 1) instead of
+	// announcing AF_UNIX addresses, for servers which don't support them.
+	LocalForUnix bool
+	// AppendTLVs, if set, is called for each established connection with
+	// the dial context. The returned TLVs are appended to the ones of the
+	// header written on that connection, e.g. to send a unique ID, a
+	// timestamp or a tenant ID. If it returns an error, the connection is
+	// closed and the error returned by the dial.
+	AppendTLVs func(ctx context.Context, conn net.Conn) ([]TLV, error)
+	// UseHeaderAddrs makes LocalAddr and RemoteAddr of the connections
+	// report the addresses announced in the header, see UseHeaderAddrs.
+	UseHeaderAddrs bool
+	// HeaderHMACKey, if set, is the shared key with which the headers are
+	// signed, see SignHeader. Version 1 headers can't be signed.
+	HeaderHMACKey []byte
+	// HeaderSigner, if set, signs the headers, see SignHeaderWith. Since a
+	// header carries a single signature, it can't be combined with
+	// HeaderHMACKey.
+	HeaderSigner Signer
+	// Codec, if set, formats the headers instead of the PROXY protocol, see
+	// ProxyHeaderCodec.
+	Codec ProxyHeaderCodec
+	// Retry, if set, retries the dials whose connection drops while the
+	// header is being written, see DialRetry.
+	Retry *DialRetry
+	// Config, if set, provides the version of the headers built when
+	// Version is zero, the keys signing them when HeaderHMACKey and
+	// HeaderSigner are nil, and
+	// bounds and validates the headers written, see Config.MaxHeaderSize and
+	// Config.ValidateHeader.
+	Config *Config
+}
+
+// Dial connects to the address on the named network and writes a PROXY
+// header on the connection.
+func (d *Dialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects to the address on the named network using the
+// provided context and writes a PROXY header on the connection.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return d.dial(ctx, network, address, false)
+}
+
+// DialTLSContext connects to the address on the named network using the
+// provided context, and initiates a TLS handshake over the connection once
+// the PROXY header is written. The header and the TLS ClientHello are
+// written at once, sparing the extra segment, and possibly round trip,
+// incurred by writing them separately.
+//
+// A nil config is equivalent to the zero configuration. If its ServerName
+// is empty, it's inferred from the address, as tls.Dial does.
+func (d *Dialer) DialTLSContext(ctx context.Context, network, address string, config *tls.Config) (*tls.Conn, error) {
+	conn, err := d.dial(ctx, network, address, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// DialLocal connects to the address on the named network and writes a PROXY
+// header attributing no client: "PROXY UNKNOWN\r\n" for version 1, or a
+// LOCAL header otherwise. It suits monitoring scripts and health checkers
+// connecting on their own behalf to servers requiring a header.
+func DialLocal(ctx context.Context, network, address string, version byte) (net.Conn, error) {
+	d := &Dialer{Header: HeaderProxyFromAddrs(version, nil, nil)}
+	return d.DialContext(ctx, network, address)
+}
+
+// dial establishes a connection and writes the PROXY header, or defers its
+// writing to the first write on the connection if corked is set. Failures
+// to write the header are retried as set by Retry.
+func (d *Dialer) dial(ctx context.Context, network, address string, corked bool) (*ClientConn, error) {
+	return d.Retry.retry(ctx, func() (*ClientConn, error) {
+		return d.dialOnce(ctx, network, address, corked)
+	})
+}
+
+// dialOnce establishes a connection and writes the PROXY header, or defers
+// its writing to the first write on the connection if corked is set. The
+// errors writing the header are wrapped into a headerWriteError.
+func (d *Dialer) dialOnce(ctx context.Context, network, address string, corked bool) (*ClientConn, error) {
+	dialer := d.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	header := d.Header
+	if header == nil {
+		header = d.headerFromAddrs(conn.LocalAddr(), conn.RemoteAddr())
+	}
+
+	if d.AppendTLVs != nil {
+		if header, err = d.appendTLVs(ctx, conn, header); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if src := sourceTLSConn(ctx); src != nil {
+		if header, err = appendSourceTLSTLVs(ctx, src, header); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	header = appendSourceTCPInfo(ctx, header)
+
+	key, signer := d.hmacKey(), d.signer()
+	if key != nil && signer != nil {
+		conn.Close()
+		return nil, ErrConflictingSigners
+	}
+	if key != nil {
+		signer = HMACKey{Key: key}
+	}
+	if signer != nil {
+		if header, err = SignHeaderWith(header, signer); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if err := d.Config.checkHeader(header); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	var opts []func(*ClientConn)
+	if d.UseHeaderAddrs {
+		opts = append(opts, UseHeaderAddrs())
+	}
+
+	codec := d.Codec
+	if codec == nil {
+		codec = StandardCodec
+	}
+	buf, err := codec.Format(header)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if corked {
+		return newCorkedClientConn(conn, header, buf, opts...), nil
+	}
+	cConn, err := newClientConn(conn, header, buf, opts...)
+	if err != nil {
+		return nil, &headerWriteError{err: err}
+	}
+	return cConn, nil
+}
+
+// headerFromAddrs builds the header announcing a connection established by
+// the dialer.
+func (d *Dialer) headerFromAddrs(localAddr, remoteAddr net.Addr) *Header {
+	if remoteAddr, ok := remoteAddr.(*net.UnixAddr); ok {
+		if d.LocalForUnix {
+			return HeaderProxyFromAddrs(d.version(), nil, nil)
+		}
+		// The client end of a unix socket is usually unnamed, and may
+		// have no address at all on some platforms.
+		if localAddr == nil {
+			localAddr = &net.UnixAddr{Net: remoteAddr.Net}
+		}
+	}
+	return HeaderProxyFromAddrs(d.version(), localAddr, remoteAddr)
+}
+
+// version returns the protocol version of the headers built by the dialer.
+func (d *Dialer) version() byte {
+	if d.Version == 0 && d.Config != nil {
+		return d.Config.Version
+	}
+	return d.Version
+}
+
+// hmacKey returns the key signing the headers written by the dialer.
+func (d *Dialer) hmacKey() []byte {
+	if d.HeaderHMACKey == nil && d.Config != nil {
+		return d.Config.HeaderHMACKey
+	}
+	return d.HeaderHMACKey
+}
+
+// signer returns the signer of the headers written by the dialer.
+func (d *Dialer) signer() Signer {
+	if d.HeaderSigner == nil && d.Config != nil {
+		return d.Config.HeaderSigner
+	}
+	return d.HeaderSigner
+}
+
+// appendTLVs returns a copy of header with the TLVs returned by AppendTLVs
+// for conn, leaving the template header untouched.
+func (d *Dialer) appendTLVs(ctx context.Context, conn net.Conn, header *Header) (*Header, error) {
+	tlvs, err := d.AppendTLVs(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := JoinTLVs(tlvs)
+	if err != nil {
+		return nil, err
+	}
+	return withTLVs(header, raw), nil
+}
+
+// withTLVs returns a copy of header with the raw TLVs appended, leaving the
+// template header untouched.
+func withTLVs(header *Header, raw []byte) *Header {
+	h := *header
+	h.rawTLVs = append(append(make([]byte, 0, len(header.rawTLVs)+len(raw)), header.rawTLVs...), raw...)
+	return &h
+}
+
+// ClientConn is used to wrap an outbound connection on which a PROXY header
+// has been written.
+type ClientConn struct {
+	conn           net.Conn
+	header         *Header
+	useHeaderAddrs bool
+
+	// corked holds the formatted header until the first write, if its
+	// writing is deferred.
+	corked   []byte
+	corkOnce sync.Once
+}
+
+// UseHeaderAddrs makes LocalAddr and RemoteAddr report the source and
+// destination addresses announced in the header, rather than the socket's,
+// when passed as option to NewClientConn(). This way client-side logging and
+// metrics show the addresses actually being announced. Headers with the
+// LOCAL command carry no addresses, in which case the socket's are reported.
+func UseHeaderAddrs() func(*ClientConn) {
+	return func(c *ClientConn) {
+		c.useHeaderAddrs = true
+	}
+}
+
+// NewClientConn writes the header on conn and wraps it into a
+// proxyproto.ClientConn. If the header can't be written, conn is closed and
+// an error is returned.
+func NewClientConn(conn net.Conn, header *Header, opts ...func(*ClientConn)) (*ClientConn, error) {
+	buf, err := header.Format()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return newClientConn(conn, header, buf, opts...)
+}
+
+// newClientConn writes the formatted header on conn and wraps it into a
+// proxyproto.ClientConn.
+func newClientConn(conn net.Conn, header *Header, buf []byte, opts ...func(*ClientConn)) (*ClientConn, error) {
+	if _, err := conn.Write(buf); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	cConn := &ClientConn{
+		conn:   conn,
+		header: header,
+	}
+
+	for _, opt := range opts {
+		opt(cConn)
+	}
+
+	return cConn, nil
+}
+
+// newCorkedClientConn wraps conn into a proxyproto.ClientConn which writes
+// the formatted header along with the first bytes written on the connection.
+func newCorkedClientConn(conn net.Conn, header *Header, buf []byte, opts ...func(*ClientConn)) *ClientConn {
+	cConn := &ClientConn{
+		conn:   conn,
+		header: header,
+		corked: buf,
+	}
+
+	for _, opt := range opts {
+		opt(cConn)
+	}
+
+	return cConn
+}
+
+// ProxyHeader returns the proxy protocol header written on the connection.
+func (c *ClientConn) ProxyHeader() *Header {
+	return c.header
+}
+
+// Read wraps original conn.Read
+func (c *ClientConn) Read(b []byte) (int, error) {
+	return c.conn.Read(b)
+}
+
+// Write wraps original conn.Write
+func (c *ClientConn) Write(b []byte) (int, error) {
+	if c.corked != nil {
+		var (
+			n     int
+			err   error
+			first bool
+		)
+		c.corkOnce.Do(func() {
+			first = true
+			n, err = c.writeCorked(b)
+		})
+		if first {
+			return n, err
+		}
+	}
+	return c.conn.Write(b)
+}
+
+// writeCorked writes the deferred header along with b, in a single write
+// whatever the underlying connection is.
+func (c *ClientConn) writeCorked(b []byte) (int, error) {
+	buf := make([]byte, 0, len(c.corked)+len(b))
+	buf = append(append(buf, c.corked...), b...)
+	n, err := c.conn.Write(buf)
+	n -= len(c.corked)
+	if n < 0 {
+		n = 0
+	}
+	return n, err
+}
+
+// ReadFrom implements io.ReaderFrom, so that copying to the connection
+// benefits from the optimizations of the underlying one, e.g. splice(2)
+// between TCP connections on Linux. A deferred header is written along with
+// the first bytes read from r.
+func (c *ClientConn) ReadFrom(r io.Reader) (n int64, err error) {
+	if c.corked != nil {
+		var done bool
+		c.corkOnce.Do(func() {
+			buf := make([]byte, 32*1024)
+			var (
+				nr   int
+				rerr error
+			)
+			for nr == 0 && rerr == nil {
+				nr, rerr = r.Read(buf)
+			}
+			var nw int
+			nw, err = c.writeCorked(buf[:nr])
+			n = int64(nw)
+			if err == nil && rerr != io.EOF {
+				err = rerr
+			}
+			done = rerr != nil
+		})
+		if err != nil || done {
+			return n, err
+		}
+	}
+	nn, err := io.Copy(c.conn, r)
+	return n + nn, err
+}
+
+// Close wraps original conn.Close
+func (c *ClientConn) Close() error {
+	return c.conn.Close()
+}
+
+// LocalAddr returns the source address announced in the header if the
+// UseHeaderAddrs option is set, otherwise the address of the socket.
+func (c *ClientConn) LocalAddr() net.Addr {
+	if c.useHeaderAddrs && c.header.Command.IsProxy() && c.header.SourceAddr != nil {
+		return c.header.SourceAddr
+	}
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the destination address announced in the header if the
+// UseHeaderAddrs option is set, otherwise the address of the socket peer.
+func (c *ClientConn) RemoteAddr() net.Addr {
+	if c.useHeaderAddrs && c.header.Command.IsProxy() && c.header.DestinationAddr != nil {
+		return c.header.DestinationAddr
+	}
+	return c.conn.RemoteAddr()
+}
+
+// Raw returns the underlying connection which can be casted to
+// a concrete type, allowing access to specialized functions.
+//
+// Use this ONLY if you know exactly what you are doing.
+func (c *ClientConn) Raw() net.Conn {
+	return c.conn
+}
+
+// SetDeadline wraps original conn.SetDeadline
+func (c *ClientConn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+// SetReadDeadline wraps original conn.SetReadDeadline
+func (c *ClientConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline wraps original conn.SetWriteDeadline
+func (c *ClientConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
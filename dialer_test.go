@@ -0,0 +1,552 @@
+package proxyproto
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestDialerWritesHeader(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{Listener: l}
+	defer pl.Close()
+
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr: &net.TCPAddr{
+			IP:   net.ParseIP("10.1.1.1"),
+			Port: 1000,
+		},
+		DestinationAddr: &net.TCPAddr{
+			IP:   net.ParseIP("20.2.2.2"),
+			Port: 2000,
+		},
+	}
+
+	cliResult := make(chan error)
+	go func() {
+		d := &Dialer{Header: header}
+		conn, err := d.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			cliResult <- err
+			return
+		}
+		defer conn.Close()
+
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			cliResult <- err
+			return
+		}
+		close(cliResult)
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	if !conn.(*Conn).ProxyHeader().EqualsTo(header) {
+		t.Fatalf("expected header %v, got %v", header, conn.(*Conn).ProxyHeader())
+	}
+	if err := <-cliResult; err != nil {
+		t.Fatalf("client error: %v", err)
+	}
+}
+
+func TestDialerUseHeaderAddrs(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	header := &Header{
+		Version:           1,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr: &net.TCPAddr{
+			IP:   net.ParseIP("10.1.1.1"),
+			Port: 1000,
+		},
+		DestinationAddr: &net.TCPAddr{
+			IP:   net.ParseIP("20.2.2.2"),
+			Port: 2000,
+		},
+	}
+
+	d := &Dialer{Header: header, UseHeaderAddrs: true}
+	conn, err := d.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	if conn.LocalAddr().String() != "10.1.1.1:1000" {
+		t.Fatalf("bad local address: %v", conn.LocalAddr())
+	}
+	if conn.RemoteAddr().String() != "20.2.2.2:2000" {
+		t.Fatalf("bad remote address: %v", conn.RemoteAddr())
+	}
+	if raw := conn.(*ClientConn).Raw(); raw.RemoteAddr().String() != l.Addr().String() {
+		t.Fatalf("bad socket remote address: %v", raw.RemoteAddr())
+	}
+}
+
+func TestDialerAppendTLVs(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{Listener: l}
+	defer pl.Close()
+
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr: &net.TCPAddr{
+			IP:   net.ParseIP("10.1.1.1"),
+			Port: 1000,
+		},
+		DestinationAddr: &net.TCPAddr{
+			IP:   net.ParseIP("20.2.2.2"),
+			Port: 2000,
+		},
+	}
+	if err := header.SetTLVs([]TLV{{Type: PP2_TYPE_AUTHORITY, Value: []byte("example.org")}}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "tenant")
+
+	cliResult := make(chan error)
+	go func() {
+		d := &Dialer{
+			Header: header,
+			AppendTLVs: func(ctx context.Context, conn net.Conn) ([]TLV, error) {
+				return []TLV{{Type: PP2_TYPE_MIN_CUSTOM, Value: []byte(ctx.Value(ctxKey{}).(string))}}, nil
+			},
+		}
+		conn, err := d.DialContext(ctx, "tcp", pl.Addr().String())
+		if err != nil {
+			cliResult <- err
+			return
+		}
+		defer conn.Close()
+
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			cliResult <- err
+			return
+		}
+		close(cliResult)
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	tlvs, err := conn.(*Conn).ProxyHeader().TLVs()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(tlvs) != 2 || tlvs[0].Type != PP2_TYPE_AUTHORITY || tlvs[1].Type != PP2_TYPE_MIN_CUSTOM || string(tlvs[1].Value) != "tenant" {
+		t.Fatalf("unexpected TLVs: %v", tlvs)
+	}
+	if err := <-cliResult; err != nil {
+		t.Fatalf("client error: %v", err)
+	}
+
+	// The template header is left untouched.
+	if tlvs, _ := header.TLVs(); len(tlvs) != 1 {
+		t.Fatalf("expected template TLVs to be untouched, got %v", tlvs)
+	}
+}
+
+func TestDialerAppendTLVsError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer l.Close()
+
+	tlvErr := errors.New("no tenant")
+	d := &Dialer{
+		AppendTLVs: func(context.Context, net.Conn) ([]TLV, error) { return nil, tlvErr },
+	}
+	if _, err := d.Dial("tcp", l.Addr().String()); err != tlvErr {
+		t.Fatalf("expected %v, got %v", tlvErr, err)
+	}
+}
+
+func TestDialerUnixTarget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxyproto.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{Listener: l}
+	defer pl.Close()
+
+	var cases = []struct {
+		name    string
+		dialer  *Dialer
+		command ProtocolVersionAndCommand
+		proto   AddressFamilyAndProtocol
+	}{
+		{"AF_UNIX", &Dialer{}, PROXY, UnixStream},
+		{"LOCAL fallback", &Dialer{LocalForUnix: true}, LOCAL, UNSPEC},
+		{"version 1", &Dialer{Version: 1}, LOCAL, UNSPEC},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cliResult := make(chan error)
+			go func() {
+				conn, err := tc.dialer.Dial("unix", path)
+				if err != nil {
+					cliResult <- err
+					return
+				}
+				defer conn.Close()
+
+				if _, err := conn.Write([]byte("ping")); err != nil {
+					cliResult <- err
+					return
+				}
+				close(cliResult)
+			}()
+
+			conn, err := pl.Accept()
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			defer conn.Close()
+
+			header := conn.(*Conn).ProxyHeader()
+			if header == nil {
+				t.Fatal("expected a header")
+			}
+			if header.Command != tc.command || header.TransportProtocol != tc.proto {
+				t.Fatalf("unexpected header: %v", header)
+			}
+			if _, destAddr, ok := header.UnixAddrs(); ok && destAddr.Name != path {
+				t.Fatalf("bad destination address: %v", destAddr)
+			}
+			if err := <-cliResult; err != nil {
+				t.Fatalf("client error: %v", err)
+			}
+		})
+	}
+}
+
+// recordingDialer records the writes on the connections it dials.
+type recordingDialer struct {
+	writes chan []byte
+}
+
+func (d *recordingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingConn{Conn: conn, writes: d.writes}, nil
+}
+
+type recordingConn struct {
+	net.Conn
+	writes chan []byte
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	select {
+	case c.writes <- append([]byte{}, b...):
+	default:
+	}
+	return c.Conn.Write(b)
+}
+
+func TestDialerDialTLSContext(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{Listener: l}
+	s := NewTestTLSServer(pl)
+	defer s.Close()
+
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr: &net.TCPAddr{
+			IP:   net.ParseIP("10.1.1.1"),
+			Port: 1000,
+		},
+		DestinationAddr: &net.TCPAddr{
+			IP:   net.ParseIP("20.2.2.2"),
+			Port: 2000,
+		},
+	}
+
+	writes := make(chan []byte, 1)
+	cliResult := make(chan error)
+	go func() {
+		d := &Dialer{Dialer: &recordingDialer{writes: writes}, Header: header}
+		conn, err := d.DialTLSContext(context.Background(), "tcp", s.Addr(), s.TLSClientConfig)
+		if err != nil {
+			cliResult <- err
+			return
+		}
+		defer conn.Close()
+
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			cliResult <- err
+			return
+		}
+		close(cliResult)
+	}()
+
+	conn, err := s.Listener.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	recv := make([]byte, 4)
+	if _, err := io.ReadFull(conn, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(recv) != "ping" {
+		t.Fatalf("bad: %v", recv)
+	}
+	if addr := conn.RemoteAddr().String(); addr != "10.1.1.1:1000" {
+		t.Fatalf("bad remote address: %v", addr)
+	}
+	if err := <-cliResult; err != nil {
+		t.Fatalf("client error: %v", err)
+	}
+
+	// The header and the ClientHello went out in the first write.
+	first := <-writes
+	formatted, _ := header.Format()
+	if !bytes.HasPrefix(first, formatted) || len(first) <= len(formatted) || first[len(formatted)] != 0x16 {
+		t.Fatalf("expected the header and the ClientHello in the first write, got %v", first)
+	}
+}
+
+func TestDialLocal(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer l.Close()
+
+	var cases = []struct {
+		version byte
+		want    []byte
+	}{
+		{1, []byte("PROXY UNKNOWN\r\nping")},
+		{2, append(append(append([]byte{}, SIGV2...), 0x20, 0x00, 0x00, 0x00), "ping"...)},
+	}
+
+	for _, tc := range cases {
+		t.Run(fmt.Sprintf("v%d", tc.version), func(t *testing.T) {
+			cliResult := make(chan error)
+			go func() {
+				conn, err := DialLocal(context.Background(), "tcp", l.Addr().String(), tc.version)
+				if err != nil {
+					cliResult <- err
+					return
+				}
+				defer conn.Close()
+
+				if _, err := conn.Write([]byte("ping")); err != nil {
+					cliResult <- err
+					return
+				}
+				close(cliResult)
+			}()
+
+			conn, err := l.Accept()
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			defer conn.Close()
+
+			recv := make([]byte, len(tc.want))
+			if _, err := io.ReadFull(conn, recv); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if !bytes.Equal(recv, tc.want) {
+				t.Fatalf("expected %q, got %q", tc.want, recv)
+			}
+			if err := <-cliResult; err != nil {
+				t.Fatalf("client error: %v", err)
+			}
+		})
+	}
+}
+
+// serveDualStackDNS answers the A and AAAA queries of any name with the
+// loopback addresses, and returns a resolver querying it.
+func serveDualStackDNS(t *testing.T) *net.Resolver {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if err := query.Unpack(buf[:n]); err != nil || len(query.Questions) != 1 {
+				continue
+			}
+			q := query.Questions[0]
+			resp := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: query.ID, Response: true, Authoritative: true},
+				Questions: query.Questions,
+			}
+			rh := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: q.Class, TTL: 60}
+			switch q.Type {
+			case dnsmessage.TypeA:
+				resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: rh, Body: &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}}})
+			case dnsmessage.TypeAAAA:
+				resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: rh, Body: &dnsmessage.AAAAResource{AAAA: [16]byte{15: 1}}})
+			}
+			b, err := resp.Pack()
+			if err != nil {
+				continue
+			}
+			_, _ = pc.WriteTo(b, addr)
+		}
+	}()
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "udp", pc.LocalAddr().String())
+		},
+	}
+}
+
+func TestDialerHappyEyeballs(t *testing.T) {
+	if l, err := net.Listen("tcp6", "[::1]:0"); err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	} else {
+		l.Close()
+	}
+	resolver := serveDualStackDNS(t)
+
+	for _, tc := range []struct {
+		name      string
+		address   string
+		transport AddressFamilyAndProtocol
+	}{
+		{"ipv4", "127.0.0.1:0", TCPv4},
+		{"ipv6", "[::1]:0", TCPv6},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Only one family is listening, the attempts on the other one
+			// are refused.
+			l, err := net.Listen("tcp", tc.address)
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			pl := &Listener{Listener: l}
+			defer pl.Close()
+			_, port, _ := net.SplitHostPort(l.Addr().String())
+
+			cliResult := make(chan error, 1)
+			go func() {
+				d := &Dialer{Dialer: &net.Dialer{Resolver: resolver}}
+				conn, err := d.Dial("tcp", net.JoinHostPort("dual.test", port))
+				if err != nil {
+					cliResult <- err
+					return
+				}
+				defer conn.Close()
+				_, err = conn.Write([]byte("ping"))
+				cliResult <- err
+			}()
+
+			conn, err := pl.Accept()
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			defer conn.Close()
+			if err := <-cliResult; err != nil {
+				t.Fatalf("client error: %v", err)
+			}
+
+			header := conn.(*Conn).ProxyHeader()
+			if header == nil || header.TransportProtocol != tc.transport {
+				t.Fatalf("expected a %v header, got %v", tc.transport, header)
+			}
+			if header.DestinationAddr.String() != l.Addr().String() {
+				t.Fatalf("expected destination %v, got %v", l.Addr(), header.DestinationAddr)
+			}
+		})
+	}
+}
+
+func TestClientConnReadFromCorked(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+
+	header := HeaderProxyFromAddrs(1, v4addr, v4addr)
+	buf, err := header.Format()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	conn := newCorkedClientConn(client, header, buf)
+
+	go func() {
+		_, _ = conn.ReadFrom(strings.NewReader("ping"))
+		conn.Close()
+	}()
+
+	// The header and the first bytes are written at once.
+	first := make([]byte, 512)
+	n, err := server.Read(first)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if want := string(buf) + "ping"; string(first[:n]) != want {
+		t.Fatalf("expected %q, got %q", want, first[:n])
+	}
+}
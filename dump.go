@@ -0,0 +1,77 @@
+package proxyproto
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// RejectedHeaderFunc receives the first bytes received on a connection whose
+// header failed, along with the address of the upstream which sent them and
+// the error the header failed with.
+type RejectedHeaderFunc func(upstream net.Addr, raw []byte, err error)
+
+// HeaderDumper captures the first bytes of connections whose header failed,
+// e.g. was malformed or missing, and hands them to a callback, so operators
+// can diagnose which upstream is sending garbage. Dumps are rate-limited so
+// that a flood of bad connections doesn't flood the logs as well. It is safe
+// for concurrent use, and can be shared by several listeners, see
+// Listener.HeaderDumper.
+type HeaderDumper struct {
+	size     int
+	interval time.Duration
+	f        RejectedHeaderFunc
+
+	last atomic.Int64 // time of the last dump, in nanoseconds
+}
+
+// NewHeaderDumper returns a HeaderDumper handing to f up to size bytes of
+// the rejected connections, at most once per interval. An interval <= 0
+// dumps every rejected connection. A size <= 0 captures nothing, and thus
+// disables the dumps.
+func NewHeaderDumper(size int, interval time.Duration, f RejectedHeaderFunc) *HeaderDumper {
+	d := &HeaderDumper{
+		size:     max(size, 0),
+		interval: interval,
+		f:        f,
+	}
+	d.last.Store(time.Now().Add(-interval).UnixNano())
+	return d
+}
+
+// dump hands the captured bytes to the callback, unless a dump was made
+// less than an interval ago.
+func (d *HeaderDumper) dump(upstream net.Addr, raw []byte, err error) {
+	if d.interval > 0 {
+		now := time.Now().UnixNano()
+		last := d.last.Load()
+		if now-last < int64(d.interval) || !d.last.CompareAndSwap(last, now) {
+			return
+		}
+	}
+	d.f(upstream, append([]byte(nil), raw...), err)
+}
+
+// WithHeaderDumper makes the connection capture its first bytes, and hand
+// them to the dumper if its header fails, when passed as option to NewConn().
+func WithHeaderDumper(d *HeaderDumper) func(*Conn) {
+	return func(c *Conn) {
+		c.headerDumper = d
+	}
+}
+
+// captureReader records the first bytes read from r, up to the capacity of
+// its buffer.
+type captureReader struct {
+	r   io.Reader
+	buf []byte
+}
+
+func (c *captureReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	if room := cap(c.buf) - len(c.buf); room > 0 {
+		c.buf = append(c.buf, b[:min(n, room)]...)
+	}
+	return n, err
+}
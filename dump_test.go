@@ -0,0 +1,82 @@
+package proxyproto
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHeaderDumper(t *testing.T) {
+	type dump struct {
+		raw string
+		err error
+	}
+	dumps := make(chan dump, 2)
+	d := NewHeaderDumper(8, time.Hour, func(upstream net.Addr, raw []byte, err error) {
+		dumps <- dump{string(raw), err}
+	})
+
+	for i := 0; i < 2; i++ {
+		server, client := net.Pipe()
+		go func() {
+			_, _ = client.Write([]byte("PROXY TCP4 garbage\r\n"))
+		}()
+
+		conn := NewConn(server, WithHeaderDumper(d))
+		if _, err := conn.Read(make([]byte, 1)); err == nil {
+			t.Fatal("expected the invalid header to fail the read")
+		}
+		server.Close()
+		client.Close()
+	}
+
+	got := <-dumps
+	if got.raw != "PROXY TC" || got.err == nil {
+		t.Fatalf("unexpected dump %q with error %v", got.raw, got.err)
+	}
+	select {
+	case got := <-dumps:
+		t.Fatalf("expected the second dump to be rate-limited, got %q", got.raw)
+	default:
+	}
+}
+
+func TestHeaderDumperIgnoresValidHeaders(t *testing.T) {
+	d := NewHeaderDumper(8, 0, func(upstream net.Addr, raw []byte, err error) {
+		t.Errorf("unexpected dump %q", raw)
+	})
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	go func() {
+		_, _ = client.Write([]byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\nping"))
+	}()
+
+	conn := NewConn(server, WithHeaderDumper(d), WithPolicy(REQUIRE))
+	recv := make([]byte, 4)
+	if _, err := conn.Read(recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(recv) != "ping" {
+		t.Fatalf("expected %q, got %q", "ping", recv)
+	}
+}
+
+func TestHeaderDumperNegativeSize(t *testing.T) {
+	d := NewHeaderDumper(-1, 0, func(upstream net.Addr, raw []byte, err error) {
+		t.Errorf("unexpected dump %q", raw)
+	})
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	go func() {
+		_, _ = client.Write([]byte("PROXY TCP4 garbage\r\n"))
+	}()
+
+	conn := NewConn(server, WithHeaderDumper(d))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected the invalid header to fail the read")
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/pires/go-proxyproto
 
-go 1.23
+go 1.23.0
 
 require golang.org/x/net v0.39.0
 
@@ -0,0 +1,261 @@
+package proxyproto
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrGroupClosed is returned by Group.Serve and Group.Add once the group
+// has been shut down or closed.
+var ErrGroupClosed = errors.New("proxyproto: group closed")
+
+// Group serves the same service on several listeners, e.g. on many ports or
+// interfaces, with a single lifecycle. Its listeners share the policy and
+// the configuration of the group, including its validators, hooks and
+// metrics callbacks. Settings specific to a listener can still be set on
+// the Listener returned by Add.
+type Group struct {
+	// mu protects the fields below, and the policy and config shared with
+	// the listeners.
+	mu         sync.Mutex
+	connPolicy ConnPolicyFunc
+	config     *Config
+	listeners  []*Listener
+	conns      map[net.Conn]struct{}
+	handlers   sync.WaitGroup
+	// serve starts serving a listener while the group is serving.
+	serve  func(*Listener)
+	closed bool
+	done   chan struct{}
+}
+
+// NewGroup returns an empty group whose listeners share the policy, which
+// may be nil, and the configuration.
+func NewGroup(policy ConnPolicyFunc, config *Config) *Group {
+	return &Group{
+		connPolicy: policy,
+		config:     config,
+		conns:      make(map[net.Conn]struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Add wraps l into a Listener sharing the policy and the configuration of
+// the group, and adds it to the group. Listeners added while the group is
+// serving are served as well. It fails with ErrGroupClosed, closing l, if
+// the group has been shut down.
+func (g *Group) Add(l net.Listener) (*Listener, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		l.Close()
+		return nil, ErrGroupClosed
+	}
+	pl := NewListener(l)
+	pl.ConnPolicy, pl.Config = g.connPolicy, g.config
+	g.listeners = append(g.listeners, pl)
+	if g.serve != nil {
+		g.serve(pl)
+	}
+	return pl, nil
+}
+
+// Listen listens on the address and adds the listener to the group, see
+// Add.
+func (g *Group) Listen(network, address string) (*Listener, error) {
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return g.Add(l)
+}
+
+// Listeners returns the listeners of the group, in the order they were
+// added.
+func (g *Group) Listeners() []*Listener {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]*Listener(nil), g.listeners...)
+}
+
+// SetConnPolicy atomically replaces the policy of the group and of its
+// listeners, see Listener.SetConnPolicy.
+func (g *Group) SetConnPolicy(policy ConnPolicyFunc) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.connPolicy = policy
+	for _, l := range g.listeners {
+		l.SetConnPolicy(policy)
+	}
+}
+
+// SetConfig atomically replaces the configuration of the group and of its
+// listeners, see Listener.SetConfig.
+func (g *Group) SetConfig(config *Config) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.config = config
+	for _, l := range g.listeners {
+		l.SetConfig(config)
+	}
+}
+
+// Serve accepts connections on all the listeners of the group, including
+// the ones added while serving, and calls handler for each of them in a
+// new goroutine. The handler is responsible for closing the connection.
+// Serve must be called at most once.
+//
+// Temporary accept errors are retried with a backoff, and a listener closed
+// on its own stops being served. If a listener fails otherwise, the whole
+// group is closed and the error returned. Once the
+// group has been shut down or closed, Serve returns ErrGroupClosed.
+func (g *Group) Serve(handler func(net.Conn)) error {
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		serveErr error
+	)
+
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return ErrGroupClosed
+	}
+	g.serve = func(l *Listener) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := g.serveListener(l, handler); err != nil {
+				errOnce.Do(func() { serveErr = err })
+				g.Close()
+			}
+		}()
+	}
+	for _, l := range g.listeners {
+		g.serve(l)
+	}
+	g.mu.Unlock()
+
+	// No listener is started once the group is closed.
+	<-g.done
+	wg.Wait()
+
+	if serveErr != nil {
+		return serveErr
+	}
+	return ErrGroupClosed
+}
+
+// serveListener accepts connections on l until it fails. It returns nil
+// once the group or l is closed.
+func (g *Group) serveListener(l *Listener, handler func(net.Conn)) error {
+	var delay time.Duration
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			g.mu.Lock()
+			closed := g.closed
+			g.mu.Unlock()
+			if closed || errors.Is(err, net.ErrClosed) {
+				// The group or this listener alone was closed.
+				return nil
+			}
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				// Back off as net/http does.
+				delay = min(max(delay*2, 5*time.Millisecond), time.Second)
+				time.Sleep(delay)
+				continue
+			}
+			return err
+		}
+		delay = 0
+
+		if !g.track(conn) {
+			conn.Close()
+			return nil
+		}
+		go func() {
+			defer g.untrack(conn)
+			handler(conn)
+		}()
+	}
+}
+
+// track records a connection being handled, unless the group is closed.
+func (g *Group) track(conn net.Conn) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return false
+	}
+	g.conns[conn] = struct{}{}
+	g.handlers.Add(1)
+	return true
+}
+
+// untrack forgets a connection whose handler returned.
+func (g *Group) untrack(conn net.Conn) {
+	g.mu.Lock()
+	delete(g.conns, conn)
+	g.mu.Unlock()
+	g.handlers.Done()
+}
+
+// closeListeners marks the group as closed and closes its listeners. It
+// returns the first error encountered.
+func (g *Group) closeListeners() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.closed {
+		g.closed = true
+		close(g.done)
+	}
+	var err error
+	for _, l := range g.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil && !errors.Is(cerr, net.ErrClosed) {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// closeConns closes the connections still being handled.
+func (g *Group) closeConns() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for conn := range g.conns {
+		conn.Close()
+	}
+}
+
+// Shutdown gracefully shuts the group down: it closes its listeners, then
+// waits for the handlers of the connections accepted so far to return. If
+// ctx is done first, the remaining connections are closed and the error of
+// ctx returned.
+func (g *Group) Shutdown(ctx context.Context) error {
+	err := g.closeListeners()
+
+	done := make(chan struct{})
+	go func() {
+		g.handlers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		g.closeConns()
+		return ctx.Err()
+	}
+}
+
+// Close immediately closes the listeners of the group and the connections
+// being handled. Use Shutdown to let the handlers finish.
+func (g *Group) Close() error {
+	err := g.closeListeners()
+	g.closeConns()
+	return err
+}
@@ -0,0 +1,129 @@
+package proxyproto
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestGroupServe(t *testing.T) {
+	var latencies = make(chan net.Addr, 2)
+	g := NewGroup(nil, &Config{
+		OnHeaderLatency: func(upstream net.Addr, latency time.Duration) {
+			latencies <- upstream
+		},
+	})
+	first, err := g.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	addrs := make(chan net.Addr, 2)
+	served := make(chan error, 1)
+	go func() {
+		served <- g.Serve(func(conn net.Conn) {
+			defer conn.Close()
+			addrs <- conn.RemoteAddr()
+			_, _ = conn.Write([]byte("pong"))
+		})
+	}()
+
+	// Added while serving.
+	second, err := g.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if got := len(g.Listeners()); got != 2 {
+		t.Fatalf("expected 2 listeners, got %d", got)
+	}
+
+	for _, l := range []*Listener{first, second} {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		header := HeaderProxyFromAddrs(2, v4addr, v4addr)
+		if _, err := header.WriteTo(conn); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if _, err := io.ReadFull(conn, make([]byte, 4)); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		conn.Close()
+
+		if addr := <-addrs; addr.String() != v4addr.String() {
+			t.Fatalf("expected %v, got %v", v4addr, addr)
+		}
+		<-latencies
+	}
+
+	if err := g.Shutdown(context.Background()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := <-served; !errors.Is(err, ErrGroupClosed) {
+		t.Fatalf("expected %v, got %v", ErrGroupClosed, err)
+	}
+	if _, err := g.Listen("tcp", "127.0.0.1:0"); !errors.Is(err, ErrGroupClosed) {
+		t.Fatalf("expected %v, got %v", ErrGroupClosed, err)
+	}
+}
+
+func TestGroupShutdownTimeout(t *testing.T) {
+	g := NewGroup(nil, nil)
+	l, err := g.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	handling := make(chan struct{})
+	go func() {
+		_ = g.Serve(func(conn net.Conn) {
+			close(handling)
+			// Blocks until the connection is closed by Shutdown.
+			_, _ = io.Copy(io.Discard, conn)
+		})
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+	header := HeaderProxyFromAddrs(2, v4addr, v4addr)
+	if _, err := header.WriteTo(conn); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	<-handling
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := g.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	// The connection was closed on the server side.
+	if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected %v, got %v", io.EOF, err)
+	}
+}
+
+func TestGroupSetConnPolicy(t *testing.T) {
+	g := NewGroup(nil, nil)
+	defer g.Close()
+	l, err := g.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	policy := func(ConnPolicyOptions) (Policy, error) { return REJECT, nil }
+	g.SetConnPolicy(policy)
+	if l.ConnPolicy == nil {
+		t.Fatal("expected the policy to be shared with the listener")
+	}
+}
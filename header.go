@@ -5,8 +5,11 @@ package proxyproto
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"math"
 	"net"
 	"time"
 )
@@ -32,6 +35,22 @@ var (
 	ErrInvalidAddress                       = errors.New("proxyproto: invalid address")
 	ErrInvalidPortNumber                    = errors.New("proxyproto: invalid port number")
 	ErrSuperfluousProxyHeader               = errors.New("proxyproto: upstream connection sent PROXY header but isn't allowed to send one")
+	ErrHeaderTooLarge                       = errors.New("proxyproto: header exceeds the maximum size")
+	// ErrTooManyTLVs is matched by the TLVCountError headers carrying more
+	// TLVs than allowed are rejected with, see WithMaxTLVCount.
+	ErrTooManyTLVs = errors.New("proxyproto: too many TLVs")
+	// ErrHeaderTruncated is returned when the peer closes the connection
+	// once the signature of a version 2 header has been received but before
+	// the rest of the header, telling network flaps apart from protocol
+	// bugs. It wraps io.ErrUnexpectedEOF. Partial version 1 headers are
+	// rejected with ErrCantReadVersion1Header, as they can't be told apart
+	// from headers not sent at once.
+	ErrHeaderTruncated = fmt.Errorf("proxyproto: header truncated: %w", io.ErrUnexpectedEOF)
+
+	// Warnings, reported for recoverable anomalies of otherwise valid headers
+	ErrVersion1TrailingFields = errors.New("proxyproto: version 1 header has trailing fields")
+	ErrUnknownTLVType         = errors.New("proxyproto: TLV type not covered by the spec")
+	ErrZeroPort               = errors.New("proxyproto: zero port number")
 )
 
 // Header is the placeholder for proxy protocol header.
@@ -42,6 +61,79 @@ type Header struct {
 	SourceAddr        net.Addr
 	DestinationAddr   net.Addr
 	rawTLVs           []byte
+	rawAddresses      []byte
+	raw               []byte
+	warnings          []error
+	size              int // bytes the header was parsed from, if read off the wire
+	deferredTLVs      int // bytes of the TLV block left unread, see LazyTLVs
+}
+
+// parseOptions tunes how headers are parsed off the wire.
+type parseOptions struct {
+	// retainRaw keeps a copy of the exact header bytes, see Header.Raw.
+	retainRaw bool
+	// skipMalformedTLVs drops malformed TLVs instead of keeping them as is,
+	// see Header.Warnings.
+	skipMalformedTLVs bool
+	// warnings looks for recoverable anomalies, see Header.Warnings.
+	warnings bool
+	// reuse, if set, is the recycled header to parse into.
+	reuse *reusableHeader
+	// maxHeaderSize, if positive, bounds the size of the header in bytes,
+	// signature included.
+	maxHeaderSize int
+	// zones tells how zoned IPv6 addresses of version 1 headers are handled.
+	zones ZonePolicy
+	// mappedIPv4 tells how IPv4-mapped IPv6 addresses are handled.
+	mappedIPv4 MappedIPv4Policy
+	// lazyTLVs, if positive, is the size in bytes of the TLV blocks of
+	// version 2 headers above which they're left unread, see LazyTLVs.
+	lazyTLVs int
+	// maxTLVCount, if positive, bounds the number of TLVs of version 2
+	// headers.
+	maxTLVCount int
+}
+
+// MappedIPv4Policy tells how IPv4-mapped IPv6 addresses, i.e. ::ffff:a.b.c.d,
+// of received headers are handled. Mixed load balancer stacks frequently
+// emit such addresses, which don't match IPv4 CIDR checks.
+type MappedIPv4Policy int
+
+const (
+	// MappedIPv4Keep leaves mapped addresses as is.
+	MappedIPv4Keep MappedIPv4Policy = iota
+	// MappedIPv4Unmap converts mapped addresses to plain IPv4 ones, keeping
+	// the address family of the header.
+	MappedIPv4Unmap
+	// MappedIPv4UnmapFamily converts mapped addresses to plain IPv4 ones, and
+	// rewrites the address family of the header to IPv4 when both its
+	// addresses are IPv4 ones.
+	MappedIPv4UnmapFamily
+)
+
+// postParse applies the parse options to a successfully parsed header.
+func (header *Header) postParse(opts parseOptions) {
+	if opts.mappedIPv4 != MappedIPv4Keep {
+		header.UnmapIPv4(opts.mappedIPv4 == MappedIPv4UnmapFamily)
+	}
+	if opts.warnings {
+		header.checkWarnings()
+	}
+}
+
+// checkWarnings records the recoverable anomalies found in a parsed header
+// which are common to both versions.
+func (header *Header) checkWarnings() {
+	if sourcePort, destPort, ok := header.Ports(); ok && header.Command.IsProxy() && (sourcePort == 0 || destPort == 0) {
+		header.warnings = append(header.warnings, ErrZeroPort)
+	}
+	if tlvs, err := SplitTLVs(header.rawTLVs); err == nil {
+		for _, tlv := range tlvs {
+			if !tlv.Type.Spec() {
+				header.warnings = append(header.warnings, fmt.Errorf("%w: %#x", ErrUnknownTLVType, byte(tlv.Type)))
+			}
+		}
+	}
 }
 
 // HeaderProxyFromAddrs creates a new PROXY header from a source and a
@@ -134,6 +226,46 @@ func (header *Header) IPs() (sourceIP, destIP net.IP, ok bool) {
 	}
 }
 
+// UnmapIPv4 converts the IPv4-mapped IPv6 addresses of the header, i.e.
+// ::ffff:a.b.c.d, to plain IPv4 ones. If rewriteFamily is set and both
+// addresses are IPv4 ones, the address family is rewritten to IPv4 as well,
+// e.g. TCPv6 becomes TCPv4.
+func (header *Header) UnmapIPv4(rewriteFamily bool) {
+	sourceIPv4 := unmapIPv4(header.SourceAddr)
+	destIPv4 := unmapIPv4(header.DestinationAddr)
+	if !rewriteFamily || !sourceIPv4 || !destIPv4 {
+		return
+	}
+
+	switch header.TransportProtocol {
+	case TCPv6:
+		header.TransportProtocol = TCPv4
+	case UDPv6:
+		header.TransportProtocol = UDPv4
+	}
+}
+
+// unmapIPv4 converts an IPv4-mapped address to a plain IPv4 one, in place,
+// and reports whether the address is an IPv4 one.
+func unmapIPv4(addr net.Addr) bool {
+	var ip *net.IP
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		ip = &addr.IP
+	case *net.UDPAddr:
+		ip = &addr.IP
+	default:
+		return false
+	}
+
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return false
+	}
+	*ip = ip4
+	return true
+}
+
 func (header *Header) Ports() (sourcePort, destPort int, ok bool) {
 	if sourceAddr, destAddr, ok := header.TCPAddrs(); ok {
 		return sourceAddr.Port, destAddr.Port, true
@@ -158,8 +290,8 @@ func (header *Header) EqualsTo(otherHeader *Header) bool {
 	if header.Version != otherHeader.Version || header.Command != otherHeader.Command || header.TransportProtocol != otherHeader.TransportProtocol {
 		return false
 	}
-	// TLVs only exist for version 2
-	if header.Version == 2 && !bytes.Equal(header.rawTLVs, otherHeader.rawTLVs) {
+	// TLVs and uninterpreted addresses only exist for version 2
+	if header.Version == 2 && (!bytes.Equal(header.rawTLVs, otherHeader.rawTLVs) || !bytes.Equal(header.rawAddresses, otherHeader.rawAddresses)) {
 		return false
 	}
 	// Return early for header with LOCAL command, which contains no address information
@@ -180,6 +312,21 @@ func (header *Header) WriteTo(w io.Writer) (int64, error) {
 	return bytes.NewBuffer(buf).WriteTo(w)
 }
 
+// WriteHeaderAndPayload writes the header followed by the first bytes of
+// the application payload on conn. Both are handed to the kernel at once,
+// using a vectored write when conn supports it, e.g. for TCP and unix
+// connections, so that they go out in a single syscall and, ideally, a single
+// TCP segment. It returns the number of bytes written, header included.
+func WriteHeaderAndPayload(conn net.Conn, header *Header, payload []byte) (int64, error) {
+	buf, err := header.Format()
+	if err != nil {
+		return 0, err
+	}
+
+	buffers := net.Buffers{buf, payload}
+	return buffers.WriteTo(conn)
+}
+
 // Format renders a proxy protocol header in a format to write over the wire.
 func (header *Header) Format() ([]byte, error) {
 	switch header.Version {
@@ -208,6 +355,81 @@ func (header *Header) SetTLVs(tlvs []TLV) error {
 	return nil
 }
 
+// PadTLVs appends a NOOP TLV to the TLVs of a version 2 header so that the
+// length of the formatted header is a multiple of alignment, e.g. 8 or 64
+// bytes, as some high-performance receivers and kernel-bypass stacks want.
+// Since a TLV takes at least 3 bytes, the padding may exceed alignment. A
+// header which is already aligned is left untouched.
+func (header *Header) PadTLVs(alignment int) error {
+	if header.Version != 2 {
+		return fmt.Errorf("proxyproto: version %d headers can't carry TLVs", header.Version)
+	}
+	if alignment <= 0 {
+		return fmt.Errorf("proxyproto: invalid alignment %d", alignment)
+	}
+
+	buf, err := header.Format()
+	if err != nil {
+		return err
+	}
+	pad := (alignment - len(buf)%alignment) % alignment
+	if pad == 0 {
+		return nil
+	}
+	for pad < 3 {
+		pad += alignment
+	}
+	if len(buf)-16+pad > math.MaxUint16 {
+		return errUint16Overflow
+	}
+
+	noop := make([]byte, pad)
+	noop[0] = byte(PP2_TYPE_NOOP)
+	binary.BigEndian.PutUint16(noop[1:3], uint16(pad-3))
+	header.rawTLVs = append(header.rawTLVs[:len(header.rawTLVs):len(header.rawTLVs)], noop...)
+	return nil
+}
+
+// RawAddresses returns the address block of a version 2 header the library
+// couldn't interpret, as it was received, e.g. the payload of an UNSPEC
+// header which isn't a valid TLV vector, or the payload of a LOCAL header
+// using an address family or transport protocol unknown to this library.
+//
+// The TLVs following the address block of a known address family, with an
+// unknown transport protocol, are still available through TLVs, whereas the
+// whole payload is kept as the address block for unknown address families.
+//
+// Such headers are formatted back with the same address block, which allows
+// forward-compatible relays to pass them through unchanged.
+func (header *Header) RawAddresses() []byte {
+	if header.rawAddresses != nil {
+		return header.rawAddresses
+	}
+	// The payload of UNSPEC headers is kept as TLVs, and formatted back as
+	// such. Some senders fill it with an address block anyway.
+	if header.TransportProtocol == UNSPEC && len(header.rawTLVs) > 0 {
+		if _, err := SplitTLVs(header.rawTLVs); err != nil {
+			return header.rawTLVs
+		}
+	}
+	return nil
+}
+
+// Warnings returns the recoverable anomalies found while parsing the header,
+// e.g. the malformed TLVs dropped when the SkipMalformedTLVs option is used.
+// Anomalies such as zero ports or unknown TLV types are only looked for when
+// a warning callback is set, see the OnWarning option.
+func (header *Header) Warnings() []error {
+	return header.warnings
+}
+
+// Raw returns the exact bytes the header was parsed from, or nil if the
+// header wasn't read off the wire or retaining them wasn't requested, e.g.
+// with the RetainRawHeader option. The returned slice must not be modified.
+func (header *Header) Raw() []byte {
+	return header.raw
+}
+
 // Read identifies the proxy protocol version and reads the remaining of
 // the header, accordingly.
 //
@@ -218,6 +440,10 @@ func (header *Header) SetTLVs(tlvs []TLV) error {
 // the remaining header, assume the reader buffer to be in a corrupt state.
 // Also, this operation will block until enough bytes are available for peeking.
 func Read(reader *bufio.Reader) (*Header, error) {
+	return read(reader, parseOptions{})
+}
+
+func read(reader *bufio.Reader, opts parseOptions) (*Header, error) {
 	// In order to improve speed for small non-PROXYed packets, take a peek at the first byte alone.
 	b1, err := reader.Peek(1)
 	if err != nil {
@@ -236,7 +462,13 @@ func Read(reader *bufio.Reader) (*Header, error) {
 			return nil, err
 		}
 		if bytes.Equal(signature[:5], SIGV1) {
-			return parseVersion1(reader)
+			var raw parseErrorRaw
+			raw.peek(reader)
+			header, err := parseVersion1(reader, opts)
+			if err == nil {
+				header.postParse(opts)
+			}
+			return header, raw.wrap(err)
 		}
 
 		signature, err = reader.Peek(12)
@@ -247,13 +479,41 @@ func Read(reader *bufio.Reader) (*Header, error) {
 			return nil, err
 		}
 		if bytes.Equal(signature[:12], SIGV2) {
-			return parseVersion2(reader)
+			var raw parseErrorRaw
+			raw.peek(reader)
+			header, err := parseVersion2(reader, opts)
+			if err == nil {
+				header.postParse(opts)
+			}
+			return header, raw.wrap(err)
 		}
 	}
 
 	return nil, ErrNoProxyProtocol
 }
 
+// SplitHeader reads the PROXY header at the start of r, if present, and
+// returns it along with a reader for the remaining stream, e.g. for replaying
+// captures from files, test fixtures, or transports which aren't a net.Conn.
+//
+// If r doesn't start with a PROXY signature, a nil header and no error are
+// returned, and the returned reader yields the whole stream.
+func SplitHeader(r io.Reader) (*Header, io.Reader, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	header, err := Read(br)
+	if err == ErrNoProxyProtocol {
+		return nil, br, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, br, nil
+}
+
 // ReadTimeout acts as Read but takes a timeout. If that timeout is reached, it's assumed
 // there's no proxy protocol header.
 func ReadTimeout(reader *bufio.Reader, timeout time.Duration) (*Header, error) {
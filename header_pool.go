@@ -0,0 +1,77 @@
+package proxyproto
+
+import (
+	"net"
+	"sync"
+)
+
+// HeaderPool recycles the headers of closed connections, along with their
+// addresses, saving a few allocations per connection for servers with very
+// high connection rates. The zero value is ready to use.
+//
+// When a pool is in use, the header returned by a connection's ProxyHeader,
+// along with its addresses, is only valid until the connection is closed:
+// it must not be retained past that point.
+type HeaderPool struct {
+	pool sync.Pool
+}
+
+func (hp *HeaderPool) get() *reusableHeader {
+	if r, ok := hp.pool.Get().(*reusableHeader); ok {
+		return r
+	}
+	return new(reusableHeader)
+}
+
+func (hp *HeaderPool) put(r *reusableHeader) {
+	hp.pool.Put(r)
+}
+
+// reusableHeader is a header along with storage for its addresses.
+type reusableHeader struct {
+	header   Header
+	tcpAddrs [2]net.TCPAddr
+	udpAddrs [2]net.UDPAddr
+}
+
+// reset clears the header, keeping the storage of its TLVs.
+func (r *reusableHeader) reset() *Header {
+	r.header = Header{rawTLVs: r.header.rawTLVs[:0]}
+	return &r.header
+}
+
+// ipAddr is like newIPAddr, but fills the i-th recycled address instead of
+// allocating a new one.
+func (r *reusableHeader) ipAddr(i int, transport AddressFamilyAndProtocol, ip net.IP, port uint16) net.Addr {
+	if transport.IsStream() {
+		addr := &r.tcpAddrs[i]
+		addr.IP = append(addr.IP[:0], ip...)
+		addr.Port = int(port)
+		addr.Zone = ""
+		return addr
+	} else if transport.IsDatagram() {
+		addr := &r.udpAddrs[i]
+		addr.IP = append(addr.IP[:0], ip...)
+		addr.Port = int(port)
+		addr.Zone = ""
+		return addr
+	}
+	return nil
+}
+
+// newHeader returns the header to parse into.
+func (opts parseOptions) newHeader() *Header {
+	if opts.reuse != nil {
+		return opts.reuse.reset()
+	}
+	return new(Header)
+}
+
+// ipAddr returns the i-th address of the header being parsed, 0 being the
+// source and 1 the destination.
+func (opts parseOptions) ipAddr(i int, transport AddressFamilyAndProtocol, ip net.IP, port uint16) net.Addr {
+	if opts.reuse != nil {
+		return opts.reuse.ipAddr(i, transport, ip, port)
+	}
+	return newIPAddr(transport, ip, port)
+}
@@ -0,0 +1,81 @@
+package proxyproto
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestReusableHeader(t *testing.T) {
+	r := new(reusableHeader)
+
+	raw := append(append(SIGV2, byte(PROXY), byte(TCPv6)), fixtureIPv6V2TLV...)
+	header, err := read(newBufioReader(raw), parseOptions{reuse: r})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if header != &r.header {
+		t.Fatal("expected the recycled header to be parsed into")
+	}
+	expected := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv6,
+		SourceAddr:        v6addr,
+		DestinationAddr:   v6addr,
+		rawTLVs:           fixtureTLV,
+	}
+	if !header.EqualsTo(expected) {
+		t.Fatalf("expected %#v, got %#v", expected, header)
+	}
+
+	header, err = read(newBufioReader([]byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\n")), parseOptions{reuse: r})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if header.Version != 1 || len(header.rawTLVs) != 0 {
+		t.Fatalf("expected a clean version 1 header, got %#v", header)
+	}
+	if header.SourceAddr.String() != "10.1.1.1:1000" || header.DestinationAddr.String() != "20.2.2.2:2000" {
+		t.Fatalf("unexpected addresses %v and %v", header.SourceAddr, header.DestinationAddr)
+	}
+
+	header, err = read(newBufioReader(append(SIGV2, byte(LOCAL), byte(UNSPEC), 0, 0)), parseOptions{reuse: r})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if header.SourceAddr != nil || header.DestinationAddr != nil {
+		t.Fatalf("expected no addresses, got %v and %v", header.SourceAddr, header.DestinationAddr)
+	}
+}
+
+func TestConnWithHeaderPool(t *testing.T) {
+	pool := new(HeaderPool)
+
+	for i := 0; i < 3; i++ {
+		server, client := net.Pipe()
+
+		conn := NewConn(server, WithHeaderPool(pool))
+		go func() {
+			_, _ = client.Write([]byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\nping"))
+		}()
+
+		recv := make([]byte, 4)
+		if _, err := io.ReadFull(conn, recv); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !bytes.Equal(recv, []byte("ping")) {
+			t.Fatalf("bad: %v", recv)
+		}
+		if conn.RemoteAddr().String() != "10.1.1.1:1000" {
+			t.Fatalf("bad remote address: %v", conn.RemoteAddr())
+		}
+
+		conn.Close()
+		client.Close()
+		if conn.ProxyHeader() != nil {
+			t.Fatal("expected the header to be recycled on close")
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"errors"
+	"io"
 	"net"
 	"reflect"
 	"testing"
@@ -789,3 +790,268 @@ func TestHeaderProxyFromAddrs(t *testing.T) {
 		})
 	}
 }
+
+func TestRawHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []byte
+	}{
+		{"v1", []byte("PROXY TCP4 127.0.0.1 127.0.0.1 65533 65533\r\n")},
+		{"v1 unknown", []byte("PROXY UNKNOWN\r\n")},
+		{"v2", append(append(SIGV2, byte(PROXY), byte(TCPv4)), fixtureIPv4V2...)},
+		{"v2 with TLVs", append(append(SIGV2, byte(PROXY), byte(TCPv6)), fixtureIPv6V2TLV...)},
+		{"v2 local", append(SIGV2, byte(LOCAL), byte(UNSPEC), 0, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := append(append([]byte{}, tt.raw...), arbitraryTailBytes...)
+
+			header, err := Read(bufio.NewReader(bytes.NewReader(payload)))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if header.Raw() != nil {
+				t.Fatalf("expected no raw bytes unless requested, got %v", header.Raw())
+			}
+
+			reader := bufio.NewReader(bytes.NewReader(payload))
+			header, err = read(reader, parseOptions{retainRaw: true})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.Equal(header.Raw(), tt.raw) {
+				t.Fatalf("expected raw bytes %v, got %v", tt.raw, header.Raw())
+			}
+			if reader.Buffered() != len(arbitraryTailBytes) {
+				t.Fatalf("expected %d bytes to remain, got %d", len(arbitraryTailBytes), reader.Buffered())
+			}
+		})
+	}
+}
+
+func TestHeaderWarnings(t *testing.T) {
+	unknownTLV := []byte{0x10, 0x00, 0x01, 0x00}
+	zeroPorts := append(append([]byte{}, addressesIPv4...), 0, 0, 0, 0)
+
+	tests := []struct {
+		name     string
+		raw      []byte
+		warnings []error
+	}{
+		{"v1 valid", []byte("PROXY TCP4 127.0.0.1 127.0.0.1 65533 65533\r\n"), nil},
+		{"v1 trailing fields", []byte("PROXY TCP4 127.0.0.1 127.0.0.1 65533 65533 extra\r\n"), []error{ErrVersion1TrailingFields}},
+		{"v1 zero port", []byte("PROXY TCP4 127.0.0.1 127.0.0.1 0 65533\r\n"), []error{ErrZeroPort}},
+		{"v2 valid", append(append(SIGV2, byte(PROXY), byte(TCPv4)), fixtureIPv4V2...), nil},
+		{"v2 unknown TLV", append(append(SIGV2, byte(PROXY), byte(TCPv4)), fixtureWithTLV(lengthV4Bytes, fixtureIPv4Address, unknownTLV)...), []error{ErrUnknownTLVType}},
+		{"v2 zero ports", append(append(append(SIGV2, byte(PROXY), byte(TCPv4)), lengthV4Bytes...), zeroPorts...), []error{ErrZeroPort}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, err := Read(newBufioReader(tt.raw))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if header.Warnings() != nil {
+				t.Fatalf("expected no warnings unless requested, got %v", header.Warnings())
+			}
+
+			header, err = read(newBufioReader(tt.raw), parseOptions{warnings: true})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			warnings := header.Warnings()
+			if len(warnings) != len(tt.warnings) {
+				t.Fatalf("expected warnings %v, got %v", tt.warnings, warnings)
+			}
+			for i := range warnings {
+				if !errors.Is(warnings[i], tt.warnings[i]) {
+					t.Fatalf("expected warning %v, got %v", tt.warnings[i], warnings[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMappedIPv4Policy(t *testing.T) {
+	const (
+		mapped = "PROXY TCP6 ::ffff:10.1.1.1 ::ffff:20.2.2.2 1000 2000\r\n"
+		mixed  = "PROXY TCP6 ::ffff:10.1.1.1 ::1 1000 2000\r\n"
+	)
+
+	tests := []struct {
+		name      string
+		raw       string
+		policy    MappedIPv4Policy
+		transport AddressFamilyAndProtocol
+		sourceLen int
+		destLen   int
+	}{
+		{"keep", mapped, MappedIPv4Keep, TCPv6, net.IPv6len, net.IPv6len},
+		{"unmap", mapped, MappedIPv4Unmap, TCPv6, net.IPv4len, net.IPv4len},
+		{"unmap family", mapped, MappedIPv4UnmapFamily, TCPv4, net.IPv4len, net.IPv4len},
+		{"unmap family mixed", mixed, MappedIPv4UnmapFamily, TCPv6, net.IPv4len, net.IPv6len},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, err := read(newBufioReader([]byte(tt.raw)), parseOptions{mappedIPv4: tt.policy})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if header.TransportProtocol != tt.transport {
+				t.Fatalf("expected transport %v, got %v", tt.transport, header.TransportProtocol)
+			}
+			sourceIP, destIP, _ := header.IPs()
+			if len(sourceIP) != tt.sourceLen || len(destIP) != tt.destLen {
+				t.Fatalf("unexpected addresses %v and %v", sourceIP, destIP)
+			}
+			if !sourceIP.Equal(net.ParseIP("10.1.1.1")) {
+				t.Fatalf("unexpected source address %v", sourceIP)
+			}
+			if _, err := header.Format(); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+		})
+	}
+}
+
+func TestSplitHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  []byte
+		header bool
+		rest   []byte
+	}{
+		{"v1", []byte("PROXY TCP4 127.0.0.1 127.0.0.1 65533 65533\r\nping"), true, []byte("ping")},
+		{"v2", append(append(append(SIGV2, byte(PROXY), byte(TCPv4)), fixtureIPv4V2...), "ping"...), true, []byte("ping")},
+		{"no header", []byte(NO_PROTOCOL), false, []byte(NO_PROTOCOL)},
+		{"empty", nil, false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, rest, err := SplitHeader(bytes.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (header != nil) != tt.header {
+				t.Fatalf("unexpected header: %v", header)
+			}
+			b, err := io.ReadAll(rest)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.Equal(b, tt.rest) {
+				t.Fatalf("expected remaining stream %q, got %q", tt.rest, b)
+			}
+		})
+	}
+
+	if _, _, err := SplitHeader(bytes.NewReader([]byte("PROXY TCP4 invalid\r\n"))); err == nil {
+		t.Fatal("expected an error for an invalid header")
+	}
+}
+
+func TestWriteHeaderAndPayload(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer l.Close()
+
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr:        v4addr,
+		DestinationAddr:   v4addr,
+	}
+	formatted, err := header.Format()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	cliResult := make(chan error, 1)
+	go func() {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			cliResult <- err
+			return
+		}
+		defer conn.Close()
+
+		n, err := WriteHeaderAndPayload(conn, header, []byte("ping"))
+		if err == nil && n != int64(len(formatted)+4) {
+			err = errors.New("unexpected number of bytes written")
+		}
+		cliResult <- err
+	}()
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	received, rest, err := SplitHeader(conn)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !received.EqualsTo(header) {
+		t.Fatalf("expected header %v, got %v", header, received)
+	}
+	recv := make([]byte, 4)
+	if _, err := io.ReadFull(rest, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.Equal(recv, []byte("ping")) {
+		t.Fatalf("bad: %v", recv)
+	}
+	if err := <-cliResult; err != nil {
+		t.Fatalf("client error: %v", err)
+	}
+
+	if _, err := WriteHeaderAndPayload(conn, &Header{}, []byte("ping")); err != ErrUnknownProxyProtocolVersion {
+		t.Fatalf("expected %v, got %v", ErrUnknownProxyProtocolVersion, err)
+	}
+}
+
+func TestPadTLVs(t *testing.T) {
+	for _, alignment := range []int{1, 2, 4, 8, 29, 64} {
+		header := &Header{
+			Version:           2,
+			Command:           PROXY,
+			TransportProtocol: TCPv4,
+			SourceAddr:        v4addr,
+			DestinationAddr:   v4addr,
+		}
+		if err := header.SetTLVs([]TLV{{Type: PP2_TYPE_UNIQUE_ID, Value: []byte("id")}}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if err := header.PadTLVs(alignment); err != nil {
+			t.Fatalf("alignment %d: unexpected error: %v", alignment, err)
+		}
+
+		buf, err := header.Format()
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if len(buf)%alignment != 0 {
+			t.Fatalf("alignment %d: got a %d-byte header", alignment, len(buf))
+		}
+		tlvs, err := header.TLVs()
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if tlvs[0].Type != PP2_TYPE_UNIQUE_ID || (len(buf) != 33 && (len(tlvs) != 2 || tlvs[1].Type != PP2_TYPE_NOOP)) {
+			t.Fatalf("alignment %d: unexpected TLVs %v", alignment, tlvs)
+		}
+	}
+
+	v1 := &Header{Version: 1, Command: PROXY, TransportProtocol: TCPv4, SourceAddr: v4addr, DestinationAddr: v4addr}
+	if err := v1.PadTLVs(8); err == nil {
+		t.Fatal("expected version 1 headers not to be padded")
+	}
+}
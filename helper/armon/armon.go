@@ -0,0 +1,61 @@
+// Package armon provides a compatibility layer for projects migrating from
+// github.com/armon/go-proxyproto.
+//
+// It exposes the SourceChecker based API of that package, mapped onto the
+// policies of github.com/pires/go-proxyproto, so existing accept paths can be
+// kept while switching the underlying implementation.
+package armon
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// SourceChecker can be used to decide whether to trust the PROXY info or
+// pass the original connection address through. If set, the connecting
+// address is passed in as an argument. If the function returns an error, the
+// connection is dropped.
+type SourceChecker func(net.Addr) (bool, error)
+
+// NewListener wraps ln in a proxyproto.Listener behaving like the Listener of
+// github.com/armon/go-proxyproto.
+//
+// The proxyHeaderTimeout bounds how long the header is waited for; unlike in
+// this package, a zero timeout disables it. A nil sourceCheck trusts every
+// upstream.
+func NewListener(ln net.Listener, proxyHeaderTimeout time.Duration, sourceCheck SourceChecker) *proxyproto.Listener {
+	if proxyHeaderTimeout == 0 {
+		proxyHeaderTimeout = -1
+	}
+
+	pl := &proxyproto.Listener{
+		Listener:          ln,
+		ReadHeaderTimeout: proxyHeaderTimeout,
+	}
+	if sourceCheck != nil {
+		pl.ConnPolicy = SourceCheckPolicy(sourceCheck)
+	}
+	return pl
+}
+
+// SourceCheckPolicy maps a SourceChecker onto a proxyproto.ConnPolicyFunc.
+//
+// Trusted upstreams get the USE policy, untrusted ones IGNORE, so that their
+// connections fall back to the socket address. SourceChecker errors are
+// reported as proxyproto.ErrInvalidUpstream, causing the listener to drop
+// the connection and keep accepting, as the armon listener did.
+func SourceCheckPolicy(sourceCheck SourceChecker) proxyproto.ConnPolicyFunc {
+	return func(opts proxyproto.ConnPolicyOptions) (proxyproto.Policy, error) {
+		trusted, err := sourceCheck(opts.Upstream)
+		if err != nil {
+			return proxyproto.REJECT, fmt.Errorf("%w: %v", proxyproto.ErrInvalidUpstream, err)
+		}
+		if trusted {
+			return proxyproto.USE, nil
+		}
+		return proxyproto.IGNORE, nil
+	}
+}
@@ -0,0 +1,61 @@
+package armon
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func TestSourceCheckPolicy(t *testing.T) {
+	upstream := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000}
+	checkErr := errors.New("check failed")
+
+	var cases = []struct {
+		name    string
+		check   SourceChecker
+		policy  proxyproto.Policy
+		wantErr bool
+	}{
+		{"trusted", func(net.Addr) (bool, error) { return true, nil }, proxyproto.USE, false},
+		{"untrusted", func(net.Addr) (bool, error) { return false, nil }, proxyproto.IGNORE, false},
+		{"error", func(net.Addr) (bool, error) { return false, checkErr }, proxyproto.REJECT, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, err := SourceCheckPolicy(tc.check)(proxyproto.ConnPolicyOptions{Upstream: upstream})
+			if policy != tc.policy {
+				t.Fatalf("expected policy %v, got %v", tc.policy, policy)
+			}
+			if tc.wantErr && !errors.Is(err, proxyproto.ErrInvalidUpstream) {
+				t.Fatalf("expected ErrInvalidUpstream, got %v", err)
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	pl := NewListener(ln, 0, nil)
+	if pl.ReadHeaderTimeout >= 0 {
+		t.Fatalf("expected header timeout to be disabled, got %v", pl.ReadHeaderTimeout)
+	}
+	if pl.ConnPolicy != nil {
+		t.Fatal("expected no policy without a source check")
+	}
+
+	pl = NewListener(ln, 0, func(net.Addr) (bool, error) { return true, nil })
+	if pl.ConnPolicy == nil {
+		t.Fatal("expected a policy with a source check")
+	}
+}
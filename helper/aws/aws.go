@@ -0,0 +1,172 @@
+// Package aws builds trusted proxy policies from the network configuration
+// of the EC2 instance it runs on, so that services fronted by a Network
+// Load Balancer trust the peers of their VPC or subnet without hardcoding
+// CIDRs.
+//
+// The CIDRs are read from the instance metadata service, using IMDSv2
+// session tokens, which doesn't require credentials nor the AWS SDK.
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// DefaultEndpoint is the address of the instance metadata service.
+const DefaultEndpoint = "http://169.254.169.254"
+
+// tokenTTL is the lifetime requested for IMDSv2 session tokens.
+const tokenTTL = "60"
+
+// ErrNoCIDRs is returned when the instance metadata lists no CIDR.
+var ErrNoCIDRs = errors.New("aws: no CIDR found in the instance metadata")
+
+// Scope is the extent of the network whose peers are trusted.
+type Scope int
+
+const (
+	// ScopeVPC trusts the CIDRs of the VPCs of the network interfaces of
+	// the instance.
+	ScopeVPC Scope = iota
+	// ScopeSubnet trusts the CIDRs of the subnets of the network interfaces
+	// of the instance only, e.g. when the load balancer nodes live in the
+	// subnets of the instance.
+	ScopeSubnet
+)
+
+// metadataKeys returns the metadata keys of a network interface listing the
+// IPv4 and IPv6 CIDRs of the scope.
+func (s Scope) metadataKeys() []string {
+	if s == ScopeSubnet {
+		return []string{"subnet-ipv4-cidr-block", "subnet-ipv6-cidr-blocks"}
+	}
+	return []string{"vpc-ipv4-cidr-blocks", "vpc-ipv6-cidr-blocks"}
+}
+
+// Metadata reads the instance metadata service.
+type Metadata struct {
+	// Endpoint is the URL of the service. If empty, DefaultEndpoint is
+	// used.
+	Endpoint string
+	// HTTPClient sends the requests. If nil, a client with a two seconds
+	// timeout is used.
+	HTTPClient *http.Client
+}
+
+// CIDRs returns the IPv4 and IPv6 CIDRs of the scope, for all the network
+// interfaces of the instance.
+func (m *Metadata) CIDRs(ctx context.Context, scope Scope) ([]string, error) {
+	token, err := m.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	macs, err := m.get(ctx, token, "network/interfaces/macs/")
+	if err != nil {
+		return nil, err
+	}
+
+	var cidrs []string
+	seen := make(map[string]bool)
+	for _, mac := range strings.Fields(macs) {
+		mac = strings.TrimSuffix(mac, "/")
+		for _, key := range scope.metadataKeys() {
+			blocks, err := m.get(ctx, token, "network/interfaces/macs/"+mac+"/"+key)
+			if errors.Is(err, errNotFound) {
+				// e.g. no IPv6 CIDR is associated
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			for _, block := range strings.Fields(blocks) {
+				if _, err := netip.ParsePrefix(block); err != nil {
+					return nil, fmt.Errorf("aws: invalid CIDR %q: %w", block, err)
+				}
+				if !seen[block] {
+					seen[block] = true
+					cidrs = append(cidrs, block)
+				}
+			}
+		}
+	}
+	if len(cidrs) == 0 {
+		return nil, ErrNoCIDRs
+	}
+	return cidrs, nil
+}
+
+// Policy returns a policy trusting the CIDRs of the scope, see CIDRs. With
+// strict set, it's a proxyproto.StrictWhiteListPolicy rejecting the
+// connections of other upstreams, otherwise a proxyproto.LaxWhiteListPolicy
+// ignoring their header.
+func (m *Metadata) Policy(ctx context.Context, scope Scope, strict bool) (proxyproto.PolicyFunc, error) {
+	cidrs, err := m.CIDRs(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+	if strict {
+		return proxyproto.StrictWhiteListPolicy(cidrs)
+	}
+	return proxyproto.LaxWhiteListPolicy(cidrs)
+}
+
+// errNotFound is returned by get for missing metadata keys.
+var errNotFound = errors.New("aws: metadata key not found")
+
+// token requests an IMDSv2 session token.
+func (m *Metadata) token(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, m.endpoint()+"/latest/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", tokenTTL)
+	return m.do(req)
+}
+
+// get reads the metadata key.
+func (m *Metadata) get(ctx context.Context, token, key string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.endpoint()+"/latest/meta-data/"+key, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	return m.do(req)
+}
+
+func (m *Metadata) do(req *http.Request) (string, error) {
+	client := m.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 2 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", errNotFound
+	default:
+		return "", fmt.Errorf("aws: %s %s: %s", req.Method, req.URL.Path, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	return string(body), err
+}
+
+func (m *Metadata) endpoint() string {
+	if m.Endpoint == "" {
+		return DefaultEndpoint
+	}
+	return strings.TrimSuffix(m.Endpoint, "/")
+}
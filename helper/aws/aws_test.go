@@ -0,0 +1,89 @@
+package aws
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func newMetadataServer(t *testing.T) *httptest.Server {
+	metadata := map[string]string{
+		"network/interfaces/macs/":                                          "0a:00:00:00:00:01/\n0a:00:00:00:00:02/",
+		"network/interfaces/macs/0a:00:00:00:00:01/vpc-ipv4-cidr-blocks":    "10.0.0.0/16\n100.64.0.0/16",
+		"network/interfaces/macs/0a:00:00:00:00:01/vpc-ipv6-cidr-blocks":    "2600:1f18:1234:5600::/56",
+		"network/interfaces/macs/0a:00:00:00:00:01/subnet-ipv4-cidr-block":  "10.0.1.0/24",
+		"network/interfaces/macs/0a:00:00:00:00:02/vpc-ipv4-cidr-blocks":    "10.0.0.0/16\n100.64.0.0/16",
+		"network/interfaces/macs/0a:00:00:00:00:02/subnet-ipv4-cidr-block":  "10.0.2.0/24",
+		"network/interfaces/macs/0a:00:00:00:00:01/subnet-ipv6-cidr-blocks": "2600:1f18:1234:5601::/64",
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			if r.Method != http.MethodPut || r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte("token"))
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		value, ok := metadata[strings.TrimPrefix(r.URL.Path, "/latest/meta-data/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(value))
+	}))
+}
+
+func TestMetadataCIDRs(t *testing.T) {
+	server := newMetadataServer(t)
+	defer server.Close()
+	m := &Metadata{Endpoint: server.URL}
+
+	var cases = []struct {
+		name  string
+		scope Scope
+		cidrs []string
+	}{
+		{"vpc", ScopeVPC, []string{"10.0.0.0/16", "100.64.0.0/16", "2600:1f18:1234:5600::/56"}},
+		{"subnet", ScopeSubnet, []string{"10.0.1.0/24", "2600:1f18:1234:5601::/64", "10.0.2.0/24"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cidrs, err := m.CIDRs(context.Background(), tc.scope)
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if !reflect.DeepEqual(cidrs, tc.cidrs) {
+				t.Fatalf("expected %v, got %v", tc.cidrs, cidrs)
+			}
+		})
+	}
+}
+
+func TestMetadataPolicy(t *testing.T) {
+	server := newMetadataServer(t)
+	defer server.Close()
+	m := &Metadata{Endpoint: server.URL}
+
+	policy, err := m.Policy(context.Background(), ScopeSubnet, true)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if p, _ := policy(&net.TCPAddr{IP: net.ParseIP("10.0.2.10"), Port: 1000}); p != proxyproto.USE {
+		t.Fatalf("expected %v, got %v", proxyproto.USE, p)
+	}
+	if p, _ := policy(&net.TCPAddr{IP: net.ParseIP("10.0.3.10"), Port: 1000}); p != proxyproto.REJECT {
+		t.Fatalf("expected %v, got %v", proxyproto.REJECT, p)
+	}
+}
@@ -0,0 +1,227 @@
+// Package forwarded converts PROXY headers to and from HTTP forwarding
+// headers, so HTTP reverse proxies terminating the PROXY protocol can
+// propagate the client identity upstream, and gateways receiving HTTP from an
+// edge can announce it to TCP backends.
+package forwarded
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// ErrNoClient is returned when the forwarding headers don't announce the
+// address of a client, e.g. when they are missing or obfuscated.
+var ErrNoClient = errors.New("forwarded: no client address")
+
+// Forwarded returns the RFC 7239 Forwarded element announcing the source of
+// the header as "for" and its destination as "by", e.g.
+// for="192.0.2.60:47011";by="198.51.100.17:443". An empty string is returned
+// if the header carries no IP addresses, e.g. for LOCAL headers.
+func Forwarded(header *proxyproto.Header) string {
+	sourceAddr, destAddr, ok := ipAddrs(header)
+	if !ok {
+		return ""
+	}
+	return "for=" + node(sourceAddr) + ";by=" + node(destAddr)
+}
+
+// XForwardedFor returns the X-Forwarded-For value announcing the source IP
+// of the header. An empty string is returned if the header carries no IP
+// addresses.
+func XForwardedFor(header *proxyproto.Header) string {
+	sourceAddr, _, ok := ipAddrs(header)
+	if !ok {
+		return ""
+	}
+	return sourceAddr.IP.String()
+}
+
+// XForwardedPort returns the X-Forwarded-Port value announcing the
+// destination port of the header, i.e. the port the client connected to. An
+// empty string is returned if the header carries no IP addresses.
+func XForwardedPort(header *proxyproto.Header) string {
+	_, destAddr, ok := ipAddrs(header)
+	if !ok {
+		return ""
+	}
+	return strconv.Itoa(destAddr.Port)
+}
+
+// ipAddrs returns the addresses of a header announcing IP endpoints.
+func ipAddrs(header *proxyproto.Header) (sourceAddr, destAddr *net.TCPAddr, ok bool) {
+	if header == nil || !header.Command.IsProxy() {
+		return nil, nil, false
+	}
+	sourceIP, destIP, ok := header.IPs()
+	if !ok {
+		return nil, nil, false
+	}
+	sourcePort, destPort, _ := header.Ports()
+	return &net.TCPAddr{IP: sourceIP, Port: sourcePort}, &net.TCPAddr{IP: destIP, Port: destPort}, true
+}
+
+// node formats an address as a RFC 7239 node, quoted whenever it holds
+// characters not allowed in a token, i.e. colons and brackets.
+func node(addr *net.TCPAddr) string {
+	var host string
+	if ip4 := addr.IP.To4(); ip4 != nil {
+		host = ip4.String()
+	} else {
+		host = "[" + addr.IP.String() + "]"
+	}
+	if addr.Port == 0 {
+		if strings.HasPrefix(host, "[") {
+			return strconv.Quote(host)
+		}
+		return host
+	}
+	return strconv.Quote(host + ":" + strconv.Itoa(addr.Port))
+}
+
+// FromForwarded builds a header announcing the client reported by the "for"
+// parameter of the last element of the Forwarded header values, i.e. the
+// element appended by the closest proxy, as connected to destAddr. Since
+// earlier elements can be forged by clients, the closest proxy must be
+// trusted. Clients reported without a port are announced with port 0.
+func FromForwarded(version byte, values []string, destAddr net.Addr) (*proxyproto.Header, error) {
+	elements := splitQuoted(strings.Join(values, ","), ',')
+	if len(elements) == 0 {
+		return nil, ErrNoClient
+	}
+
+	for _, pair := range splitQuoted(elements[len(elements)-1], ';') {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !strings.EqualFold(name, "for") {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		sourceAddr, err := parseNode(value)
+		if err != nil {
+			return nil, err
+		}
+		return newHeader(version, sourceAddr, destAddr)
+	}
+	return nil, ErrNoClient
+}
+
+// FromXForwardedFor builds a header announcing the client reported by the
+// last address of the X-Forwarded-For header values, i.e. the address
+// appended by the closest proxy, as connected to destAddr. Since earlier
+// addresses can be forged by clients, the closest proxy must be trusted.
+// Clients are announced with port 0, unless reported with a port.
+func FromXForwardedFor(version byte, values []string, destAddr net.Addr) (*proxyproto.Header, error) {
+	addrs := strings.Split(strings.Join(values, ","), ",")
+	last := strings.TrimSpace(addrs[len(addrs)-1])
+	if last == "" {
+		return nil, ErrNoClient
+	}
+
+	sourceAddr, err := parseNode(last)
+	if err != nil {
+		return nil, err
+	}
+	return newHeader(version, sourceAddr, destAddr)
+}
+
+// FromRequest builds a header announcing the client of a request received
+// from a trusted proxy, as reported by its Forwarded header or, failing
+// that, its X-Forwarded-For header. The destination is the local address the
+// request was received on, see http.LocalAddrContextKey.
+func FromRequest(version byte, r *http.Request) (*proxyproto.Header, error) {
+	destAddr, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if values := r.Header.Values("Forwarded"); len(values) > 0 {
+		return FromForwarded(version, values, destAddr)
+	}
+	return FromXForwardedFor(version, r.Header.Values("X-Forwarded-For"), destAddr)
+}
+
+// newHeader builds a header announcing a TCP connection from sourceAddr to
+// destAddr. Mixed address families are announced as IPv6.
+func newHeader(version byte, sourceAddr *net.TCPAddr, destAddr net.Addr) (*proxyproto.Header, error) {
+	dest, ok := destAddr.(*net.TCPAddr)
+	if !ok {
+		return nil, proxyproto.ErrInvalidAddress
+	}
+
+	header := proxyproto.HeaderProxyFromAddrs(version, sourceAddr, dest)
+	if (sourceAddr.IP.To4() == nil) != (dest.IP.To4() == nil) {
+		header.TransportProtocol = proxyproto.TCPv6
+	}
+	return header, nil
+}
+
+// parseNode parses a RFC 7239 node, or a bare IP address, into an address.
+// Obfuscated ports are reported as port 0.
+func parseNode(node string) (*net.TCPAddr, error) {
+	host, port := node, ""
+	if strings.HasPrefix(node, "[") {
+		end := strings.Index(node, "]")
+		if end < 0 {
+			return nil, proxyproto.ErrInvalidAddress
+		}
+		host = node[1:end]
+		if rest := node[end+1:]; rest != "" {
+			if !strings.HasPrefix(rest, ":") {
+				return nil, proxyproto.ErrInvalidAddress
+			}
+			port = rest[1:]
+		}
+	} else if strings.Count(node, ":") == 1 {
+		host, port, _ = strings.Cut(node, ":")
+	}
+
+	if host == "unknown" || strings.HasPrefix(host, "_") {
+		return nil, ErrNoClient
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return nil, proxyproto.ErrInvalidAddress
+	}
+
+	addr := &net.TCPAddr{IP: net.IP(ip.AsSlice())}
+	if port != "" && !strings.HasPrefix(port, "_") {
+		if addr.Port, err = strconv.Atoi(port); err != nil || addr.Port < 0 || addr.Port > 65535 {
+			return nil, proxyproto.ErrInvalidPortNumber
+		}
+	}
+	return addr, nil
+}
+
+// splitQuoted splits s around sep, ignoring the separators within quoted
+// strings. Empty parts are dropped.
+func splitQuoted(s string, sep byte) []string {
+	var (
+		parts  []string
+		start  int
+		quoted bool
+	)
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				if part := strings.TrimSpace(s[start:i]); part != "" {
+					parts = append(parts, part)
+				}
+				start = i + 1
+			}
+		}
+	}
+	if part := strings.TrimSpace(s[start:]); part != "" {
+		parts = append(parts, part)
+	}
+	return parts
+}
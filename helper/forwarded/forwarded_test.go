@@ -0,0 +1,131 @@
+package forwarded
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func TestForwardingHeaders(t *testing.T) {
+	var cases = []struct {
+		name      string
+		header    *proxyproto.Header
+		forwarded string
+		xff       string
+		xfp       string
+	}{
+		{
+			"ipv4",
+			proxyproto.HeaderProxyFromAddrs(2,
+				&net.TCPAddr{IP: net.ParseIP("192.0.2.60"), Port: 47011},
+				&net.TCPAddr{IP: net.ParseIP("198.51.100.17"), Port: 443}),
+			`for="192.0.2.60:47011";by="198.51.100.17:443"`,
+			"192.0.2.60",
+			"443",
+		},
+		{
+			"ipv6",
+			proxyproto.HeaderProxyFromAddrs(2,
+				&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 4711},
+				&net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 80}),
+			`for="[2001:db8::1]:4711";by="[2001:db8::2]:80"`,
+			"2001:db8::1",
+			"80",
+		},
+		{
+			"udp zero ports",
+			proxyproto.HeaderProxyFromAddrs(2,
+				&net.UDPAddr{IP: net.ParseIP("192.0.2.60")},
+				&net.UDPAddr{IP: net.ParseIP("2001:db8::2")}),
+			`for=192.0.2.60;by="[2001:db8::2]"`,
+			"192.0.2.60",
+			"0",
+		},
+		{"local", proxyproto.HeaderProxyFromAddrs(2, nil, nil), "", "", ""},
+		{"unix", proxyproto.HeaderProxyFromAddrs(2, &net.UnixAddr{Net: "unix", Name: "a"}, &net.UnixAddr{Net: "unix", Name: "b"}), "", "", ""},
+		{"nil", nil, "", "", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Forwarded(tc.header); got != tc.forwarded {
+				t.Fatalf("expected Forwarded %q, got %q", tc.forwarded, got)
+			}
+			if got := XForwardedFor(tc.header); got != tc.xff {
+				t.Fatalf("expected X-Forwarded-For %q, got %q", tc.xff, got)
+			}
+			if got := XForwardedPort(tc.header); got != tc.xfp {
+				t.Fatalf("expected X-Forwarded-Port %q, got %q", tc.xfp, got)
+			}
+		})
+	}
+}
+
+func TestFromForwardingHeaders(t *testing.T) {
+	dest4 := &net.TCPAddr{IP: net.ParseIP("198.51.100.17"), Port: 443}
+	dest6 := &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443}
+
+	var cases = []struct {
+		name      string
+		forwarded []string
+		xff       []string
+		destAddr  *net.TCPAddr
+		source    string
+		transport proxyproto.AddressFamilyAndProtocol
+		err       error
+	}{
+		{"forwarded ipv4", []string{`for=192.0.2.60;proto=http, for="192.0.2.61:47011";by=203.0.113.43`}, nil, dest4, "192.0.2.61:47011", proxyproto.TCPv4, nil},
+		{"forwarded ipv6", []string{`for=192.0.2.60`, `For="[2001:db8::1]:4711"`}, nil, dest6, "[2001:db8::1]:4711", proxyproto.TCPv6, nil},
+		{"forwarded mixed families", []string{`for=192.0.2.60`}, nil, dest6, "192.0.2.60:0", proxyproto.TCPv6, nil},
+		{"forwarded obfuscated port", []string{`for="192.0.2.60:_abc"`}, nil, dest4, "192.0.2.60:0", proxyproto.TCPv4, nil},
+		{"forwarded unknown", []string{`for=192.0.2.60, for=unknown`}, nil, dest4, "", 0, ErrNoClient},
+		{"forwarded obfuscated", []string{`for=_hidden`}, nil, dest4, "", 0, ErrNoClient},
+		{"forwarded without for", []string{`proto=https`}, nil, dest4, "", 0, ErrNoClient},
+		{"forwarded invalid", []string{`for="[2001:db8::1"`}, nil, dest4, "", 0, proxyproto.ErrInvalidAddress},
+		{"forwarded over xff", []string{`for=192.0.2.60`}, []string{"192.0.2.99"}, dest4, "192.0.2.60:0", proxyproto.TCPv4, nil},
+		{"xff", nil, []string{"10.0.0.1, 192.0.2.60"}, dest4, "192.0.2.60:0", proxyproto.TCPv4, nil},
+		{"xff multiple values", nil, []string{"10.0.0.1", "2001:db8::1"}, dest6, "[2001:db8::1]:0", proxyproto.TCPv6, nil},
+		{"xff invalid", nil, []string{"example.com"}, dest4, "", 0, proxyproto.ErrInvalidAddress},
+		{"none", nil, nil, dest4, "", 0, ErrNoClient},
+		{"no destination", []string{`for=192.0.2.60`}, nil, nil, "", 0, proxyproto.ErrInvalidAddress},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for _, value := range tc.forwarded {
+				r.Header.Add("Forwarded", value)
+			}
+			for _, value := range tc.xff {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tc.destAddr != nil {
+				r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, tc.destAddr))
+			}
+
+			header, err := FromRequest(2, r)
+			if err != tc.err {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if header.TransportProtocol != tc.transport {
+				t.Fatalf("expected transport %v, got %v", tc.transport, header.TransportProtocol)
+			}
+			if header.SourceAddr.String() != tc.source {
+				t.Fatalf("expected source %v, got %v", tc.source, header.SourceAddr)
+			}
+			if header.DestinationAddr != tc.destAddr {
+				t.Fatalf("expected destination %v, got %v", tc.destAddr, header.DestinationAddr)
+			}
+			if _, err := header.Format(); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+		})
+	}
+}
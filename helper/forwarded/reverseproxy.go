@@ -0,0 +1,68 @@
+package forwarded
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httputil"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// connContextKey is the context key of the proxyproto connection of a
+// request.
+type connContextKey struct{}
+
+// ConnContext stores the proxyproto connection into the context of its
+// requests, when set as http.Server.ConnContext. Connections wrapped into a
+// tls.Conn, or other wrappers, are supported, see proxyproto.AsConn. It
+// doesn't wait for the header, as http.Server calls it from its accept loop;
+// FromContext reads it instead, from the goroutine serving the connection.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	conn, ok := proxyproto.AsConn(c)
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, connContextKey{}, conn)
+}
+
+// FromContext returns the PROXY header of the connection stored by
+// ConnContext, if any. It blocks until the header is read, or the read
+// header timeout expires, which has usually happened by the time a request
+// is served.
+func FromContext(ctx context.Context) *proxyproto.Header {
+	conn, ok := ctx.Value(connContextKey{}).(*proxyproto.Conn)
+	if !ok {
+		return nil
+	}
+	return conn.ProxyHeader()
+}
+
+// SetHeaders sets the X-Forwarded-For, X-Forwarded-Port and Forwarded
+// headers announcing the client of a PROXY header. The headers are left
+// untouched if the PROXY header carries no IP addresses.
+func SetHeaders(h http.Header, header *proxyproto.Header) {
+	forwarded := Forwarded(header)
+	if forwarded == "" {
+		return
+	}
+	h.Set("Forwarded", forwarded)
+	h.Set("X-Forwarded-For", XForwardedFor(header))
+	h.Set("X-Forwarded-Port", XForwardedPort(header))
+}
+
+// Rewrite sets the forwarding headers of a request proxied by a
+// httputil.ReverseProxy. It sets X-Forwarded-For, X-Forwarded-Host and
+// X-Forwarded-Proto as httputil.ProxyRequest.SetXForwarded does, then
+// overrides them with the client announced by the PROXY header of the
+// inbound connection, see ConnContext and SetHeaders:
+//
+//	srv := &http.Server{ConnContext: forwarded.ConnContext}
+//	rp := &httputil.ReverseProxy{Rewrite: func(pr *httputil.ProxyRequest) {
+//		pr.SetURL(target)
+//		forwarded.Rewrite(pr)
+//	}}
+func Rewrite(pr *httputil.ProxyRequest) {
+	pr.SetXForwarded()
+	SetHeaders(pr.Out.Header, FromContext(pr.In.Context()))
+}
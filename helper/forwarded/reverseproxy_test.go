@@ -0,0 +1,122 @@
+package forwarded
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func TestRewrite(t *testing.T) {
+	received := make(chan http.Header, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+	}))
+	defer backend.Close()
+
+	target, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pl := &proxyproto.Listener{Listener: l}
+
+	srv := &http.Server{
+		ConnContext: ConnContext,
+		Handler: &httputil.ReverseProxy{Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			Rewrite(pr)
+		}},
+	}
+	go func() {
+		_ = srv.Serve(pl)
+	}()
+	defer srv.Close()
+
+	d := &proxyproto.Dialer{Header: proxyproto.HeaderProxyFromAddrs(2,
+		&net.TCPAddr{IP: net.ParseIP("10.1.1.1"), Port: 1000},
+		&net.TCPAddr{IP: net.ParseIP("20.2.2.2"), Port: 2000})}
+	conn, err := d.DialContext(context.Background(), "tcp", pl.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req.Header.Set("X-Forwarded-For", "192.0.2.1")
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	resp.Body.Close()
+
+	h := <-received
+	for name, want := range map[string]string{
+		"X-Forwarded-For":   "10.1.1.1",
+		"X-Forwarded-Port":  "2000",
+		"X-Forwarded-Host":  "example.com",
+		"X-Forwarded-Proto": "http",
+		"Forwarded":         `for="10.1.1.1:1000";by="20.2.2.2:2000"`,
+	} {
+		if got := h.Get(name); got != want {
+			t.Fatalf("expected %s %q, got %q", name, want, got)
+		}
+	}
+}
+
+func TestConnContextWithoutHeader(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	ctx := ConnContext(context.Background(), server)
+	if header := FromContext(ctx); header != nil {
+		t.Fatalf("expected no header, got %v", header)
+	}
+}
+
+func TestConnContextDoesNotWait(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	// A client sending nothing doesn't hold the accept loop.
+	conn := proxyproto.NewConn(server)
+	done := make(chan context.Context, 1)
+	go func() {
+		done <- ConnContext(context.Background(), conn)
+	}()
+	var ctx context.Context
+	select {
+	case ctx = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected ConnContext not to wait for the header")
+	}
+
+	header := proxyproto.HeaderProxyFromAddrs(2,
+		&net.TCPAddr{IP: net.ParseIP("10.1.1.1"), Port: 1000},
+		&net.TCPAddr{IP: net.ParseIP("20.2.2.2"), Port: 2000})
+	go func() {
+		_, _ = header.WriteTo(client)
+	}()
+	if got := FromContext(ctx); got == nil || got.SourceAddr.String() != "10.1.1.1:1000" {
+		t.Fatalf("expected the header, got %v", got)
+	}
+}
@@ -0,0 +1,311 @@
+// Package kubernetes provides a trusted proxy policy whose ranges are
+// discovered from a Kubernetes cluster, e.g. the pod CIDRs of the nodes or
+// the endpoints of the Service of an ingress tier, so that in-cluster
+// servers don't hardcode CIDRs.
+//
+// The API server is queried with the standard library rather than
+// client-go, so that depending on the proxyproto module doesn't pull in the
+// dependencies of client-go. Only the few read-only requests needed are
+// made, authenticated with the token of the service account of the pod.
+// This departs from client-go in ways worth knowing:
+//
+//   - kubeconfig files, and the exec and auth provider plugins they may
+//     configure, are not supported. Outside of a cluster, a Client is set up
+//     by hand with the URL of the API server and a bearer token file.
+//   - Resources are listed again every refresh interval rather than
+//     watched, so changes are picked up within an interval, at the cost of
+//     a few requests per interval.
+//
+// Applications already depending on client-go can still use TrustedRanges
+// by writing a Source reading from their informers.
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// serviceAccountDir is where the credentials of the service account of a pod
+// are mounted.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// ErrNotInCluster is returned by InClusterClient outside of a pod.
+var ErrNotInCluster = errors.New("kubernetes: not running in a cluster")
+
+// Client queries the Kubernetes API server.
+type Client struct {
+	// BaseURL is the URL of the API server, e.g. https://10.96.0.1:443.
+	BaseURL string
+	// HTTPClient sends the requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+	// TokenFile, if set, is the file holding the bearer token of the
+	// requests. It is read on each request, as tokens are rotated.
+	TokenFile string
+}
+
+// InClusterClient returns a Client authenticated as the service account of
+// the pod it runs in, as configured by Kubernetes. The service account needs
+// the permissions to list the resources of the sources used, e.g. nodes.
+func InClusterClient() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, ErrNotInCluster
+	}
+
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("kubernetes: invalid service account CA certificate")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &Client{
+		BaseURL:    "https://" + net.JoinHostPort(host, port),
+		HTTPClient: &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		TokenFile:  serviceAccountDir + "/token",
+	}, nil
+}
+
+// get decodes the JSON resource at the API path into v.
+func (c *Client) get(ctx context.Context, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.BaseURL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.TokenFile != "" {
+		token, err := os.ReadFile(c.TokenFile)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kubernetes: GET %s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Source discovers trusted ranges from the cluster.
+type Source func(ctx context.Context, c *Client) ([]netip.Prefix, error)
+
+// NodePodCIDRs discovers the pod CIDRs of the nodes of the cluster, for
+// servers fronted by proxies running as pods.
+func NodePodCIDRs() Source {
+	return func(ctx context.Context, c *Client) ([]netip.Prefix, error) {
+		var nodes struct {
+			Items []struct {
+				Spec struct {
+					PodCIDR  string   `json:"podCIDR"`
+					PodCIDRs []string `json:"podCIDRs"`
+				} `json:"spec"`
+			} `json:"items"`
+		}
+		if err := c.get(ctx, "/api/v1/nodes", &nodes); err != nil {
+			return nil, err
+		}
+
+		var prefixes []netip.Prefix
+		for _, node := range nodes.Items {
+			cidrs := node.Spec.PodCIDRs
+			if len(cidrs) == 0 && node.Spec.PodCIDR != "" {
+				cidrs = []string{node.Spec.PodCIDR}
+			}
+			for _, cidr := range cidrs {
+				prefix, err := netip.ParsePrefix(cidr)
+				if err != nil {
+					return nil, fmt.Errorf("kubernetes: invalid pod CIDR %q: %w", cidr, err)
+				}
+				prefixes = append(prefixes, prefix)
+			}
+		}
+		return prefixes, nil
+	}
+}
+
+// ServiceEndpoints discovers the addresses of the endpoints of a Service,
+// e.g. the pods of an ingress tier, from its EndpointSlices.
+func ServiceEndpoints(namespace, name string) Source {
+	return func(ctx context.Context, c *Client) ([]netip.Prefix, error) {
+		var slices struct {
+			Items []struct {
+				Endpoints []struct {
+					Addresses []string `json:"addresses"`
+				} `json:"endpoints"`
+			} `json:"items"`
+		}
+		path := "/apis/discovery.k8s.io/v1/namespaces/" + url.PathEscape(namespace) +
+			"/endpointslices?labelSelector=" + url.QueryEscape("kubernetes.io/service-name="+name)
+		if err := c.get(ctx, path, &slices); err != nil {
+			return nil, err
+		}
+
+		var prefixes []netip.Prefix
+		for _, slice := range slices.Items {
+			for _, endpoint := range slice.Endpoints {
+				for _, address := range endpoint.Addresses {
+					addr, err := netip.ParseAddr(address)
+					if err != nil {
+						// FQDN endpoints don't designate proxies.
+						continue
+					}
+					prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+				}
+			}
+		}
+		return prefixes, nil
+	}
+}
+
+// ConfigMap discovers the ranges listed under the key of a ConfigMap, as
+// CIDRs or IP addresses separated by commas or whitespace.
+func ConfigMap(namespace, name, key string) Source {
+	return func(ctx context.Context, c *Client) ([]netip.Prefix, error) {
+		var configMap struct {
+			Data map[string]string `json:"data"`
+		}
+		path := "/api/v1/namespaces/" + url.PathEscape(namespace) + "/configmaps/" + url.PathEscape(name)
+		if err := c.get(ctx, path, &configMap); err != nil {
+			return nil, err
+		}
+
+		var prefixes []netip.Prefix
+		fields := strings.FieldsFunc(configMap.Data[key], func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+		})
+		for _, field := range fields {
+			prefix, err := parsePrefix(field)
+			if err != nil {
+				return nil, fmt.Errorf("kubernetes: invalid range %q in ConfigMap %s/%s: %w", field, namespace, name, err)
+			}
+			prefixes = append(prefixes, prefix)
+		}
+		return prefixes, nil
+	}
+}
+
+// parsePrefix parses a CIDR, or an IP address as a single address range.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		return netip.ParsePrefix(s)
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// TrustedRanges is a trusted proxy list discovered from the cluster and
+// refreshed on an interval. Its Policy method can be used as a
+// proxyproto.PolicyFunc.
+//
+// A refresh is all or nothing: if any source fails, the ranges of all the
+// sources stay as previously discovered.
+type TrustedRanges struct {
+	client  *Client
+	sources []Source
+	def     proxyproto.Policy
+
+	ranges    atomic.Pointer[[]netip.Prefix]
+	refresher *proxyproto.Refresher
+}
+
+// NewTrustedRanges discovers the ranges of the sources and returns a
+// TrustedRanges which discovers them again every refresh interval. Upstream
+// addresses within one of the ranges are allowed to send a proxy header, for
+// others the def policy is returned. A refresh interval <= 0 disables
+// refreshing, see proxyproto.NewRefresher.
+//
+// An error is returned if the ranges can't be discovered initially. Close
+// must be called to stop refreshing once the list is no longer used.
+func NewTrustedRanges(ctx context.Context, client *Client, refresh time.Duration, def proxyproto.Policy, sources ...Source) (*TrustedRanges, error) {
+	t := &TrustedRanges{
+		client:  client,
+		sources: sources,
+		def:     def,
+	}
+	if err := t.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	t.refresher = proxyproto.NewRefresher(refresh, t.Refresh)
+	return t, nil
+}
+
+// Ranges returns the ranges currently trusted.
+func (t *TrustedRanges) Ranges() []netip.Prefix {
+	return *t.ranges.Load()
+}
+
+// Policy implements proxyproto.PolicyFunc.
+func (t *TrustedRanges) Policy(upstream net.Addr) (proxyproto.Policy, error) {
+	ip, err := proxyproto.IPFromAddr(upstream)
+	if err != nil {
+		// something is wrong with the source IP, better reject the connection
+		return proxyproto.REJECT, err
+	}
+	addr, _ := netip.AddrFromSlice(ip)
+	addr = addr.Unmap()
+
+	for _, prefix := range t.Ranges() {
+		if prefix.Contains(addr) {
+			return proxyproto.USE, nil
+		}
+	}
+	return t.def, nil
+}
+
+// Refresh discovers the ranges again. It is called periodically when a
+// refresh interval is set, but may also be called manually. If a source
+// fails, the ranges are left unchanged and the error is returned.
+func (t *TrustedRanges) Refresh(ctx context.Context) error {
+	var ranges []netip.Prefix
+	for _, source := range t.sources {
+		prefixes, err := source(ctx, t.client)
+		if err != nil {
+			return err
+		}
+		ranges = append(ranges, prefixes...)
+	}
+	t.ranges.Store(&ranges)
+	return nil
+}
+
+// OnRefreshError sets the hook called with the errors of the periodic
+// refreshes, see proxyproto.Refresher.OnError.
+func (t *TrustedRanges) OnRefreshError(f func(err error)) {
+	t.refresher.OnError(f)
+}
+
+// Close stops refreshing the ranges.
+func (t *TrustedRanges) Close() error {
+	return t.refresher.Close()
+}
@@ -0,0 +1,143 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func TestTrustedRanges(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0o600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	configMap := `{"data": {"proxies": "192.0.2.0/24, 2001:db8::1"}}`
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/nodes", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"items": [
+			{"spec": {"podCIDR": "10.244.0.0/24", "podCIDRs": ["10.244.0.0/24", "fd00:10:244::/64"]}},
+			{"spec": {"podCIDR": "10.244.1.0/24"}}
+		]}`))
+	})
+	mux.HandleFunc("/apis/discovery.k8s.io/v1/namespaces/ingress/endpointslices", func(w http.ResponseWriter, r *http.Request) {
+		if selector := r.URL.Query().Get("labelSelector"); selector != "kubernetes.io/service-name=edge" {
+			t.Errorf("unexpected label selector %q", selector)
+		}
+		_, _ = w.Write([]byte(`{"items": [{"endpoints": [{"addresses": ["172.16.0.5"]}, {"addresses": ["edge.example.com"]}]}]}`))
+	})
+	mux.HandleFunc("/api/v1/namespaces/ingress/configmaps/trusted", func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer secret" {
+			t.Errorf("unexpected authorization %q", auth)
+		}
+		_, _ = w.Write([]byte(configMap))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &Client{BaseURL: server.URL, TokenFile: tokenFile}
+	ranges, err := NewTrustedRanges(context.Background(), client, 0, proxyproto.REJECT,
+		NodePodCIDRs(),
+		ServiceEndpoints("ingress", "edge"),
+		ConfigMap("ingress", "trusted", "proxies"),
+	)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer ranges.Close()
+
+	var cases = []struct {
+		ip     string
+		policy proxyproto.Policy
+	}{
+		{"10.244.0.7", proxyproto.USE},
+		{"10.244.1.7", proxyproto.USE},
+		{"fd00:10:244::7", proxyproto.USE},
+		{"172.16.0.5", proxyproto.USE},
+		{"::ffff:172.16.0.5", proxyproto.USE},
+		{"192.0.2.9", proxyproto.USE},
+		{"2001:db8::1", proxyproto.USE},
+		{"172.16.0.6", proxyproto.REJECT},
+		{"2001:db8::2", proxyproto.REJECT},
+	}
+	for _, tc := range cases {
+		policy, err := ranges.Policy(&net.TCPAddr{IP: net.ParseIP(tc.ip), Port: 1000})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if policy != tc.policy {
+			t.Errorf("%s: expected policy %v, got %v", tc.ip, tc.policy, policy)
+		}
+	}
+
+	// A failed refresh keeps the ranges discovered previously.
+	configMap = `{"data": {"proxies": "not a range"}}`
+	if err := ranges.Refresh(context.Background()); err == nil {
+		t.Fatal("expected the refresh to fail")
+	}
+	if policy, _ := ranges.Policy(&net.TCPAddr{IP: net.ParseIP("192.0.2.9"), Port: 1000}); policy != proxyproto.USE {
+		t.Fatalf("expected the previous ranges to be kept, got policy %v", policy)
+	}
+}
+
+func TestTrustedRangesRefreshError(t *testing.T) {
+	var stalled atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/namespaces/ingress/configmaps/trusted", func(w http.ResponseWriter, r *http.Request) {
+		if stalled.Load() {
+			<-r.Context().Done()
+			return
+		}
+		_, _ = w.Write([]byte(`{"data": {"proxies": "192.0.2.0/24"}}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// The default HTTP client has no timeout, the refreshes must be bounded
+	// nonetheless.
+	client := &Client{BaseURL: server.URL}
+	ranges, err := NewTrustedRanges(context.Background(), client, 20*time.Millisecond, proxyproto.REJECT,
+		ConfigMap("ingress", "trusted", "proxies"),
+	)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer ranges.Close()
+
+	errs := make(chan error, 1)
+	ranges.OnRefreshError(func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+	stalled.Store(true)
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the stalled refresh to fail")
+	}
+	if policy, _ := ranges.Policy(&net.TCPAddr{IP: net.ParseIP("192.0.2.9"), Port: 1000}); policy != proxyproto.USE {
+		t.Fatalf("expected the previous ranges to be kept, got policy %v", policy)
+	}
+}
+
+func TestInClusterClientOutsideCluster(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	if _, err := InClusterClient(); err != ErrNotInCluster {
+		t.Fatalf("expected %v, got %v", ErrNotInCluster, err)
+	}
+}
@@ -0,0 +1,226 @@
+// Package xclient converts PROXY headers to and from the attributes of the
+// SMTP XCLIENT command, as supported by Postfix, so mail gateways can
+// translate between the PROXY protocol and SMTP-level client attribution.
+package xclient
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pires/go-proxyproto"
+)
+
+var (
+	// ErrNoClient is returned when the attributes don't announce the address
+	// of a client, e.g. when it's missing or unavailable, or when a header
+	// carries no IP addresses.
+	ErrNoClient = errors.New("xclient: no client address")
+	// ErrMalformedCommand is returned when parsing a line which isn't a
+	// well-formed XCLIENT command.
+	ErrMalformedCommand = errors.New("xclient: malformed command")
+)
+
+// The XCLIENT attributes mapped to and from headers. PROTO isn't carried by
+// headers: it's the SMTP protocol spoken by the client, SMTP or ESMTP.
+const (
+	Addr     = "ADDR"
+	Port     = "PORT"
+	DestAddr = "DESTADDR"
+	DestPort = "DESTPORT"
+	Proto    = "PROTO"
+)
+
+// The values of attributes whose information is unavailable, permanently or
+// temporarily.
+const (
+	Unavailable     = "[UNAVAILABLE]"
+	TempUnavailable = "[TEMPUNAVAIL]"
+)
+
+// order is the order in which the known attributes are written, the others
+// following in lexical order.
+var order = []string{Addr, Port, Proto, DestAddr, DestPort}
+
+// Attributes are the attributes of an XCLIENT command, by upper case name,
+// with their values decoded.
+type Attributes map[string]string
+
+// FromHeader returns the ADDR, PORT, DESTADDR and DESTPORT attributes
+// announcing the source and destination of the header. ErrNoClient is
+// returned if the header carries no IP addresses, e.g. for LOCAL headers.
+// The PROTO attribute, which headers don't carry, is to be set by the
+// caller.
+func FromHeader(header *proxyproto.Header) (Attributes, error) {
+	if header == nil || !header.Command.IsProxy() {
+		return nil, ErrNoClient
+	}
+	sourceIP, destIP, ok := header.IPs()
+	if !ok {
+		return nil, ErrNoClient
+	}
+	sourcePort, destPort, _ := header.Ports()
+	return Attributes{
+		Addr:     formatAddr(sourceIP),
+		Port:     strconv.Itoa(sourcePort),
+		DestAddr: formatAddr(destIP),
+		DestPort: strconv.Itoa(destPort),
+	}, nil
+}
+
+// Header builds a header announcing the client of the ADDR and PORT
+// attributes, as connected to the DESTADDR and DESTPORT ones or, failing
+// those, to destAddr. Clients announced without a port are announced with
+// port 0. ErrNoClient is returned if ADDR is missing or unavailable.
+func (a Attributes) Header(version byte, destAddr net.Addr) (*proxyproto.Header, error) {
+	sourceAddr, err := a.tcpAddr(Addr, Port)
+	if err != nil {
+		return nil, err
+	}
+	dest, ok := destAddr.(*net.TCPAddr)
+	if _, found := a[DestAddr]; found {
+		if dest, err = a.tcpAddr(DestAddr, DestPort); err != nil {
+			return nil, err
+		}
+	} else if !ok {
+		return nil, proxyproto.ErrInvalidAddress
+	}
+
+	header := proxyproto.HeaderProxyFromAddrs(version, sourceAddr, dest)
+	if (sourceAddr.IP.To4() == nil) != (dest.IP.To4() == nil) {
+		header.TransportProtocol = proxyproto.TCPv6
+	}
+	return header, nil
+}
+
+// tcpAddr parses the address and port attributes of the given names.
+func (a Attributes) tcpAddr(addrName, portName string) (*net.TCPAddr, error) {
+	value, ok := a[addrName]
+	if !ok || value == Unavailable || value == TempUnavailable {
+		return nil, ErrNoClient
+	}
+	// IPv6 addresses are prefixed, as in SMTP address literals.
+	if len(value) > 5 && strings.EqualFold(value[:5], "IPV6:") {
+		value = value[5:]
+	}
+	ip, err := netip.ParseAddr(value)
+	if err != nil {
+		return nil, proxyproto.ErrInvalidAddress
+	}
+
+	addr := &net.TCPAddr{IP: net.IP(ip.AsSlice())}
+	if port, ok := a[portName]; ok && port != Unavailable && port != TempUnavailable {
+		if addr.Port, err = strconv.Atoi(port); err != nil || addr.Port < 0 || addr.Port > 65535 {
+			return nil, proxyproto.ErrInvalidPortNumber
+		}
+	}
+	return addr, nil
+}
+
+// Command returns the XCLIENT command line sending the attributes, without
+// the trailing CRLF, e.g. "XCLIENT ADDR=192.0.2.60 PORT=47011 PROTO=ESMTP".
+// Values are xtext encoded.
+func (a Attributes) Command() string {
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(x, y string) int {
+		i, j := slices.Index(order, x), slices.Index(order, y)
+		switch {
+		case i >= 0 && j >= 0:
+			return i - j
+		case i >= 0:
+			return -1
+		case j >= 0:
+			return 1
+		}
+		return strings.Compare(x, y)
+	})
+
+	var b strings.Builder
+	b.WriteString("XCLIENT")
+	for _, name := range names {
+		b.WriteByte(' ')
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(encodeXtext(a[name]))
+	}
+	return b.String()
+}
+
+// ParseCommand parses an XCLIENT command line, with or without its trailing
+// CRLF, into its attributes. Attribute names are upper cased.
+func ParseCommand(line string) (Attributes, error) {
+	fields := strings.Fields(strings.TrimSuffix(line, "\r\n"))
+	if len(fields) < 2 || !strings.EqualFold(fields[0], "XCLIENT") {
+		return nil, ErrMalformedCommand
+	}
+
+	a := make(Attributes, len(fields)-1)
+	for _, field := range fields[1:] {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok || name == "" {
+			return nil, ErrMalformedCommand
+		}
+		decoded, err := decodeXtext(value)
+		if err != nil {
+			return nil, err
+		}
+		a[strings.ToUpper(name)] = decoded
+	}
+	return a, nil
+}
+
+// formatAddr formats an IP address as an XCLIENT address, IPv6 addresses
+// being prefixed.
+func formatAddr(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String()
+	}
+	return "IPV6:" + ip.String()
+}
+
+// encodeXtext encodes a value as RFC 3461 xtext.
+func encodeXtext(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < '!' || c > '~' || c == '+' || c == '=' {
+			b.WriteByte('+')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0xf])
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// decodeXtext decodes a RFC 3461 xtext value.
+func decodeXtext(s string) (string, error) {
+	if !strings.Contains(s, "+") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '+' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", ErrMalformedCommand
+		}
+		c, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", ErrMalformedCommand
+		}
+		b.WriteByte(byte(c))
+		i += 2
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,115 @@
+package xclient
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func TestFromHeader(t *testing.T) {
+	var cases = []struct {
+		name    string
+		header  *proxyproto.Header
+		command string
+	}{
+		{
+			"ipv4",
+			proxyproto.HeaderProxyFromAddrs(2,
+				&net.TCPAddr{IP: net.ParseIP("192.0.2.60"), Port: 47011},
+				&net.TCPAddr{IP: net.ParseIP("198.51.100.17"), Port: 25}),
+			"XCLIENT ADDR=192.0.2.60 PORT=47011 PROTO=ESMTP DESTADDR=198.51.100.17 DESTPORT=25",
+		},
+		{
+			"ipv6",
+			proxyproto.HeaderProxyFromAddrs(1,
+				&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 4711},
+				&net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 587}),
+			"XCLIENT ADDR=IPV6:2001:db8::1 PORT=4711 PROTO=ESMTP DESTADDR=IPV6:2001:db8::2 DESTPORT=587",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			attrs, err := FromHeader(tc.header)
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			attrs[Proto] = "ESMTP"
+			if got := attrs.Command(); got != tc.command {
+				t.Fatalf("expected %q, got %q", tc.command, got)
+			}
+
+			parsed, err := ParseCommand(tc.command + "\r\n")
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			header, err := parsed.Header(tc.header.Version, nil)
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if !header.EqualsTo(tc.header) {
+				t.Fatalf("expected %v, got %v", tc.header, header)
+			}
+		})
+	}
+
+	if _, err := FromHeader(proxyproto.HeaderProxyFromAddrs(2, nil, nil)); !errors.Is(err, ErrNoClient) {
+		t.Fatalf("expected %v, got %v", ErrNoClient, err)
+	}
+}
+
+func TestAttributesHeader(t *testing.T) {
+	destAddr := &net.TCPAddr{IP: net.ParseIP("198.51.100.17"), Port: 25}
+
+	attrs, err := ParseCommand("xclient addr=192.0.2.60 name=mail+2Eexample.com")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if attrs["NAME"] != "mail.example.com" {
+		t.Fatalf("unexpected NAME %q", attrs["NAME"])
+	}
+	header, err := attrs.Header(2, destAddr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := proxyproto.HeaderProxyFromAddrs(2, &net.TCPAddr{IP: net.ParseIP("192.0.2.60")}, destAddr)
+	if !header.EqualsTo(expected) {
+		t.Fatalf("expected %v, got %v", expected, header)
+	}
+
+	for _, line := range []string{"XCLIENT ADDR=[UNAVAILABLE]", "XCLIENT NAME=mail"} {
+		attrs, err := ParseCommand(line)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if _, err := attrs.Header(2, destAddr); !errors.Is(err, ErrNoClient) {
+			t.Fatalf("%s: expected %v, got %v", line, ErrNoClient, err)
+		}
+	}
+
+	attrs, _ = ParseCommand("XCLIENT ADDR=192.0.2.60 PORT=70000")
+	if _, err := attrs.Header(2, destAddr); !errors.Is(err, proxyproto.ErrInvalidPortNumber) {
+		t.Fatalf("expected %v, got %v", proxyproto.ErrInvalidPortNumber, err)
+	}
+}
+
+func TestParseCommandMalformed(t *testing.T) {
+	for _, line := range []string{"", "XCLIENT", "HELO example.com", "XCLIENT ADDR", "XCLIENT NAME=a+4"} {
+		if _, err := ParseCommand(line); !errors.Is(err, ErrMalformedCommand) {
+			t.Fatalf("%q: expected %v, got %v", line, ErrMalformedCommand, err)
+		}
+	}
+}
+
+func TestXtextRoundTrip(t *testing.T) {
+	value := "a b=c+d\x01"
+	decoded, err := decodeXtext(encodeXtext(value))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if decoded != value {
+		t.Fatalf("expected %q, got %q", value, decoded)
+	}
+}
@@ -0,0 +1,60 @@
+package proxyproto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// The HMAC errors are the signature ones, since SignHeader and
+// WithHeaderHMAC sign and verify headers with an HMACKey.
+var (
+	ErrHeaderHMACVersion = ErrHeaderSignatureVersion
+	ErrMissingHeaderHMAC = ErrMissingHeaderSignature
+	ErrInvalidHeaderHMAC = ErrInvalidHeaderSignature
+)
+
+// SignHeader returns a copy of the version 2 header authenticated with the
+// shared key. It is SignHeaderWith with an HMACKey without ID.
+func SignHeader(header *Header, key []byte) (*Header, error) {
+	return SignHeaderWith(header, HMACKey{Key: key})
+}
+
+// VerifyHeaderHMAC checks the PP2_TYPE_SIGNATURE TLV of the header against
+// the shared key, see SignHeader. Unlike VerifyHeaderSignature, the key ID
+// the TLV names is ignored.
+func VerifyHeaderHMAC(header *Header, key []byte) error {
+	return verifyHeaderSignature(header, func(_ string, message, signature []byte) error {
+		return HMACKey{Key: key}.Verify(message, signature)
+	})
+}
+
+// WithHeaderHMAC makes the connection verify the PP2_TYPE_SIGNATURE TLV of
+// the received header with the shared key before trusting its addresses,
+// when passed as option to NewConn(). Headers lacking a valid HMAC fail the
+// connection with ErrMissingHeaderHMAC or ErrInvalidHeaderHMAC. This gives
+// spoofing protection on networks where trusting upstream CIDRs isn't enough.
+// The raw header bytes are retained for the verification, see Header.Raw.
+func WithHeaderHMAC(key []byte) func(*Conn) {
+	return func(c *Conn) {
+		c.hmacKey = key
+		c.parseOptions.retainRaw = true
+	}
+}
+
+// headerHMAC returns the HMAC-SHA256 of the formatted header.
+func headerHMAC(buf, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(buf)
+	return mac.Sum(nil)
+}
+
+// tlvEnd returns the offset past the TLV starting at offset i of raw, and
+// whether the TLV is complete.
+func tlvEnd(raw []byte, i int) (int, bool) {
+	if len(raw)-i < 3 {
+		return 0, false
+	}
+	end := i + 3 + int(binary.BigEndian.Uint16(raw[i+1:i+3]))
+	return end, end <= len(raw)
+}
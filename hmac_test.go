@@ -0,0 +1,164 @@
+package proxyproto
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestSignHeader(t *testing.T) {
+	key := []byte("shared secret")
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr:        v4addr,
+		DestinationAddr:   v4addr,
+	}
+	if err := header.SetTLVs([]TLV{{Type: PP2_TYPE_UNIQUE_ID, Value: []byte("id")}}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	signed, err := SignHeader(header, key)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := VerifyHeaderHMAC(signed, key); err != nil {
+		t.Fatalf("expected a valid HMAC, got %v", err)
+	}
+	if err := VerifyHeaderHMAC(header, key); err != ErrMissingHeaderHMAC {
+		t.Fatalf("expected %v, got %v", ErrMissingHeaderHMAC, err)
+	}
+	if err := VerifyHeaderHMAC(signed, []byte("other secret")); err != ErrInvalidHeaderHMAC {
+		t.Fatalf("expected %v, got %v", ErrInvalidHeaderHMAC, err)
+	}
+
+	// Signing again replaces the HMAC rather than adding one.
+	resigned, err := SignHeader(signed, key)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.Equal(resigned.rawTLVs, signed.rawTLVs) {
+		t.Fatalf("expected the HMAC to be replaced, got TLVs %x", resigned.rawTLVs)
+	}
+
+	// Tampering with the addresses of the received header is detected.
+	raw, err := signed.Format()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	raw[16] ^= 1
+	tampered, err := read(newBufioReader(raw), parseOptions{retainRaw: true})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := VerifyHeaderHMAC(tampered, key); err != ErrInvalidHeaderHMAC {
+		t.Fatalf("expected %v, got %v", ErrInvalidHeaderHMAC, err)
+	}
+
+	// The HMAC is a signature made with an HMACKey without ID.
+	if err := VerifyHeaderSignature(signed, NewKeyring(HMACKey{Key: key})); err != nil {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+
+	if _, err := SignHeader(&Header{Version: 1, Command: PROXY, TransportProtocol: TCPv4, SourceAddr: v4addr, DestinationAddr: v4addr}, key); err != ErrHeaderHMACVersion {
+		t.Fatalf("expected %v, got %v", ErrHeaderHMACVersion, err)
+	}
+}
+
+func TestConnWithHeaderHMAC(t *testing.T) {
+	key := []byte("shared secret")
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr:        v4addr,
+		DestinationAddr:   v4addr,
+	}
+	signed, err := SignHeader(header, key)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var cases = []struct {
+		name   string
+		header *Header
+		err    error
+	}{
+		{"signed", signed, nil},
+		{"unsigned", header, ErrMissingHeaderHMAC},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+
+			go func() {
+				_, _ = WriteHeaderAndPayload(client, tc.header, []byte("ping"))
+			}()
+
+			conn := NewConn(server, WithHeaderHMAC(key))
+			recv := make([]byte, 4)
+			_, err := io.ReadFull(conn, recv)
+			if err != tc.err {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if err == nil && conn.RemoteAddr().String() != v4addr.String() {
+				t.Fatalf("expected remote address %v, got %v", v4addr, conn.RemoteAddr())
+			}
+		})
+	}
+}
+
+func TestConfigHeaderHMAC(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	config := &Config{HeaderHMACKey: []byte("shared secret")}
+	pl := &Listener{Listener: l, Config: config}
+	defer pl.Close()
+
+	cliResult := make(chan error)
+	go func() {
+		d := &Dialer{Config: config}
+		conn, err := d.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			cliResult <- err
+			return
+		}
+		defer conn.Close()
+
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			cliResult <- err
+			return
+		}
+		close(cliResult)
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	recv := make([]byte, 4)
+	if _, err := io.ReadFull(conn, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := <-cliResult; err != nil {
+		t.Fatalf("client error: %v", err)
+	}
+
+	tlvs, err := conn.(*Conn).ProxyHeader().TLVs()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(tlvs) != 1 || tlvs[0].Type != PP2_TYPE_SIGNATURE {
+		t.Fatalf("expected an HMAC TLV, got %v", tlvs)
+	}
+}
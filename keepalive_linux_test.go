@@ -0,0 +1,44 @@
+package proxyproto
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// checkKeepAlive makes sure the keep-alive setting of the socket matches
+// the KeepAlive setting of a Listener.
+func checkKeepAlive(t *testing.T, conn *net.TCPConn, keepAlive time.Duration) {
+	t.Helper()
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var enabled, idle int
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		if enabled, sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_KEEPALIVE); sockErr != nil {
+			return
+		}
+		idle, sockErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE)
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if sockErr != nil {
+		t.Fatalf("err: %v", sockErr)
+	}
+
+	if keepAlive < 0 {
+		if enabled != 0 {
+			t.Fatal("expected keep-alive to be disabled")
+		}
+		return
+	}
+	if enabled == 0 {
+		t.Fatal("expected keep-alive to be enabled")
+	}
+	if time.Duration(idle)*time.Second != keepAlive {
+		t.Fatalf("expected a keep-alive period of %v, got %ds", keepAlive, idle)
+	}
+}
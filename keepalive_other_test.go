@@ -0,0 +1,13 @@
+//go:build !linux
+
+package proxyproto
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// checkKeepAlive is a no-op where the keep-alive settings of sockets can't
+// be read back portably.
+func checkKeepAlive(t *testing.T, conn *net.TCPConn, keepAlive time.Duration) {}
@@ -0,0 +1,161 @@
+package proxyproto
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// LazyTLVs makes the connection leave the TLV block of version 2 headers
+// unread when it's larger than threshold bytes, when passed as option to
+// NewConn(). The addresses of the header are available right away, while
+// the TLVs are streamed off the connection on request, see NextDeferredTLV
+// and SeekDeferredTLV, so that large TLVs, e.g. client certificates, are
+// neither buffered nor bounded by the buffer the header is read through. The
+// TLVs not requested by the time the payload is read are skipped.
+//
+// Header.TLVs and the accessors of the TLVs of a header whose block was
+// deferred find none, the validator included. As they need the TLVs up
+// front, the checks of WithHeaderHMAC, WithHeaderVerifier, RequireTLVs,
+// AllowAuthorities and WithReplayCache disable it, as do RetainRawHeader and
+// WithStackedHeaders.
+func LazyTLVs(threshold int) func(*Conn) {
+	return func(c *Conn) {
+		c.parseOptions.lazyTLVs = threshold
+	}
+}
+
+// deferredTLVs streams the TLV block of a header left unread off the
+// connection.
+type deferredTLVs struct {
+	r *bufio.Reader
+	// value is the value of the last TLV returned, whose unread bytes are
+	// skipped before moving on.
+	value *io.LimitedReader
+	// left is the number of bytes of the block following value.
+	left int
+	// count is the number of TLVs returned so far, bounded by limit if
+	// positive, see WithMaxTLVCount.
+	count      int
+	limit      int
+	onExceeded func(*TLVCountError)
+	err        error
+}
+
+// next returns the next TLV of the block, or io.EOF once the block is
+// exhausted.
+func (d *deferredTLVs) next() (PP2Type, io.Reader, error) {
+	if err := d.skipValue(); err != nil {
+		return 0, nil, err
+	}
+	if d.left == 0 {
+		return 0, nil, io.EOF
+	}
+
+	var tl [3]byte
+	if d.left < len(tl) {
+		return 0, nil, d.fail(fmt.Errorf("%w: %d trailing bytes", ErrTruncatedTLV, d.left))
+	}
+	if _, err := io.ReadFull(d.r, tl[:]); err != nil {
+		return 0, nil, d.fail(truncated(ErrTruncatedTLV, err))
+	}
+	d.left -= len(tl)
+	d.count++
+	if d.limit > 0 && d.count > d.limit {
+		err := &TLVCountError{Count: d.count, Max: d.limit}
+		if d.onExceeded != nil {
+			d.onExceeded(err)
+		}
+		return 0, nil, d.fail(err)
+	}
+	length := int(binary.BigEndian.Uint16(tl[1:]))
+	if length > d.left {
+		return 0, nil, d.fail(fmt.Errorf("%w: type %#x", ErrTruncatedTLV, tl[0]))
+	}
+	d.left -= length
+	d.value = &io.LimitedReader{R: d.r, N: int64(length)}
+	return PP2Type(tl[0]), d.value, nil
+}
+
+// skip skips the rest of the block.
+func (d *deferredTLVs) skip() error {
+	if err := d.skipValue(); err != nil {
+		return err
+	}
+	if _, err := d.r.Discard(d.left); err != nil {
+		return d.fail(truncated(ErrTruncatedTLV, err))
+	}
+	d.left = 0
+	return nil
+}
+
+// skipValue skips the unread bytes of the value of the last TLV returned.
+func (d *deferredTLVs) skipValue() error {
+	if d.err != nil {
+		return d.err
+	}
+	if d.value == nil {
+		return nil
+	}
+	n := d.value.N
+	d.value.N = 0
+	d.value = nil
+	if _, err := d.r.Discard(int(n)); err != nil {
+		return d.fail(truncated(ErrTruncatedTLV, err))
+	}
+	return nil
+}
+
+// fail records the error the block failed with. The payload can't be told
+// apart from the block anymore, so that reads keep failing.
+func (d *deferredTLVs) fail(err error) error {
+	d.err = err
+	return err
+}
+
+// NextDeferredTLV reads the header of the connection if it hasn't been read
+// yet, and returns the type and the value of the next TLV of its block, if
+// it was deferred by LazyTLVs. The value is read off the connection, and
+// must be read before the next TLV is requested, or else it's skipped. It
+// returns io.EOF once the block is exhausted, or if it wasn't deferred. It
+// must not be called once the payload is being read.
+func (p *Conn) NextDeferredTLV() (PP2Type, io.Reader, error) {
+	p.once.Do(func() { p.readErr = p.readHeader() })
+	if p.readErr != nil {
+		return 0, nil, p.readErr
+	}
+	if p.deferred == nil {
+		return 0, nil, io.EOF
+	}
+	return p.deferred.next()
+}
+
+// SeekDeferredTLV returns the value of the next TLV of type t of the block
+// deferred by LazyTLVs, skipping the TLVs before it, see NextDeferredTLV. It
+// returns io.EOF if the rest of the block carries no such TLV.
+func (p *Conn) SeekDeferredTLV(t PP2Type) (io.Reader, error) {
+	for {
+		tlvType, value, err := p.NextDeferredTLV()
+		if err != nil {
+			return nil, err
+		}
+		if tlvType == t {
+			return value, nil
+		}
+	}
+}
+
+// skipDeferredTLVs skips the TLVs left unread before the payload is read.
+// The block is forgotten once skipped, along with the buffer it's read
+// through.
+func (p *Conn) skipDeferredTLVs() error {
+	if p.deferred == nil {
+		return nil
+	}
+	if err := p.deferred.skip(); err != nil {
+		return err
+	}
+	p.deferred = nil
+	return nil
+}
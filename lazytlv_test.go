@@ -0,0 +1,125 @@
+package proxyproto
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func lazyTLVHeader(t *testing.T, large int) []byte {
+	t.Helper()
+	header := HeaderProxyFromAddrs(2, v4addr, v4addr)
+	if err := header.SetTLVs([]TLV{
+		{Type: PP2_TYPE_AUTHORITY, Value: []byte("example.org")},
+		{Type: PP2_TYPE_MIN_CUSTOM + 1, Value: bytes.Repeat([]byte{'x'}, large)},
+		{Type: PP2_TYPE_UNIQUE_ID, Value: []byte("id")},
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	raw, err := header.Format()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return append(raw, "ping"...)
+}
+
+func TestLazyTLVs(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	// The block is larger than the buffer the header is read through.
+	raw := lazyTLVHeader(t, 2*bufSize)
+	go func() { _, _ = client.Write(raw) }()
+
+	conn := NewConn(server, LazyTLVs(1024))
+	if conn.RemoteAddr().String() != v4addr.String() {
+		t.Fatalf("expected the addresses right away, got %v", conn.RemoteAddr())
+	}
+	if tlvs, _ := conn.ProxyHeader().TLVs(); len(tlvs) != 0 {
+		t.Fatalf("expected no TLVs to be buffered, got %d", len(tlvs))
+	}
+
+	value, err := conn.SeekDeferredTLV(PP2_TYPE_MIN_CUSTOM + 1)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if n, err := io.Copy(io.Discard, value); err != nil || n != 2*bufSize {
+		t.Fatalf("expected %d bytes, got %d: %v", 2*bufSize, n, err)
+	}
+	tlvType, value, err := conn.NextDeferredTLV()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if id, _ := io.ReadAll(value); tlvType != PP2_TYPE_UNIQUE_ID || string(id) != "id" {
+		t.Fatalf("unexpected TLV %#x: %q", byte(tlvType), id)
+	}
+	if _, _, err := conn.NextDeferredTLV(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+
+	recv := make([]byte, 4)
+	if _, err := io.ReadFull(conn, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(recv) != "ping" {
+		t.Fatalf("unexpected payload %q", recv)
+	}
+}
+
+func TestLazyTLVsSkipped(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	raw := lazyTLVHeader(t, 2*bufSize)
+	go func() { _, _ = client.Write(raw) }()
+
+	conn := NewConn(server, LazyTLVs(1024))
+	// The TLVs which aren't requested are skipped.
+	if _, err := conn.SeekDeferredTLV(PP2_TYPE_AUTHORITY); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	recv := make([]byte, 4)
+	if _, err := io.ReadFull(conn, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(recv) != "ping" {
+		t.Fatalf("unexpected payload %q", recv)
+	}
+}
+
+func TestLazyTLVsBelowThreshold(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	raw := lazyTLVHeader(t, 16)
+	go func() { _, _ = client.Write(raw) }()
+
+	conn := NewConn(server, LazyTLVs(1024))
+	if authority, ok := GetTLV[string](conn.ProxyHeader(), PP2_TYPE_AUTHORITY); !ok || authority != "example.org" {
+		t.Fatalf("expected the TLVs to be read, got %q", authority)
+	}
+	if _, _, err := conn.NextDeferredTLV(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestLazyTLVsTruncated(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+
+	raw := lazyTLVHeader(t, 2*bufSize)
+	go func() {
+		_, _ = client.Write(raw[:len(raw)-100])
+		client.Close()
+	}()
+
+	conn := NewConn(server, LazyTLVs(1024))
+	if _, err := conn.Read(make([]byte, 4)); !errors.Is(err, ErrTruncatedTLV) {
+		t.Fatalf("expected %v, got %v", ErrTruncatedTLV, err)
+	}
+}
@@ -0,0 +1,46 @@
+package proxyproto
+
+// connLimiter caps the number of connections open at once.
+type connLimiter struct {
+	sem chan struct{}
+}
+
+// acquire waits for a slot, and reports whether one was taken before done
+// was closed.
+func (l *connLimiter) acquire(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return false
+	default:
+	}
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+func (l *connLimiter) release() {
+	<-l.sem
+}
+
+// limiter returns the limiter of the listener, if MaxConnections is set.
+func (p *Listener) limiter() *connLimiter {
+	if p.MaxConnections <= 0 {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.connLimiter == nil {
+		p.connLimiter = &connLimiter{sem: make(chan struct{}, p.MaxConnections)}
+	}
+	return p.connLimiter
+}
+
+// onClose sets a function called once when the connection is closed.
+func onClose(f func()) func(*Conn) {
+	return func(c *Conn) {
+		c.onClose = f
+	}
+}
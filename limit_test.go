@@ -0,0 +1,91 @@
+package proxyproto
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestListenerMaxConnections(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pl := &Listener{Listener: l, MaxConnections: 1}
+	defer pl.Close()
+
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		defer conn.Close()
+	}
+
+	first, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	accepted := make(chan net.Conn)
+	go func() {
+		conn, err := pl.Accept()
+		if err != nil {
+			t.Errorf("err: %v", err)
+		}
+		accepted <- conn
+	}()
+
+	select {
+	case <-accepted:
+		t.Fatal("expected Accept to wait for a connection to be closed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	first.Close()
+	// Closing twice releases a single slot.
+	first.Close()
+	select {
+	case conn := <-accepted:
+		conn.Close()
+	case <-time.After(time.Second):
+		t.Fatal("expected Accept to return once a connection is closed")
+	}
+}
+
+func TestListenerMaxConnectionsClose(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pl := &Listener{Listener: l, MaxConnections: 1}
+
+	conn, err := net.Dial("tcp", pl.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+	first, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer first.Close()
+
+	result := make(chan error)
+	go func() {
+		_, err := pl.Accept()
+		result <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	pl.Close()
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Fatalf("expected %v, got %v", net.ErrClosed, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Close to unblock Accept")
+	}
+}
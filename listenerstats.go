@@ -0,0 +1,108 @@
+package proxyproto
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ListenerStats is a point in time copy of the counters of a Listener, see
+// Listener.Snapshot.
+type ListenerStats struct {
+	// Accepted is the number of connections returned by Accept.
+	Accepted uint64
+	// AcceptErrors is the number of errors returned by Accept.
+	AcceptErrors uint64
+	// PolicyErrors is the number of connections closed because their policy
+	// couldn't be decided, ErrInvalidUpstream included.
+	PolicyErrors uint64
+	// Policies is the number of accepted connections by the policy applied
+	// to them, the one of the ban list included.
+	Policies map[Policy]uint64
+	// HeadersV1 and HeadersV2 are the number of headers parsed, by version,
+	// whether they were then accepted or not.
+	HeadersV1 uint64
+	HeadersV2 uint64
+	// NoHeader is the number of connections carrying on without a header,
+	// e.g. without one under the USE policy, or whose header was ignored.
+	NoHeader uint64
+	// HeaderErrors is the number of connections whose header failed, to
+	// read, parse or to be accepted.
+	HeaderErrors uint64
+	// HeaderTimeouts is the number of header errors which are timeouts, see
+	// ErrHeaderReadTimeout.
+	HeaderTimeouts uint64
+}
+
+// listenerCounters holds the atomic counters of a listener, shared with the
+// connections it accepts.
+type listenerCounters struct {
+	accepted       atomic.Uint64
+	acceptErrors   atomic.Uint64
+	policyErrors   atomic.Uint64
+	policies       [SKIP + 1]atomic.Uint64
+	headersV1      atomic.Uint64
+	headersV2      atomic.Uint64
+	noHeader       atomic.Uint64
+	headerErrors   atomic.Uint64
+	headerTimeouts atomic.Uint64
+}
+
+// countedBy makes the connection account for its header in the counters of
+// the listener which accepted it.
+func countedBy(counters *listenerCounters) func(*Conn) {
+	return func(c *Conn) {
+		c.listenerCounters = counters
+	}
+}
+
+// Snapshot returns a copy of the counters of the listener. They are always
+// maintained, so that basic operational visibility exists without hooks or
+// a metrics system.
+func (p *Listener) Snapshot() ListenerStats {
+	c := &p.counters
+	s := ListenerStats{
+		Accepted:       c.accepted.Load(),
+		AcceptErrors:   c.acceptErrors.Load(),
+		PolicyErrors:   c.policyErrors.Load(),
+		Policies:       make(map[Policy]uint64, len(c.policies)),
+		HeadersV1:      c.headersV1.Load(),
+		HeadersV2:      c.headersV2.Load(),
+		NoHeader:       c.noHeader.Load(),
+		HeaderErrors:   c.headerErrors.Load(),
+		HeaderTimeouts: c.headerTimeouts.Load(),
+	}
+	for policy := range c.policies {
+		s.Policies[Policy(policy)] = c.policies[policy].Load()
+	}
+	return s
+}
+
+// countAccepted accounts for a connection accepted with the policy.
+func (c *listenerCounters) countAccepted(policy Policy) {
+	c.accepted.Add(1)
+	if policy >= 0 && int(policy) < len(c.policies) {
+		c.policies[policy].Add(1)
+	}
+}
+
+// countParsed accounts for a parsed header.
+func (c *listenerCounters) countParsed(header *Header) {
+	if header.Version == 1 {
+		c.headersV1.Add(1)
+	} else {
+		c.headersV2.Add(1)
+	}
+}
+
+// countOutcome accounts for the outcome of the header of a connection.
+func (c *listenerCounters) countOutcome(header *Header, err error) {
+	switch {
+	case err != nil:
+		c.headerErrors.Add(1)
+		if errors.Is(err, ErrHeaderReadTimeout) {
+			c.headerTimeouts.Add(1)
+		}
+	case header == nil:
+		c.noHeader.Add(1)
+	}
+}
@@ -0,0 +1,77 @@
+package proxyproto
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+func TestListenerSnapshot(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var calls atomic.Int32
+	pl := NewListener(l)
+	pl.ConnPolicy = func(ConnPolicyOptions) (Policy, error) {
+		if calls.Add(1) == 1 {
+			return USE, ErrInvalidUpstream
+		}
+		return USE, nil
+	}
+	defer pl.Close()
+
+	v2, err := (&Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr:        v4addr,
+		DestinationAddr:   v4addr,
+	}).Format()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	payloads := [][]byte{
+		[]byte("rejected by the policy"),
+		[]byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\nping"),
+		append(v2, "ping"...),
+		[]byte("ping"),
+		[]byte("PROXY TCP4 not an address\r\nping"),
+	}
+	go func() {
+		for _, payload := range payloads {
+			client, err := net.Dial("tcp", pl.Addr().String())
+			if err != nil {
+				return
+			}
+			_, _ = client.Write(payload)
+			// Wait for the server to be done with the connection.
+			_, _ = io.Copy(io.Discard, client)
+			client.Close()
+		}
+	}()
+
+	for range payloads[1:] {
+		conn, err := pl.Accept()
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		_, _ = io.ReadFull(conn, make([]byte, 4))
+		conn.Close()
+	}
+
+	stats := pl.Snapshot()
+	if stats.Accepted != 4 || stats.PolicyErrors != 1 || stats.AcceptErrors != 0 {
+		t.Fatalf("unexpected accept counters: %+v", stats)
+	}
+	if stats.Policies[USE] != 4 || stats.Policies[REQUIRE] != 0 {
+		t.Fatalf("unexpected policy counters: %+v", stats.Policies)
+	}
+	if stats.HeadersV1 != 1 || stats.HeadersV2 != 1 || stats.NoHeader != 1 || stats.HeaderErrors != 1 {
+		t.Fatalf("unexpected header counters: %+v", stats)
+	}
+	if stats.HeaderTimeouts != 0 {
+		t.Fatalf("expected no timeouts, got %d", stats.HeaderTimeouts)
+	}
+}
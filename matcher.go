@@ -0,0 +1,57 @@
+package proxyproto
+
+import (
+	"bytes"
+	"io"
+)
+
+// IsProxyProtocolSignature reports whether b starts with a PROXY protocol
+// signature, and the version of the protocol it signs. It lets multiplexers
+// and sniffers detect the protocol from the bytes they buffered. At most
+// len(SIGV2) bytes of b are looked at.
+func IsProxyProtocolSignature(b []byte) (version byte, ok bool) {
+	switch {
+	case bytes.HasPrefix(b, SIGV1) && len(b) > len(SIGV1) && b[len(SIGV1)] == ' ':
+		return 1, true
+	case bytes.HasPrefix(b, SIGV2):
+		return 2, true
+	}
+	return 0, false
+}
+
+// MatchPROXY reports whether the first bytes read from r are a PROXY protocol
+// signature, either version 1 or version 2.
+//
+// Its signature is compatible with soheilhy/cmux-style matchers, which buffer
+// the bytes consumed by a matcher and replay them to the selected listener,
+// allowing a single port to serve PROXY protocol and plain traffic side by
+// side:
+//
+//	m := cmux.New(ln)
+//	proxied := m.Match(proxyproto.MatchPROXY)
+//	plain := m.Match(cmux.Any())
+//
+// At most len(SIGV2) bytes are read from r.
+func MatchPROXY(r io.Reader) bool {
+	var buf [12]byte
+	if _, err := io.ReadFull(r, buf[:1]); err != nil {
+		return false
+	}
+
+	// Read as many bytes as IsProxyProtocolSignature needs to tell the
+	// signature starting with the first byte, if any.
+	var n int
+	switch buf[0] {
+	case SIGV1[0]:
+		n = len(SIGV1) + 1
+	case SIGV2[0]:
+		n = len(SIGV2)
+	default:
+		return false
+	}
+	if _, err := io.ReadFull(r, buf[1:n]); err != nil {
+		return false
+	}
+	_, ok := IsProxyProtocolSignature(buf[:n])
+	return ok
+}
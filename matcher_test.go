@@ -0,0 +1,72 @@
+package proxyproto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMatchPROXY(t *testing.T) {
+	var cases = []struct {
+		name  string
+		input []byte
+		want  bool
+	}{
+		{"v1", []byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\n"), true},
+		{"v1 unknown", []byte("PROXY UNKNOWN\r\n"), true},
+		{"v2", append(append([]byte{}, SIGV2...), 0x20, 0x00, 0x00, 0x00), true},
+		{"v2 signature only", SIGV2, true},
+		{"http", []byte("GET / HTTP/1.1\r\n"), false},
+		{"partial v1", []byte("PRO"), false},
+		{"partial v2", SIGV2[:8], false},
+		{"v1 lookalike", []byte("PROXIMITY"), false},
+		{"v1 without space", []byte("PROXYX"), false},
+		{"empty", nil, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := MatchPROXY(bytes.NewReader(tc.input)); got != tc.want {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestMatchPROXYReadsOnlySignature(t *testing.T) {
+	r := strings.NewReader("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\n")
+	if !MatchPROXY(r) {
+		t.Fatal("expected match")
+	}
+	if consumed := int(r.Size()) - r.Len(); consumed != len("PROXY ") {
+		t.Fatalf("expected %d bytes consumed, got %d", len("PROXY "), consumed)
+	}
+}
+
+func TestIsProxyProtocolSignature(t *testing.T) {
+	var cases = []struct {
+		name    string
+		input   []byte
+		version byte
+		ok      bool
+	}{
+		{"v1", []byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\n"), 1, true},
+		{"v1 signature only", []byte("PROXY "), 1, true},
+		{"v2", append(append([]byte(nil), SIGV2...), 0x20, 0x00, 0x00, 0x00), 2, true},
+		{"v2 signature only", SIGV2, 2, true},
+		{"http", []byte("GET / HTTP/1.1\r\n"), 0, false},
+		{"v1 without space", SIGV1, 0, false},
+		{"v1 lookalike", []byte("PROXYX"), 0, false},
+		{"partial v2", SIGV2[:8], 0, false},
+		{"empty", nil, 0, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			version, ok := IsProxyProtocolSignature(tc.input)
+			if version != tc.version || ok != tc.ok {
+				t.Fatalf("expected (%d, %v), got (%d, %v)", tc.version, tc.ok, version, ok)
+			}
+		})
+	}
+}
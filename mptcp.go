@@ -0,0 +1,30 @@
+package proxyproto
+
+// multipathConn is implemented by connections which may use Multipath TCP,
+// e.g. *net.TCPConn.
+type multipathConn interface {
+	MultipathTCP() (bool, error)
+}
+
+// MultipathTCP reports whether the underlying connection uses Multipath TCP,
+// as net.TCPConn.MultipathTCP does, e.g. when accepted by a listener created
+// with net.ListenConfig.SetMultipathTCP. Connections which can't use it,
+// e.g. unix sockets, report false. The header is read the same way on
+// Multipath TCP connections, whose subflows are reassembled by the kernel
+// into a single stream.
+func (p *Conn) MultipathTCP() (bool, error) {
+	if c, ok := p.conn.(multipathConn); ok {
+		return c.MultipathTCP()
+	}
+	return false, nil
+}
+
+// MultipathTCP reports whether the underlying connection uses Multipath TCP,
+// e.g. when established by a Dialer whose underlying net.Dialer enables it
+// with SetMultipathTCP. Connections which can't use it report false.
+func (c *ClientConn) MultipathTCP() (bool, error) {
+	if c, ok := c.conn.(multipathConn); ok {
+		return c.MultipathTCP()
+	}
+	return false, nil
+}
@@ -0,0 +1,61 @@
+package proxyproto
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestMultipathTCP(t *testing.T) {
+	var lc net.ListenConfig
+	lc.SetMultipathTCP(true)
+	l, err := lc.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pl := &Listener{Listener: l}
+	defer pl.Close()
+
+	cliResult := make(chan error)
+	go func() {
+		nd := &net.Dialer{}
+		nd.SetMultipathTCP(true)
+		d := &Dialer{Dialer: nd, Header: HeaderProxyFromAddrs(2, v4addr, v4addr)}
+		conn, err := d.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			cliResult <- err
+			return
+		}
+		defer conn.Close()
+
+		want, wantErr := conn.(*ClientConn).Raw().(*net.TCPConn).MultipathTCP()
+		if got, err := conn.(*ClientConn).MultipathTCP(); got != want || (err == nil) != (wantErr == nil) {
+			t.Errorf("expected (%v, %v), got (%v, %v)", want, wantErr, got, err)
+		}
+		close(cliResult)
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	if conn.(*Conn).ProxyHeader() == nil {
+		t.Fatal("expected a header")
+	}
+	want, wantErr := conn.(*Conn).Raw().(*net.TCPConn).MultipathTCP()
+	if got, err := conn.(*Conn).MultipathTCP(); got != want || (err == nil) != (wantErr == nil) {
+		t.Fatalf("expected (%v, %v), got (%v, %v)", want, wantErr, got, err)
+	}
+	if err := <-cliResult; err != nil {
+		t.Fatalf("client error: %v", err)
+	}
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	if got, err := NewConn(server).MultipathTCP(); got || err != nil {
+		t.Fatalf("expected (false, <nil>), got (%v, %v)", got, err)
+	}
+}
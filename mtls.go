@@ -0,0 +1,81 @@
+package proxyproto
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"slices"
+)
+
+// ClientCertMatcher decides whether the client certificate presented on a TLS
+// connection belongs to an upstream trusted to send a proxy header.
+type ClientCertMatcher func(cert *x509.Certificate) bool
+
+// MatchClientCerts returns a ClientCertMatcher accepting exactly the given
+// certificates, e.g. the ones of the load balancers in front of the server.
+func MatchClientCerts(certs ...*x509.Certificate) ClientCertMatcher {
+	return func(cert *x509.Certificate) bool {
+		return slices.ContainsFunc(certs, func(c *x509.Certificate) bool {
+			return bytes.Equal(c.Raw, cert.Raw)
+		})
+	}
+}
+
+// MatchClientCertNames returns a ClientCertMatcher accepting the
+// certificates whose common name or one of the DNS names is among names.
+// Use it along with a tls.Config verifying client certificates against a
+// trusted CA, e.g. with ClientAuth set to tls.RequireAndVerifyClientCert.
+func MatchClientCertNames(names ...string) ClientCertMatcher {
+	return func(cert *x509.Certificate) bool {
+		if slices.Contains(names, cert.Subject.CommonName) {
+			return true
+		}
+		return slices.ContainsFunc(cert.DNSNames, func(name string) bool {
+			return slices.Contains(names, name)
+		})
+	}
+}
+
+// WithTrustedClientCerts makes the connection honor the proxy header only if
+// the upstream presented a client certificate accepted by match, when passed
+// as option to NewConn(). This suits listeners wrapping a TLS listener which
+// requires client certificates, e.g. one returned by tls.NewListener, the
+// header then being sent inside the TLS stream.
+//
+// The TLS handshake is completed before the header is read, within the read
+// header timeout. If no certificate is presented, none matches, or the
+// connection isn't a TLS one, the USE and REQUIRE policies are downgraded to
+// IGNORE.
+func WithTrustedClientCerts(match ClientCertMatcher) func(*Conn) {
+	return func(c *Conn) {
+		c.trustedClientCerts = match
+	}
+}
+
+// tlsConn is implemented by TLS connections such as *tls.Conn.
+type tlsConn interface {
+	Handshake() error
+	ConnectionState() tls.ConnectionState
+}
+
+// checkClientCert downgrades the policy of the connection to IGNORE unless
+// the upstream presented a trusted client certificate.
+func (p *Conn) checkClientCert() error {
+	if p.ProxyHeaderPolicy != USE && p.ProxyHeaderPolicy != REQUIRE {
+		return nil
+	}
+
+	trusted := false
+	if conn, ok := p.conn.(tlsConn); ok {
+		if err := conn.Handshake(); err != nil {
+			return err
+		}
+		if certs := conn.ConnectionState().PeerCertificates; len(certs) > 0 {
+			trusted = p.trustedClientCerts(certs[0])
+		}
+	}
+	if !trusted {
+		p.ProxyHeaderPolicy = IGNORE
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package proxyproto
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestMatchClientCerts(t *testing.T) {
+	cert, err := tls.X509KeyPair(LocalhostCert, LocalhostKey)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if !MatchClientCerts(leaf)(leaf) {
+		t.Fatal("expected the certificate to match")
+	}
+	if MatchClientCerts()(leaf) {
+		t.Fatal("expected an empty set not to match")
+	}
+	if !MatchClientCertNames("example.com")(leaf) {
+		t.Fatalf("expected the DNS name to match, got %v", leaf.DNSNames)
+	}
+	if MatchClientCertNames("lb.internal")(leaf) {
+		t.Fatal("expected an unknown name not to match")
+	}
+}
+
+func TestListenerTrustedClientCerts(t *testing.T) {
+	cert, err := tls.X509KeyPair(LocalhostCert, LocalhostKey)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var cases = []struct {
+		name       string
+		match      ClientCertMatcher
+		clientCert bool
+		trusted    bool
+	}{
+		{"trusted", MatchClientCertNames("example.com"), true, true},
+		{"untrusted", MatchClientCertNames("lb.internal"), true, false},
+		{"no certificate", MatchClientCertNames("example.com"), false, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+
+			pl := &Listener{
+				Listener: tls.NewListener(l, &tls.Config{
+					Certificates: []tls.Certificate{cert},
+					ClientAuth:   tls.RequestClientCert,
+				}),
+				ConnPolicy: func(ConnPolicyOptions) (Policy, error) {
+					return REQUIRE, nil
+				},
+				TrustedClientCerts: tc.match,
+			}
+			defer pl.Close()
+
+			header := &Header{
+				Version:           2,
+				Command:           PROXY,
+				TransportProtocol: TCPv4,
+				SourceAddr:        v4addr,
+				DestinationAddr:   v4addr,
+			}
+
+			cliResult := make(chan error)
+			go func() {
+				config := &tls.Config{InsecureSkipVerify: true}
+				if tc.clientCert {
+					config.Certificates = []tls.Certificate{cert}
+				}
+				conn, err := tls.Dial("tcp", pl.Addr().String(), config)
+				if err != nil {
+					cliResult <- err
+					return
+				}
+				defer conn.Close()
+
+				if _, err := WriteHeaderAndPayload(conn, header, []byte("ping")); err != nil {
+					cliResult <- err
+					return
+				}
+				close(cliResult)
+			}()
+
+			conn, err := pl.Accept()
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			defer conn.Close()
+
+			recv := make([]byte, 4)
+			if _, err := io.ReadFull(conn, recv); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if err := <-cliResult; err != nil {
+				t.Fatalf("client error: %v", err)
+			}
+
+			if string(recv) != "ping" {
+				t.Fatalf("expected %q, got %q", "ping", recv)
+			}
+			if trusted := conn.RemoteAddr().String() == v4addr.String(); trusted != tc.trusted {
+				t.Fatalf("expected trusted %v, got remote address %v", tc.trusted, conn.RemoteAddr())
+			}
+		})
+	}
+}
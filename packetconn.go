@@ -0,0 +1,241 @@
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultPacketIdleTimeout is how long a PacketConn remembers the flow of a
+// client, if PacketConn.IdleTimeout is not set.
+var DefaultPacketIdleTimeout = 2 * time.Minute
+
+// DroppedDatagramFunc receives the datagrams dropped by a PacketConn, along
+// with the address of the upstream which sent them and the reason.
+type DroppedDatagramFunc func(upstream net.Addr, err error)
+
+// PacketConn wraps a PacketConn receiving datagrams from proxies which
+// prefix them with a header, e.g. UDP load balancers, so that packet
+// oriented servers, e.g. DTLS ones like pion/dtls, see the addresses of the
+// clients. Proxies may prefix every datagram of a flow, or only the first
+// one, e.g. the first DTLS handshake message: the datagrams received without
+// header from an upstream are attributed to the client it last announced.
+//
+// ReadFrom strips the header and reports the source of the header as the
+// address of the datagram. WriteTo sends the datagrams addressed to a known
+// client to the upstream it was announced by, as proxies relay replies
+// based on the flow they belong to. Datagrams addressed to other addresses
+// are sent as is.
+//
+// Datagrams whose header fails to parse, or is disallowed by the policy or
+// the validator, are dropped.
+type PacketConn struct {
+	PacketConn net.PacketConn
+	// Format is the format of the headers prefixed to datagrams.
+	Format DatagramFormat
+	// ConnPolicy, if set, decides the policy of each datagram, by the
+	// upstream which sent it. With the REQUIRE policy, datagrams neither
+	// carrying a header nor belonging to a known flow are dropped.
+	ConnPolicy     ConnPolicyFunc
+	ValidateHeader Validator
+	// IdleTimeout is how long the flow of a client is remembered once it
+	// stops sending datagrams. If zero, DefaultPacketIdleTimeout is used.
+	IdleTimeout time.Duration
+	// OnDroppedDatagram, if set, is called for each dropped datagram.
+	OnDroppedDatagram DroppedDatagramFunc
+
+	mu        sync.Mutex
+	clients   map[string]*packetFlow // by client address
+	upstreams map[string]*packetFlow // by upstream address
+	swept     time.Time
+}
+
+// packetFlow is the flow of a client through an upstream.
+type packetFlow struct {
+	client   net.Addr
+	upstream net.Addr
+	header   *Header
+	seen     time.Time
+}
+
+// ReadFrom reads a datagram, strips its header and returns the address of
+// the client it was announced for. Datagrams are read into b whole, header
+// included, so b should have room for the header as well.
+func (p *PacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		n, upstream, err := p.PacketConn.ReadFrom(b)
+		if err != nil {
+			return n, upstream, err
+		}
+
+		payload, addr, err := p.handle(b[:n], upstream)
+		if err != nil {
+			if p.OnDroppedDatagram != nil {
+				p.OnDroppedDatagram(upstream, err)
+			}
+			continue
+		}
+		return copy(b, payload), addr, nil
+	}
+}
+
+// handle returns the payload of a datagram received from upstream and the
+// address it's to be reported from.
+func (p *PacketConn) handle(datagram []byte, upstream net.Addr) ([]byte, net.Addr, error) {
+	policy := USE
+	if p.ConnPolicy != nil {
+		var err error
+		policy, err = p.ConnPolicy(ConnPolicyOptions{
+			Upstream:   upstream,
+			Downstream: p.PacketConn.LocalAddr(),
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if policy == SKIP {
+		return datagram, upstream, nil
+	}
+
+	if !p.hasHeader(datagram) {
+		if flow := p.flow(upstream); flow != nil && policy != IGNORE {
+			return datagram, flow.client, nil
+		}
+		if policy == REQUIRE {
+			return nil, nil, ErrNoProxyProtocol
+		}
+		return datagram, upstream, nil
+	}
+
+	header, payload, err := ParseDatagram(datagram, p.Format)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch policy {
+	case REJECT:
+		return nil, nil, ErrSuperfluousProxyHeader
+	case IGNORE:
+		return payload, upstream, nil
+	}
+	if p.ValidateHeader != nil {
+		if err := p.ValidateHeader(header); err != nil {
+			return nil, nil, err
+		}
+	}
+	if header.Command.IsLocal() || header.SourceAddr == nil {
+		return payload, upstream, nil
+	}
+
+	p.track(header, upstream)
+	return payload, header.SourceAddr, nil
+}
+
+// hasHeader tells whether the datagram starts with a header signature.
+func (p *PacketConn) hasHeader(datagram []byte) bool {
+	if p.Format == DatagramSPP {
+		return len(datagram) >= 2 && binary.BigEndian.Uint16(datagram) == sppMagic
+	}
+	return bytes.HasPrefix(datagram, SIGV2)
+}
+
+// track records the flow of the client announced by the header, and
+// forgets the flows idle for too long.
+func (p *PacketConn) track(header *Header, upstream net.Addr) {
+	now := time.Now()
+	timeout := p.IdleTimeout
+	if timeout <= 0 {
+		timeout = DefaultPacketIdleTimeout
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.clients == nil {
+		p.clients = make(map[string]*packetFlow)
+		p.upstreams = make(map[string]*packetFlow)
+	}
+	if now.Sub(p.swept) > timeout/2 {
+		for key, flow := range p.clients {
+			if now.Sub(flow.seen) > timeout {
+				delete(p.clients, key)
+				if p.upstreams[flow.upstream.String()] == flow {
+					delete(p.upstreams, flow.upstream.String())
+				}
+			}
+		}
+		p.swept = now
+	}
+
+	flow := &packetFlow{
+		client:   header.SourceAddr,
+		upstream: upstream,
+		header:   header,
+		seen:     now,
+	}
+	p.clients[header.SourceAddr.String()] = flow
+	p.upstreams[upstream.String()] = flow
+}
+
+// flow returns the flow last announced by upstream, if any.
+func (p *PacketConn) flow(upstream net.Addr) *packetFlow {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	flow := p.upstreams[upstream.String()]
+	if flow != nil {
+		flow.seen = time.Now()
+	}
+	return flow
+}
+
+// WriteTo writes a datagram to addr, through the upstream which announced
+// it if it's a known client.
+func (p *PacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if addr != nil {
+		p.mu.Lock()
+		flow := p.clients[addr.String()]
+		p.mu.Unlock()
+		if flow != nil {
+			addr = flow.upstream
+		}
+	}
+	return p.PacketConn.WriteTo(b, addr)
+}
+
+// Header returns the header last received for the client at addr, or nil
+// if the client isn't known.
+func (p *PacketConn) Header(addr net.Addr) *Header {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if flow := p.clients[addr.String()]; flow != nil {
+		return flow.header
+	}
+	return nil
+}
+
+// Close closes the underlying PacketConn.
+func (p *PacketConn) Close() error {
+	return p.PacketConn.Close()
+}
+
+// LocalAddr returns the underlying PacketConn's network address.
+func (p *PacketConn) LocalAddr() net.Addr {
+	return p.PacketConn.LocalAddr()
+}
+
+// SetDeadline wraps the underlying PacketConn's SetDeadline.
+func (p *PacketConn) SetDeadline(t time.Time) error {
+	return p.PacketConn.SetDeadline(t)
+}
+
+// SetReadDeadline wraps the underlying PacketConn's SetReadDeadline.
+func (p *PacketConn) SetReadDeadline(t time.Time) error {
+	return p.PacketConn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline wraps the underlying PacketConn's SetWriteDeadline.
+func (p *PacketConn) SetWriteDeadline(t time.Time) error {
+	return p.PacketConn.SetWriteDeadline(t)
+}
+
+var _ net.PacketConn = (*PacketConn)(nil)
@@ -0,0 +1,110 @@
+package proxyproto
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestPacketConns(t *testing.T, format DatagramFormat, policy ConnPolicyFunc) (*PacketConn, net.PacketConn) {
+	t.Helper()
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	proxy, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	t.Cleanup(func() {
+		server.Close()
+		proxy.Close()
+	})
+	for _, pc := range []net.PacketConn{server, proxy} {
+		if err := pc.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	return &PacketConn{PacketConn: server, Format: format, ConnPolicy: policy}, proxy
+}
+
+func TestPacketConn(t *testing.T) {
+	for _, format := range []DatagramFormat{DatagramV2, DatagramSPP} {
+		pc, proxy := newTestPacketConns(t, format, nil)
+
+		client := &net.UDPAddr{IP: net.ParseIP("192.0.2.60").To4(), Port: 4433}
+		header := HeaderProxyFromAddrs(2, client, &net.UDPAddr{IP: net.ParseIP("198.51.100.17").To4(), Port: 443})
+		datagram, err := FormatDatagram(header, []byte("hello"), format)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if _, err := proxy.WriteTo(datagram, pc.LocalAddr()); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		// Only the first datagram of the flow carries the header.
+		if _, err := proxy.WriteTo([]byte("again"), pc.LocalAddr()); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+
+		buf := make([]byte, 1500)
+		for _, expected := range []string{"hello", "again"} {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if string(buf[:n]) != expected {
+				t.Fatalf("expected %q, got %q", expected, buf[:n])
+			}
+			if addr.String() != client.String() {
+				t.Fatalf("expected %v, got %v", client, addr)
+			}
+		}
+		if pc.Header(client) == nil {
+			t.Fatal("expected the header of the client")
+		}
+
+		// Replies go back through the proxy.
+		if _, err := pc.WriteTo([]byte("pong"), client); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		n, addr, err := proxy.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if string(buf[:n]) != "pong" || addr.String() != pc.LocalAddr().String() {
+			t.Fatalf("unexpected reply %q from %v", buf[:n], addr)
+		}
+	}
+}
+
+func TestPacketConnRequire(t *testing.T) {
+	pc, proxy := newTestPacketConns(t, DatagramV2, func(ConnPolicyOptions) (Policy, error) { return REQUIRE, nil })
+	var dropped []error
+	pc.OnDroppedDatagram = func(upstream net.Addr, err error) {
+		dropped = append(dropped, err)
+	}
+
+	if _, err := proxy.WriteTo([]byte("no header"), pc.LocalAddr()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	datagram, err := FormatDatagram(HeaderProxyFromAddrs(2, v4addr, v4addr), []byte("hello"), DatagramV2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := proxy.WriteTo(datagram, pc.LocalAddr()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	buf := make([]byte, 1500)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(buf[:n]) != "hello" {
+		t.Fatalf("expected %q, got %q", "hello", buf[:n])
+	}
+	if len(dropped) != 1 || !errors.Is(dropped[0], ErrNoProxyProtocol) {
+		t.Fatalf("expected the first datagram to be dropped, got %v", dropped)
+	}
+}
@@ -0,0 +1,104 @@
+package proxyproto
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+// ProxyPair forwards the traffic between a and b in both directions, as
+// relays do once they've accepted a connection and dialed its backend, and
+// closes both connections once done. When a side reaches EOF, the writing
+// side of the other connection is shut down, so that half-closed
+// connections, e.g. of clients shutting down their writing side once their
+// request is sent, still get the response. Connections which can't be
+// half-closed are closed instead.
+//
+// The connections of this package, e.g. returned by Listener.Accept,
+// Dialer.Dial or PreserveInterfaces, are unwrapped: the bytes buffered
+// while reading the header are forwarded first, then the traffic flows
+// directly between the underlying connections. When both are TCP
+// connections, the Go runtime forwards it with splice(2) on Linux, without
+// copying it to user space.
+//
+// It returns the first error encountered, if any, once both directions are
+// done. Errors caused by closing a connection because of the failure of
+// the other direction are not reported.
+func ProxyPair(a, b net.Conn) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		failed   bool
+	)
+	forward := func(dst, src net.Conn) {
+		defer wg.Done()
+		_, err := io.Copy(pairWriter(dst), pairReader(src))
+		if err == nil {
+			if closeWrite(dst) == nil {
+				return
+			}
+		}
+
+		mu.Lock()
+		if err != nil && !failed {
+			firstErr = err
+		}
+		failed = true
+		mu.Unlock()
+		// Unblock the other direction.
+		a.Close()
+		b.Close()
+	}
+
+	wg.Add(2)
+	go forward(b, a)
+	go forward(a, b)
+	wg.Wait()
+
+	a.Close()
+	b.Close()
+	return firstErr
+}
+
+// pairReader returns the reader to forward the traffic of conn from,
+// unwrapping the connections of this package so that io.Copy reaches the
+// underlying connection. The WriteTo method of *Conn hands out the bytes
+// buffered while reading the header first.
+func pairReader(conn net.Conn) io.Reader {
+	switch c := conn.(type) {
+	case *ClientConn:
+		return c.conn
+	case interface{ ProxyConn() *Conn }:
+		return c.ProxyConn()
+	}
+	return conn
+}
+
+// pairWriter returns the writer to forward the traffic to conn to, see
+// pairReader. Writes go through *ClientConn, in case its header is
+// deferred, which implements io.ReaderFrom as well.
+func pairWriter(conn net.Conn) io.Writer {
+	if c, ok := conn.(interface{ ProxyConn() *Conn }); ok {
+		return c.ProxyConn()
+	}
+	return conn
+}
+
+// closeWrite shuts down the writing side of conn, or of the connection it
+// wraps.
+func closeWrite(conn net.Conn) error {
+	switch c := conn.(type) {
+	case *ClientConn:
+		conn = c.conn
+	case *Conn:
+		conn = c.conn
+	case interface{ ProxyConn() *Conn }:
+		conn = c.ProxyConn().conn
+	}
+	if cw, ok := conn.(closeWriter); ok {
+		return cw.CloseWrite()
+	}
+	return errors.ErrUnsupported
+}
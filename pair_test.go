@@ -0,0 +1,117 @@
+package proxyproto
+
+import (
+	"io"
+	"net"
+	"testing"
+)
+
+func TestProxyPair(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pb := NewListener(backend)
+	defer pb.Close()
+
+	front, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pf := NewListener(front)
+	defer pf.Close()
+
+	// The relay announces the client it got from the front header.
+	relayResult := make(chan error, 1)
+	go func() {
+		conn, err := pf.Accept()
+		if err != nil {
+			relayResult <- err
+			return
+		}
+		d := &Dialer{Header: conn.(*Conn).ProxyHeader()}
+		upstream, err := d.Dial("tcp", pb.Addr().String())
+		if err != nil {
+			conn.Close()
+			relayResult <- err
+			return
+		}
+		relayResult <- ProxyPair(conn, upstream)
+	}()
+
+	backendResult := make(chan error, 1)
+	go func() {
+		conn, err := pb.Accept()
+		if err != nil {
+			backendResult <- err
+			return
+		}
+		defer conn.Close()
+		request, err := io.ReadAll(conn)
+		if err != nil {
+			backendResult <- err
+			return
+		}
+		if string(request) != "request" || conn.RemoteAddr().String() != "10.1.1.1:1000" {
+			backendResult <- io.ErrUnexpectedEOF
+			return
+		}
+		_, err = conn.Write([]byte("response"))
+		backendResult <- err
+	}()
+
+	client, err := net.Dial("tcp", pf.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+	// The payload is buffered along with the header by the relay.
+	if _, err := client.Write([]byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\nrequest")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	// The backend only responds once it has seen the end of the request.
+	if err := client.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	response, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(response) != "response" {
+		t.Fatalf("unexpected response %q", response)
+	}
+
+	if err := <-backendResult; err != nil {
+		t.Fatalf("backend error: %v", err)
+	}
+	if err := <-relayResult; err != nil {
+		t.Fatalf("relay error: %v", err)
+	}
+}
+
+func TestProxyPairWithoutHalfClose(t *testing.T) {
+	a, client := net.Pipe()
+	b, server := net.Pipe()
+
+	result := make(chan error, 1)
+	go func() { result <- ProxyPair(a, b) }()
+
+	go func() {
+		_, _ = client.Write([]byte("ping"))
+		client.Close()
+	}()
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(server, buf); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(buf) != "ping" {
+		t.Fatalf("unexpected payload %q", buf)
+	}
+	// Pipes can't be half-closed, so the EOF of a closes b.
+	if _, err := server.Read(buf); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+	if err := <-result; err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
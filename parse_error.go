@@ -0,0 +1,155 @@
+package proxyproto
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// maxParseErrorRaw bounds the number of header bytes kept by a ParseError.
+const maxParseErrorRaw = 256
+
+// ParseErrorReason is the machine-readable reason of a ParseError.
+type ParseErrorReason string
+
+const (
+	// ReasonTruncated is reported when the header ended early, e.g. it
+	// wasn't received at once or the peer closed the connection, see
+	// ErrHeaderTruncated.
+	ReasonTruncated ParseErrorReason = "truncated"
+	// ReasonTimeout is reported when the header didn't arrive in full
+	// before the read header timeout, see ErrHeaderReadTimeout.
+	ReasonTimeout ParseErrorReason = "timeout"
+	// ReasonTooLong is reported for version 1 headers longer than 107 bytes.
+	ReasonTooLong ParseErrorReason = "too_long"
+	// ReasonTooLarge is reported for headers exceeding the maximum size set
+	// on the connection, see WithMaxHeaderSize.
+	ReasonTooLarge ParseErrorReason = "too_large"
+	// ReasonTooManyTLVs is reported for headers carrying more TLVs than
+	// allowed on the connection, see WithMaxTLVCount.
+	ReasonTooManyTLVs ParseErrorReason = "too_many_tlvs"
+	// ReasonMissingCRLF is reported for version 1 headers not ending with
+	// "\r\n".
+	ReasonMissingCRLF ParseErrorReason = "missing_crlf"
+	// ReasonInvalidCommand is reported for unsupported version and command
+	// bytes of version 2 headers.
+	ReasonInvalidCommand ParseErrorReason = "invalid_command"
+	// ReasonInvalidFamily is reported for unsupported or missing address
+	// families and transport protocols.
+	ReasonInvalidFamily ParseErrorReason = "invalid_family"
+	// ReasonInvalidLength is reported for version 2 lengths not matching
+	// the address family, or exceeding the received bytes.
+	ReasonInvalidLength ParseErrorReason = "invalid_length"
+	// ReasonInvalidAddress is reported for malformed addresses.
+	ReasonInvalidAddress ParseErrorReason = "invalid_address"
+	// ReasonInvalidPort is reported for malformed port numbers.
+	ReasonInvalidPort ParseErrorReason = "invalid_port"
+	// ReasonOther is reported for any other failure.
+	ReasonOther ParseErrorReason = "other"
+)
+
+// parseErrorReasons maps the sentinel errors to their reason.
+var parseErrorReasons = map[error]ParseErrorReason{
+	ErrCantReadVersion1Header:               ReasonTruncated,
+	ErrCantReadProtocolVersionAndCommand:    ReasonTruncated,
+	ErrCantReadLength:                       ReasonTruncated,
+	ErrVersion1HeaderTooLong:                ReasonTooLong,
+	ErrHeaderTooLarge:                       ReasonTooLarge,
+	ErrTooManyTLVs:                          ReasonTooManyTLVs,
+	ErrLineMustEndWithCrlf:                  ReasonMissingCRLF,
+	ErrUnsupportedProtocolVersionAndCommand: ReasonInvalidCommand,
+	ErrCantReadAddressFamilyAndProtocol:     ReasonInvalidFamily,
+	ErrUnsupportedAddressFamilyAndProtocol:  ReasonInvalidFamily,
+	ErrInvalidLength:                        ReasonInvalidLength,
+	ErrInvalidAddress:                       ReasonInvalidAddress,
+	ErrInvalidPortNumber:                    ReasonInvalidPort,
+}
+
+// ParseError is returned when a header starting with a valid signature
+// fails to parse. It unwraps to the sentinel error describing the failure,
+// e.g. ErrInvalidAddress, and carries the context needed to debug interop
+// problems, e.g. with hardware load balancers.
+type ParseError struct {
+	// Version is the protocol version attempted, 1 or 2.
+	Version byte
+	// Offset is the offset in the header of the byte where parsing failed.
+	Offset int
+	// Raw holds the first bytes of the header, at most 256.
+	Raw []byte
+	// Reason is the machine-readable reason of the failure.
+	Reason ParseErrorReason
+	// Err is the error describing the failure.
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%v (version %d, offset %d)", e.Err, e.Version, e.Offset)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseError returns the ParseError of a header of the given version which
+// failed to parse at offset. Its raw bytes are set by read.
+func parseError(version byte, offset int, err error) *ParseError {
+	reason := ReasonOther
+	var netErr net.Error
+	// These take precedence over the sentinel they're wrapped along with.
+	if errors.Is(err, ErrHeaderTruncated) {
+		reason = ReasonTruncated
+	} else if errors.As(err, &netErr) && netErr.Timeout() {
+		reason = ReasonTimeout
+	} else {
+		for sentinel, r := range parseErrorReasons {
+			if errors.Is(err, sentinel) {
+				reason = r
+				break
+			}
+		}
+	}
+	return &ParseError{
+		Version: version,
+		Offset:  offset,
+		Reason:  reason,
+		Err:     err,
+	}
+}
+
+// truncated returns err, wrapped along with ErrHeaderTruncated if the read
+// error cause tells the peer closed the connection, or along with cause if
+// it's a timeout.
+func truncated(err, cause error) error {
+	if errors.Is(cause, io.EOF) || errors.Is(cause, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %w", err, ErrHeaderTruncated)
+	}
+	if netErr, ok := cause.(net.Error); ok && netErr.Timeout() {
+		return fmt.Errorf("%w: %w", err, cause)
+	}
+	return err
+}
+
+// parseErrorRaw holds a copy of the first bytes of a header, to be reported
+// by the ParseError it may fail with.
+type parseErrorRaw struct {
+	buf [maxParseErrorRaw]byte
+	n   int
+}
+
+// peek copies the bytes buffered at the start of the header. They're copied
+// upfront as parsing may overwrite the buffer.
+func (r *parseErrorRaw) peek(reader *bufio.Reader) {
+	b, _ := reader.Peek(min(reader.Buffered(), maxParseErrorRaw))
+	r.n = copy(r.buf[:], b)
+}
+
+// wrap sets the raw header bytes on err, if it's a ParseError.
+func (r *parseErrorRaw) wrap(err error) error {
+	var pe *ParseError
+	if errors.As(err, &pe) {
+		pe.Raw = append([]byte(nil), r.buf[:r.n]...)
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+package proxyproto
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	v2 := append(append([]byte{}, SIGV2...), 0x2F, 0x11, 0x00, 0x0C)
+
+	tests := []struct {
+		name    string
+		raw     []byte
+		version byte
+		offset  int
+		reason  ParseErrorReason
+		err     error
+	}{
+		{"v1 invalid port", []byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 99999\r\n"), 1, 34, ReasonInvalidPort, ErrInvalidPortNumber},
+		{"v1 invalid family", []byte("PROXY TCP5 10.1.1.1 20.2.2.2 1000 2000\r\n"), 1, 6, ReasonInvalidFamily, ErrCantReadAddressFamilyAndProtocol},
+		{"v1 missing CR", []byte("PROXY UNKNOWN\n"), 1, 13, ReasonMissingCRLF, ErrLineMustEndWithCrlf},
+		{"v2 invalid command", v2, 2, 12, ReasonInvalidCommand, ErrUnsupportedProtocolVersionAndCommand},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(newBufioReader(tt.raw))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("expected a ParseError, got %T", err)
+			}
+			if pe.Version != tt.version || pe.Offset != tt.offset || pe.Reason != tt.reason {
+				t.Fatalf("unexpected parse error: version %d, offset %d, reason %s", pe.Version, pe.Offset, pe.Reason)
+			}
+			if string(pe.Raw) != string(tt.raw) {
+				t.Fatalf("expected raw bytes %q, got %q", tt.raw, pe.Raw)
+			}
+		})
+	}
+}
+
+func TestParseErrorNoSignature(t *testing.T) {
+	if _, err := Read(newBufioReader([]byte("GET / HTTP/1.1\r\n"))); err != ErrNoProxyProtocol {
+		t.Fatalf("expected %v, got %v", ErrNoProxyProtocol, err)
+	}
+}
+
+func TestParseErrorTruncated(t *testing.T) {
+	full := append(append([]byte{}, SIGV2...), 0x21, 0x11, 0x00, 0x0C, 10, 1, 1, 1, 20, 2, 2, 2, 0x03, 0xE8, 0x07, 0xD0)
+
+	tests := []struct {
+		name string
+		n    int
+		err  error
+	}{
+		{"command", 12, ErrCantReadProtocolVersionAndCommand},
+		{"family", 13, ErrCantReadAddressFamilyAndProtocol},
+		{"length", 15, ErrCantReadLength},
+		{"addresses", 20, ErrInvalidLength},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(newBufioReader(full[:tt.n]))
+			if !errors.Is(err, ErrHeaderTruncated) || !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("expected %v, got %v", ErrHeaderTruncated, err)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+			var pe *ParseError
+			if !errors.As(err, &pe) || pe.Reason != ReasonTruncated {
+				t.Fatalf("expected a %s ParseError, got %v", ReasonTruncated, err)
+			}
+		})
+	}
+
+	if _, err := Read(newBufioReader(full)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
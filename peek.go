@@ -0,0 +1,106 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+)
+
+var errPeekUnsupported = errors.New("proxyproto: peeking sockets is not supported on this platform")
+
+// lacksSignature reports whether the bytes waiting on the socket of conn
+// rule out a PROXY protocol signature, without consuming any of them. While
+// the bytes received so far are a prefix of a signature, it waits for more,
+// bounded by the read deadline of conn, unless the peer is done sending.
+//
+// It returns false whenever the socket can't be peeked, in which case the
+// header has to be read as usual. Only timeouts are returned as errors.
+func lacksSignature(conn net.Conn) (bool, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return false, nil
+	}
+
+	var buf [12]byte
+	n, err := peekSocket(sc, buf[:], signatureConclusive)
+	if err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return false, err
+		}
+		return false, nil
+	}
+	if n == 0 {
+		// EOF, there is nothing to consume anyway.
+		return true, nil
+	}
+
+	return !bytes.HasPrefix(SIGV1, buf[:min(n, len(SIGV1))]) &&
+		!bytes.HasPrefix(SIGV2, buf[:min(n, len(SIGV2))]), nil
+}
+
+// signatureConclusive tells whether b tells a signature apart from other
+// bytes: it is a whole signature, or isn't the prefix of one.
+func signatureConclusive(b []byte) bool {
+	if bytes.HasPrefix(b, SIGV1) || bytes.HasPrefix(b, SIGV2) {
+		return true
+	}
+	return !bytes.HasPrefix(SIGV1, b[:min(len(b), len(SIGV1))]) &&
+		!bytes.HasPrefix(SIGV2, b)
+}
+
+// PeekHeader reads the PROXY header of conn, if present, without wrapping
+// conn into a Conn. The returned connection replays the bytes read past the
+// header, if any, before reading from conn again.
+//
+// If no header is received within timeout, or if the first bytes received
+// aren't a PROXY signature, a nil header and no error are returned. A
+// timeout <= 0 disables it. The read deadline of conn is cleared before
+// returning.
+//
+// Policies and validators are not applied, it's up to the caller to decide
+// whether to trust the header.
+func PeekHeader(conn net.Conn, timeout time.Duration) (*Header, net.Conn, error) {
+	if timeout > 0 {
+		if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	br := bufio.NewReaderSize(conn, bufSize)
+	header, err := Read(br)
+
+	if timeout > 0 {
+		if err := conn.SetReadDeadline(time.Time{}); err != nil {
+			return nil, nil, err
+		}
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			err = ErrNoProxyProtocol
+		}
+	}
+	if err == ErrNoProxyProtocol {
+		header, err = nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if br.Buffered() == 0 {
+		return header, conn, nil
+	}
+	return header, &replayConn{Conn: conn, reader: io.MultiReader(br, conn)}, nil
+}
+
+// replayConn is a net.Conn reading from a reader replaying buffered bytes
+// before the ones of the connection.
+type replayConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *replayConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
@@ -0,0 +1,31 @@
+package proxyproto
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// The poll events, missing from the syscall package.
+const (
+	pollERR   = 0x8
+	pollHUP   = 0x10
+	pollRDHUP = 0x2000
+)
+
+// peerClosed tells whether the peer shut the writing side of the socket
+// down, so that no more bytes are to be peeked.
+func peerClosed(fd uintptr) bool {
+	pfd := struct {
+		fd      int32
+		events  int16
+		revents int16
+	}{fd: int32(fd), events: pollRDHUP}
+	var timeout syscall.Timespec
+	n, _, errno := syscall.Syscall6(syscall.SYS_PPOLL, uintptr(unsafe.Pointer(&pfd)), 1,
+		uintptr(unsafe.Pointer(&timeout)), 0, 0, 0)
+	if errno != 0 {
+		// Better read the header as usual than wait forever.
+		return true
+	}
+	return n > 0 && pfd.revents&(pollRDHUP|pollHUP|pollERR) != 0
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package proxyproto
+
+import "syscall"
+
+func peekSocket(conn syscall.Conn, b []byte, done func(b []byte) bool) (int, error) {
+	return 0, errPeekUnsupported
+}
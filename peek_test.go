@@ -0,0 +1,327 @@
+package proxyproto
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPeekDetectionConsumesNothingWithoutHeader(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{Listener: l, PeekDetection: true}
+	defer pl.Close()
+
+	cliResult := make(chan error)
+	go func() {
+		conn, err := net.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			cliResult <- err
+			return
+		}
+		defer conn.Close()
+
+		if _, err := conn.Write([]byte("PING")); err != nil {
+			cliResult <- err
+			return
+		}
+		close(cliResult)
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	proxyprotoConn := conn.(*Conn)
+	if proxyprotoConn.ProxyHeader() != nil {
+		t.Fatal("expected no header")
+	}
+
+	// The bytes are still on the socket, so they can be read from the
+	// underlying connection.
+	recv := make([]byte, 4)
+	if _, err := io.ReadFull(proxyprotoConn.Raw(), recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.Equal(recv, []byte("PING")) {
+		t.Fatalf("bad: %v", recv)
+	}
+	if err := <-cliResult; err != nil {
+		t.Fatalf("client error: %v", err)
+	}
+}
+
+func TestPeekDetectionWaitsForConclusivePrefix(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{Listener: l, PeekDetection: true}
+	defer pl.Close()
+
+	cliResult := make(chan error)
+	go func() {
+		conn, err := net.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			cliResult <- err
+			return
+		}
+		defer conn.Close()
+
+		// A lone "P" could start a version 1 signature.
+		for _, segment := range []string{"P", "ING"} {
+			if _, err := conn.Write([]byte(segment)); err != nil {
+				cliResult <- err
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		close(cliResult)
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	proxyprotoConn := conn.(*Conn)
+	if proxyprotoConn.ProxyHeader() != nil {
+		t.Fatal("expected no header")
+	}
+	recv := make([]byte, 4)
+	if _, err := io.ReadFull(proxyprotoConn.Raw(), recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.Equal(recv, []byte("PING")) {
+		t.Fatalf("bad: %v", recv)
+	}
+	if err := <-cliResult; err != nil {
+		t.Fatalf("client error: %v", err)
+	}
+}
+
+func TestPeekDetectionPartialPrefixAtEOF(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{Listener: l, PeekDetection: true, ReadHeaderTimeout: 5 * time.Second}
+	defer pl.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write([]byte("PR"))
+		_ = conn.(*net.TCPConn).CloseWrite()
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	// The partial signature is returned at EOF, without waiting for the
+	// header timeout.
+	start := time.Now()
+	recv, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(recv) != "PR" {
+		t.Fatalf("bad: %q", recv)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the read to end at EOF, took %v", elapsed)
+	}
+}
+
+func TestSignatureConclusive(t *testing.T) {
+	for data, want := range map[string]bool{
+		"P":                  false,
+		"PROX":               false,
+		"PROXY":              true,
+		"PING":               true,
+		"\r\n\r\n":           false,
+		string(SIGV2):        true,
+		string(SIGV2[:11]):   false,
+		"\r\n\r\nGET":        true,
+		"GET / HTTP/1.1\r\n": true,
+	} {
+		if got := signatureConclusive([]byte(data)); got != want {
+			t.Fatalf("%q: expected %v, got %v", data, want, got)
+		}
+	}
+}
+
+func TestPeekDetectionReadsHeader(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{Listener: l, PeekDetection: true}
+	defer pl.Close()
+
+	cliResult := make(chan error)
+	go func() {
+		conn, err := net.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			cliResult <- err
+			return
+		}
+		defer conn.Close()
+
+		header := &Header{
+			Version:           1,
+			Command:           PROXY,
+			TransportProtocol: TCPv4,
+			SourceAddr: &net.TCPAddr{
+				IP:   net.ParseIP("10.1.1.1"),
+				Port: 1000,
+			},
+			DestinationAddr: &net.TCPAddr{
+				IP:   net.ParseIP("20.2.2.2"),
+				Port: 2000,
+			},
+		}
+		if _, err := header.WriteTo(conn); err != nil {
+			cliResult <- err
+			return
+		}
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			cliResult <- err
+			return
+		}
+		close(cliResult)
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	recv := make([]byte, 4)
+	if _, err := io.ReadFull(conn, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.Equal(recv, []byte("ping")) {
+		t.Fatalf("bad: %v", recv)
+	}
+	if addr := conn.RemoteAddr().(*net.TCPAddr); addr.IP.String() != "10.1.1.1" {
+		t.Fatalf("bad: %v", addr)
+	}
+	if err := <-cliResult; err != nil {
+		t.Fatalf("client error: %v", err)
+	}
+}
+
+func TestPeekHeader(t *testing.T) {
+	var cases = []struct {
+		name   string
+		data   string
+		header bool
+	}{
+		{"with header", "PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\nping", true},
+		{"without header", "ping", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+
+			go func() {
+				_, _ = client.Write([]byte(tc.data))
+			}()
+
+			header, conn, err := PeekHeader(server, time.Second)
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if (header != nil) != tc.header {
+				t.Fatalf("unexpected header: %v", header)
+			}
+			if tc.header && header.SourceAddr.String() != "10.1.1.1:1000" {
+				t.Fatalf("bad source address: %v", header.SourceAddr)
+			}
+
+			recv := make([]byte, 4)
+			if _, err := io.ReadFull(conn, recv); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if !bytes.Equal(recv, []byte("ping")) {
+				t.Fatalf("bad: %v", recv)
+			}
+		})
+	}
+}
+
+func TestPeekHeaderLargeTLVs(t *testing.T) {
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr:        v4addr,
+		DestinationAddr:   v4addr,
+	}
+	if err := header.SetTLVs([]TLV{{Type: PP2_TYPE_AUTHORITY, Value: bytes.Repeat([]byte("a"), 1000)}}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	raw, err := header.Format()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	go func() {
+		_, _ = client.Write(append(raw, "ping"...))
+	}()
+
+	got, conn, err := PeekHeader(server, time.Second)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if authority, ok := findTLV(got.rawTLVs, PP2_TYPE_AUTHORITY); !ok || len(authority) != 1000 {
+		t.Fatalf("expected the authority TLV, got %q", authority)
+	}
+	recv := make([]byte, 4)
+	if _, err := io.ReadFull(conn, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.Equal(recv, []byte("ping")) {
+		t.Fatalf("bad: %v", recv)
+	}
+}
+
+func TestPeekHeaderTimeout(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	header, conn, err := PeekHeader(server, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if header != nil || conn != server {
+		t.Fatalf("expected no header and the original connection, got %v and %v", header, conn)
+	}
+}
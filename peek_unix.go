@@ -0,0 +1,43 @@
+//go:build unix
+
+package proxyproto
+
+import (
+	"errors"
+	"syscall"
+)
+
+// peekSocket copies the bytes available on the socket into b, without
+// consuming them. It blocks until the bytes available are enough for done
+// to return true, bounded by the read deadline of the socket, unless the
+// peer shut its writing side down, see peerClosed. It returns zero with no
+// error at EOF.
+func peekSocket(conn syscall.Conn, b []byte, done func(b []byte) bool) (int, error) {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	var peekErr error
+	err = rawConn.Read(func(fd uintptr) bool {
+		n, _, peekErr = syscall.Recvfrom(int(fd), b, syscall.MSG_PEEK)
+		if errors.Is(peekErr, syscall.EAGAIN) {
+			// Nothing to peek yet, wait for the socket to be readable.
+			return false
+		}
+		if peekErr == nil && n > 0 && !done(b[:n]) && !peerClosed(fd) {
+			// Wait for more bytes to arrive, the runtime poller being
+			// edge-triggered.
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if peekErr != nil {
+		return 0, peekErr
+	}
+	return n, nil
+}
@@ -1,9 +1,13 @@
 package proxyproto
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // PolicyFunc can be used to decide whether to trust the PROXY info from
@@ -59,7 +63,7 @@ const (
 // address doesn't match the skipHeaderCIDR.
 func SkipProxyHeaderForCIDR(skipHeaderCIDR *net.IPNet, def Policy) PolicyFunc {
 	return func(upstream net.Addr) (Policy, error) {
-		ip, err := ipFromAddr(upstream)
+		ip, err := IPFromAddr(upstream)
 		if err != nil {
 			return def, err
 		}
@@ -79,6 +83,40 @@ func WithPolicy(p Policy) func(*Conn) {
 	}
 }
 
+// VersionPolicyFunc decides the policy applied to a received header given
+// its version, 1 or 2, and the policy of the connection, e.g. to trust the
+// version 2 headers of a load balancer while ignoring the version 1 headers
+// of legacy scripts. Returning REQUIRE is the same as USE, and SKIP the same
+// as IGNORE, as the header has already been read.
+type VersionPolicyFunc func(version byte, policy Policy) Policy
+
+// PolicyByVersion returns a VersionPolicyFunc applying v1 to the version 1
+// headers and v2 to the version 2 headers of the connections whose policy
+// is USE or REQUIRE. The headers of the connections with another policy are
+// handled as that policy says, so that the version of a header never makes
+// an upstream more trusted than it is.
+func PolicyByVersion(v1, v2 Policy) VersionPolicyFunc {
+	return func(version byte, policy Policy) Policy {
+		if policy != USE && policy != REQUIRE {
+			return policy
+		}
+		if version == 1 {
+			return v1
+		}
+		return v2
+	}
+}
+
+// WithVersionPolicy makes the connection decide the policy applied to its
+// header once its version is known, when passed as option to NewConn(). The
+// policy of the connection still decides whether a header is looked for,
+// and required.
+func WithVersionPolicy(f VersionPolicyFunc) func(*Conn) {
+	return func(c *Conn) {
+		c.versionPolicy = f
+	}
+}
+
 // LaxWhiteListPolicy returns a PolicyFunc which decides whether the
 // upstream ip is allowed to send a proxy header based on a list of allowed
 // IP addresses and IP ranges. In case upstream IP is not in list the proxy
@@ -133,7 +171,7 @@ func MustStrictWhiteListPolicy(allowed []string) PolicyFunc {
 
 func whitelistPolicy(allowed []func(net.IP) bool, def Policy) PolicyFunc {
 	return func(upstream net.Addr) (Policy, error) {
-		upstreamIP, err := ipFromAddr(upstream)
+		upstreamIP, err := IPFromAddr(upstream)
 		if err != nil {
 			// something is wrong with the source IP, better reject the connection
 			return REJECT, err
@@ -155,7 +193,7 @@ func parse(allowed []string) ([]func(net.IP) bool, error) {
 		if strings.LastIndex(allowFrom, "/") > 0 {
 			_, ipRange, err := net.ParseCIDR(allowFrom)
 			if err != nil {
-				return nil, fmt.Errorf("proxyproto: given string %q is not a valid IP range: %v", allowFrom, err)
+				return nil, fmt.Errorf("proxyproto: given string %q is not a valid IP range: %w", allowFrom, err)
 			}
 
 			a[i] = ipRange.Contains
@@ -172,7 +210,10 @@ func parse(allowed []string) ([]func(net.IP) bool, error) {
 	return a, nil
 }
 
-func ipFromAddr(upstream net.Addr) (net.IP, error) {
+// IPFromAddr returns the IP address of the upstream, e.g. the one passed to
+// a PolicyFunc, so that policies built outside of this package parse it the
+// same way.
+func IPFromAddr(upstream net.Addr) (net.IP, error) {
 	upstreamString, _, err := net.SplitHostPort(upstream.String())
 	if err != nil {
 		return nil, err
@@ -192,7 +233,7 @@ func ipFromAddr(upstream net.Addr) (net.IP, error) {
 // is bound to multiple interfaces but wants to allow on only one interface.
 func IgnoreProxyHeaderNotOnInterface(allowedIP net.IP) ConnPolicyFunc {
 	return func(connOpts ConnPolicyOptions) (Policy, error) {
-		ip, err := ipFromAddr(connOpts.Downstream)
+		ip, err := IPFromAddr(connOpts.Downstream)
 		if err != nil {
 			return REJECT, err
 		}
@@ -204,3 +245,103 @@ func IgnoreProxyHeaderNotOnInterface(allowedIP net.IP) ConnPolicyFunc {
 		return IGNORE, nil
 	}
 }
+
+// DNSWhiteList is a trusted proxy list built from hostnames, e.g. the
+// internal names of load balancers whose addresses change over time. The
+// hostnames are resolved when the list is created and then refreshed on an
+// interval. Its Policy method can be used as a PolicyFunc.
+//
+// Hostnames are refreshed one by one: one failing to resolve keeps the
+// addresses it last resolved to, while the others are updated.
+type DNSWhiteList struct {
+	hostnames []string
+	def       Policy
+	lookup    func(ctx context.Context, host string) ([]net.IP, error)
+
+	resolved  atomic.Pointer[map[string][]net.IP]
+	refresher *Refresher
+}
+
+// NewDNSWhiteList resolves the given hostnames and returns a DNSWhiteList
+// which refreshes them every refresh interval. Upstream addresses matching
+// one of the resolved IPs are allowed to send a proxy header, for others the
+// def policy is returned. A refresh interval <= 0 disables refreshing, see
+// NewRefresher.
+//
+// An error is returned if one of the hostnames cannot be resolved initially.
+// Close must be called to stop refreshing once the list is no longer used.
+func NewDNSWhiteList(hostnames []string, refresh time.Duration, def Policy) (*DNSWhiteList, error) {
+	return newDNSWhiteList(hostnames, refresh, def, func(ctx context.Context, host string) ([]net.IP, error) {
+		return net.DefaultResolver.LookupIP(ctx, "ip", host)
+	})
+}
+
+func newDNSWhiteList(hostnames []string, refresh time.Duration, def Policy, lookup func(ctx context.Context, host string) ([]net.IP, error)) (*DNSWhiteList, error) {
+	d := &DNSWhiteList{
+		hostnames: hostnames,
+		def:       def,
+		lookup:    lookup,
+	}
+
+	resolved := make(map[string][]net.IP, len(hostnames))
+	for _, host := range hostnames {
+		ips, err := d.lookup(context.Background(), host)
+		if err != nil {
+			return nil, fmt.Errorf("proxyproto: can't resolve %q: %w", host, err)
+		}
+		resolved[host] = ips
+	}
+	d.resolved.Store(&resolved)
+	d.refresher = NewRefresher(refresh, d.Refresh)
+
+	return d, nil
+}
+
+// Policy implements PolicyFunc.
+func (d *DNSWhiteList) Policy(upstream net.Addr) (Policy, error) {
+	upstreamIP, err := IPFromAddr(upstream)
+	if err != nil {
+		// something is wrong with the source IP, better reject the connection
+		return REJECT, err
+	}
+
+	for _, ips := range *d.resolved.Load() {
+		for _, ip := range ips {
+			if ip.Equal(upstreamIP) {
+				return USE, nil
+			}
+		}
+	}
+
+	return d.def, nil
+}
+
+// Refresh resolves the hostnames again. It is called periodically when a
+// refresh interval is set, but may also be called manually. It returns the
+// errors of the hostnames which can't be resolved.
+func (d *DNSWhiteList) Refresh(ctx context.Context) error {
+	prev := *d.resolved.Load()
+	resolved := make(map[string][]net.IP, len(d.hostnames))
+	var errs []error
+	for _, host := range d.hostnames {
+		ips, err := d.lookup(ctx, host)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("proxyproto: can't resolve %q: %w", host, err))
+			ips = prev[host]
+		}
+		resolved[host] = ips
+	}
+	d.resolved.Store(&resolved)
+	return errors.Join(errs...)
+}
+
+// OnRefreshError sets the hook called with the errors of the periodic
+// refreshes, see Refresher.OnError.
+func (d *DNSWhiteList) OnRefreshError(f func(err error)) {
+	d.refresher.OnError(f)
+}
+
+// Close stops refreshing the hostnames.
+func (d *DNSWhiteList) Close() error {
+	return d.refresher.Close()
+}
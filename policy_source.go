@@ -0,0 +1,190 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrPolicySourceEnded is returned by NewSourceWhiteList when the source
+// stops before providing its first list.
+var ErrPolicySourceEnded = errors.New("proxyproto: policy source ended before providing trusted proxies")
+
+// PolicySource is a source of trusted proxy addresses which change over time,
+// e.g. a file, or the catalog of a service discovery system such as Consul or
+// etcd, for the list of trusted proxies to track the fleet of edge load
+// balancers. Sources backed by such systems are implemented on top of their
+// clients, e.g. with Consul blocking queries or etcd watches.
+type PolicySource interface {
+	// Watch calls update with the current list of allowed IP addresses and
+	// IP ranges, in the format of LaxWhiteListPolicy, and then again each
+	// time it changes, until ctx is done or the source fails for good. The
+	// calls to update are not concurrent.
+	Watch(ctx context.Context, update func(allowed []string)) error
+}
+
+// SourceWhiteList is a trusted proxy list kept in sync with a PolicySource.
+// Its Policy method can be used as a PolicyFunc.
+//
+// Lists holding an invalid IP address or IP range are skipped as a whole:
+// the previous list stays in effect until the source provides a valid one.
+type SourceWhiteList struct {
+	def     Policy
+	onError func(err error)
+	policy  atomic.Pointer[PolicyFunc]
+	cancel  context.CancelFunc
+	done    chan struct{}
+	err     error
+}
+
+// NewSourceWhiteList starts watching the source, and returns a
+// SourceWhiteList once the source provided a valid list. Upstream addresses
+// matching the list are allowed to send a proxy header, for others the def
+// policy is returned. If onError is not nil, it's called with the invalid
+// lists skipped, and the error the source stops with, if any.
+//
+// An error is returned if ctx is done, or the source stops, before that.
+// Close must be called to stop watching the source once the list is no
+// longer used.
+func NewSourceWhiteList(ctx context.Context, source PolicySource, def Policy, onError func(err error)) (*SourceWhiteList, error) {
+	watchCtx, cancel := context.WithCancel(context.Background())
+	w := &SourceWhiteList{
+		def:     def,
+		onError: onError,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+
+	ready := make(chan struct{})
+	var readyOnce sync.Once
+	go func() {
+		defer close(w.done)
+		w.err = source.Watch(watchCtx, func(allowed []string) {
+			if w.update(allowed) {
+				readyOnce.Do(func() { close(ready) })
+			}
+		})
+		select {
+		case <-ready:
+			// The failures before the first list are returned instead.
+			if w.err != nil && !errors.Is(w.err, context.Canceled) && w.onError != nil {
+				w.onError(w.err)
+			}
+		default:
+		}
+	}()
+
+	select {
+	case <-ready:
+		return w, nil
+	case <-w.done:
+		cancel()
+		if w.err != nil {
+			return nil, w.err
+		}
+		return nil, ErrPolicySourceEnded
+	case <-ctx.Done():
+		cancel()
+		<-w.done
+		return nil, ctx.Err()
+	}
+}
+
+// update replaces the list, and tells whether it was valid.
+func (w *SourceWhiteList) update(allowed []string) bool {
+	allowFrom, err := parse(allowed)
+	if err != nil {
+		if w.onError != nil {
+			w.onError(err)
+		}
+		return false
+	}
+	policy := whitelistPolicy(allowFrom, w.def)
+	w.policy.Store(&policy)
+	return true
+}
+
+// Policy implements PolicyFunc.
+func (w *SourceWhiteList) Policy(upstream net.Addr) (Policy, error) {
+	return (*w.policy.Load())(upstream)
+}
+
+// Close stops watching the source, and waits for it to stop.
+func (w *SourceWhiteList) Close() error {
+	w.cancel()
+	<-w.done
+	return nil
+}
+
+// FileSource is a PolicySource reading the trusted proxies from a file,
+// e.g. one rendered by consul-template or confd, with one IP address or IP
+// range per line. Empty lines and lines starting with # are ignored. The
+// file is checked for changes on an interval.
+type FileSource struct {
+	// Path is the path of the file.
+	Path string
+	// Interval is the time between checks of the file. If <= 0, five
+	// seconds are used.
+	Interval time.Duration
+	// OnError, if set, is called with the errors reading the file. The
+	// previous list is kept on errors.
+	OnError func(err error)
+}
+
+// Watch implements PolicySource. Besides the cancellation of ctx, it only
+// fails if the file can't be read initially.
+func (s *FileSource) Watch(ctx context.Context, update func(allowed []string)) error {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return err
+	}
+	update(parseSourceFile(data))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		next, err := os.ReadFile(s.Path)
+		if err != nil {
+			if s.OnError != nil {
+				s.OnError(err)
+			}
+			continue
+		}
+		if !bytes.Equal(next, data) {
+			data = next
+			update(parseSourceFile(data))
+		}
+	}
+}
+
+// parseSourceFile returns the entries of a file read by a FileSource.
+func parseSourceFile(data []byte) []string {
+	var allowed []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		allowed = append(allowed, line)
+	}
+	return allowed
+}
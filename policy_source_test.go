@@ -0,0 +1,91 @@
+package proxyproto
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSourceWhiteListWithFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxies")
+	if err := os.WriteFile(path, []byte("# edge load balancers\n10.0.0.1\n\n192.168.0.0/24\n"), 0o644); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	invalid := make(chan error, 1)
+	source := &FileSource{Path: path, Interval: 10 * time.Millisecond}
+	list, err := NewSourceWhiteList(context.Background(), source, REJECT, func(err error) {
+		select {
+		case invalid <- err:
+		default:
+		}
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer list.Close()
+
+	policyOf := func(ip string) Policy {
+		policy, err := list.Policy(&net.TCPAddr{IP: net.ParseIP(ip), Port: 1000})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return policy
+	}
+	if policy := policyOf("192.168.0.7"); policy != USE {
+		t.Fatalf("expected USE, got %v", policy)
+	}
+	if policy := policyOf("10.0.0.2"); policy != REJECT {
+		t.Fatalf("expected REJECT, got %v", policy)
+	}
+
+	// Changes of the file are picked up.
+	if err := os.WriteFile(path, []byte("10.0.0.2\n"), 0o644); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for policyOf("10.0.0.2") != USE {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the change to be picked up")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// An invalid list is reported and skipped.
+	if err := os.WriteFile(path, []byte("not an address\n"), 0o644); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	select {
+	case <-invalid:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the invalid list to be reported")
+	}
+	if policy := policyOf("10.0.0.2"); policy != USE {
+		t.Fatalf("expected the previous list to be kept, got %v", policy)
+	}
+}
+
+func TestSourceWhiteListMissingFile(t *testing.T) {
+	source := &FileSource{Path: filepath.Join(t.TempDir(), "missing")}
+	if _, err := NewSourceWhiteList(context.Background(), source, REJECT, nil); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected %v, got %v", os.ErrNotExist, err)
+	}
+}
+
+func TestFileSourceNegativeInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxies")
+	if err := os.WriteFile(path, []byte("10.0.0.1\n"), 0o644); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// A negative interval falls back to the default rather than panicking.
+	list, err := NewSourceWhiteList(context.Background(), &FileSource{Path: path, Interval: -time.Second}, REJECT, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	list.Close()
+}
@@ -1,8 +1,13 @@
 package proxyproto
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"net"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type failingAddr struct{}
@@ -249,3 +254,162 @@ func TestIgnoreProxyHeaderNotOnInterface(t *testing.T) {
 	}
 
 }
+
+func TestDNSWhiteListPolicy(t *testing.T) {
+	var lbAddr atomic.Value
+	lbAddr.Store("10.0.0.2")
+	var failLookup atomic.Bool
+	lookup := func(_ context.Context, host string) ([]net.IP, error) {
+		if host != "lb.internal" {
+			return nil, fmt.Errorf("no such host %q", host)
+		}
+		if failLookup.Load() {
+			return nil, fmt.Errorf("lookup failed")
+		}
+		return []net.IP{net.ParseIP(lbAddr.Load().(string))}, nil
+	}
+
+	if _, err := newDNSWhiteList([]string{"unknown.internal"}, 0, REJECT, lookup); err == nil {
+		t.Fatal("Expected error, got none")
+	}
+
+	d, err := newDNSWhiteList([]string{"lb.internal"}, 0, REJECT, lookup)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer d.Close()
+
+	check := func(addr string, expected Policy) {
+		t.Helper()
+		upstream, err := net.ResolveTCPAddr("tcp", addr)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		policy, err := d.Policy(upstream)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if policy != expected {
+			t.Fatalf("Expected policy %v for %s, got %v", expected, addr, policy)
+		}
+	}
+
+	check("10.0.0.2:45738", USE)
+	check("10.0.0.3:45738", REJECT)
+
+	lbAddr.Store("10.0.0.3")
+	if err := d.Refresh(context.Background()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	check("10.0.0.2:45738", REJECT)
+	check("10.0.0.3:45738", USE)
+
+	// Failed lookups keep the previously resolved addresses.
+	failLookup.Store(true)
+	if err := d.Refresh(context.Background()); err == nil {
+		t.Fatal("Expected error, got none")
+	}
+	check("10.0.0.3:45738", USE)
+
+	if _, err := d.Policy(failingAddr{}); err == nil {
+		t.Fatal("Expected error, got none")
+	}
+}
+
+func TestDNSWhiteListPolicyRefreshesOnInterval(t *testing.T) {
+	var lookups atomic.Int32
+	lookup := func(_ context.Context, _ string) ([]net.IP, error) {
+		lookups.Add(1)
+		return []net.IP{net.ParseIP("10.0.0.2")}, nil
+	}
+
+	d, err := newDNSWhiteList([]string{"lb.internal"}, 10*time.Millisecond, IGNORE, lookup)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer d.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for lookups.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected periodic refreshes, got %d lookups", lookups.Load())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPolicyByVersion(t *testing.T) {
+	f := PolicyByVersion(IGNORE, USE)
+	var cases = []struct {
+		version byte
+		policy  Policy
+		want    Policy
+	}{
+		{1, USE, IGNORE},
+		{2, USE, USE},
+		{1, REQUIRE, IGNORE},
+		{2, REQUIRE, USE},
+		{2, IGNORE, IGNORE},
+		{2, REJECT, REJECT},
+	}
+	for _, tc := range cases {
+		if got := f(tc.version, tc.policy); got != tc.want {
+			t.Fatalf("version %d with policy %v: expected %v, got %v", tc.version, tc.policy, tc.want, got)
+		}
+	}
+}
+
+func TestConnWithVersionPolicy(t *testing.T) {
+	var cases = []struct {
+		name       string
+		version    byte
+		err        error
+		remoteAddr net.Addr
+	}{
+		{"v1 ignored", 1, nil, nil},
+		{"v2 used", 2, nil, v4addr},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+
+			go func() {
+				_, _ = WriteHeaderAndPayload(client, HeaderProxyFromAddrs(tc.version, v4addr, v4addr), []byte("ping"))
+			}()
+
+			conn := NewConn(server, WithPolicy(REQUIRE), WithVersionPolicy(PolicyByVersion(IGNORE, USE)))
+			recv := make([]byte, 4)
+			if _, err := io.ReadFull(conn, recv); err != tc.err {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if string(recv) != "ping" {
+				t.Fatalf("expected ping, got %q", recv)
+			}
+			if tc.remoteAddr == nil {
+				if conn.ProxyHeader() != nil {
+					t.Fatalf("expected the header to be ignored, got %v", conn.ProxyHeader())
+				}
+				if conn.RemoteAddr() != server.RemoteAddr() {
+					t.Fatalf("expected remote address %v, got %v", server.RemoteAddr(), conn.RemoteAddr())
+				}
+			} else if conn.RemoteAddr().String() != tc.remoteAddr.String() {
+				t.Fatalf("expected remote address %v, got %v", tc.remoteAddr, conn.RemoteAddr())
+			}
+		})
+	}
+
+	// The version can make a header rejected.
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	go func() {
+		_, _ = WriteHeaderAndPayload(client, HeaderProxyFromAddrs(1, v4addr, v4addr), []byte("ping"))
+	}()
+	conn := NewConn(server, WithVersionPolicy(PolicyByVersion(REJECT, USE)))
+	if _, err := conn.Read(make([]byte, 4)); err != ErrSuperfluousProxyHeader {
+		t.Fatalf("expected error %v, got %v", ErrSuperfluousProxyHeader, err)
+	}
+}
@@ -0,0 +1,128 @@
+package proxyproto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// ProbeResult classifies the way a backend handles the PROXY protocol.
+type ProbeResult int
+
+const (
+	// ProbeInconclusive means the backend closed the connections both with
+	// and without a header, e.g. it expects a different header, or closes
+	// idle connections before the probe timeout.
+	ProbeInconclusive ProbeResult = iota
+	// ProbeRequires means the backend kept the connection with a header
+	// open, but closed the one without.
+	ProbeRequires
+	// ProbeTolerates means the backend kept both connections open, e.g. it
+	// handles the protocol optionally.
+	ProbeTolerates
+	// ProbeRejects means the backend closed the connection with a header,
+	// but kept the one without open, e.g. it doesn't speak the protocol.
+	ProbeRejects
+)
+
+func (r ProbeResult) String() string {
+	switch r {
+	case ProbeInconclusive:
+		return "inconclusive"
+	case ProbeRequires:
+		return "requires"
+	case ProbeTolerates:
+		return "tolerates"
+	case ProbeRejects:
+		return "rejects"
+	}
+	return fmt.Sprintf("ProbeResult(%d)", int(r))
+}
+
+// Prober tells whether backends expect the PROXY protocol, so that
+// deployment tooling can catch configuration drift between load balancers
+// and backends.
+//
+// It connects to the backend twice, with and without a header, followed by
+// the payload, and watches whether the backend closes each connection within
+// the timeout. Backends waiting for the rest of a request keep the
+// connections they accept open, while the ones failing to parse what they
+// received close them.
+type Prober struct {
+	// Dialer establishes the connections. If nil, a zero net.Dialer is used.
+	Dialer ContextDialer
+	// Version is the protocol version of the header sent. If zero, the
+	// latest version is used.
+	Version byte
+	// Payload is sent on both connections, after the header if any, e.g.
+	// the start of a request the backend waits for the rest of. Without a
+	// payload, backends requiring a header only notice its absence once
+	// their header timeout expires, which must then be shorter than the
+	// timeout of the prober.
+	Payload []byte
+	// Timeout is the time a connection is watched for before deeming it
+	// accepted. If zero, two seconds are used.
+	Timeout time.Duration
+}
+
+// Probe classifies the way the backend listening at the address on the named
+// network handles the PROXY protocol. An error is returned if the backend
+// can't be reached.
+func (p *Prober) Probe(ctx context.Context, network, address string) (ProbeResult, error) {
+	dialer := p.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+
+	withHeader, err := p.accepted(ctx, &Dialer{Dialer: dialer, Version: p.Version}, network, address)
+	if err != nil {
+		return ProbeInconclusive, err
+	}
+	withoutHeader, err := p.accepted(ctx, dialer, network, address)
+	if err != nil {
+		return ProbeInconclusive, err
+	}
+
+	switch {
+	case withHeader && withoutHeader:
+		return ProbeTolerates, nil
+	case withHeader:
+		return ProbeRequires, nil
+	case withoutHeader:
+		return ProbeRejects, nil
+	}
+	return ProbeInconclusive, nil
+}
+
+// accepted tells whether the backend keeps a connection dialed with dialer
+// open for the timeout of the prober.
+func (p *Prober) accepted(ctx context.Context, dialer ContextDialer, network, address string) (bool, error) {
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = 2 * time.Second
+	}
+
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return false, err
+	}
+	if len(p.Payload) > 0 {
+		if _, err := conn.Write(p.Payload); err != nil {
+			// The backend gave up on the connection already.
+			return false, nil
+		}
+	}
+
+	// Drain whatever the backend sends, e.g. a banner or an error
+	// response, until it closes the connection or the timeout expires.
+	_, err = io.Copy(io.Discard, conn)
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout(), nil
+}
@@ -0,0 +1,58 @@
+package proxyproto
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProber(t *testing.T) {
+	var cases = []struct {
+		name   string
+		policy Policy
+		result ProbeResult
+	}{
+		{"requires", REQUIRE, ProbeRequires},
+		{"tolerates", USE, ProbeTolerates},
+		{"rejects", REJECT, ProbeRejects},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			pl := &Listener{Listener: l, Policy: func(net.Addr) (Policy, error) { return tc.policy, nil }}
+			defer pl.Close()
+
+			go func() {
+				for {
+					conn, err := pl.Accept()
+					if err != nil {
+						return
+					}
+					go func() {
+						defer conn.Close()
+						buf := make([]byte, 16)
+						for {
+							if _, err := conn.Read(buf); err != nil {
+								return
+							}
+						}
+					}()
+				}
+			}()
+
+			prober := &Prober{Payload: []byte("GET"), Timeout: 200 * time.Millisecond}
+			result, err := prober.Probe(context.Background(), "tcp", l.Addr().String())
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if result != tc.result {
+				t.Fatalf("expected %v, got %v", tc.result, result)
+			}
+		})
+	}
+}
@@ -6,8 +6,8 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"sync"
-	"sync/atomic"
 	"time"
 )
 
@@ -16,6 +16,10 @@ var (
 	// be read from the wire, if Listener.ReaderHeaderTimeout is not set.
 	// It's kept as a global variable so to make it easier to find and override,
 	// e.g. go build -ldflags -X "github.com/pires/go-proxyproto.DefaultReadHeaderTimeout=1s"
+	//
+	// Listeners created with NewListener take a copy of it, see
+	// WithDefaultReadHeaderTimeout. Changing it while listeners created
+	// otherwise are accepting connections is racy.
 	DefaultReadHeaderTimeout = 10 * time.Second
 
 	// ErrInvalidUpstream should be returned when an upstream connection address
@@ -32,7 +36,8 @@ var (
 // timeout to < 0.
 //
 // Only one of Policy or ConnPolicy should be provided. If both are provided then
-// a panic would occur during accept.
+// a panic would occur during accept. Use SetPolicy or SetConnPolicy to change
+// them once the listener is accepting connections.
 type Listener struct {
 	Listener net.Listener
 	// Deprecated: use ConnPolicyFunc instead. This will be removed in future release.
@@ -40,25 +45,209 @@ type Listener struct {
 	ConnPolicy        ConnPolicyFunc
 	ValidateHeader    Validator
 	ReadHeaderTimeout time.Duration
+	// RetainRawHeader keeps the exact bytes of received headers, available
+	// through Header.Raw. It is off by default to avoid the memory cost.
+	RetainRawHeader bool
+	// PeekDetection looks for the PROXY signature without consuming any
+	// bytes from the socket, see WithPeekDetection.
+	PeekDetection bool
+	// SkipMalformedTLVs drops malformed TLVs of received headers instead of
+	// failing on them, see the SkipMalformedTLVs option.
+	SkipMalformedTLVs bool
+	// LazyTLVThreshold, if positive, makes the accepted connections leave
+	// the TLV blocks larger than it unread until requested, see LazyTLVs.
+	LazyTLVThreshold int
+	// MaxTLVCount, if positive, bounds the number of TLVs of received
+	// headers, see WithMaxTLVCount.
+	MaxTLVCount int
+	// OnTooManyTLVs is called for the headers rejected for carrying more
+	// than MaxTLVCount TLVs, see the OnTooManyTLVs option.
+	OnTooManyTLVs TLVCountFunc
+	// Clock, if set, tells the time of the listener and of the accepted
+	// connections, see WithClock.
+	Clock Clock
+	// VersionPolicy, if set, decides the policy applied to received headers
+	// given their version, see WithVersionPolicy.
+	VersionPolicy VersionPolicyFunc
+	// MaxStackedHeaders, if above 1, makes the accepted connections read
+	// up to as many stacked headers, see WithStackedHeaders.
+	MaxStackedHeaders int
+	// OnWarning is called for recoverable anomalies of received headers,
+	// see the OnWarning option.
+	OnWarning WarningFunc
+	// HeaderPool, if set, recycles the headers of closed connections, see
+	// the WithHeaderPool option.
+	HeaderPool *HeaderPool
+	// OnHeaderLatency is called with the time taken by each connection to
+	// send its header, see the OnHeaderLatency option.
+	OnHeaderLatency HeaderLatencyFunc
+	// OnHeaderStats is called with the stats of each header received, see
+	// the OnHeaderStats option.
+	OnHeaderStats HeaderStatsFunc
+	// KeepAlive is the TCP keep-alive period of accepted connections, so that
+	// idle proxied connections behind a NAT don't silently die. If zero, the
+	// keep-alive settings of the underlying listener are left untouched. If
+	// negative, keep-alives are disabled.
+	KeepAlive time.Duration
+	// ZonePolicy tells how IPv6 addresses with a zone are handled in version
+	// 1 headers, see WithZonePolicy.
+	ZonePolicy ZonePolicy
+	// MappedIPv4Policy tells how IPv4-mapped IPv6 addresses of received
+	// headers are handled, see WithMappedIPv4Policy.
+	MappedIPv4Policy MappedIPv4Policy
+	// HeaderHMACKey, if set, is the shared key authenticating received
+	// headers, see WithHeaderHMAC.
+	HeaderHMACKey []byte
+	// HeaderKeyring, if set, holds the keys trusted to sign received
+	// headers, see WithHeaderVerifier.
+	HeaderKeyring *Keyring
+	// TrustedClientCerts, if set, makes the header of connections only be
+	// honored if their TLS client certificate is accepted, see
+	// WithTrustedClientCerts.
+	TrustedClientCerts ClientCertMatcher
+	// BanList, if set, records the header failures of connections, and the
+	// connections of banned upstreams are handled with the policy of the
+	// list instead of the listener's one, see NewBanList.
+	BanList *BanList
+	// HeaderDumper, if set, is handed the first bytes of connections whose
+	// header failed, see NewHeaderDumper.
+	HeaderDumper *HeaderDumper
+	// AuditLog, if set, records each accepted connection once closed, see
+	// WithAuditLog. The connections of the SKIP policy aren't recorded.
+	AuditLog *AuditLog
+	// PreserveInterfaces makes Accept return connections implementing the
+	// optional interfaces of the underlying ones only, rather than *Conn,
+	// see PreserveInterfaces.
+	PreserveInterfaces bool
+	// MaxConnections, if positive, caps the number of connections accepted
+	// and not closed yet. Once reached, Accept waits for connections to be
+	// closed before accepting new ones, so that connection storms queue up
+	// in the kernel backlog rather than allocating header buffers.
+	// Connections handled as regular ones with the SKIP policy aren't
+	// counted. It must not be changed once the listener is accepting
+	// connections.
+	MaxConnections int
+	// CloseOnHeaderError makes the accepted connections close themselves
+	// when their header is malformed or disallowed, see CloseOnHeaderError.
+	CloseOnHeaderError bool
+	// RejectResponse, if set, is written to the accepted connections whose
+	// header is malformed or disallowed before they close themselves, see
+	// RejectResponse, HTTPRejectResponse and SMTPRejectResponse.
+	RejectResponse []byte
+	// RequiredTLVs lists the TLV types the headers of accepted connections
+	// must carry, see RequireTLVs.
+	RequiredTLVs []PP2Type
+	// AllowedAuthorities, if set, lists the hostnames the PP2_TYPE_AUTHORITY
+	// TLV of received headers must match, see AllowAuthorities. An empty,
+	// non-nil list rejects any authority.
+	AllowedAuthorities []string
+	// ReplayCache, if set, records the PP2_TYPE_UNIQUE_ID TLV of received
+	// headers to detect duplicates, see NewReplayCache.
+	ReplayCache *ReplayCache
+	// Codec, if set, parses the headers of the accepted connections instead
+	// of the PROXY protocol, see WithCodec.
+	Codec ProxyHeaderCodec
+	// ValidationFallback, if set, makes the accepted connections whose
+	// header is rejected by ValidateHeader carry on with their socket
+	// addresses and report the rejection to it, see FallbackOnInvalidHeader.
+	ValidationFallback ValidationFallbackFunc
+	// ConnStats makes the accepted connections count their traffic, see
+	// WithStats.
+	ConnStats bool
+	// AcceptThrottle, if set, bounds the rate at which connections are
+	// accepted, see NewAcceptThrottle.
+	AcceptThrottle *AcceptThrottle
+	// Config, if set, provides the settings left unset on the listener.
+	// Use SetConfig to change it once the listener is accepting connections.
+	Config *Config
+
+	// defaultReadHeaderTimeout, if not zero, is used in place of
+	// DefaultReadHeaderTimeout, see NewListener.
+	defaultReadHeaderTimeout time.Duration
+
+	// counters are the counters of the listener, see Snapshot.
+	counters listenerCounters
+
+	// mu protects Policy, ConnPolicy and Config against concurrent swaps.
+	mu          sync.RWMutex
+	connLimiter *connLimiter
+	done        chan struct{}
+	closeOnce   sync.Once
 }
 
 // Conn is used to wrap and underlying connection which
 // may be speaking the Proxy Protocol. If it is, the RemoteAddr() will
 // return the address of the client instead of the proxy address. Each connection
 // will have its own readHeaderTimeout and readDeadline set by the Accept() call.
+//
+// The header and the payload are read with distinct deadlines: the header
+// deadline, see SetHeaderDeadline, bounds the reading of the header, whereas
+// the read deadline set by the application only applies to the payload.
 type Conn struct {
-	readDeadline      atomic.Value // time.Time
-	once              sync.Once
-	readErr           error
-	conn              net.Conn
-	bufReader         *bufio.Reader
-	reader            io.Reader
-	header            *Header
-	ProxyHeaderPolicy Policy
-	Validate          Validator
-	readHeaderTimeout time.Duration
+	deadlines          headerDeadlines
+	once               sync.Once
+	readErr            error
+	conn               net.Conn
+	bufReader          *bufio.Reader
+	header             *Header
+	ProxyHeaderPolicy  Policy
+	Validate           Validator
+	readHeaderTimeout  time.Duration
+	parseOptions       parseOptions
+	peekDetection      bool
+	onWarning          WarningFunc
+	headerPool         *HeaderPool
+	reusable           *reusableHeader
+	recycleOnce        sync.Once
+	acceptedAt         time.Time
+	headerLatency      time.Duration
+	headerParsed       bool
+	onHeaderLatency    HeaderLatencyFunc
+	policyErr          error
+	hmacKey            []byte
+	trustedClientCerts ClientCertMatcher
+	banList            *BanList
+	headerDumper       *HeaderDumper
+	capture            *captureReader
+	onHeaderStats      HeaderStatsFunc
+	onClose            func()
+	closeOnce          sync.Once
+	headerBytes        int
+	counters           *connCounters
+	closeOnHeaderError bool
+	// validationFallback keeps the socket addresses of connections whose
+	// header is rejected by Validate.
+	validationFallback   bool
+	onValidationFallback ValidationFallbackFunc
+	requiredTLVs         []PP2Type
+	allowedAuthorities   []string
+	replayCache          *ReplayCache
+	codec                ProxyHeaderCodec
+	rejectResponse       []byte
+	rejectOnce           sync.Once
+	listenerCounters     *listenerCounters
+	deferred             *deferredTLVs
+	onTooManyTLVs        TLVCountFunc
+	keyring              *Keyring
+	maxStackedHeaders    int
+	chain                ForwardedChain
+	versionPolicy        VersionPolicyFunc
+	clock                Clock
+	auditLog             *AuditLog
+	auditOnce            sync.Once
 }
 
+// WarningFunc receives the recoverable anomalies found in the header of a
+// connection, e.g. zero ports or unknown TLV types, along with the address of
+// the upstream which sent it. See Header.Warnings for the list of anomalies.
+type WarningFunc func(upstream net.Addr, warning error)
+
+// HeaderLatencyFunc receives the time elapsed between the acceptance of a
+// connection and the successful parsing of its header, along with the
+// address of the upstream which sent it. This is the key signal to detect
+// slow or misbehaving upstream proxies.
+type HeaderLatencyFunc func(upstream net.Addr, latency time.Duration)
+
 // Validator receives a header and decides whether it is a valid one
 // In case the header is not deemed valid it should return an error.
 type Validator func(*Header) error
@@ -72,6 +261,40 @@ func ValidateHeader(v Validator) func(*Conn) {
 	}
 }
 
+// ValidationFallbackFunc receives the headers rejected by the validator of a
+// connection carrying on with its socket addresses, along with the address
+// of the upstream which sent them and the error they were rejected with.
+type ValidationFallbackFunc func(upstream net.Addr, header *Header, err error)
+
+// FallbackOnInvalidHeader makes the connection carry on with the socket
+// addresses, as if no header had been sent, when its validator rejects the
+// header, when passed as option to NewConn(). The rejection is reported to f
+// instead of failing the connection. This allows stricter validation to be
+// rolled out softly, by watching what it would reject first.
+func FallbackOnInvalidHeader(f ValidationFallbackFunc) func(*Conn) {
+	return func(c *Conn) {
+		c.validationFallback = true
+		c.onValidationFallback = f
+	}
+}
+
+// WithConnPolicy decides the policy of a connection with the given
+// ConnPolicyFunc when passed as option to NewConn(), as a Listener would,
+// which is handy for code paths wrapping individual connections. If the
+// function fails, its error is returned by the first read on the connection.
+// With the SKIP policy, the connection is not looked at for a header.
+func WithConnPolicy(f ConnPolicyFunc) func(*Conn) {
+	return func(c *Conn) {
+		if f == nil {
+			return
+		}
+		c.ProxyHeaderPolicy, c.policyErr = f(ConnPolicyOptions{
+			Upstream:   c.conn.RemoteAddr(),
+			Downstream: c.conn.LocalAddr(),
+		})
+	}
+}
+
 // SetReadHeaderTimeout sets the readHeaderTimeout for a connection when passed as option to NewConn()
 func SetReadHeaderTimeout(t time.Duration) func(*Conn) {
 	return func(c *Conn) {
@@ -81,95 +304,490 @@ func SetReadHeaderTimeout(t time.Duration) func(*Conn) {
 	}
 }
 
+// RetainRawHeader keeps the exact bytes of the received header, available
+// through Header.Raw, when passed as option to NewConn()
+func RetainRawHeader() func(*Conn) {
+	return func(c *Conn) {
+		c.parseOptions.retainRaw = true
+	}
+}
+
+// OnWarning sets a callback for recoverable anomalies found in the header
+// of a connection when passed as option to NewConn(). This allows operators
+// to observe protocol oddities in the wild without connections failing.
+func OnWarning(f WarningFunc) func(*Conn) {
+	return func(c *Conn) {
+		if f != nil {
+			c.onWarning = f
+			c.parseOptions.warnings = true
+		}
+	}
+}
+
+// OnHeaderLatency sets a callback receiving the time taken by the header of
+// the connection to be received and parsed, when passed as option to
+// NewConn(). The time is measured from the connection's acceptance by a
+// Listener, or from the call to NewConn otherwise.
+func OnHeaderLatency(f HeaderLatencyFunc) func(*Conn) {
+	return func(c *Conn) {
+		c.onHeaderLatency = f
+	}
+}
+
+// acceptedAt sets the time the connection was accepted at.
+func acceptedAt(t time.Time) func(*Conn) {
+	return func(c *Conn) {
+		c.acceptedAt = t
+	}
+}
+
+// WithHeaderPool makes the connection parse its header into one recycled
+// from the pool, and give it back to the pool once closed, when passed as
+// option to NewConn(). The header must not be retained after the connection
+// is closed, see HeaderPool.
+func WithHeaderPool(pool *HeaderPool) func(*Conn) {
+	return func(c *Conn) {
+		c.headerPool = pool
+	}
+}
+
+// SkipMalformedTLVs makes the connection tolerate truncated TLVs and TLVs
+// whose value is malformed for their registered type, when passed as option
+// to NewConn(). Such TLVs are dropped and reported by Header.Warnings, while
+// the addresses and the remaining TLVs of the header are still honored.
+// Some hardware load balancers are known to emit slightly broken TLVs.
+func SkipMalformedTLVs() func(*Conn) {
+	return func(c *Conn) {
+		c.parseOptions.skipMalformedTLVs = true
+	}
+}
+
+// CloseOnHeaderError makes the connection close itself when its header is
+// malformed or disallowed, once the hooks of the connection, e.g. OnWarning
+// or the ban list, have been invoked, when passed as option to NewConn().
+// Reads then return io.EOF rather than the error, for servers whose handlers
+// don't inspect read errors. The error is still available through
+// Conn.HeaderError.
+func CloseOnHeaderError() func(*Conn) {
+	return func(c *Conn) {
+		c.closeOnHeaderError = true
+	}
+}
+
+// WithMaxHeaderSize bounds the size in bytes of the header accepted on the
+// connection, signature included, when passed as option to NewConn(). Larger
+// headers are rejected with ErrHeaderTooLarge without being buffered. Sizes
+// above the default buffer of 4096 bytes grow the buffer accordingly, allowing
+// version 2 headers carrying large TLVs.
+func WithMaxHeaderSize(n int) func(*Conn) {
+	return func(c *Conn) {
+		c.parseOptions.maxHeaderSize = n
+	}
+}
+
+// WithZonePolicy sets how IPv6 addresses with a zone are handled in version 1
+// headers received on the connection, when passed as option to NewConn(). By
+// default, zones are stripped.
+func WithZonePolicy(zones ZonePolicy) func(*Conn) {
+	return func(c *Conn) {
+		c.parseOptions.zones = zones
+	}
+}
+
+// WithMappedIPv4Policy sets how IPv4-mapped IPv6 addresses of the header
+// received on the connection are handled, when passed as option to NewConn().
+// By default, they are left as is.
+func WithMappedIPv4Policy(policy MappedIPv4Policy) func(*Conn) {
+	return func(c *Conn) {
+		c.parseOptions.mappedIPv4 = policy
+	}
+}
+
+// WithPeekDetection makes the connection look for the PROXY signature by
+// peeking at the socket, when passed as option to NewConn(). If the first
+// bytes received aren't a signature, not a single byte is consumed from the
+// socket, and reads are handed straight to the underlying connection with
+// no buffering. The connection returned by Raw can then be passed to code
+// parsing the stream from its start.
+//
+// While the bytes received are a prefix of a signature, e.g. a lone "P",
+// the connection waits for more, bounded by the header deadline, so that
+// the bytes are only consumed once a signature is certain. This requires
+// the underlying connection to be a socket implementing syscall.Conn on a
+// unix platform. Otherwise, the header is read as usual, in which case
+// bytes received past the header are buffered by the Conn. The header is
+// read as usual too once the peer stops sending after a partial signature.
+// Other unix platforms than Linux can't detect it, so they don't wait.
+func WithPeekDetection() func(*Conn) {
+	return func(c *Conn) {
+		c.peekDetection = true
+	}
+}
+
 // Accept waits for and returns the next valid connection to the listener.
 func (p *Listener) Accept() (net.Conn, error) {
+	limiter := p.limiter()
 	for {
+		if limiter != nil && !limiter.acquire(p.doneChan()) {
+			return nil, net.ErrClosed
+		}
+		release := func() {
+			if limiter != nil {
+				limiter.release()
+			}
+		}
+		if p.AcceptThrottle != nil && !p.throttle() {
+			release()
+			return nil, net.ErrClosed
+		}
+
 		// Get the underlying connection
 		conn, err := p.Listener.Accept()
 		if err != nil {
+			release()
+			p.counters.acceptErrors.Add(1)
 			return nil, err
 		}
+		accepted := time.Now()
+		if p.Clock != nil {
+			accepted = p.Clock.Now()
+		}
+
+		if err := p.setKeepAlive(conn); err != nil {
+			// The connection is likely reset already, keep listening for
+			// other connections.
+			release()
+			conn.Close()
+			p.counters.acceptErrors.Add(1)
+			continue
+		}
+
+		p.mu.RLock()
+		policyFunc, connPolicyFunc, config := p.Policy, p.ConnPolicy, p.Config
+		p.mu.RUnlock()
 
 		proxyHeaderPolicy := USE
-		if p.Policy != nil && p.ConnPolicy != nil {
+		if policyFunc != nil && connPolicyFunc != nil {
 			panic("only one of policy or connpolicy must be provided.")
 		}
-		if p.Policy != nil || p.ConnPolicy != nil {
-			if p.Policy != nil {
-				proxyHeaderPolicy, err = p.Policy(conn.RemoteAddr())
+		if policyFunc != nil || connPolicyFunc != nil {
+			if policyFunc != nil {
+				proxyHeaderPolicy, err = policyFunc(conn.RemoteAddr())
 			} else {
-				proxyHeaderPolicy, err = p.ConnPolicy(ConnPolicyOptions{
+				proxyHeaderPolicy, err = connPolicyFunc(ConnPolicyOptions{
 					Upstream:   conn.RemoteAddr(),
 					Downstream: conn.LocalAddr(),
 				})
 			}
 			if err != nil {
 				// can't decide the policy, we can't accept the connection
+				release()
 				conn.Close()
+				p.counters.policyErrors.Add(1)
 
 				if errors.Is(err, ErrInvalidUpstream) {
 					// keep listening for other connections
 					continue
 				}
 
+				p.counters.acceptErrors.Add(1)
 				return nil, err
 			}
 			// Handle a connection as a regular one
 			if proxyHeaderPolicy == SKIP {
+				release()
+				p.counters.countAccepted(SKIP)
 				return conn, nil
 			}
 		}
+		if p.BanList != nil {
+			if policy, banned := p.BanList.Banned(conn.RemoteAddr()); banned {
+				proxyHeaderPolicy = policy
+				if proxyHeaderPolicy == SKIP {
+					release()
+					p.counters.countAccepted(SKIP)
+					return conn, nil
+				}
+			}
+		}
 
-		newConn := NewConn(
-			conn,
-			WithPolicy(proxyHeaderPolicy),
-			ValidateHeader(p.ValidateHeader),
-		)
+		opts := []func(*Conn){WithPolicy(proxyHeaderPolicy)}
+		if p.Clock != nil {
+			opts = append(opts, WithClock(p.Clock))
+		}
+		opts = append(opts, acceptedAt(accepted), countedBy(&p.counters))
+		opts = append(opts, config.connOptions()...)
+		opts = append(opts, ValidateHeader(p.ValidateHeader))
+		if p.RetainRawHeader {
+			opts = append(opts, RetainRawHeader())
+		}
+		if p.PeekDetection {
+			opts = append(opts, WithPeekDetection())
+		}
+		if p.SkipMalformedTLVs {
+			opts = append(opts, SkipMalformedTLVs())
+		}
+		if p.LazyTLVThreshold > 0 {
+			opts = append(opts, LazyTLVs(p.LazyTLVThreshold))
+		}
+		if p.MaxTLVCount > 0 {
+			opts = append(opts, WithMaxTLVCount(p.MaxTLVCount))
+		}
+		if p.OnTooManyTLVs != nil {
+			opts = append(opts, OnTooManyTLVs(p.OnTooManyTLVs))
+		}
+		if p.VersionPolicy != nil {
+			opts = append(opts, WithVersionPolicy(p.VersionPolicy))
+		}
+		if p.MaxStackedHeaders > 1 {
+			opts = append(opts, WithStackedHeaders(p.MaxStackedHeaders))
+		}
+		if p.OnWarning != nil {
+			opts = append(opts, OnWarning(p.OnWarning))
+		}
+		if p.HeaderPool != nil {
+			opts = append(opts, WithHeaderPool(p.HeaderPool))
+		}
+		if p.OnHeaderLatency != nil {
+			opts = append(opts, OnHeaderLatency(p.OnHeaderLatency))
+		}
+		if p.OnHeaderStats != nil {
+			opts = append(opts, OnHeaderStats(p.OnHeaderStats))
+		}
+		if p.ZonePolicy != ZoneStrip {
+			opts = append(opts, WithZonePolicy(p.ZonePolicy))
+		}
+		if p.MappedIPv4Policy != MappedIPv4Keep {
+			opts = append(opts, WithMappedIPv4Policy(p.MappedIPv4Policy))
+		}
+		if p.HeaderHMACKey != nil {
+			opts = append(opts, WithHeaderHMAC(p.HeaderHMACKey))
+		}
+		if p.HeaderKeyring != nil {
+			opts = append(opts, WithHeaderVerifier(p.HeaderKeyring))
+		}
+		if p.TrustedClientCerts != nil {
+			opts = append(opts, WithTrustedClientCerts(p.TrustedClientCerts))
+		}
+		if p.BanList != nil {
+			opts = append(opts, WithBanList(p.BanList))
+		}
+		if p.HeaderDumper != nil {
+			opts = append(opts, WithHeaderDumper(p.HeaderDumper))
+		}
+		if p.AuditLog != nil {
+			opts = append(opts, WithAuditLog(p.AuditLog))
+		}
+		if p.ConnStats {
+			opts = append(opts, WithStats())
+		}
+		if p.CloseOnHeaderError {
+			opts = append(opts, CloseOnHeaderError())
+		}
+		if p.RejectResponse != nil {
+			opts = append(opts, RejectResponse(p.RejectResponse))
+		}
+		if len(p.RequiredTLVs) > 0 {
+			opts = append(opts, RequireTLVs(p.RequiredTLVs...))
+		}
+		if p.AllowedAuthorities != nil {
+			opts = append(opts, AllowAuthorities(p.AllowedAuthorities...))
+		}
+		if p.ReplayCache != nil {
+			opts = append(opts, WithReplayCache(p.ReplayCache))
+		}
+		if p.Codec != nil {
+			opts = append(opts, WithCodec(p.Codec))
+		}
+		if p.ValidationFallback != nil {
+			opts = append(opts, FallbackOnInvalidHeader(p.ValidationFallback))
+		}
+		if limiter != nil {
+			opts = append(opts, onClose(release))
+		}
+		newConn := NewConn(conn, opts...)
 
-		// If the ReadHeaderTimeout for the listener is unset, use the default timeout.
-		if p.ReadHeaderTimeout == 0 {
-			p.ReadHeaderTimeout = DefaultReadHeaderTimeout
+		// If the ReadHeaderTimeout for the listener is unset, use the one of
+		// its config, or else the default timeout of the listener.
+		timeout := p.ReadHeaderTimeout
+		if timeout == 0 && config != nil {
+			timeout = config.ReadHeaderTimeout
+		}
+		if timeout == 0 {
+			timeout = p.defaultReadHeaderTimeout
+		}
+		if timeout == 0 {
+			timeout = DefaultReadHeaderTimeout
 		}
 
 		// Set the readHeaderTimeout of the new conn to the value of the listener
-		newConn.readHeaderTimeout = p.ReadHeaderTimeout
+		newConn.readHeaderTimeout = timeout
+		p.counters.countAccepted(proxyHeaderPolicy)
 
+		if p.PreserveInterfaces {
+			return PreserveInterfaces(newConn), nil
+		}
 		return newConn, nil
 	}
 }
 
+// NewListener wraps inner into a Listener, configured by the options. The
+// listener takes a copy of DefaultReadHeaderTimeout as its default timeout,
+// so that it's unaffected by later changes of the global, unless set by
+// WithDefaultReadHeaderTimeout. Other settings can be set on the returned
+// listener before it starts accepting connections.
+func NewListener(inner net.Listener, opts ...func(*Listener)) *Listener {
+	l := &Listener{
+		Listener:                 inner,
+		defaultReadHeaderTimeout: DefaultReadHeaderTimeout,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// WithDefaultReadHeaderTimeout sets the read header timeout used by the
+// listener when neither its ReadHeaderTimeout nor the one of its Config are
+// set, when passed as option to NewListener(). Unlike ReadHeaderTimeout, it
+// doesn't take precedence over the config, so that a reloaded config can
+// still set the timeout. A negative timeout disables it.
+func WithDefaultReadHeaderTimeout(t time.Duration) func(*Listener) {
+	return func(l *Listener) {
+		l.defaultReadHeaderTimeout = t
+	}
+}
+
+// setKeepAlive applies the listener's KeepAlive setting to TCP connections.
+func (p *Listener) setKeepAlive(conn net.Conn) error {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok || p.KeepAlive == 0 {
+		return nil
+	}
+	if p.KeepAlive < 0 {
+		return tcpConn.SetKeepAlive(false)
+	}
+	if err := tcpConn.SetKeepAlive(true); err != nil {
+		return err
+	}
+	return tcpConn.SetKeepAlivePeriod(p.KeepAlive)
+}
+
+// SetPolicy atomically replaces the listener's PolicyFunc, clearing any
+// ConnPolicy. It is safe to call while the listener is accepting connections;
+// connections already accepted keep the policy they were accepted with.
+// Prefer SetConnPolicy, as Policy is deprecated.
+func (p *Listener) SetPolicy(policy PolicyFunc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Policy = policy
+	p.ConnPolicy = nil
+}
+
+// SetConnPolicy atomically replaces the listener's ConnPolicyFunc, clearing
+// any Policy. It is safe to call while the listener is accepting connections;
+// connections already accepted keep the policy they were accepted with.
+func (p *Listener) SetConnPolicy(policy ConnPolicyFunc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ConnPolicy = policy
+	p.Policy = nil
+}
+
+// SetConfig atomically replaces the listener's Config, e.g. to reload it on
+// SIGHUP. It is safe to call while the listener is accepting connections;
+// connections accepted afterwards pick up the new limits, validators and
+// hooks, while connections already accepted keep the config they were
+// accepted with. The config must not be modified once passed.
+func (p *Listener) SetConfig(config *Config) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Config = config
+}
+
 // Close closes the underlying listener.
 func (p *Listener) Close() error {
+	p.closeOnce.Do(func() { close(p.doneChan()) })
 	return p.Listener.Close()
 }
 
+// doneChan returns the channel closed when the listener is closed.
+func (p *Listener) doneChan() chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done == nil {
+		p.done = make(chan struct{})
+	}
+	return p.done
+}
+
 // Addr returns the underlying listener's network address.
 func (p *Listener) Addr() net.Addr {
 	return p.Listener.Addr()
 }
 
+// bufSize is the default size of the buffer the header is read through.
+// For v1 the header length is at most 108 bytes.
+// For v2 the header length is at most 52 bytes plus the length of the TLVs.
+// The buffer is sized well beyond that so that the header and the start of
+// the payload usually arrive with a single read of the underlying conn.
+const bufSize = 4096
+
 // NewConn is used to wrap a net.Conn that may be speaking
 // the proxy protocol into a proxyproto.Conn
 func NewConn(conn net.Conn, opts ...func(*Conn)) *Conn {
-	// For v1 the header length is at most 108 bytes.
-	// For v2 the header length is at most 52 bytes plus the length of the TLVs.
-	// We use 256 bytes to be safe.
-	const bufSize = 256
 	br := bufio.NewReaderSize(conn, bufSize)
 
 	pConn := &Conn{
-		bufReader: br,
-		reader:    io.MultiReader(br, conn),
-		conn:      conn,
+		bufReader:  br,
+		conn:       conn,
+		acceptedAt: time.Now(),
 	}
 
 	for _, opt := range opts {
 		opt(pConn)
 	}
 
+	size := max(pConn.parseOptions.maxHeaderSize, bufSize)
+	if size > bufSize || pConn.headerDumper != nil {
+		var r io.Reader = conn
+		if pConn.headerDumper != nil {
+			pConn.capture = &captureReader{r: conn, buf: make([]byte, 0, pConn.headerDumper.size)}
+			r = pConn.capture
+		}
+		pConn.bufReader = bufio.NewReaderSize(r, size)
+	}
+
 	return pConn
 }
 
+// readPayload hands out the bytes buffered while reading the header, then
+// reads straight from the underlying conn, so that the payload is neither
+// copied through the buffer nor read with more syscalls than needed.
+func (p *Conn) readPayload(b []byte) (int, error) {
+	if p.bufReader != nil {
+		if p.bufReader.Buffered() > 0 {
+			return p.bufReader.Read(b)
+		}
+		// The buffer is drained for good, let it be collected.
+		p.bufReader = nil
+	}
+	return p.conn.Read(b)
+}
+
+// drainBuffer hands out the bytes left in the buffer in place rather than
+// copying them out, and lets the buffer be collected. Discarding them
+// leaves the peeked slice valid, as the buffer isn't read from anymore.
+func (p *Conn) drainBuffer() []byte {
+	if p.bufReader == nil {
+		return nil
+	}
+	b, _ := p.bufReader.Peek(p.bufReader.Buffered())
+	_, _ = p.bufReader.Discard(len(b))
+	p.bufReader = nil
+	return b
+}
+
 // Read is check for the proxy protocol header when doing
 // the initial scan. If there is an error parsing the header,
 // it is returned and the socket is closed.
@@ -178,20 +796,52 @@ func (p *Conn) Read(b []byte) (int, error) {
 		p.readErr = p.readHeader()
 	})
 	if p.readErr != nil {
-		return 0, p.readErr
+		return 0, p.headerError()
 	}
 
-	return p.reader.Read(b)
+	if err := p.skipDeferredTLVs(); err != nil {
+		return 0, err
+	}
+
+	n, err := p.readPayload(b)
+	p.countRead(int64(n))
+	return n, err
 }
 
 // Write wraps original conn.Write
 func (p *Conn) Write(b []byte) (int, error) {
-	return p.conn.Write(b)
+	n, err := p.conn.Write(b)
+	p.countWritten(int64(n))
+	return n, err
 }
 
 // Close wraps original conn.Close
 func (p *Conn) Close() error {
-	return p.conn.Close()
+	err := p.conn.Close()
+	if p.onClose != nil {
+		p.closeOnce.Do(p.onClose)
+	}
+	if p.auditLog != nil {
+		p.auditOnce.Do(p.audit)
+	}
+	if p.headerPool != nil {
+		// Wait for a header being read concurrently before recycling it.
+		p.once.Do(func() {})
+		p.recycleOnce.Do(p.recycleHeader)
+	}
+	return err
+}
+
+// recycleHeader gives the header back to the pool it was taken from.
+func (p *Conn) recycleHeader() {
+	if p.reusable == nil {
+		return
+	}
+	if p.header == &p.reusable.header {
+		p.header = nil
+	}
+	p.headerPool.put(p.reusable)
+	p.reusable = nil
 }
 
 // ProxyHeader returns the proxy protocol header, if any. If an error occurs
@@ -201,6 +851,50 @@ func (p *Conn) ProxyHeader() *Header {
 	return p.header
 }
 
+// HeaderLatency returns the time elapsed between the acceptance of the
+// connection and the successful parsing of its header, and whether a header
+// was parsed at all.
+func (p *Conn) HeaderLatency() (time.Duration, bool) {
+	p.once.Do(func() { p.readErr = p.readHeader() })
+	return p.headerLatency, p.headerParsed
+}
+
+// HeaderBytes returns the number of bytes consumed from the connection by
+// the header, signature included, so that metering systems can account for
+// the protocol overhead deliberately. The header is read first if needed.
+// Headers parsed but ignored, e.g. with the IGNORE policy, are counted as
+// well, while headers attached with SetHeader aren't.
+func (p *Conn) HeaderBytes() int {
+	p.once.Do(func() { p.readErr = p.readHeader() })
+	return p.headerBytes
+}
+
+// HeaderError returns the error the header of the connection failed with, if
+// any. The header is read first if needed. With the RejectResponse option,
+// a failed connection is rejected right away, so that servers speaking
+// first, e.g. SMTP ones, can check the header before sending their banner.
+func (p *Conn) HeaderError() error {
+	p.once.Do(func() { p.readErr = p.readHeader() })
+	if p.readErr != nil && p.rejectResponse != nil {
+		p.rejectOnce.Do(p.reject)
+	}
+	return p.readErr
+}
+
+// SetHeader attaches a header to the connection, which then behaves as if the
+// header had been received on the wire: ProxyHeader returns it, and
+// RemoteAddr and LocalAddr report its addresses. This is useful for tests,
+// in-process tunnels, or when the header was received by another component.
+//
+// No header is read from the wire once SetHeader has been called, and the
+// connection's policy and validator are not applied to the given header. It
+// must not be called concurrently with other methods of the connection.
+func (p *Conn) SetHeader(header *Header) {
+	p.once.Do(func() {})
+	p.header = header
+	p.readErr = nil
+}
+
 // LocalAddr returns the address of the server if the proxy
 // protocol is being used, otherwise just returns the address of
 // the socket server. In case an error happens on reading the
@@ -257,6 +951,20 @@ func (p *Conn) UnixConn() (conn *net.UnixConn, ok bool) {
 	return
 }
 
+// File returns a copy of the file descriptor of the underlying connection,
+// e.g. to pass the socket to a child process or use raw fd APIs, as
+// net.TCPConn.File does. It fails with ErrConnNotExportable if the underlying
+// connection isn't backed by one. The bytes read off the socket while
+// looking for the header, but not read by the application yet, aren't part
+// of the file: use Export to hand them over as well.
+func (p *Conn) File() (*os.File, error) {
+	fc, ok := p.conn.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, ErrConnNotExportable
+	}
+	return fc.File()
+}
+
 // UDPConn returns the underlying UDP connection,
 // allowing access to specialized functions.
 //
@@ -266,19 +974,22 @@ func (p *Conn) UDPConn() (conn *net.UDPConn, ok bool) {
 	return
 }
 
-// SetDeadline wraps original conn.SetDeadline
+// SetDeadline wraps original conn.SetDeadline. The read deadline applies as
+// with SetReadDeadline.
 func (p *Conn) SetDeadline(t time.Time) error {
-	p.readDeadline.Store(t)
-	return p.conn.SetDeadline(t)
+	if err := p.conn.SetWriteDeadline(t); err != nil {
+		return err
+	}
+	return p.SetReadDeadline(t)
 }
 
-// SetReadDeadline wraps original conn.SetReadDeadline
+// SetReadDeadline wraps original conn.SetReadDeadline. The deadline only
+// applies to the payload: while the header is being read under a header
+// deadline, see SetHeaderDeadline, it's held back and takes effect once the
+// header has been read. Without a header deadline, it bounds the reading of
+// the header as well.
 func (p *Conn) SetReadDeadline(t time.Time) error {
-	// Set a local var that tells us the desired deadline. This is
-	// needed in order to reset the read deadline to the one that is
-	// desired by the user, rather than an empty deadline.
-	p.readDeadline.Store(t)
-	return p.conn.SetReadDeadline(t)
+	return p.deadlines.setRead(p.conn, t)
 }
 
 // SetWriteDeadline wraps original conn.SetWriteDeadline
@@ -286,40 +997,131 @@ func (p *Conn) SetWriteDeadline(t time.Time) error {
 	return p.conn.SetWriteDeadline(t)
 }
 
-func (p *Conn) readHeader() error {
-	// If the connection's readHeaderTimeout is more than 0,
-	// push our deadline back to now plus the timeout. This should only
-	// run on the connection, as we don't want to override the previous
-	// read deadline the user may have used.
-	if p.readHeaderTimeout > 0 {
-		if err := p.conn.SetReadDeadline(time.Now().Add(p.readHeaderTimeout)); err != nil {
-			return err
+// SetHeaderDeadline sets the deadline for reading the header, overriding
+// the read header timeout of the connection. Unlike the read deadline, it
+// doesn't apply to the payload. If the header is being read, the new
+// deadline applies to the pending read. A zero value falls back to the read
+// header timeout, or to the read deadline if the header is being read.
+// Once the header has been read, it has no effect.
+func (p *Conn) SetHeaderDeadline(t time.Time) error {
+	return p.deadlines.setHeader(p.conn, t)
+}
+
+func (p *Conn) readHeader() (err error) {
+	if p.policyErr != nil {
+		return p.policyErr
+	}
+	if p.ProxyHeaderPolicy == SKIP {
+		return nil
+	}
+	// disallowed tells whether the header was received, but failed the
+	// policy or the checks of the connection.
+	var disallowed bool
+	defer func() {
+		if err != nil {
+			p.headerFailed(err, disallowed)
+		}
+		if p.listenerCounters != nil {
+			p.listenerCounters.countOutcome(p.header, err)
 		}
+	}()
+
+	if p.headerPool != nil {
+		p.reusable = p.headerPool.get()
+		p.parseOptions.reuse = p.reusable
+		defer func() {
+			// Give the header back right away if it isn't used.
+			if p.header != &p.reusable.header {
+				p.recycleOnce.Do(p.recycleHeader)
+			}
+		}()
+	}
+
+	// Bound the reading of the header by the header deadline, if any, in
+	// place of the read deadline the user may have set, which is held back
+	// until the header has been read.
+	if err := p.deadlines.begin(p.conn, p.readHeaderTimeout); err != nil {
+		return err
 	}
 
-	header, err := Read(p.bufReader)
+	// The checks of the TLVs, and the headers stacked behind, need the
+	// block up front.
+	if p.hmacKey != nil || p.keyring != nil || len(p.requiredTLVs) > 0 || p.allowedAuthorities != nil || p.replayCache != nil || p.maxStackedHeaders > 1 {
+		p.parseOptions.lazyTLVs = 0
+	}
 
-	// If the connection's readHeaderTimeout is more than 0, undo the change to the
-	// deadline that we made above. Because we retain the readDeadline as part of our
-	// SetReadDeadline override, we know the user's desired deadline so we use that.
-	// Therefore, we check whether the error is a net.Timeout and if it is, we decide
-	// the proxy proto does not exist and set the error accordingly.
-	if p.readHeaderTimeout > 0 {
-		t := p.readDeadline.Load()
-		if t == nil {
-			t = time.Time{}
+	var (
+		header      *Header
+		noSignature bool
+	)
+	if p.trustedClientCerts != nil {
+		err = p.checkClientCert()
+	}
+	if err == nil && p.peekDetection && p.codec == nil {
+		noSignature, err = lacksSignature(p.conn)
+	}
+	if noSignature {
+		// Nothing was consumed, bypass the buffered reader entirely.
+		p.bufReader = nil
+		err = ErrNoProxyProtocol
+	} else if err == nil && p.codec != nil {
+		header, err = p.codec.Parse(p.bufReader)
+	} else if err == nil {
+		header, err = read(p.bufReader, p.parseOptions)
+		if err == nil && p.maxStackedHeaders > 1 {
+			p.chain, err = p.readStackedHeaders(header)
 		}
-		if err := p.conn.SetReadDeadline(t.(time.Time)); err != nil {
-			return err
+	}
+	if err == nil && header != nil {
+		if header.deferredTLVs > 0 {
+			p.deferred = &deferredTLVs{
+				r:     p.bufReader,
+				left:  header.deferredTLVs,
+				limit: p.parseOptions.maxTLVCount,
+				onExceeded: func(err *TLVCountError) {
+					p.notifyTooManyTLVs(err)
+				},
+			}
+		}
+		p.headerLatency, p.headerParsed = p.now().Sub(p.acceptedAt), true
+		p.headerBytes = header.size
+		if p.listenerCounters != nil {
+			p.listenerCounters.countParsed(header)
+		}
+		if p.onHeaderLatency != nil {
+			p.onHeaderLatency(p.conn.RemoteAddr(), p.headerLatency)
+		}
+		if p.onHeaderStats != nil {
+			p.onHeaderStats(p.conn.RemoteAddr(), headerStats(header))
 		}
+	}
+	if header != nil && p.onWarning != nil {
+		for _, warning := range header.warnings {
+			p.onWarning(p.conn.RemoteAddr(), warning)
+		}
+	}
+
+	// If the header was bounded by the header deadline, restore the read
+	// deadline desired by the user. Therefore, we check whether the error is
+	// a net.Timeout and if it is, we decide the proxy proto does not exist,
+	// unless its signature was received, and set the error accordingly.
+	bounded, restoreErr := p.deadlines.end(p.conn)
+	if restoreErr != nil {
+		return restoreErr
+	}
+	if bounded {
+		var pe *ParseError
 		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-			err = ErrNoProxyProtocol
+			err = &headerTimeoutError{err: ErrNoProxyProtocol}
+		} else if errors.As(err, &pe) && pe.Reason == ReasonTimeout {
+			// The signature was received, not the rest of the header.
+			err = &headerTimeoutError{err: err}
 		}
 	}
 
 	// For the purpose of this wrapper shamefully stolen from armon/go-proxyproto
 	// let's act as if there was no error when PROXY protocol is not present.
-	if err == ErrNoProxyProtocol {
+	if errors.Is(err, ErrNoProxyProtocol) {
 		// but not if it is required that the connection has one
 		if p.ProxyHeaderPolicy == REQUIRE {
 			return err
@@ -330,14 +1132,49 @@ func (p *Conn) readHeader() error {
 
 	// proxy protocol header was found
 	if err == nil && header != nil {
-		switch p.ProxyHeaderPolicy {
+		disallowed = true
+		policy := p.ProxyHeaderPolicy
+		if p.versionPolicy != nil {
+			policy = p.versionPolicy(header.Version, policy)
+		}
+		switch policy {
 		case REJECT:
 			// this connection is not allowed to send one
 			return ErrSuperfluousProxyHeader
 		case USE, REQUIRE:
+			if p.hmacKey != nil {
+				if err := VerifyHeaderHMAC(header, p.hmacKey); err != nil {
+					return err
+				}
+			}
+			if p.keyring != nil {
+				if err := VerifyHeaderSignature(header, p.keyring); err != nil {
+					return err
+				}
+			}
+			if len(p.requiredTLVs) > 0 {
+				if err := checkRequiredTLVs(header, p.requiredTLVs); err != nil {
+					return err
+				}
+			}
+			if p.allowedAuthorities != nil {
+				if err := checkAuthority(header, p.allowedAuthorities); err != nil {
+					return err
+				}
+			}
 			if p.Validate != nil {
-				err = p.Validate(header)
-				if err != nil {
+				if err := p.Validate(header); err != nil {
+					if !p.validationFallback {
+						return err
+					}
+					if p.onValidationFallback != nil {
+						p.onValidationFallback(p.conn.RemoteAddr(), header, err)
+					}
+					return nil
+				}
+			}
+			if p.replayCache != nil {
+				if err := p.replayCache.check(p.conn.RemoteAddr(), header); err != nil {
 					return err
 				}
 			}
@@ -349,8 +1186,40 @@ func (p *Conn) readHeader() error {
 	return err
 }
 
+// headerError returns the error the header failed with, to be returned by
+// reads. With the CloseOnHeaderError or RejectResponse options, the
+// connection is closed and io.EOF returned instead.
+func (p *Conn) headerError() error {
+	if p.rejectResponse != nil {
+		p.rejectOnce.Do(p.reject)
+		return io.EOF
+	}
+	if !p.closeOnHeaderError {
+		return p.readErr
+	}
+	p.Close()
+	return io.EOF
+}
+
+// headerFailed reports the failure of the header to the ban list, the
+// header dumper and the hooks of the connection. Only malformed or
+// disallowed headers count against the upstream in the ban list.
+func (p *Conn) headerFailed(err error, disallowed bool) {
+	var countErr *TLVCountError
+	if errors.As(err, &countErr) {
+		p.notifyTooManyTLVs(countErr)
+	}
+	if p.banList != nil && (disallowed || malformed(err)) {
+		p.banList.Fail(p.conn.RemoteAddr())
+	}
+	if p.headerDumper != nil && len(p.capture.buf) > 0 {
+		p.headerDumper.dump(p.conn.RemoteAddr(), p.capture.buf, err)
+	}
+}
+
 // ReadFrom implements the io.ReaderFrom ReadFrom method
-func (p *Conn) ReadFrom(r io.Reader) (int64, error) {
+func (p *Conn) ReadFrom(r io.Reader) (n int64, err error) {
+	defer func() { p.countWritten(n) }()
 	if rf, ok := p.conn.(io.ReaderFrom); ok {
 		return rf.ReadFrom(r)
 	}
@@ -358,18 +1227,18 @@ func (p *Conn) ReadFrom(r io.Reader) (int64, error) {
 }
 
 // WriteTo implements io.WriterTo
-func (p *Conn) WriteTo(w io.Writer) (int64, error) {
+func (p *Conn) WriteTo(w io.Writer) (n int64, err error) {
 	p.once.Do(func() { p.readErr = p.readHeader() })
 	if p.readErr != nil {
-		return 0, p.readErr
+		return 0, p.headerError()
 	}
-
-	b := make([]byte, p.bufReader.Buffered())
-	if _, err := p.bufReader.Read(b); err != nil {
-		return 0, err // this should never as we read buffered data
+	if err := p.skipDeferredTLVs(); err != nil {
+		return 0, err
 	}
+	defer func() { p.countRead(n) }()
 
-	var n int64
+	// Hand out the buffered bytes in place rather than copying them out.
+	b := p.drainBuffer()
 	{
 		nn, err := w.Write(b)
 		n += int64(nn)
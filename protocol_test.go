@@ -1596,6 +1596,52 @@ func TestCopyFromWrappedConnectionToWrappedConnection(t *testing.T) {
 	}
 }
 
+// countingConn serves data with a single read and records the reads issued.
+type countingConn struct {
+	net.Conn // nil; crash on any unexpected use
+	data     []byte
+	reads    [][]byte
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	c.reads = append(c.reads, p)
+	if len(c.data) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, c.data)
+	c.data = c.data[n:]
+	return n, nil
+}
+
+func TestHeaderAndPayloadInSingleRead(t *testing.T) {
+	data := append([]byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\n"), "ping"...)
+	inner := &countingConn{data: data}
+	conn := NewConn(inner)
+
+	recv := make([]byte, 4)
+	if _, err := io.ReadFull(conn, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(recv) != "ping" {
+		t.Fatalf("expected %q, got %q", "ping", recv)
+	}
+	if len(inner.reads) != 1 {
+		t.Fatalf("expected header and payload in 1 read, got %d", len(inner.reads))
+	}
+
+	// Once the buffer is drained, reads go straight to the caller's buffer.
+	next := make([]byte, 16)
+	if _, err := conn.Read(next); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+	if len(inner.reads) != 2 || &inner.reads[1][0] != &next[0] {
+		t.Fatalf("expected a direct read into the caller's buffer")
+	}
+	if conn.bufReader != nil {
+		t.Fatal("expected the drained buffer to be released")
+	}
+}
+
 func benchmarkTCPProxy(size int, b *testing.B) {
 	// create and start the echo backend
 	backend, err := net.Listen("tcp", "127.0.0.1:0")
@@ -1771,3 +1817,516 @@ y2ptGsuSmgUtWj3NM9xuwYPm+Z/F84K6+ARYiZ6PYj013sovGKUFfYAqVXVlxtIX
 qyUBnu3X9ps8ZfjLZO7BAkEAlT4R5Yl6cGhaJQYZHOde3JEMhNRcVFMO8dJDaFeo
 f9Oeos0UUothgiDktdQHxdNEwLjQf7lJJBzV+5OtwswCWA==
 -----END RSA PRIVATE KEY-----`)
+
+func TestListenerSetConnPolicy(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{Listener: l, Policy: func(upstream net.Addr) (Policy, error) { return USE, nil }}
+	defer pl.Close()
+
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr: &net.TCPAddr{
+			IP:   net.ParseIP("10.1.1.1"),
+			Port: 1000,
+		},
+		DestinationAddr: &net.TCPAddr{
+			IP:   net.ParseIP("20.2.2.2"),
+			Port: 2000,
+		},
+	}
+
+	acceptRemoteAddr := func() string {
+		t.Helper()
+		cliResult := make(chan error)
+		go func() {
+			conn, err := net.Dial("tcp", pl.Addr().String())
+			if err != nil {
+				cliResult <- err
+				return
+			}
+			defer conn.Close()
+
+			if _, err := header.WriteTo(conn); err != nil {
+				cliResult <- err
+				return
+			}
+			close(cliResult)
+		}()
+
+		conn, err := pl.Accept()
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		defer conn.Close()
+
+		addr := conn.RemoteAddr().(*net.TCPAddr)
+		if err := <-cliResult; err != nil {
+			t.Fatalf("client error: %v", err)
+		}
+		return addr.IP.String()
+	}
+
+	if addr := acceptRemoteAddr(); addr != "10.1.1.1" {
+		t.Fatalf("bad: %v", addr)
+	}
+
+	pl.SetConnPolicy(func(ConnPolicyOptions) (Policy, error) { return IGNORE, nil })
+	if pl.Policy != nil {
+		t.Fatal("expected Policy to be cleared")
+	}
+	if addr := acceptRemoteAddr(); addr != "127.0.0.1" {
+		t.Fatalf("bad: %v", addr)
+	}
+
+	pl.SetPolicy(func(upstream net.Addr) (Policy, error) { return USE, nil })
+	if pl.ConnPolicy != nil {
+		t.Fatal("expected ConnPolicy to be cleared")
+	}
+	if addr := acceptRemoteAddr(); addr != "10.1.1.1" {
+		t.Fatalf("bad: %v", addr)
+	}
+}
+
+func TestOnWarning(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	var warnings []error
+	conn := NewConn(server, OnWarning(func(upstream net.Addr, warning error) {
+		warnings = append(warnings, warning)
+	}))
+
+	go func() {
+		_, _ = client.Write([]byte("PROXY TCP4 10.1.1.1 20.2.2.2 0 2000\r\nping"))
+	}()
+
+	recv := make([]byte, 4)
+	if _, err := io.ReadFull(conn, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.Equal(recv, []byte("ping")) {
+		t.Fatalf("bad: %v", recv)
+	}
+	if len(warnings) != 1 || !errors.Is(warnings[0], ErrZeroPort) {
+		t.Fatalf("expected a zero port warning, got %v", warnings)
+	}
+}
+
+func TestConnSetHeader(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr: &net.TCPAddr{
+			IP:   net.ParseIP("10.1.1.1"),
+			Port: 1000,
+		},
+		DestinationAddr: &net.TCPAddr{
+			IP:   net.ParseIP("20.2.2.2"),
+			Port: 2000,
+		},
+	}
+
+	conn := NewConn(server, WithPolicy(REQUIRE))
+	conn.SetHeader(header)
+
+	if conn.ProxyHeader() != header {
+		t.Fatalf("expected header %v, got %v", header, conn.ProxyHeader())
+	}
+	if conn.RemoteAddr().String() != header.SourceAddr.String() {
+		t.Fatalf("bad remote address: %v", conn.RemoteAddr())
+	}
+	if conn.LocalAddr().String() != header.DestinationAddr.String() {
+		t.Fatalf("bad local address: %v", conn.LocalAddr())
+	}
+
+	// The stream is not parsed for a header anymore.
+	go func() {
+		_, _ = client.Write([]byte("ping"))
+	}()
+	recv := make([]byte, 4)
+	if _, err := io.ReadFull(conn, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.Equal(recv, []byte("ping")) {
+		t.Fatalf("bad: %v", recv)
+	}
+}
+
+func TestListenerKeepAlive(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for _, keepAlive := range []time.Duration{-1, 30 * time.Second} {
+		pl := &Listener{Listener: l, KeepAlive: keepAlive}
+
+		cliResult := make(chan error)
+		go func() {
+			conn, err := net.Dial("tcp", pl.Addr().String())
+			if err != nil {
+				cliResult <- err
+				return
+			}
+			conn.Close()
+			close(cliResult)
+		}()
+
+		conn, err := pl.Accept()
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		checkKeepAlive(t, conn.(*Conn).Raw().(*net.TCPConn), keepAlive)
+		conn.Close()
+		if err := <-cliResult; err != nil {
+			t.Fatalf("client error: %v", err)
+		}
+	}
+	l.Close()
+}
+
+// closedFirstListener hands out a closed connection before the ones of
+// the wrapped listener.
+type closedFirstListener struct {
+	net.Listener
+	closed net.Conn
+}
+
+func (l *closedFirstListener) Accept() (net.Conn, error) {
+	if conn := l.closed; conn != nil {
+		l.closed = nil
+		return conn, nil
+	}
+	return l.Listener.Accept()
+}
+
+func TestListenerKeepAliveError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	cliResult := make(chan error, 2)
+	dial := func() {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			cliResult <- err
+			return
+		}
+		defer conn.Close()
+		_, err = conn.Write([]byte("ping"))
+		cliResult <- err
+	}
+	go dial()
+	closed, err := l.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	closed.Close()
+
+	pl := &Listener{Listener: &closedFirstListener{Listener: l, closed: closed}, KeepAlive: 30 * time.Second}
+	defer pl.Close()
+	go dial()
+
+	// The connection failing to take the setting is skipped.
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+	if conn.(*Conn).Raw() == closed {
+		t.Fatal("expected the closed connection to be skipped")
+	}
+	if stats := pl.Snapshot(); stats.AcceptErrors != 1 {
+		t.Fatalf("expected 1 accept error, got %d", stats.AcceptErrors)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-cliResult; err != nil {
+			t.Fatalf("client error: %v", err)
+		}
+	}
+}
+
+func TestHeaderLatency(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	latencies := make(chan time.Duration, 1)
+	pl := &Listener{
+		Listener: l,
+		OnHeaderLatency: func(upstream net.Addr, latency time.Duration) {
+			latencies <- latency
+		},
+	}
+	defer pl.Close()
+
+	const delay = 50 * time.Millisecond
+	cliResult := make(chan error)
+	go func() {
+		conn, err := net.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			cliResult <- err
+			return
+		}
+		defer conn.Close()
+
+		time.Sleep(delay)
+		if _, err := conn.Write([]byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\n")); err != nil {
+			cliResult <- err
+			return
+		}
+		close(cliResult)
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	latency, ok := conn.(*Conn).HeaderLatency()
+	if !ok {
+		t.Fatal("expected a header to be parsed")
+	}
+	if latency < delay {
+		t.Fatalf("expected latency of at least %v, got %v", delay, latency)
+	}
+	if reported := <-latencies; reported != latency {
+		t.Fatalf("expected reported latency %v, got %v", latency, reported)
+	}
+	if err := <-cliResult; err != nil {
+		t.Fatalf("client error: %v", err)
+	}
+}
+
+func TestHeaderBytes(t *testing.T) {
+	const header = "PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\n"
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go func() {
+		_, _ = client.Write([]byte(header + "ping"))
+	}()
+
+	conn := NewConn(server)
+	if n := conn.HeaderBytes(); n != len(header) {
+		t.Fatalf("expected %d header bytes, got %d", len(header), n)
+	}
+
+	conn = NewConn(server)
+	conn.SetHeader(HeaderProxyFromAddrs(1, v4addr, v4addr))
+	if n := conn.HeaderBytes(); n != 0 {
+		t.Fatalf("expected no header bytes for an attached header, got %d", n)
+	}
+}
+
+func TestCloseOnHeaderError(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		_, _ = client.Write([]byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000\r\n"))
+	}()
+
+	conn := NewConn(server, CloseOnHeaderError())
+	if _, err := conn.Read(make([]byte, 4)); err != io.EOF {
+		t.Fatalf("expected %v, got %v", io.EOF, err)
+	}
+	if err := conn.HeaderError(); !errors.Is(err, ErrCantReadAddressFamilyAndProtocol) {
+		t.Fatalf("expected %v, got %v", ErrCantReadAddressFamilyAndProtocol, err)
+	}
+	// The connection was closed by the wrapper.
+	if _, err := client.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected the connection to be closed, got %v", err)
+	}
+}
+
+func TestFallbackOnInvalidHeader(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		_, _ = client.Write([]byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\nping"))
+	}()
+
+	validationErr := errors.New("validation failed")
+	var (
+		rejected *Header
+		reported error
+	)
+	conn := NewConn(server,
+		ValidateHeader(func(*Header) error { return validationErr }),
+		FallbackOnInvalidHeader(func(upstream net.Addr, header *Header, err error) {
+			rejected, reported = header, err
+		}),
+	)
+	defer conn.Close()
+
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(buf) != "ping" {
+		t.Fatalf("expected ping, got %q", buf)
+	}
+	if reported != validationErr {
+		t.Fatalf("expected %v, got %v", validationErr, reported)
+	}
+	if rejected == nil || rejected.SourceAddr.String() != "10.1.1.1:1000" {
+		t.Fatalf("unexpected rejected header: %v", rejected)
+	}
+	if conn.ProxyHeader() != nil {
+		t.Fatalf("expected no header, got %v", conn.ProxyHeader())
+	}
+	if conn.RemoteAddr().String() != server.RemoteAddr().String() {
+		t.Fatalf("expected the socket address, got %v", conn.RemoteAddr())
+	}
+}
+
+func TestNewConnWithConnPolicyAndValidator(t *testing.T) {
+	const data = "PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\nping"
+	policyErr := errors.New("policy failed")
+	validationErr := errors.New("validation failed")
+
+	var cases = []struct {
+		name   string
+		opts   []func(*Conn)
+		err    error
+		remote string
+		recv   string
+	}{
+		{"use", []func(*Conn){WithConnPolicy(func(ConnPolicyOptions) (Policy, error) { return USE, nil })}, nil, "10.1.1.1:1000", "ping"},
+		{"policy error", []func(*Conn){WithConnPolicy(func(ConnPolicyOptions) (Policy, error) { return REJECT, policyErr })}, policyErr, "", ""},
+		{"skip", []func(*Conn){WithConnPolicy(func(ConnPolicyOptions) (Policy, error) { return SKIP, nil })}, nil, "pipe", "PROX"},
+		{"validation error", []func(*Conn){
+			WithConnPolicy(func(ConnPolicyOptions) (Policy, error) { return REQUIRE, nil }),
+			ValidateHeader(func(*Header) error { return validationErr }),
+		}, validationErr, "", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+
+			go func() {
+				_, _ = client.Write([]byte(data))
+			}()
+
+			conn := NewConn(server, tc.opts...)
+			recv := make([]byte, 4)
+			_, err := io.ReadFull(conn, recv)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if string(recv) != tc.recv {
+				t.Fatalf("expected %q, got %q", tc.recv, recv)
+			}
+			if conn.RemoteAddr().String() != tc.remote {
+				t.Fatalf("expected remote address %v, got %v", tc.remote, conn.RemoteAddr())
+			}
+		})
+	}
+}
+
+func TestNewConnWithMaxHeaderSize(t *testing.T) {
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr:        v4addr,
+		DestinationAddr:   v4addr,
+	}
+	if err := header.SetTLVs([]TLV{{Type: PP2_TYPE_NOOP, Value: make([]byte, 5000)}}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	v2, err := header.Format()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	v1 := []byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\n")
+
+	var cases = []struct {
+		name string
+		data []byte
+		opts []func(*Conn)
+		err  error
+	}{
+		{"large v2 default", v2, nil, ErrInvalidLength},
+		{"large v2 within limit", v2, []func(*Conn){WithMaxHeaderSize(8192)}, nil},
+		{"large v2 over limit", v2, []func(*Conn){WithMaxHeaderSize(64)}, ErrHeaderTooLarge},
+		{"v1 within limit", v1, []func(*Conn){WithMaxHeaderSize(64)}, nil},
+		{"v1 over limit", v1, []func(*Conn){WithMaxHeaderSize(32)}, ErrHeaderTooLarge},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+
+			go func() {
+				_, _ = client.Write(append(append([]byte{}, tc.data...), "ping"...))
+			}()
+
+			conn := NewConn(server, tc.opts...)
+			recv := make([]byte, 4)
+			_, err := io.ReadFull(conn, recv)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if err == nil && string(recv) != "ping" {
+				t.Fatalf("expected %q, got %q", "ping", recv)
+			}
+		})
+	}
+}
+
+func TestLocalHeaderTLVs(t *testing.T) {
+	header := HeaderProxyFromAddrs(2, nil, nil)
+	if err := header.SetTLVs([]TLV{{Type: PP2_TYPE_UNIQUE_ID, Value: []byte("health-check")}}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go func() {
+		_, _ = WriteHeaderAndPayload(client, header, []byte("ping"))
+	}()
+
+	conn := NewConn(server, WithPolicy(REQUIRE))
+	if _, err := io.ReadFull(conn, make([]byte, 4)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if conn.RemoteAddr() != server.RemoteAddr() {
+		t.Fatalf("expected the socket's address, got %v", conn.RemoteAddr())
+	}
+	tlvs, err := conn.ProxyHeader().TLVs()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(tlvs) != 1 || string(tlvs[0].Value) != "health-check" {
+		t.Fatalf("expected the TLVs of the LOCAL header, got %v", tlvs)
+	}
+}
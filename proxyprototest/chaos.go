@@ -0,0 +1,191 @@
+package proxyprototest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// Corruption is a controlled corruption of a header, injected by a
+// ChaosDialer or a ChaosListener to verify the error handling of
+// applications under realistic failure modes.
+type Corruption int
+
+const (
+	// CorruptNone leaves the header intact.
+	CorruptNone Corruption = iota
+	// CorruptTruncate cuts the header in half, the payload following right
+	// after.
+	CorruptTruncate
+	// CorruptLength sets the length field of a version 2 header beyond the
+	// maximum size of a header, or pads a version 1 header beyond 107 bytes.
+	CorruptLength
+	// CorruptCRC32C appends a CRC32C TLV holding a bogus checksum to a
+	// version 2 header. Such a header is still parsed, so that applications
+	// checking checksums can be tested.
+	CorruptCRC32C
+	// CorruptSignature garbles the signature of the header.
+	CorruptSignature
+	// CorruptSplit leaves the header intact, but splits it in two segments
+	// sent separately, as with a misbehaving load balancer.
+	CorruptSplit
+)
+
+// ErrCorruptionVersion is returned when a corruption doesn't apply to the
+// version of the header.
+var ErrCorruptionVersion = errors.New("proxyprototest: corruption not applicable to the header version")
+
+// Corrupt formats the header with the corruption applied, and returns the
+// segments it is to be sent in.
+func Corrupt(header *proxyproto.Header, corruption Corruption) ([][]byte, error) {
+	buf, err := header.Format()
+	if err != nil {
+		return nil, err
+	}
+
+	switch corruption {
+	case CorruptNone:
+	case CorruptTruncate:
+		buf = buf[:len(buf)/2]
+	case CorruptLength:
+		if header.Version == 1 {
+			pad := bytes.Repeat([]byte{' '}, 108-len(buf))
+			buf = append(append(buf[:len(buf)-2:len(buf)-2], pad...), "\r\n"...)
+		} else {
+			buf = withLength(buf, 0xffff)
+		}
+	case CorruptCRC32C:
+		if header.Version == 1 {
+			return nil, ErrCorruptionVersion
+		}
+		buf = withCRC32C(buf, true)
+	case CorruptSignature:
+		buf[0] ^= 0xff
+	case CorruptSplit:
+		return [][]byte{buf[:len(buf)/2], buf[len(buf)/2:]}, nil
+	}
+	return [][]byte{buf}, nil
+}
+
+// ChaosDialer dials connections on which a corrupted header is written,
+// standing for an upstream proxy misbehaving in a controlled way.
+type ChaosDialer struct {
+	// Dialer establishes the underlying connections. If nil, a zero
+	// net.Dialer is used.
+	Dialer proxyproto.ContextDialer
+	// Header is the header to corrupt. If nil, a header is built from the
+	// addresses of the established connection.
+	Header *proxyproto.Header
+	// Corruption is the corruption applied to the header.
+	Corruption Corruption
+	// Delay is the pause between the segments of a split header.
+	Delay time.Duration
+}
+
+// DialContext connects to the address on the named network and writes the
+// corrupted header on the connection.
+func (d *ChaosDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := d.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	header := d.Header
+	if header == nil {
+		header = proxyproto.HeaderProxyFromAddrs(0, conn.LocalAddr(), conn.RemoteAddr())
+	}
+	segments, err := Corrupt(header, d.Corruption)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	for i, segment := range segments {
+		if i > 0 {
+			time.Sleep(d.Delay)
+		}
+		if _, err := conn.Write(segment); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// ChaosListener wraps a listener, injecting a corrupted header at the start
+// of the stream of each accepted connection, as if a misbehaving load
+// balancer sent it. Wrap it into a proxyproto.Listener, and connect plain
+// clients to it.
+type ChaosListener struct {
+	net.Listener
+	// Header is the header to corrupt. If nil, a header is built from the
+	// addresses of the accepted connection.
+	Header *proxyproto.Header
+	// Corruption is the corruption applied to the header.
+	Corruption Corruption
+	// Delay is the pause before reading each segment of a split header but
+	// the first.
+	Delay time.Duration
+}
+
+// Accept waits for the next connection and injects the corrupted header in
+// front of its stream.
+func (l *ChaosListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	header := l.Header
+	if header == nil {
+		header = proxyproto.HeaderProxyFromAddrs(0, conn.RemoteAddr(), conn.LocalAddr())
+	}
+	segments, err := Corrupt(header, l.Corruption)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &chaosConn{Conn: conn, segments: segments, delay: l.Delay}, nil
+}
+
+// chaosConn serves the segments of an injected header, one per read, before
+// reading from the connection.
+type chaosConn struct {
+	net.Conn
+	delay time.Duration
+
+	mu       sync.Mutex
+	segments [][]byte
+	first    bool // the first segment has been started
+	partial  bool // the current segment has been partially served
+}
+
+func (c *chaosConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	if len(c.segments) == 0 {
+		c.mu.Unlock()
+		return c.Conn.Read(b)
+	}
+	defer c.mu.Unlock()
+
+	if c.first && !c.partial {
+		time.Sleep(c.delay)
+	}
+	c.first = true
+	n := copy(b, c.segments[0])
+	c.segments[0] = c.segments[0][n:]
+	c.partial = len(c.segments[0]) > 0
+	if !c.partial {
+		c.segments = c.segments[1:]
+	}
+	return n, nil
+}
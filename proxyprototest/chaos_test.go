@@ -0,0 +1,113 @@
+package proxyprototest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func TestChaosListener(t *testing.T) {
+	v1 := &proxyproto.Header{
+		Version:           1,
+		Command:           proxyproto.PROXY,
+		TransportProtocol: proxyproto.TCPv4,
+		SourceAddr:        &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000},
+		DestinationAddr:   &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 2000},
+	}
+	v2 := *v1
+	v2.Version = 2
+
+	var cases = []struct {
+		name       string
+		header     *proxyproto.Header
+		corruption Corruption
+		err        error
+	}{
+		{"v1 none", v1, CorruptNone, nil},
+		{"v2 none", &v2, CorruptNone, nil},
+		{"v1 truncate", v1, CorruptTruncate, proxyproto.ErrCantReadVersion1Header},
+		{"v2 truncate", &v2, CorruptTruncate, proxyproto.ErrInvalidLength},
+		{"v1 length", v1, CorruptLength, proxyproto.ErrVersion1HeaderTooLong},
+		{"v2 length", &v2, CorruptLength, proxyproto.ErrInvalidLength},
+		{"v2 crc32c", &v2, CorruptCRC32C, nil},
+		{"v1 signature", v1, CorruptSignature, proxyproto.ErrNoProxyProtocol},
+		{"v1 split", v1, CorruptSplit, proxyproto.ErrCantReadVersion1Header},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			pl := &proxyproto.Listener{
+				Listener: &ChaosListener{
+					Listener:   l,
+					Header:     tc.header,
+					Corruption: tc.corruption,
+					Delay:      10 * time.Millisecond,
+				},
+				ConnPolicy: func(proxyproto.ConnPolicyOptions) (proxyproto.Policy, error) {
+					return proxyproto.REQUIRE, nil
+				},
+			}
+			defer pl.Close()
+
+			go func() {
+				conn, err := net.Dial("tcp", pl.Addr().String())
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				_, _ = conn.Write([]byte("ping"))
+			}()
+
+			conn, err := pl.Accept()
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			defer conn.Close()
+
+			_, err = conn.Read(make([]byte, 4))
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestChaosDialer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pl := &proxyproto.Listener{Listener: l}
+	defer pl.Close()
+
+	go func() {
+		d := &ChaosDialer{Corruption: CorruptLength}
+		conn, err := d.DialContext(context.Background(), "tcp", pl.Addr().String())
+		if err != nil {
+			return
+		}
+		conn.Close()
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, proxyproto.ErrInvalidLength) {
+		t.Fatalf("expected error %v, got %v", proxyproto.ErrInvalidLength, err)
+	}
+
+	if _, err := Corrupt(&proxyproto.Header{Version: 1, Command: proxyproto.LOCAL}, CorruptCRC32C); err != ErrCorruptionVersion {
+		t.Fatalf("expected error %v, got %v", ErrCorruptionVersion, err)
+	}
+}
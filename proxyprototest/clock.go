@@ -0,0 +1,110 @@
+package proxyprototest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// FakeClock is a proxyproto.Clock whose time only moves when told to, so
+// that tests of header timeouts run deterministically without waiting for
+// them to expire:
+//
+//	clock := proxyprototest.NewFakeClock(time.Now())
+//	conn := proxyproto.NewConn(server, proxyproto.WithClock(clock),
+//		proxyproto.SetReadHeaderTimeout(time.Second), proxyproto.WithPolicy(proxyproto.REQUIRE))
+//	go func() { _, err := conn.Read(buf); errc <- err }()
+//	clock.BlockUntil(1) // the header deadline is armed
+//	clock.Advance(time.Second)
+//
+// It is safe for concurrent use.
+type FakeClock struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*fakeTimer
+}
+
+var _ proxyproto.Clock = (*FakeClock)(nil)
+
+type fakeTimer struct {
+	clock *FakeClock
+	at    time.Time
+	f     func()
+}
+
+// NewFakeClock returns a fake clock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now implements proxyproto.Clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AfterFunc implements proxyproto.Clock. f is called by Advance, once the
+// clock has moved past d.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) proxyproto.ClockTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	c.cond.Broadcast()
+	return t
+}
+
+// Stop implements proxyproto.ClockTimer.
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, pending := range c.timers {
+		if pending == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			c.cond.Broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+// Advance moves the clock forward by d, and calls the functions of the
+// timers expiring meanwhile, in the order they expire, before returning.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	for {
+		sort.SliceStable(c.timers, func(i, j int) bool {
+			return c.timers[i].at.Before(c.timers[j].at)
+		})
+		if len(c.timers) == 0 || c.timers[0].at.After(end) {
+			break
+		}
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		c.now = t.at
+		c.cond.Broadcast()
+		c.mu.Unlock()
+		t.f()
+		c.mu.Lock()
+	}
+	c.now = end
+	c.mu.Unlock()
+}
+
+// BlockUntil waits until n timers are pending, e.g. until a connection has
+// armed the deadline of its header.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) != n {
+		c.cond.Wait()
+	}
+}
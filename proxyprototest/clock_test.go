@@ -0,0 +1,103 @@
+package proxyprototest
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func TestFakeClockAdvance(t *testing.T) {
+	start := time.Unix(1000, 0)
+	clock := NewFakeClock(start)
+
+	var fired []int
+	clock.AfterFunc(2*time.Second, func() { fired = append(fired, 2) })
+	clock.AfterFunc(time.Second, func() { fired = append(fired, 1) })
+	stopped := clock.AfterFunc(time.Second, func() { fired = append(fired, 0) })
+	if !stopped.Stop() {
+		t.Fatal("expected the timer to be stopped")
+	}
+	if stopped.Stop() {
+		t.Fatal("expected the timer to be stopped already")
+	}
+
+	clock.Advance(1500 * time.Millisecond)
+	if len(fired) != 1 || fired[0] != 1 {
+		t.Fatalf("expected the first timer to fire, got %v", fired)
+	}
+	if now := clock.Now(); !now.Equal(start.Add(1500 * time.Millisecond)) {
+		t.Fatalf("unexpected time %v", now)
+	}
+	clock.Advance(time.Second)
+	if len(fired) != 2 || fired[1] != 2 {
+		t.Fatalf("expected the second timer to fire, got %v", fired)
+	}
+}
+
+func TestFakeClockReadHeaderTimeout(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	clock := NewFakeClock(time.Now())
+	conn := proxyproto.NewConn(server,
+		proxyproto.WithClock(clock),
+		proxyproto.WithPolicy(proxyproto.REQUIRE),
+		proxyproto.SetReadHeaderTimeout(time.Hour))
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		errc <- err
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour - time.Nanosecond)
+	select {
+	case err := <-errc:
+		t.Fatalf("expected the header to be awaited, got %v", err)
+	default:
+	}
+
+	clock.Advance(time.Nanosecond)
+	if err := <-errc; !errors.Is(err, proxyproto.ErrHeaderReadTimeout) {
+		t.Fatalf("expected %v, got %v", proxyproto.ErrHeaderReadTimeout, err)
+	}
+
+}
+
+func TestFakeClockHeaderInTime(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	clock := NewFakeClock(time.Now())
+	conn := proxyproto.NewConn(server,
+		proxyproto.WithClock(clock),
+		proxyproto.WithPolicy(proxyproto.REQUIRE),
+		proxyproto.SetReadHeaderTimeout(time.Hour))
+
+	header := proxyproto.HeaderProxyFromAddrs(2,
+		&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000},
+		&net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 2000})
+	go func() {
+		_, _ = proxyproto.WriteHeaderAndPayload(client, header, []byte("ping"))
+	}()
+	if _, err := io.ReadFull(conn, make([]byte, 4)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The deadline of the header is disarmed once it's read.
+	clock.BlockUntil(0)
+	clock.Advance(2 * time.Hour)
+	go func() {
+		_, _ = client.Write([]byte("pong"))
+	}()
+	if _, err := io.ReadFull(conn, make([]byte, 4)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
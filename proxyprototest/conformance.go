@@ -0,0 +1,219 @@
+package proxyprototest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// Outcome is the way a server handled the header of a connection, as seen
+// from the client side.
+type Outcome int
+
+const (
+	// Accepted means the server kept the connection open, waiting for more
+	// data or after answering it.
+	Accepted Outcome = iota
+	// Rejected means the server closed the connection, possibly after
+	// sending an error response.
+	Rejected
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Accepted:
+		return "accepted"
+	case Rejected:
+		return "rejected"
+	}
+	return fmt.Sprintf("Outcome(%d)", int(o))
+}
+
+// Scenario is a conformance scenario: bytes sent by a client standing for an
+// upstream proxy, and the outcome expected from a conforming server.
+type Scenario struct {
+	// Name identifies the scenario.
+	Name string
+	// Data holds the bytes sent once connected.
+	Data []byte
+	// CloseWrite makes the client shut down its side of the connection
+	// once the data is sent, e.g. to end a header midway.
+	CloseWrite bool
+	// Expect is the outcome expected from a conforming server.
+	Expect Outcome
+}
+
+// ConformanceScenarios returns the default scenarios of a
+// ConformanceSuite: valid headers of both versions and every TCP family,
+// headers with TLVs, and malformed headers such as headers truncated
+// midway, with a TLV overflowing the data sent, or with a wrong family.
+func ConformanceScenarios() []Scenario {
+	ipv4 := &proxyproto.Header{
+		Version:           2,
+		Command:           proxyproto.PROXY,
+		TransportProtocol: proxyproto.TCPv4,
+		SourceAddr:        &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000},
+		DestinationAddr:   &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 2000},
+	}
+	tcp4 := format(ipv4)
+	v1 := []byte("PROXY TCP4 10.0.0.1 10.0.0.2 1000 2000\r\n")
+
+	return []Scenario{
+		{Name: "v1-tcp4", Data: v1, Expect: Accepted},
+		{Name: "v1-tcp6", Data: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 1000 2000\r\n"), Expect: Accepted},
+		{Name: "v1-unknown", Data: []byte("PROXY UNKNOWN\r\n"), Expect: Accepted},
+		{Name: "v2-local", Data: format(proxyproto.HeaderProxyFromAddrs(2, nil, nil)), Expect: Accepted},
+		{Name: "v2-tcp4", Data: tcp4, Expect: Accepted},
+		{Name: "v2-tcp6", Data: format(proxyproto.HeaderProxyFromAddrs(2,
+			&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1000},
+			&net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 2000})), Expect: Accepted},
+		{Name: "v2-tlvs", Data: withTLVs(proxyproto.HeaderProxyFromAddrs(2, ipv4.SourceAddr, ipv4.DestinationAddr),
+			proxyproto.TLV{Type: proxyproto.PP2_TYPE_ALPN, Value: []byte("h2")},
+			proxyproto.TLV{Type: proxyproto.PP2_TYPE_AUTHORITY, Value: []byte("example.com")},
+			proxyproto.TLV{Type: proxyproto.PP2_TYPE_UNIQUE_ID, Value: []byte("0123456789abcdef")},
+			proxyproto.TLV{Type: proxyproto.PP2_TYPE_MIN_CUSTOM, Value: []byte("custom")},
+		), Expect: Accepted},
+		{Name: "v1-truncated", Data: v1[:len(v1)/2], CloseWrite: true, Expect: Rejected},
+		{Name: "v1-too-long", Data: append([]byte("PROXY UNKNOWN "), make([]byte, 108)...), Expect: Rejected},
+		{Name: "v1-missing-crlf", Data: []byte("PROXY TCP4 10.0.0.1 10.0.0.2 1000 2000\n"), Expect: Rejected},
+		{Name: "v1-wrong-family", Data: []byte("PROXY TCP4 2001:db8::1 2001:db8::2 1000 2000\r\n"), Expect: Rejected},
+		{Name: "v1-invalid-port", Data: []byte("PROXY TCP4 10.0.0.1 10.0.0.2 1000 65536\r\n"), Expect: Rejected},
+		{Name: "v2-truncated", Data: tcp4[:len(tcp4)/2], CloseWrite: true, Expect: Rejected},
+		{Name: "v2-oversize-tlv", Data: withLength(withTLVBytes(tcp4, byte(proxyproto.PP2_TYPE_NOOP), 0xff, 0xff), 0xffff), CloseWrite: true, Expect: Rejected},
+		{Name: "v2-wrong-family", Data: withByte(tcp4, 13, 0x21), Expect: Rejected},
+		{Name: "v2-unknown-family", Data: withByte(tcp4, 13, 0x41), Expect: Rejected},
+		{Name: "v2-unknown-version", Data: withByte(tcp4, 12, 0x31), Expect: Rejected},
+		{Name: "v2-unknown-command", Data: withByte(tcp4, 12, 0x2f), Expect: Rejected},
+	}
+}
+
+// ConformanceResult is the result of a scenario run against a server.
+type ConformanceResult struct {
+	Scenario Scenario
+	// Observed is the outcome observed, meaningless if Err is set.
+	Observed Outcome
+	// Err is set if the scenario couldn't be run, e.g. the server couldn't
+	// be reached.
+	Err error
+}
+
+// Passed tells whether the server behaved as expected.
+func (r ConformanceResult) Passed() bool {
+	return r.Err == nil && r.Observed == r.Scenario.Expect
+}
+
+// ConformanceSuite runs conformance scenarios against a server speaking the
+// PROXY protocol, whatever the language it is written in.
+//
+// A server is deemed to accept a connection if it keeps it open for the
+// timeout of the suite, and to reject it if it closes it before. The
+// clients send no payload after the header, so that servers waiting for a
+// request don't close the connections they accept.
+type ConformanceSuite struct {
+	// Dialer establishes the connections. If nil, a zero net.Dialer is
+	// used.
+	Dialer proxyproto.ContextDialer
+	// Scenarios are the scenarios run. If nil, ConformanceScenarios is
+	// used.
+	Scenarios []Scenario
+	// Timeout is the time a connection is watched for before deeming it
+	// accepted. If zero, two seconds are used.
+	Timeout time.Duration
+}
+
+// Run runs the scenarios concurrently against the server listening at the
+// TCP address, and returns their results in order.
+func (s *ConformanceSuite) Run(ctx context.Context, address string) []ConformanceResult {
+	scenarios := s.Scenarios
+	if scenarios == nil {
+		scenarios = ConformanceScenarios()
+	}
+
+	results := make([]ConformanceResult, len(scenarios))
+	var wg sync.WaitGroup
+	for i, scenario := range scenarios {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = s.run(ctx, address, scenario)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// run runs a single scenario.
+func (s *ConformanceSuite) run(ctx context.Context, address string, scenario Scenario) ConformanceResult {
+	result := ConformanceResult{Scenario: scenario}
+
+	dialer := s.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = 2 * time.Second
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		result.Err = err
+		return result
+	}
+
+	if _, err := conn.Write(scenario.Data); err != nil {
+		// The server gave up on the connection before reading it all.
+		result.Observed = Rejected
+		return result
+	}
+	if scenario.CloseWrite {
+		if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		}
+	}
+
+	// Drain whatever the server sends, e.g. a banner or an error
+	// response, until it closes the connection or the timeout expires.
+	_, err = io.Copy(io.Discard, conn)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		result.Observed = Accepted
+	} else {
+		result.Observed = Rejected
+	}
+	return result
+}
+
+// WriteConformanceReport writes a report of the results to w, one line per
+// scenario followed by a summary, and tells whether all scenarios passed.
+func WriteConformanceReport(w io.Writer, results []ConformanceResult) (bool, error) {
+	passed := 0
+	for _, r := range results {
+		var err error
+		switch {
+		case r.Err != nil:
+			_, err = fmt.Fprintf(w, "FAIL  %-20s error: %v\n", r.Scenario.Name, r.Err)
+		case r.Passed():
+			passed++
+			_, err = fmt.Fprintf(w, "PASS  %-20s %v\n", r.Scenario.Name, r.Observed)
+		default:
+			_, err = fmt.Fprintf(w, "FAIL  %-20s expected %v, got %v\n", r.Scenario.Name, r.Scenario.Expect, r.Observed)
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d/%d scenarios passed\n", passed, len(results))
+	return passed == len(results), err
+}
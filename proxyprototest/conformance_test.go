@@ -0,0 +1,83 @@
+package proxyprototest
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// serve accepts connections on l, reading each until it fails.
+func serve(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			buf := make([]byte, 512)
+			for {
+				if _, err := conn.Read(buf); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+func TestConformanceSuite(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pl := &proxyproto.Listener{Listener: l}
+	defer pl.Close()
+	go serve(pl)
+
+	suite := &ConformanceSuite{Timeout: 300 * time.Millisecond}
+	results := suite.Run(context.Background(), l.Addr().String())
+
+	var report bytes.Buffer
+	ok, err := WriteConformanceReport(&report, results)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !ok {
+		t.Fatalf("expected all scenarios to pass:\n%s", report.String())
+	}
+}
+
+func TestConformanceSuiteNonConforming(t *testing.T) {
+	// A server ignoring the protocol accepts every connection.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer l.Close()
+	go serve(l)
+
+	suite := &ConformanceSuite{
+		Scenarios: []Scenario{
+			{Name: "valid", Data: []byte("PROXY UNKNOWN\r\n"), Expect: Accepted},
+			{Name: "invalid", Data: []byte("PROXY TCP4\r\n"), Expect: Rejected},
+		},
+		Timeout: 100 * time.Millisecond,
+	}
+	results := suite.Run(context.Background(), l.Addr().String())
+	if !results[0].Passed() || results[1].Passed() {
+		t.Fatalf("unexpected results %+v", results)
+	}
+
+	var report bytes.Buffer
+	if ok, _ := WriteConformanceReport(&report, results); ok {
+		t.Fatal("expected the report to fail")
+	}
+	if !strings.Contains(report.String(), "FAIL  invalid") {
+		t.Fatalf("unexpected report:\n%s", report.String())
+	}
+}
@@ -0,0 +1,193 @@
+// Package proxyprototest provides utilities for testing code built on top of
+// the proxyproto package.
+package proxyprototest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// Seed is an entry of the fuzzing corpus.
+type Seed struct {
+	// Name identifies the seed, and is usable as a file name.
+	Name string
+	// Data holds the header, followed by a few payload bytes.
+	Data []byte
+	// Valid tells whether proxyproto.Read accepts the header, given a
+	// reader with a buffer large enough for the whole header. Since TLVs
+	// are only split on demand, malformed TLVs don't make a header invalid.
+	Valid bool
+}
+
+// payload follows the header of every seed, so that parsers reading past the
+// header are caught.
+var payload = []byte("GET / HTTP/1.1\r\n\r\n")
+
+// Corpus returns a broad seed corpus of valid and adversarial version 1 and
+// version 2 headers, e.g. length field edge cases, giant TLVs and truncated
+// addresses, to bootstrap fuzzing of PROXY protocol parsers.
+func Corpus() []Seed {
+	var seeds []Seed
+	add := func(name string, valid bool, header []byte) {
+		data := append(append(make([]byte, 0, len(header)+len(payload)), header...), payload...)
+		seeds = append(seeds, Seed{Name: name, Data: data, Valid: valid})
+	}
+
+	// Version 1
+	add("v1-tcp4", true, []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"))
+	add("v1-tcp6", true, []byte("PROXY TCP6 ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff 65535 65535\r\n"))
+	add("v1-tcp6-ipv4-mapped", true, []byte("PROXY TCP6 ::ffff:10.0.0.1 ::ffff:10.0.0.2 1000 2000\r\n"))
+	add("v1-unknown", true, []byte("PROXY UNKNOWN\r\n"))
+	add("v1-unknown-addresses", true, []byte("PROXY UNKNOWN ::1 ::1 1000 2000\r\n"))
+	add("v1-zero-ports", true, []byte("PROXY TCP4 10.0.0.1 10.0.0.2 0 0\r\n"))
+	add("v1-no-crlf", false, []byte("PROXY TCP4 10.0.0.1 10.0.0.2 1000 2000\n"))
+	add("v1-no-delimiter", false, []byte("PROXY TCP4 10.0.0.1 10.0.0.2 1000 2000"))
+	add("v1-too-long", false, append([]byte("PROXY UNKNOWN "), bytes.Repeat([]byte("f"), 108)...))
+	add("v1-invalid-port", false, []byte("PROXY TCP4 10.0.0.1 10.0.0.2 1000 65536\r\n"))
+	add("v1-negative-port", false, []byte("PROXY TCP4 10.0.0.1 10.0.0.2 -1 2000\r\n"))
+	add("v1-family-mismatch", false, []byte("PROXY TCP4 ::1 ::1 1000 2000\r\n"))
+	add("v1-truncated-addresses", false, []byte("PROXY TCP4 10.0.0.1\r\n"))
+	add("v1-unknown-family", false, []byte("PROXY UDP4 10.0.0.1 10.0.0.2 1000 2000\r\n"))
+	add("v1-signature-only", false, []byte("PROXY"))
+
+	// Version 2
+	ipv4 := func(transport proxyproto.AddressFamilyAndProtocol) *proxyproto.Header {
+		return &proxyproto.Header{
+			Version:           2,
+			Command:           proxyproto.PROXY,
+			TransportProtocol: transport,
+			SourceAddr:        &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000},
+			DestinationAddr:   &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 2000},
+		}
+	}
+	add("v2-local", true, format(proxyproto.HeaderProxyFromAddrs(2, nil, nil)))
+	add("v2-tcp4", true, format(ipv4(proxyproto.TCPv4)))
+	add("v2-udp4", true, format(proxyproto.HeaderProxyFromAddrs(2,
+		&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000},
+		&net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 2000})))
+	add("v2-tcp6", true, format(proxyproto.HeaderProxyFromAddrs(2,
+		&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1000},
+		&net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 2000})))
+	add("v2-unix", true, format(proxyproto.HeaderProxyFromAddrs(2,
+		&net.UnixAddr{Net: "unix", Name: "/var/run/src.sock"},
+		&net.UnixAddr{Net: "unix", Name: "/var/run/dst.sock"})))
+
+	tlvs := []proxyproto.TLV{
+		{Type: proxyproto.PP2_TYPE_ALPN, Value: []byte("h2")},
+		{Type: proxyproto.PP2_TYPE_AUTHORITY, Value: []byte("example.com")},
+		{Type: proxyproto.PP2_TYPE_UNIQUE_ID, Value: []byte("0123456789abcdef")},
+		{Type: proxyproto.PP2_TYPE_NOOP, Value: make([]byte, 3)},
+		{Type: proxyproto.PP2_TYPE_SSL, Value: []byte{
+			0x01, 0x00, 0x00, 0x00, 0x00,
+			byte(proxyproto.PP2_SUBTYPE_SSL_VERSION), 0x00, 0x07, 'T', 'L', 'S', 'v', '1', '.', '3',
+		}},
+		{Type: proxyproto.PP2_TYPE_MIN_CUSTOM, Value: []byte("custom")},
+	}
+	add("v2-tcp4-tlvs", true, withTLVs(ipv4(proxyproto.TCPv4), tlvs...))
+	add("v2-local-tlvs", true, withTLVs(proxyproto.HeaderProxyFromAddrs(2, nil, nil), tlvs[2]))
+	add("v2-crc32c", true, withCRC32C(format(ipv4(proxyproto.TCPv4)), false))
+	add("v2-crc32c-wrong", true, withCRC32C(format(ipv4(proxyproto.TCPv4)), true))
+	add("v2-giant-tlv", true, withTLVs(ipv4(proxyproto.TCPv4), proxyproto.TLV{
+		Type:  proxyproto.PP2_TYPE_NOOP,
+		Value: make([]byte, 0xffff-12-3),
+	}))
+
+	// Headers Read accepts, but whose TLVs are malformed.
+	tcp4 := format(ipv4(proxyproto.TCPv4))
+	add("v2-length-beyond-addresses", true, withLength(tcp4, 13))
+	add("v2-truncated-tlv", true, withTLVBytes(tcp4, byte(proxyproto.PP2_TYPE_ALPN), 0x00))
+	add("v2-tlv-length-beyond-header", true, withTLVBytes(tcp4, byte(proxyproto.PP2_TYPE_ALPN), 0x00, 0x10, 'h', '2'))
+	add("v2-ssl-too-short", true, withTLVBytes(tcp4, byte(proxyproto.PP2_TYPE_SSL), 0x00, 0x02, 0x01, 0x00))
+
+	add("v2-signature-only", false, append([]byte{}, proxyproto.SIGV2...))
+	add("v2-partial-signature", false, append([]byte{}, proxyproto.SIGV2[:6]...))
+	add("v2-version-1", false, withByte(tcp4, 12, 0x11))
+	add("v2-version-3", false, withByte(tcp4, 12, 0x31))
+	add("v2-unknown-command", false, withByte(tcp4, 12, 0x2f))
+	add("v2-unknown-family", false, withByte(tcp4, 13, 0x41))
+	add("v2-unknown-transport", false, withByte(tcp4, 13, 0x13))
+	add("v2-length-zero", false, withLength(tcp4[:16], 0))
+	add("v2-length-short", false, withLength(tcp4, 11))
+	add("v2-length-max", false, withLength(tcp4, 0xffff))
+	add("v2-truncated-addresses", false, withLength(tcp4[:16+6], 6))
+
+	return seeds
+}
+
+// WriteCorpus writes the seeds of the corpus as files of dir, which is
+// created if missing. If goFormat is set, the files use the format of the
+// corpus of native Go fuzz tests, i.e. testdata/fuzz/FuzzXxx, expecting a
+// single []byte argument. Otherwise, they hold the raw seeds.
+func WriteCorpus(dir string, goFormat bool) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, seed := range Corpus() {
+		data := seed.Data
+		if goFormat {
+			data = []byte("go test fuzz v1\n[]byte(" + strconv.Quote(string(seed.Data)) + ")\n")
+		}
+		if err := os.WriteFile(filepath.Join(dir, seed.Name), data, 0o644); err != nil {
+			return fmt.Errorf("proxyprototest: writing seed %s: %w", seed.Name, err)
+		}
+	}
+	return nil
+}
+
+// format formats a header known to be valid.
+func format(header *proxyproto.Header) []byte {
+	buf, err := header.Format()
+	if err != nil {
+		panic(err)
+	}
+	return buf
+}
+
+// withTLVs formats a header along with TLVs.
+func withTLVs(header *proxyproto.Header, tlvs ...proxyproto.TLV) []byte {
+	if err := header.SetTLVs(tlvs); err != nil {
+		panic(err)
+	}
+	return format(header)
+}
+
+// withTLVBytes appends raw TLV bytes to a formatted version 2 header.
+func withTLVBytes(header []byte, tlv ...byte) []byte {
+	buf := append(append([]byte{}, header...), tlv...)
+	return withLength(buf, len(buf)-16)
+}
+
+// withCRC32C appends a CRC32C TLV to a formatted version 2 header, holding
+// the checksum of the header or, if wrong is set, a bogus one.
+func withCRC32C(header []byte, wrong bool) []byte {
+	buf := withTLVBytes(header, byte(proxyproto.PP2_TYPE_CRC32C), 0x00, 0x04, 0, 0, 0, 0)
+	sum := crc32.Checksum(buf, crc32.MakeTable(crc32.Castagnoli))
+	if wrong {
+		sum = ^sum
+	}
+	binary.BigEndian.PutUint32(buf[len(buf)-4:], sum)
+	return buf
+}
+
+// withLength returns a copy of a version 2 header with the given length
+// field.
+func withLength(header []byte, length int) []byte {
+	buf := append([]byte{}, header...)
+	binary.BigEndian.PutUint16(buf[14:16], uint16(length))
+	return buf
+}
+
+// withByte returns a copy of a header with the byte at index i replaced.
+func withByte(header []byte, i int, b byte) []byte {
+	buf := append([]byte{}, header...)
+	buf[i] = b
+	return buf
+}
@@ -0,0 +1,60 @@
+package proxyprototest
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func TestCorpus(t *testing.T) {
+	names := make(map[string]bool)
+	for _, seed := range Corpus() {
+		t.Run(seed.Name, func(t *testing.T) {
+			if names[seed.Name] {
+				t.Fatal("duplicate seed name")
+			}
+			names[seed.Name] = true
+
+			reader := bufio.NewReaderSize(bytes.NewReader(seed.Data), 1<<17)
+			_, err := proxyproto.Read(reader)
+			if seed.Valid && err != nil {
+				t.Fatalf("expected valid seed, got %v", err)
+			}
+			if !seed.Valid && err == nil {
+				t.Fatal("expected invalid seed")
+			}
+		})
+	}
+}
+
+func TestWriteCorpus(t *testing.T) {
+	dir := t.TempDir()
+	if err := WriteCorpus(filepath.Join(dir, "raw"), false); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := WriteCorpus(filepath.Join(dir, "go"), true); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for _, seed := range Corpus() {
+		raw, err := os.ReadFile(filepath.Join(dir, "raw", seed.Name))
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !bytes.Equal(raw, seed.Data) {
+			t.Fatalf("unexpected raw seed %s", seed.Name)
+		}
+		goSeed, err := os.ReadFile(filepath.Join(dir, "go", seed.Name))
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !strings.HasPrefix(string(goSeed), "go test fuzz v1\n[]byte(") {
+			t.Fatalf("unexpected Go seed %s: %q", seed.Name, goSeed)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+// Package golden provides canonical PROXY protocol headers, as exact wire
+// bytes along with the header they decode to, so that implementations of
+// the protocol, forks of the proxyproto package included, can assert their
+// byte-level interoperability.
+//
+// The bytes are spelled out independently of the proxyproto package, after
+// the spec at https://www.haproxy.org/download/2.3/doc/proxy-protocol.txt,
+// or taken from captures of proxies and load balancers.
+package golden
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"net"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// Vector is a header, in its wire format and decoded.
+type Vector struct {
+	// Name identifies the vector, and is usable as a file name.
+	Name string
+	// Source tells where the bytes come from, e.g. "spec" or the proxy
+	// they were captured from.
+	Source string
+	// Data holds the exact bytes of the header, without any payload.
+	Data []byte
+	// Header is the header Data decodes to, TLVs included.
+	Header *proxyproto.Header
+	// Canonical tells whether formatting Header yields Data again. It
+	// doesn't for headers which can be written in several ways, e.g.
+	// version 1 UNKNOWN headers carrying addresses.
+	Canonical bool
+}
+
+// signature is the version 2 signature, see section 2.2 of the spec.
+var signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+// Vectors returns the golden vectors, covering both versions of the protocol,
+// every address family and transport protocol, the registered TLVs and
+// samples sent by HAProxy and the AWS Network Load Balancer.
+func Vectors() []Vector {
+	var vectors []Vector
+	add := func(name, source string, canonical bool, data []byte, header *proxyproto.Header, tlvs ...proxyproto.TLV) {
+		if len(tlvs) > 0 {
+			if err := header.SetTLVs(tlvs); err != nil {
+				panic("golden: " + name + ": " + err.Error())
+			}
+		}
+		vectors = append(vectors, Vector{Name: name, Source: source, Data: data, Header: header, Canonical: canonical})
+	}
+
+	tcp4Src := &net.TCPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 56324}
+	tcp4Dst := &net.TCPAddr{IP: net.IPv4(192, 168, 0, 11), Port: 443}
+	tcp6Src := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 56324}
+	tcp6Dst := &net.TCPAddr{IP: net.ParseIP("2001:db8::11"), Port: 443}
+	udp4Src := &net.UDPAddr{IP: tcp4Src.IP, Port: tcp4Src.Port}
+	udp4Dst := &net.UDPAddr{IP: tcp4Dst.IP, Port: tcp4Dst.Port}
+	udp6Src := &net.UDPAddr{IP: tcp6Src.IP, Port: tcp6Src.Port}
+	udp6Dst := &net.UDPAddr{IP: tcp6Dst.IP, Port: tcp6Dst.Port}
+	unixSrc := &net.UnixAddr{Net: "unix", Name: "/var/run/src.sock"}
+	unixDst := &net.UnixAddr{Net: "unix", Name: "/var/run/dst.sock"}
+	unixgramSrc := &net.UnixAddr{Net: "unixgram", Name: unixSrc.Name}
+	unixgramDst := &net.UnixAddr{Net: "unixgram", Name: unixDst.Name}
+
+	header := func(version byte, command proxyproto.ProtocolVersionAndCommand, transport proxyproto.AddressFamilyAndProtocol, src, dst net.Addr) *proxyproto.Header {
+		return &proxyproto.Header{
+			Version:           version,
+			Command:           command,
+			TransportProtocol: transport,
+			SourceAddr:        src,
+			DestinationAddr:   dst,
+		}
+	}
+
+	// Version 1, see section 2.1 of the spec.
+	add("v1-tcp4", "spec", true,
+		[]byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"),
+		header(1, proxyproto.PROXY, proxyproto.TCPv4, tcp4Src, tcp4Dst))
+	add("v1-tcp6", "spec", true,
+		[]byte("PROXY TCP6 2001:db8::1 2001:db8::11 56324 443\r\n"),
+		header(1, proxyproto.PROXY, proxyproto.TCPv6, tcp6Src, tcp6Dst))
+	add("v1-unknown", "spec", true,
+		[]byte("PROXY UNKNOWN\r\n"),
+		header(1, proxyproto.LOCAL, proxyproto.UNSPEC, nil, nil))
+	add("v1-unknown-addresses", "spec", false,
+		[]byte("PROXY UNKNOWN ffff:f::f:ffff ffff:f::f:ffff 65535 65535\r\n"),
+		header(1, proxyproto.LOCAL, proxyproto.UNSPEC, nil, nil))
+
+	// Version 2, see section 2.2 of the spec.
+	add("v2-local", "spec", true,
+		v2(0x20, 0x00, nil),
+		header(2, proxyproto.LOCAL, proxyproto.UNSPEC, nil, nil))
+	add("v2-tcp4", "spec", true,
+		v2(0x21, 0x11, ipv4Addrs()),
+		header(2, proxyproto.PROXY, proxyproto.TCPv4, tcp4Src, tcp4Dst))
+	add("v2-udp4", "spec", true,
+		v2(0x21, 0x12, ipv4Addrs()),
+		header(2, proxyproto.PROXY, proxyproto.UDPv4, udp4Src, udp4Dst))
+	add("v2-tcp6", "spec", true,
+		v2(0x21, 0x21, ipv6Addrs()),
+		header(2, proxyproto.PROXY, proxyproto.TCPv6, tcp6Src, tcp6Dst))
+	add("v2-udp6", "spec", true,
+		v2(0x21, 0x22, ipv6Addrs()),
+		header(2, proxyproto.PROXY, proxyproto.UDPv6, udp6Src, udp6Dst))
+	add("v2-unix-stream", "spec", true,
+		v2(0x21, 0x31, unixAddrs()),
+		header(2, proxyproto.PROXY, proxyproto.UnixStream, unixSrc, unixDst))
+	add("v2-unix-datagram", "spec", true,
+		v2(0x21, 0x32, unixAddrs()),
+		header(2, proxyproto.PROXY, proxyproto.UnixDatagram, unixgramSrc, unixgramDst))
+
+	// Version 2 with TLVs, see section 2.2.1 and following of the spec.
+	ssl := []byte{
+		0x01,                   // client: PP2_CLIENT_SSL
+		0x00, 0x00, 0x00, 0x00, // verify: success
+		0x21, 0x00, 0x07, 'T', 'L', 'S', 'v', '1', '.', '3', // PP2_SUBTYPE_SSL_VERSION
+		0x23, 0x00, 0x16, 'T', 'L', 'S', '_', 'A', 'E', 'S', '_', '1', '2', '8', '_', 'G', 'C', 'M', '_', 'S', 'H', 'A', '2', '5', '6', // PP2_SUBTYPE_SSL_CIPHER
+	}
+	tlvs := []proxyproto.TLV{
+		{Type: proxyproto.PP2_TYPE_ALPN, Value: []byte("h2")},
+		{Type: proxyproto.PP2_TYPE_AUTHORITY, Value: []byte("example.com")},
+		{Type: proxyproto.PP2_TYPE_UNIQUE_ID, Value: []byte("0123456789abcdef")},
+		{Type: proxyproto.PP2_TYPE_SSL, Value: ssl},
+		{Type: proxyproto.PP2_TYPE_NETNS, Value: []byte("blue")},
+	}
+	add("v2-tcp4-tlvs", "spec", true,
+		v2(0x21, 0x11, ipv4Addrs(),
+			tlv(0x01, []byte("h2")),
+			tlv(0x02, []byte("example.com")),
+			tlv(0x05, []byte("0123456789abcdef")),
+			tlv(0x20, ssl),
+			tlv(0x30, []byte("blue"))),
+		header(2, proxyproto.PROXY, proxyproto.TCPv4, tcp4Src, tcp4Dst), tlvs...)
+	add("v2-local-unique-id", "spec", true,
+		v2(0x20, 0x00, nil, tlv(0x05, []byte("0123456789abcdef"))),
+		header(2, proxyproto.LOCAL, proxyproto.UNSPEC, nil, nil), tlvs[2])
+	crc := withCRC32C(v2(0x21, 0x11, ipv4Addrs(), tlv(0x03, make([]byte, 4))))
+	add("v2-tcp4-crc32c", "spec", true, crc,
+		header(2, proxyproto.PROXY, proxyproto.TCPv4, tcp4Src, tcp4Dst),
+		proxyproto.TLV{Type: proxyproto.PP2_TYPE_CRC32C, Value: crc[len(crc)-4:]})
+
+	// Laid out as by HAProxy 2.x with "send-proxy-v2 proxy-v2-options
+	// ssl,unique-id" for a TLS 1.3 client, padded with a NOOP TLV.
+	add("haproxy-v2-ssl-unique-id", "haproxy", true,
+		v2(0x21, 0x11, ipv4Addrs(),
+			tlv(0x05, []byte("0123456789abcdef")),
+			tlv(0x20, ssl),
+			tlv(0x04, make([]byte, 5))),
+		header(2, proxyproto.PROXY, proxyproto.TCPv4, tcp4Src, tcp4Dst),
+		tlvs[2], tlvs[3], proxyproto.TLV{Type: proxyproto.PP2_TYPE_NOOP, Value: make([]byte, 5)})
+
+	// AWS Network Load Balancer behind a VPC endpoint, from
+	// https://github.com/aws/elastic-load-balancing-tools/blob/c8eee30ab991ab4c57dc37d1c58f09f67bd534aa/proprot/tst/com/amazonaws/proprot/Compatibility_AwsNetworkLoadBalancerTest.java#L41..L67
+	nlb := []byte{
+		0x0d, 0x0a, 0x0d, 0x0a, 0x00, 0x0d, 0x0a, 0x51, 0x55, 0x49, 0x54, 0x0a,
+		0x21, 0x11, 0x00, 0x54,
+		0xac, 0x1f, 0x07, 0x71,
+		0xac, 0x1f, 0x0a, 0x1f,
+		0xc8, 0xf2, 0x00, 0x50,
+		0x03, 0x00, 0x04, 0xe8, 0xd6, 0x89, 0x2d,
+		0xea, 0x00, 0x17, 0x01, 'v', 'p', 'c', 'e', '-', '0', '8', 'd', '2', 'b', 'f', '1', '5', 'f', 'a', 'c', '5', '0', '0', '1', 'c', '9',
+		0x04, 0x00, 0x24,
+	}
+	nlb = append(nlb, make([]byte, 0x24)...)
+	add("aws-nlb-vpce", "aws-nlb", true, nlb,
+		header(2, proxyproto.PROXY, proxyproto.TCPv4,
+			&net.TCPAddr{IP: net.IPv4(172, 31, 7, 113), Port: 51442},
+			&net.TCPAddr{IP: net.IPv4(172, 31, 10, 31), Port: 80}),
+		proxyproto.TLV{Type: proxyproto.PP2_TYPE_CRC32C, Value: []byte{0xe8, 0xd6, 0x89, 0x2d}},
+		proxyproto.TLV{Type: 0xea, Value: append([]byte{0x01}, "vpce-08d2bf15fac5001c9"...)},
+		proxyproto.TLV{Type: proxyproto.PP2_TYPE_NOOP, Value: make([]byte, 0x24)})
+
+	return vectors
+}
+
+// v2 returns a version 2 header with the given version and command byte,
+// family and transport byte, addresses and TLVs.
+func v2(verCmd, family byte, addrs []byte, tlvs ...[]byte) []byte {
+	var rest []byte
+	rest = append(rest, addrs...)
+	for _, t := range tlvs {
+		rest = append(rest, t...)
+	}
+	buf := append([]byte(nil), signature...)
+	buf = append(buf, verCmd, family)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(rest)))
+	return append(buf, rest...)
+}
+
+// tlv returns the TLV of the given type and value.
+func tlv(t byte, value []byte) []byte {
+	buf := binary.BigEndian.AppendUint16([]byte{t}, uint16(len(value)))
+	return append(buf, value...)
+}
+
+// ipv4Addrs returns the addresses 192.168.0.1:56324 and 192.168.0.11:443.
+func ipv4Addrs() []byte {
+	return []byte{
+		192, 168, 0, 1,
+		192, 168, 0, 11,
+		0xdc, 0x04, // 56324
+		0x01, 0xbb, // 443
+	}
+}
+
+// ipv6Addrs returns the addresses [2001:db8::1]:56324 and
+// [2001:db8::11]:443.
+func ipv6Addrs() []byte {
+	return []byte{
+		0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01,
+		0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x11,
+		0xdc, 0x04, // 56324
+		0x01, 0xbb, // 443
+	}
+}
+
+// unixAddrs returns the addresses /var/run/src.sock and /var/run/dst.sock,
+// each padded with zeros to 108 bytes.
+func unixAddrs() []byte {
+	buf := make([]byte, 216)
+	copy(buf, "/var/run/src.sock")
+	copy(buf[108:], "/var/run/dst.sock")
+	return buf
+}
+
+// withCRC32C fills the trailing CRC32C TLV of the header with the checksum
+// of the header, computed with the value of the TLV zeroed.
+func withCRC32C(buf []byte) []byte {
+	sum := crc32.Checksum(buf, crc32.MakeTable(crc32.Castagnoli))
+	binary.BigEndian.PutUint32(buf[len(buf)-4:], sum)
+	return buf
+}
@@ -0,0 +1,34 @@
+package golden
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func TestVectors(t *testing.T) {
+	for _, v := range Vectors() {
+		t.Run(v.Name, func(t *testing.T) {
+			header, err := proxyproto.Read(bufio.NewReader(bytes.NewReader(v.Data)))
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if !header.EqualsTo(v.Header) {
+				t.Fatalf("expected %#v, got %#v", v.Header, header)
+			}
+
+			if !v.Canonical {
+				return
+			}
+			buf, err := v.Header.Format()
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if !bytes.Equal(buf, v.Data) {
+				t.Fatalf("expected %x, got %x", v.Data, buf)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package proxyprototest
+
+import (
+	"net"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// Pipe creates a synchronous, in-memory, full duplex connection pair, as
+// net.Pipe does, whose server end is a *proxyproto.Conn already carrying
+// the header: its ProxyHeader returns it, and its RemoteAddr and LocalAddr
+// report the header's addresses. Nothing is written on the pipe, so unit
+// tests can exercise header-dependent logic without real listeners and
+// timeouts. A nil header makes the server end report the pipe's addresses.
+func Pipe(header *proxyproto.Header, opts ...func(*proxyproto.Conn)) (server *proxyproto.Conn, client net.Conn) {
+	serverConn, client := net.Pipe()
+	server = proxyproto.NewConn(serverConn, opts...)
+	server.SetHeader(header)
+	return server, client
+}
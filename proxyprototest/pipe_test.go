@@ -0,0 +1,50 @@
+package proxyprototest
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func TestPipe(t *testing.T) {
+	header := proxyproto.HeaderProxyFromAddrs(2,
+		&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000},
+		&net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 2000})
+
+	server, client := Pipe(header)
+	defer server.Close()
+	defer client.Close()
+
+	if server.ProxyHeader() != header {
+		t.Fatal("expected the header to be attached")
+	}
+	if server.RemoteAddr().String() != "10.0.0.1:1000" || server.LocalAddr().String() != "10.0.0.2:2000" {
+		t.Fatalf("unexpected addresses %v and %v", server.RemoteAddr(), server.LocalAddr())
+	}
+
+	go func() {
+		_, _ = client.Write([]byte("ping"))
+	}()
+	recv := make([]byte, 4)
+	if _, err := io.ReadFull(server, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(recv) != "ping" {
+		t.Fatalf("expected %q, got %q", "ping", recv)
+	}
+}
+
+func TestPipeWithoutHeader(t *testing.T) {
+	server, client := Pipe(nil)
+	defer server.Close()
+	defer client.Close()
+
+	if server.ProxyHeader() != nil {
+		t.Fatal("expected no header")
+	}
+	if server.RemoteAddr().Network() != "pipe" {
+		t.Fatalf("expected the pipe's address, got %v", server.RemoteAddr())
+	}
+}
@@ -0,0 +1,121 @@
+package proxyprototest
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// SlowLorisDialer dials connections on which a valid header is written one
+// byte at a time, standing for a slow-loris client holding connections open
+// with a header which never completes. It verifies that the header
+// timeouts, rate limits and caps of pending connections of an application
+// actually work.
+type SlowLorisDialer struct {
+	// Dialer establishes the underlying connections. If nil, a zero
+	// net.Dialer is used.
+	Dialer proxyproto.ContextDialer
+	// Header is the header to write. If nil, a header is built from the
+	// addresses of the established connection. Note that version 1 headers
+	// not received at once are rejected rather than waited for.
+	Header *proxyproto.Header
+	// Interval is the pause before writing each byte of the header.
+	Interval time.Duration
+	// StallAfter, if positive, stops the writing of the header after as
+	// many bytes, the connection being held open until closed.
+	StallAfter int
+}
+
+// DialContext connects to the address on the named network, and starts
+// writing the header on the connection in the background. The context only
+// bounds the dial.
+func (d *SlowLorisDialer) DialContext(ctx context.Context, network, address string) (*SlowLorisConn, error) {
+	dialer := d.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	header := d.Header
+	if header == nil {
+		header = proxyproto.HeaderProxyFromAddrs(0, conn.LocalAddr(), conn.RemoteAddr())
+	}
+	buf, err := header.Format()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if d.StallAfter > 0 && d.StallAfter < len(buf) {
+		buf = buf[:d.StallAfter]
+	}
+
+	c := &SlowLorisConn{
+		Conn:    conn,
+		done:    make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+	go c.trickle(buf, d.Interval)
+	return c, nil
+}
+
+// SlowLorisConn is a connection dialed by a SlowLorisDialer. It must not be
+// written to before Done is closed.
+type SlowLorisConn struct {
+	net.Conn
+
+	done      chan struct{}
+	closing   chan struct{}
+	closeOnce sync.Once
+	written   int
+	err       error
+}
+
+// trickle writes buf on the connection one byte at a time.
+func (c *SlowLorisConn) trickle(buf []byte, interval time.Duration) {
+	defer close(c.done)
+
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for i := range buf {
+		if i > 0 {
+			timer.Reset(interval)
+		}
+		select {
+		case <-timer.C:
+		case <-c.closing:
+			return
+		}
+		if _, err := c.Conn.Write(buf[i : i+1]); err != nil {
+			c.err = err
+			return
+		}
+		c.written++
+	}
+}
+
+// Done returns a channel closed once the writing of the header is over:
+// either all the bytes to write were written, the peer failed the writes,
+// e.g. by closing the connection, or the connection was closed.
+func (c *SlowLorisConn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Written returns the number of bytes of the header written, and the error
+// the writing failed with, if any. It must only be called once Done is
+// closed.
+func (c *SlowLorisConn) Written() (int, error) {
+	return c.written, c.err
+}
+
+// Close stops the writing of the header, and closes the connection.
+func (c *SlowLorisConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closing) })
+	return c.Conn.Close()
+}
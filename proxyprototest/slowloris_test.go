@@ -0,0 +1,91 @@
+package proxyprototest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func TestSlowLorisDialer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pl := &proxyproto.Listener{Listener: l}
+	defer pl.Close()
+
+	header := proxyproto.HeaderProxyFromAddrs(2,
+		&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000},
+		&net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 2000})
+	d := &SlowLorisDialer{Header: header, Interval: time.Millisecond}
+	client, err := d.DialContext(context.Background(), "tcp", pl.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	// The header is received whole, however slowly.
+	if conn.RemoteAddr().String() != "10.0.0.1:1000" {
+		t.Fatalf("expected the header addresses, got %v", conn.RemoteAddr())
+	}
+	<-client.Done()
+	raw, _ := header.Format()
+	if n, err := client.Written(); n != len(raw) || err != nil {
+		t.Fatalf("expected %d bytes written, got %d and %v", len(raw), n, err)
+	}
+}
+
+func TestSlowLorisDialerStall(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pl := &proxyproto.Listener{
+		Listener:          l,
+		ReadHeaderTimeout: 50 * time.Millisecond,
+		ConnPolicy: func(proxyproto.ConnPolicyOptions) (proxyproto.Policy, error) {
+			return proxyproto.REQUIRE, nil
+		},
+	}
+	defer pl.Close()
+
+	d := &SlowLorisDialer{StallAfter: 5}
+	client, err := d.DialContext(context.Background(), "tcp", pl.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	// The stalled header fails the connection once its timeout expires.
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, proxyproto.ErrHeaderReadTimeout) {
+		t.Fatalf("expected error %v, got %v", proxyproto.ErrHeaderReadTimeout, err)
+	}
+	<-client.Done()
+	if n, err := client.Written(); n != 5 || err != nil {
+		t.Fatalf("expected 5 bytes written, got %d and %v", n, err)
+	}
+
+	// Closing the connection releases a stall.
+	stalled, err := (&SlowLorisDialer{StallAfter: 1, Interval: time.Hour}).DialContext(context.Background(), "tcp", pl.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	stalled.Close()
+	<-stalled.Done()
+}
@@ -0,0 +1,56 @@
+package proxyproto
+
+import (
+	"bufio"
+	"io"
+)
+
+// Reader parses the PROXY header at the start of any io.Reader, e.g. a
+// file, a recorded session or a pipe, and then yields the remaining payload.
+// It decouples parsing from net.Conn for offline analysis tooling. A Reader
+// isn't safe for concurrent use.
+type Reader struct {
+	r      *bufio.Reader
+	opts   parseOptions
+	parsed bool
+	header *Header
+	err    error
+}
+
+// NewReader returns a Reader parsing the header at the start of r. The
+// options tuning the parsing of connections apply, e.g. RetainRawHeader,
+// SkipMalformedTLVs, WithMaxHeaderSize or WithZonePolicy, the others are
+// ignored.
+func NewReader(r io.Reader, opts ...func(*Conn)) *Reader {
+	c := &Conn{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return &Reader{
+		r:    bufio.NewReaderSize(r, max(c.parseOptions.maxHeaderSize, bufSize)),
+		opts: c.parseOptions,
+	}
+}
+
+// Header parses the header at the start of the stream on the first call,
+// and returns it. If the stream doesn't start with a PROXY signature, a nil
+// header and no error are returned, and the whole stream is the payload.
+func (r *Reader) Header() (*Header, error) {
+	if !r.parsed {
+		r.parsed = true
+		r.header, r.err = read(r.r, r.opts)
+		if r.err == ErrNoProxyProtocol {
+			r.header, r.err = nil, nil
+		}
+	}
+	return r.header, r.err
+}
+
+// Read reads the payload following the header, parsing the header first if
+// needed. It returns the error the header failed to parse with, if any.
+func (r *Reader) Read(b []byte) (int, error) {
+	if _, err := r.Header(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(b)
+}
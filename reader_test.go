@@ -0,0 +1,58 @@
+package proxyproto
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	r := NewReader(strings.NewReader("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\nping"), RetainRawHeader())
+
+	header, err := r.Header()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if header == nil || header.Version != 1 || header.SourceAddr.String() != "10.1.1.1:1000" {
+		t.Fatalf("unexpected header: %v", header)
+	}
+	if string(header.Raw()) != "PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\n" {
+		t.Fatalf("unexpected raw header: %q", header.Raw())
+	}
+
+	payload, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(payload) != "ping" {
+		t.Fatalf("expected payload %q, got %q", "ping", payload)
+	}
+}
+
+func TestReaderWithoutHeader(t *testing.T) {
+	r := NewReader(strings.NewReader("GET / HTTP/1.1\r\n"))
+
+	// The payload is readable without asking for the header first.
+	payload, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(payload) != "GET / HTTP/1.1\r\n" {
+		t.Fatalf("unexpected payload: %q", payload)
+	}
+	if header, err := r.Header(); header != nil || err != nil {
+		t.Fatalf("expected no header, got %v, %v", header, err)
+	}
+}
+
+func TestReaderInvalidHeader(t *testing.T) {
+	r := NewReader(bytes.NewReader([]byte("PROXY TCP4 10.1.1.1\r\nping")))
+
+	if _, err := r.Header(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if _, err := r.Read(make([]byte, 4)); err == nil {
+		t.Fatal("expected the header error to be returned by Read")
+	}
+}
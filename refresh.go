@@ -0,0 +1,63 @@
+package proxyproto
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Refresher calls a refresh function on an interval until closed, e.g. to
+// rediscover the trusted proxies of a policy, see DNSWhiteList. It is safe
+// for concurrent use.
+type Refresher struct {
+	refresh  func(ctx context.Context) error
+	onError  atomic.Pointer[func(err error)]
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewRefresher returns a Refresher calling refresh every interval. Each
+// call is given up after an interval, so that a stalled backend doesn't
+// hold the next ones up. An interval <= 0 disables refreshing.
+func NewRefresher(interval time.Duration, refresh func(ctx context.Context) error) *Refresher {
+	r := &Refresher{
+		refresh: refresh,
+		done:    make(chan struct{}),
+	}
+	if interval > 0 {
+		go r.loop(interval)
+	}
+	return r
+}
+
+// OnError sets the hook called with the errors of the refreshes, e.g. to
+// log them.
+func (r *Refresher) OnError(f func(err error)) {
+	r.onError.Store(&f)
+}
+
+// Close stops refreshing.
+func (r *Refresher) Close() error {
+	r.stopOnce.Do(func() { close(r.done) })
+	return nil
+}
+
+func (r *Refresher) loop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			err := r.refresh(ctx)
+			cancel()
+			if f := r.onError.Load(); err != nil && f != nil {
+				(*f)(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package proxyproto
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRefresher(t *testing.T) {
+	refreshes := make(chan struct{}, 1)
+	r := NewRefresher(10*time.Millisecond, func(ctx context.Context) error {
+		select {
+		case refreshes <- struct{}{}:
+		default:
+		}
+		// Stall, as a backend not answering.
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	defer r.Close()
+
+	errs := make(chan error, 1)
+	r.OnError(func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+
+	select {
+	case <-refreshes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a refresh")
+	}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the stalled refresh to be given up")
+	}
+}
+
+func TestRefresherDisabled(t *testing.T) {
+	r := NewRefresher(0, func(ctx context.Context) error {
+		t.Error("unexpected refresh")
+		return nil
+	})
+	time.Sleep(20 * time.Millisecond)
+	if err := r.Close(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package proxyproto
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	// rejectWriteTimeout bounds the time spent writing a rejection response.
+	rejectWriteTimeout = time.Second
+	// rejectLinger is how long the input of a rejected connection is
+	// drained after its write side is closed, so that closing it with
+	// unread data doesn't reset it before the response is read, as
+	// net/http does.
+	rejectLinger = 500 * time.Millisecond
+)
+
+// RejectResponse makes the connection write response before closing itself
+// when its header is malformed or disallowed, e.g. missing with the REQUIRE
+// policy, when passed as option to NewConn(). Clients and intermediaries then
+// get a diagnosable failure rather than a silent reset. As with
+// CloseOnHeaderError, which it implies, reads return io.EOF and the error is
+// available through Conn.HeaderError. See HTTPRejectResponse and
+// SMTPRejectResponse.
+func RejectResponse(response []byte) func(*Conn) {
+	return func(c *Conn) {
+		c.rejectResponse = response
+	}
+}
+
+// HTTPRejectResponse returns a minimal "400 Bad Request" HTTP/1.1 response
+// with the given plain text body, to be used with RejectResponse on
+// listeners serving HTTP.
+func HTTPRejectResponse(body string) []byte {
+	return []byte("HTTP/1.1 400 Bad Request\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\r\n" +
+		"Connection: close\r\n" +
+		"\r\n" +
+		body)
+}
+
+// SMTPRejectResponse returns a "421" SMTP reply with the given text, to be
+// used with RejectResponse on listeners serving mail, so that misconfigured
+// upstream MTAs log a meaningful error. If text is empty, "Service not
+// available, closing transmission channel" is used. As SMTP servers speak
+// first, they should call Conn.HeaderError before sending their banner.
+func SMTPRejectResponse(text string) []byte {
+	if text == "" {
+		text = "Service not available, closing transmission channel"
+	}
+	return []byte("421 " + text + "\r\n")
+}
+
+// reject writes the rejection response of the connection, then closes it.
+func (p *Conn) reject() {
+	if err := p.conn.SetWriteDeadline(time.Now().Add(rejectWriteTimeout)); err == nil {
+		if _, err := p.conn.Write(p.rejectResponse); err == nil {
+			if cw, ok := p.conn.(interface{ CloseWrite() error }); ok && cw.CloseWrite() == nil {
+				linger(p.conn)
+			}
+		}
+	}
+	p.Close()
+}
+
+// linger drains the input of conn until the peer closes it, or for
+// rejectLinger at most.
+func linger(conn net.Conn) {
+	if err := conn.SetReadDeadline(time.Now().Add(rejectLinger)); err != nil {
+		return
+	}
+	_, _ = io.Copy(io.Discard, conn)
+}
@@ -0,0 +1,110 @@
+package proxyproto
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHTTPRejectResponse(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pl := &Listener{
+		Listener:       l,
+		ConnPolicy:     func(ConnPolicyOptions) (Policy, error) { return REQUIRE, nil },
+		RejectResponse: HTTPRejectResponse("missing PROXY header\n"),
+	}
+	defer pl.Close()
+
+	served := make(chan error, 1)
+	go func() {
+		conn, err := pl.Accept()
+		if err != nil {
+			served <- err
+			return
+		}
+		defer conn.Close()
+		if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+			served <- err
+			return
+		}
+		served <- conn.(*Conn).HeaderError()
+	}()
+
+	conn, err := net.Dial("tcp", pl.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(body) != "missing PROXY header\n" {
+		t.Fatalf("unexpected body %q", body)
+	}
+
+	if err := <-served; !errors.Is(err, ErrNoProxyProtocol) {
+		t.Fatalf("expected %v, got %v", ErrNoProxyProtocol, err)
+	}
+}
+
+func TestSMTPRejectResponse(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pl := &Listener{
+		Listener:          l,
+		ConnPolicy:        func(ConnPolicyOptions) (Policy, error) { return REQUIRE, nil },
+		ReadHeaderTimeout: 50 * time.Millisecond,
+		RejectResponse:    SMTPRejectResponse(""),
+	}
+	defer pl.Close()
+
+	go func() {
+		conn, err := pl.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Check the header before sending the banner.
+		if conn.(*Conn).HeaderError() != nil {
+			return
+		}
+		_, _ = conn.Write([]byte("220 mx.example.com ESMTP\r\n"))
+	}()
+
+	// An upstream MTA not sending the header waits for the banner.
+	conn, err := net.Dial("tcp", pl.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if line != "421 Service not available, closing transmission channel\r\n" {
+		t.Fatalf("unexpected reply %q", line)
+	}
+}
@@ -0,0 +1,101 @@
+package proxyproto
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrDuplicateUniqueID is returned when the PP2_TYPE_UNIQUE_ID TLV of a
+// header was already seen within the window of a rejecting ReplayCache.
+var ErrDuplicateUniqueID = errors.New("proxyproto: duplicate unique ID")
+
+// ReplayCache remembers the PP2_TYPE_UNIQUE_ID TLVs of recent headers to
+// detect the upstreams replaying headers, or misbehaving and reusing IDs. It
+// holds a bounded number of IDs, the oldest being forgotten first. It is
+// safe for concurrent use, and can be shared by several listeners, see
+// Listener.ReplayCache.
+type ReplayCache struct {
+	// OnDuplicate, if set, is called for each duplicate ID, along with the
+	// address of the upstream which sent it.
+	OnDuplicate func(upstream net.Addr, id []byte)
+
+	window time.Duration
+	reject bool
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]time.Time
+	ring    []replayEntry
+	next    int
+}
+
+// replayEntry records when an ID was seen, in insertion order.
+type replayEntry struct {
+	id   string
+	seen time.Time
+}
+
+// NewReplayCache returns a ReplayCache remembering up to size IDs seen
+// within window. If reject is true, the headers carrying a duplicate ID are
+// rejected with ErrDuplicateUniqueID, otherwise duplicates are only reported
+// to OnDuplicate.
+func NewReplayCache(size int, window time.Duration, reject bool) *ReplayCache {
+	return &ReplayCache{
+		window:  window,
+		reject:  reject,
+		now:     time.Now,
+		entries: make(map[string]time.Time, size),
+		ring:    make([]replayEntry, max(size, 1)),
+	}
+}
+
+// Seen records the ID sent by the upstream, and reports whether it was
+// already seen within the window. Connections configured with the cache,
+// see WithReplayCache, record the IDs of their header themselves.
+func (c *ReplayCache) Seen(upstream net.Addr, id []byte) bool {
+	now := c.now()
+	key := string(id)
+
+	c.mu.Lock()
+	seen, ok := c.entries[key]
+	duplicate := ok && now.Sub(seen) <= c.window
+	if !duplicate {
+		// Forget the oldest ID to make room, unless it was seen again since.
+		if old := c.ring[c.next]; old.id != "" && c.entries[old.id].Equal(old.seen) {
+			delete(c.entries, old.id)
+		}
+		c.ring[c.next] = replayEntry{id: key, seen: now}
+		c.next = (c.next + 1) % len(c.ring)
+		c.entries[key] = now
+	}
+	c.mu.Unlock()
+
+	if duplicate && c.OnDuplicate != nil {
+		c.OnDuplicate(upstream, id)
+	}
+	return duplicate
+}
+
+// check records the unique ID of the header, if any, failing if it is a
+// duplicate and the cache rejects them.
+func (c *ReplayCache) check(upstream net.Addr, header *Header) error {
+	id, ok := findTLV(header.rawTLVs, PP2_TYPE_UNIQUE_ID)
+	if !ok || len(id) == 0 {
+		return nil
+	}
+	if c.Seen(upstream, id) && c.reject {
+		return ErrDuplicateUniqueID
+	}
+	return nil
+}
+
+// WithReplayCache makes the connection record the PP2_TYPE_UNIQUE_ID TLV of
+// its header in the replay cache when passed as option to NewConn(), so that
+// duplicates are reported, or rejected.
+func WithReplayCache(c *ReplayCache) func(*Conn) {
+	return func(conn *Conn) {
+		conn.replayCache = c
+	}
+}
@@ -0,0 +1,75 @@
+package proxyproto
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReplayCache(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := NewReplayCache(2, time.Minute, false)
+	c.now = func() time.Time { return now }
+
+	var duplicates []string
+	c.OnDuplicate = func(upstream net.Addr, id []byte) {
+		duplicates = append(duplicates, string(id))
+	}
+
+	if c.Seen(v4addr, []byte("a")) {
+		t.Fatal("expected a new ID")
+	}
+	if !c.Seen(v4addr, []byte("a")) {
+		t.Fatal("expected a duplicate ID")
+	}
+
+	// IDs are forgotten once the window is over.
+	now = now.Add(2 * time.Minute)
+	if c.Seen(v4addr, []byte("a")) {
+		t.Fatal("expected the ID to be forgotten after the window")
+	}
+
+	// The oldest IDs are forgotten once the cache is full.
+	c.Seen(v4addr, []byte("b"))
+	c.Seen(v4addr, []byte("c"))
+	if c.Seen(v4addr, []byte("a")) {
+		t.Fatal("expected the oldest ID to be evicted")
+	}
+	if len(c.entries) > 2 {
+		t.Fatalf("expected at most 2 entries, got %d", len(c.entries))
+	}
+
+	if len(duplicates) != 1 || duplicates[0] != "a" {
+		t.Fatalf("unexpected duplicates %q", duplicates)
+	}
+}
+
+func TestConnWithReplayCache(t *testing.T) {
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr:        v4addr,
+		DestinationAddr:   v4addr,
+	}
+	if err := header.SetTLVs([]TLV{{Type: PP2_TYPE_UNIQUE_ID, Value: []byte("id")}}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	c := NewReplayCache(16, time.Minute, true)
+	for _, expected := range []error{nil, ErrDuplicateUniqueID} {
+		server, client := net.Pipe()
+		go func() {
+			_, _ = WriteHeaderAndPayload(client, header, []byte("ping"))
+		}()
+
+		conn := NewConn(server, WithReplayCache(c))
+		recv := make([]byte, 4)
+		if _, err := io.ReadFull(conn, recv); err != expected {
+			t.Fatalf("expected error %v, got %v", expected, err)
+		}
+		conn.Close()
+		client.Close()
+	}
+}
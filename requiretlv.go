@@ -0,0 +1,52 @@
+package proxyproto
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrMissingTLV is returned when a header lacks a TLV required with
+// RequireTLVs.
+var ErrMissingTLV = errors.New("proxyproto: header lacks a required TLV")
+
+// RequireTLVs rejects the headers lacking a TLV of any of the given types
+// with ErrMissingTLV, when passed as option to NewConn(), e.g. to make sure
+// every upstream sends PP2_TYPE_UNIQUE_ID and PP2_TYPE_CRC32C. Version 1
+// headers, which can't carry TLVs, are rejected as well. Headers with the
+// LOCAL command aren't checked, as their content is to be ignored. The
+// types replace the ones of a previous RequireTLVs option.
+func RequireTLVs(types ...PP2Type) func(*Conn) {
+	return func(c *Conn) {
+		c.requiredTLVs = types
+	}
+}
+
+// checkRequiredTLVs makes sure the header carries a TLV of each type.
+func checkRequiredTLVs(header *Header, types []PP2Type) error {
+	if header.Command.IsLocal() {
+		return nil
+	}
+
+	for _, t := range types {
+		if _, ok := findTLV(header.rawTLVs, t); !ok {
+			return fmt.Errorf("%w: type %#x", ErrMissingTLV, byte(t))
+		}
+	}
+	return nil
+}
+
+// findTLV returns the value of the first TLV of the given type in the raw
+// TLV vector, and whether there is one.
+func findTLV(raw []byte, t PP2Type) ([]byte, bool) {
+	for i := 0; i < len(raw); {
+		end, ok := tlvEnd(raw, i)
+		if !ok {
+			return nil, false
+		}
+		if PP2Type(raw[i]) == t {
+			return raw[i+3 : end], true
+		}
+		i = end
+	}
+	return nil, false
+}
@@ -0,0 +1,82 @@
+package proxyproto
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestRequireTLVs(t *testing.T) {
+	withTLVs := func(version byte, command ProtocolVersionAndCommand, tlvs ...TLV) *Header {
+		header := &Header{
+			Version:           version,
+			Command:           command,
+			TransportProtocol: TCPv4,
+			SourceAddr:        v4addr,
+			DestinationAddr:   v4addr,
+		}
+		if err := header.SetTLVs(tlvs); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return header
+	}
+	uniqueID := TLV{Type: PP2_TYPE_UNIQUE_ID, Value: []byte("id")}
+	crc := TLV{Type: PP2_TYPE_CRC32C, Value: make([]byte, 4)}
+
+	var cases = []struct {
+		name   string
+		header *Header
+		err    error
+	}{
+		{"all present", withTLVs(2, PROXY, crc, uniqueID), nil},
+		{"one missing", withTLVs(2, PROXY, uniqueID), ErrMissingTLV},
+		{"none", withTLVs(2, PROXY), ErrMissingTLV},
+		{"version 1", withTLVs(1, PROXY), ErrMissingTLV},
+		{"local", withTLVs(2, LOCAL), nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+
+			go func() {
+				_, _ = WriteHeaderAndPayload(client, tc.header, []byte("ping"))
+			}()
+
+			conn := NewConn(server, RequireTLVs(PP2_TYPE_UNIQUE_ID, PP2_TYPE_CRC32C))
+			recv := make([]byte, 4)
+			if _, err := io.ReadFull(conn, recv); !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestRequireTLVsReplaces(t *testing.T) {
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr:        v4addr,
+		DestinationAddr:   v4addr,
+	}
+	if err := header.SetTLVs([]TLV{{Type: PP2_TYPE_UNIQUE_ID, Value: []byte("id")}}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	go func() {
+		_, _ = WriteHeaderAndPayload(client, header, []byte("ping"))
+	}()
+
+	// The types of a listener replace the ones of its config.
+	conn := NewConn(server, RequireTLVs(PP2_TYPE_NETNS), RequireTLVs(PP2_TYPE_UNIQUE_ID))
+	if _, err := io.ReadFull(conn, make([]byte, 4)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
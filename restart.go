@@ -0,0 +1,152 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+)
+
+var (
+	// ErrConnNotExportable is returned by Conn.Export and Conn.File when the
+	// underlying connection has no file descriptor to hand over.
+	ErrConnNotExportable = errors.New("proxyproto: connection can't be exported to a file")
+	// ErrMalformedConnState is returned when decoding a malformed ConnState.
+	ErrMalformedConnState = errors.New("proxyproto: malformed connection state")
+)
+
+// ConnState is the state of a connection besides its file descriptor, as
+// exported by Conn.Export to hand the connection over to another process,
+// e.g. during a zero-downtime binary upgrade.
+type ConnState struct {
+	// Header is the header received on the connection, nil if none.
+	Header *Header
+	// Buffered holds the bytes read off the socket while looking for the
+	// header, but not read by the application yet.
+	Buffered []byte
+}
+
+// Export reads the header of the connection if it hasn't been read yet, and
+// returns a duplicate of the file descriptor of the underlying connection
+// along with the state to rebuild the connection from in another process, see
+// ImportConn. It fails with ErrConnNotExportable if the underlying connection
+// isn't backed by a file descriptor, as *net.TCPConn and *net.UnixConn are,
+// e.g. a net.Pipe or a *tls.Conn. The connection must be neither read from
+// nor written to afterwards, and is to be closed once handed over. Closing
+// the returned file is the caller's responsibility.
+func (p *Conn) Export() (*os.File, *ConnState, error) {
+	p.once.Do(func() { p.readErr = p.readHeader() })
+	if p.readErr != nil {
+		return nil, nil, p.readErr
+	}
+	if err := p.skipDeferredTLVs(); err != nil {
+		return nil, nil, err
+	}
+
+	f, err := p.File()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var b []byte
+	if p.bufReader != nil {
+		b, _ = p.bufReader.Peek(p.bufReader.Buffered())
+	}
+	return f, &ConnState{
+		Header:   p.header,
+		Buffered: append([]byte(nil), b...),
+	}, nil
+}
+
+// TakeBuffered reads the header of the connection if it hasn't been read
+// yet, and returns the bytes read off the socket past the header but not
+// read by the application yet, detaching them from the connection: the
+// following reads go straight to the underlying connection. This lets
+// protocol routers hand the raw connection, see Raw and File, along with
+// the surplus bytes over to another subsystem or process without buffering
+// them twice. The returned slice is owned by the caller. It's nil if
+// nothing is buffered or if the header failed.
+func (p *Conn) TakeBuffered() []byte {
+	p.once.Do(func() { p.readErr = p.readHeader() })
+	if p.readErr != nil || p.skipDeferredTLVs() != nil {
+		return nil
+	}
+
+	b := p.drainBuffer()
+	if len(b) == 0 {
+		return nil
+	}
+	p.countRead(int64(len(b)))
+	return b[:len(b):len(b)]
+}
+
+// ImportConn rebuilds a connection exported by Conn.Export, e.g. in a new
+// process, from the file descriptor and the state it was exported with. The
+// connection behaves as if the header had been received on it, and the
+// buffered bytes are read before any other. The options are applied as
+// with NewConn, those tuning the reading of the header aside. Closing f is
+// the caller's responsibility, as with net.FileConn.
+func ImportConn(f *os.File, state *ConnState, opts ...func(*Conn)) (*Conn, error) {
+	conn, err := net.FileConn(f)
+	if err != nil {
+		return nil, err
+	}
+
+	p := NewConn(conn, opts...)
+	if len(state.Buffered) > 0 {
+		// Prime the buffer with the bytes buffered by the exporting
+		// process, without reading from the connection.
+		r := bufio.NewReaderSize(io.MultiReader(bytes.NewReader(state.Buffered), conn), max(len(state.Buffered), bufSize))
+		if _, err := r.Peek(len(state.Buffered)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		p.bufReader = r
+	}
+	p.SetHeader(state.Header)
+	return p, nil
+}
+
+// MarshalBinary encodes the state, e.g. to be sent to another process along
+// with the file descriptor of the connection.
+func (s *ConnState) MarshalBinary() ([]byte, error) {
+	var header []byte
+	if s.Header != nil {
+		var err error
+		if header, err = s.Header.Format(); err != nil {
+			return nil, err
+		}
+	}
+
+	buf := make([]byte, 0, 4+len(header)+len(s.Buffered))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(header)))
+	buf = append(buf, header...)
+	return append(buf, s.Buffered...), nil
+}
+
+// UnmarshalBinary decodes a state encoded by MarshalBinary.
+func (s *ConnState) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 {
+		return ErrMalformedConnState
+	}
+	n := binary.BigEndian.Uint32(data)
+	data = data[4:]
+	if uint64(n) > uint64(len(data)) {
+		return ErrMalformedConnState
+	}
+
+	var header *Header
+	if n > 0 {
+		var err error
+		header, err = read(bufio.NewReaderSize(bytes.NewReader(data[:n]), max(int(n), bufSize)), parseOptions{})
+		if err != nil {
+			return err
+		}
+	}
+	s.Header = header
+	s.Buffered = append([]byte(nil), data[n:]...)
+	return nil
+}
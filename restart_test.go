@@ -0,0 +1,194 @@
+package proxyproto
+
+import (
+	"io"
+	"net"
+	"testing"
+)
+
+func TestConnExportImport(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pl := &Listener{Listener: l}
+	defer pl.Close()
+
+	header := HeaderProxyFromAddrs(2,
+		&net.TCPAddr{IP: net.ParseIP("10.1.1.1"), Port: 1000},
+		&net.TCPAddr{IP: net.ParseIP("20.2.2.2"), Port: 2000})
+	raw, err := header.Format()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	cliResult := make(chan error)
+	go func() {
+		conn, err := net.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			cliResult <- err
+			return
+		}
+		defer conn.Close()
+
+		if _, err := conn.Write(append(raw, "ping pong"...)); err != nil {
+			cliResult <- err
+			return
+		}
+		recv := make([]byte, 4)
+		if _, err := io.ReadFull(conn, recv); err != nil {
+			cliResult <- err
+			return
+		}
+		close(cliResult)
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	recv := make([]byte, 4)
+	if _, err := io.ReadFull(conn, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	f, state, err := conn.(*Conn).Export()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer f.Close()
+	conn.Close()
+
+	// The state goes through its encoding, as when sent to another process.
+	data, err := state.MarshalBinary()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var decoded ConnState
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(decoded.Buffered) != " pong" {
+		t.Fatalf("expected buffered bytes %q, got %q", " pong", decoded.Buffered)
+	}
+
+	imported, err := ImportConn(f, &decoded)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer imported.Close()
+
+	if addr := imported.RemoteAddr().String(); addr != "10.1.1.1:1000" {
+		t.Fatalf("expected the header's source address, got %s", addr)
+	}
+	recv = make([]byte, 5)
+	if _, err := io.ReadFull(imported, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(recv) != " pong" {
+		t.Fatalf("expected %q, got %q", " pong", recv)
+	}
+	if _, err := imported.Write([]byte("done")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := <-cliResult; err != nil {
+		t.Fatalf("client error: %v", err)
+	}
+}
+
+func TestConnExportNotExportable(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	conn := NewConn(server)
+	conn.SetHeader(nil)
+	if _, _, err := conn.Export(); err != ErrConnNotExportable {
+		t.Fatalf("expected %v, got %v", ErrConnNotExportable, err)
+	}
+}
+
+func TestConnStateUnmarshalMalformed(t *testing.T) {
+	var s ConnState
+	for _, data := range [][]byte{nil, {0, 0, 0, 9, 'x'}} {
+		if err := s.UnmarshalBinary(data); err != ErrMalformedConnState {
+			t.Fatalf("expected %v, got %v", ErrMalformedConnState, err)
+		}
+	}
+}
+
+func TestConnFile(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer l.Close()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+
+	conn := NewConn(client)
+	f, err := conn.File()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	f.Close()
+
+	server, pipeClient := net.Pipe()
+	defer server.Close()
+	defer pipeClient.Close()
+	if _, err := NewConn(server).File(); err != ErrConnNotExportable {
+		t.Fatalf("expected %v, got %v", ErrConnNotExportable, err)
+	}
+}
+
+func TestConnTakeBuffered(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go func() {
+		_, _ = client.Write([]byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\nsurplus"))
+		_, _ = client.Write([]byte("more"))
+	}()
+
+	conn := NewConn(server, WithStats())
+	if b := conn.TakeBuffered(); string(b) != "surplus" {
+		t.Fatalf("expected the surplus bytes, got %q", b)
+	}
+	if conn.RemoteAddr().String() != "10.1.1.1:1000" {
+		t.Fatalf("unexpected remote address %v", conn.RemoteAddr())
+	}
+	if b := conn.TakeBuffered(); b != nil {
+		t.Fatalf("expected the bytes to be detached, got %q", b)
+	}
+
+	recv := make([]byte, 4)
+	if _, err := io.ReadFull(conn, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(recv) != "more" {
+		t.Fatalf("unexpected payload %q", recv)
+	}
+	if stats := conn.Stats(); stats.BytesRead != uint64(len("surplus")+len("more")) {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestConnTakeBufferedHeaderError(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go func() {
+		_, _ = client.Write([]byte("PROXY garbage\r\nsurplus"))
+	}()
+
+	conn := NewConn(server, WithPolicy(REQUIRE))
+	if b := conn.TakeBuffered(); b != nil {
+		t.Fatalf("expected no bytes, got %q", b)
+	}
+}
@@ -0,0 +1,84 @@
+package proxyproto
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	// defaultRetryBackoff is the delay before the first retry, if
+	// DialRetry.Backoff is not set.
+	defaultRetryBackoff = 50 * time.Millisecond
+	// defaultRetryMaxBackoff caps the delay between retries, if
+	// DialRetry.MaxBackoff is not set.
+	defaultRetryMaxBackoff = time.Second
+)
+
+// DialRetry tells how a Dialer retries the dials whose connection drops
+// while the header is being written, e.g. because an aggressive idle reaper
+// upstream closed it, rather than failing at once. Each attempt dials a new
+// connection. Failures to establish the connection aren't retried, nor are
+// the headers written along with the first bytes, see
+// Dialer.DialTLSContext.
+type DialRetry struct {
+	// Attempts is the maximum number of attempts, the first one included.
+	// Values below 2 disable retries.
+	Attempts int
+	// Backoff is the delay before the first retry, doubled for each of the
+	// following ones. If zero, 50ms is used.
+	Backoff time.Duration
+	// MaxBackoff caps the delay between retries. If zero, 1s is used.
+	MaxBackoff time.Duration
+	// OnRetry, if set, is called before each retry with the number of the
+	// attempt which failed, starting at 1, and its error.
+	OnRetry func(attempt int, err error)
+}
+
+// headerWriteError is the error of a dial whose header couldn't be written.
+type headerWriteError struct {
+	err error
+}
+
+func (e *headerWriteError) Error() string {
+	return e.err.Error()
+}
+
+func (e *headerWriteError) Unwrap() error {
+	return e.err
+}
+
+// retry calls dial until it succeeds, fails otherwise than writing the
+// header, or the attempts are exhausted. Errors are returned unwrapped.
+func (r *DialRetry) retry(ctx context.Context, dial func() (*ClientConn, error)) (*ClientConn, error) {
+	backoff, maxBackoff := defaultRetryBackoff, defaultRetryMaxBackoff
+	if r != nil && r.Backoff > 0 {
+		backoff = r.Backoff
+	}
+	if r != nil && r.MaxBackoff > 0 {
+		maxBackoff = r.MaxBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		conn, err := dial()
+		var writeErr *headerWriteError
+		if !errors.As(err, &writeErr) {
+			return conn, err
+		}
+		if r == nil || attempt >= r.Attempts {
+			return nil, writeErr.err
+		}
+		if r.OnRetry != nil {
+			r.OnRetry(attempt, writeErr.err)
+		}
+
+		timer := time.NewTimer(min(backoff, maxBackoff))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, writeErr.err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,118 @@
+package proxyproto
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errDropped = errors.New("connection dropped")
+
+// droppingDialer dials connections whose first write fails, for the first
+// drops connections dialed.
+type droppingDialer struct {
+	drops int32
+	dials atomic.Int32
+}
+
+func (d *droppingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	if d.dials.Add(1) <= d.drops {
+		return &droppedConn{Conn: conn}, nil
+	}
+	return conn, nil
+}
+
+type droppedConn struct {
+	net.Conn
+}
+
+func (c *droppedConn) Write(b []byte) (int, error) {
+	return 0, errDropped
+}
+
+func TestDialerRetry(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	dialer := &droppingDialer{drops: 2}
+	var retries []int
+	d := &Dialer{
+		Dialer: dialer,
+		Retry: &DialRetry{
+			Attempts: 3,
+			Backoff:  time.Millisecond,
+			OnRetry: func(attempt int, err error) {
+				if !errors.Is(err, errDropped) {
+					t.Errorf("expected %v, got %v", errDropped, err)
+				}
+				retries = append(retries, attempt)
+			},
+		},
+	}
+	conn, err := d.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	conn.Close()
+	if len(retries) != 2 || retries[0] != 1 || retries[1] != 2 {
+		t.Fatalf("expected retries after attempts 1 and 2, got %v", retries)
+	}
+
+	// Attempts exhausted.
+	dialer = &droppingDialer{drops: 3}
+	d.Dialer = dialer
+	if _, err := d.Dial("tcp", l.Addr().String()); !errors.Is(err, errDropped) {
+		t.Fatalf("expected %v, got %v", errDropped, err)
+	}
+	if dials := dialer.dials.Load(); dials != 3 {
+		t.Fatalf("expected 3 dials, got %d", dials)
+	}
+
+	// Without retries.
+	dialer = &droppingDialer{drops: 1}
+	d = &Dialer{Dialer: dialer}
+	if _, err := d.Dial("tcp", l.Addr().String()); !errors.Is(err, errDropped) {
+		t.Fatalf("expected %v, got %v", errDropped, err)
+	}
+	if dials := dialer.dials.Load(); dials != 1 {
+		t.Fatalf("expected 1 dial, got %d", dials)
+	}
+}
+
+func TestDialerRetryNotOnDialError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	d := &Dialer{Retry: &DialRetry{
+		Attempts: 3,
+		OnRetry: func(int, error) {
+			t.Error("expected no retry")
+		},
+	}}
+	if _, err := d.Dial("tcp", address); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,52 @@
+package proxyproto
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// ErrReusePortUnsupported is returned by ListenReusePort on platforms
+// lacking SO_REUSEPORT.
+var ErrReusePortUnsupported = errors.New("proxyproto: SO_REUSEPORT not supported on this platform")
+
+// ListenReusePort creates n listeners on the same address with SO_REUSEPORT
+// set, so that the kernel balances incoming connections among them, e.g.
+// one accept loop per core. Each is wrapped into a Listener sharing the
+// policy, which may be nil, and the configuration, including its metrics
+// callbacks. The address should have an explicit port: with port 0, the
+// first listener picks one and the others bind to it. If any listener can't
+// be created, those already created are closed.
+func ListenReusePort(ctx context.Context, network, address string, n int, policy ConnPolicyFunc, config *Config) ([]*Listener, error) {
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var err error
+			if cerr := c.Control(func(fd uintptr) {
+				err = setReusePort(fd)
+			}); cerr != nil {
+				return cerr
+			}
+			return err
+		},
+	}
+
+	listeners := make([]*Listener, 0, n)
+	for i := 0; i < n; i++ {
+		l, err := lc.Listen(ctx, network, address)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		if i == 0 {
+			// Bind the others to the port picked by the first one.
+			address = l.Addr().String()
+		}
+		pl := NewListener(l)
+		pl.ConnPolicy, pl.Config = policy, config
+		listeners = append(listeners, pl)
+	}
+	return listeners, nil
+}
@@ -0,0 +1,14 @@
+//go:build linux && (386 || amd64 || arm)
+
+package proxyproto
+
+import "syscall"
+
+// soReusePort is SO_REUSEPORT, which package syscall lacks on these
+// architectures.
+const soReusePort = 0xf
+
+// setReusePort sets SO_REUSEPORT on the socket.
+func setReusePort(fd uintptr) error {
+	return syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+}
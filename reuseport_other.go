@@ -0,0 +1,7 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd && !linux
+
+package proxyproto
+
+func setReusePort(fd uintptr) error {
+	return ErrReusePortUnsupported
+}
@@ -0,0 +1,62 @@
+package proxyproto
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestListenReusePort(t *testing.T) {
+	config := &Config{RetainRawHeader: true}
+	listeners, err := ListenReusePort(context.Background(), "tcp", "127.0.0.1:0", 4, nil, config)
+	if errors.Is(err, ErrReusePortUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+
+	if len(listeners) != 4 {
+		t.Fatalf("expected 4 listeners, got %d", len(listeners))
+	}
+	addr := listeners[0].Addr().String()
+	for _, l := range listeners {
+		if l.Addr().String() != addr {
+			t.Fatalf("expected all listeners on %s, got %s", addr, l.Addr())
+		}
+		if l.Config != config {
+			t.Fatal("expected the configuration to be shared")
+		}
+	}
+
+	accepted := make(chan *Conn, len(listeners))
+	for _, l := range listeners {
+		go func(l *Listener) {
+			conn, err := l.Accept()
+			if err == nil {
+				accepted <- conn.(*Conn)
+			}
+		}(l)
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+	if _, err := HeaderProxyFromAddrs(1, v4addr, v4addr).WriteTo(conn); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pconn := <-accepted
+	defer pconn.Close()
+	if header := pconn.ProxyHeader(); header == nil || header.Raw() == nil {
+		t.Fatalf("expected a header parsed with the shared configuration, got %v", header)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build aix || darwin || dragonfly || freebsd || netbsd || openbsd || (linux && !386 && !amd64 && !arm)
+
+package proxyproto
+
+import "syscall"
+
+// setReusePort sets SO_REUSEPORT on the socket.
+func setReusePort(fd uintptr) error {
+	return syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEPORT, 1)
+}
@@ -0,0 +1,277 @@
+package proxyproto
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// PP2_TYPE_SIGNATURE is the application specific TLV type carrying the
+// signature of a version 2 header, see SignHeaderWith. Its value holds the
+// length of the ID of the signing key on one byte, the key ID, and the
+// signature.
+const PP2_TYPE_SIGNATURE PP2Type = 0xEC
+
+var (
+	ErrHeaderSignatureVersion = errors.New("proxyproto: only version 2 headers can carry a signature")
+	ErrMissingHeaderSignature = errors.New("proxyproto: header lacks a signature")
+	ErrInvalidHeaderSignature = errors.New("proxyproto: header signature mismatch")
+	// ErrUnknownSigningKey is returned when verifying a signature made with
+	// a key the verifier doesn't know of.
+	ErrUnknownSigningKey = errors.New("proxyproto: unknown signing key")
+	// ErrConflictingSigners is returned by a Dialer set to sign its headers
+	// both with an HMAC key and a Signer, as a header carries one signature.
+	ErrConflictingSigners = errors.New("proxyproto: headers can't be signed with both an HMAC key and a signer")
+)
+
+// Signer signs headers, see SignHeaderWith. Implementations may keep their
+// key in an external KMS or HSM.
+type Signer interface {
+	// KeyID identifies the signing key, so that receivers pick the key to
+	// verify the signature with, e.g. during key rotations. It must be at
+	// most 255 bytes long.
+	KeyID() string
+	// Sign returns the signature of the message.
+	Sign(message []byte) ([]byte, error)
+}
+
+// Verifier verifies the signatures of headers made with a single key, see
+// Keyring.
+type Verifier interface {
+	// KeyID identifies the key verifying signatures, see Signer.KeyID.
+	KeyID() string
+	// Verify checks the signature of the message, and returns
+	// ErrInvalidHeaderSignature if it doesn't match.
+	Verify(message, signature []byte) error
+}
+
+// HMACKey is a key shared by senders and receivers, signing and verifying
+// headers with HMAC-SHA256. It implements both Signer and Verifier.
+type HMACKey struct {
+	ID  string
+	Key []byte
+}
+
+// KeyID implements Signer and Verifier.
+func (k HMACKey) KeyID() string {
+	return k.ID
+}
+
+// Sign implements Signer.
+func (k HMACKey) Sign(message []byte) ([]byte, error) {
+	return headerHMAC(message, k.Key), nil
+}
+
+// Verify implements Verifier.
+func (k HMACKey) Verify(message, signature []byte) error {
+	if !hmac.Equal(signature, headerHMAC(message, k.Key)) {
+		return ErrInvalidHeaderSignature
+	}
+	return nil
+}
+
+// Ed25519Signer signs headers with an Ed25519 private key, so that
+// receivers only need the public key, see Ed25519Verifier.
+type Ed25519Signer struct {
+	ID  string
+	Key ed25519.PrivateKey
+}
+
+// KeyID implements Signer.
+func (s Ed25519Signer) KeyID() string {
+	return s.ID
+}
+
+// Sign implements Signer.
+func (s Ed25519Signer) Sign(message []byte) ([]byte, error) {
+	return ed25519.Sign(s.Key, message), nil
+}
+
+// Ed25519Verifier verifies the headers signed by an Ed25519Signer.
+type Ed25519Verifier struct {
+	ID  string
+	Key ed25519.PublicKey
+}
+
+// KeyID implements Verifier.
+func (v Ed25519Verifier) KeyID() string {
+	return v.ID
+}
+
+// Verify implements Verifier.
+func (v Ed25519Verifier) Verify(message, signature []byte) error {
+	if !ed25519.Verify(v.Key, message, signature) {
+		return ErrInvalidHeaderSignature
+	}
+	return nil
+}
+
+// Keyring holds the verifiers of the keys trusted to sign headers, by key
+// ID. Keys can be added and removed while it's in use, so that they can be
+// rotated without downtime: the new key is added to the receivers first,
+// then the senders switch to it, and the old key is removed last. It is safe
+// for concurrent use.
+type Keyring struct {
+	mu        sync.RWMutex
+	verifiers map[string]Verifier
+}
+
+// NewKeyring returns a keyring trusting the verifiers.
+func NewKeyring(verifiers ...Verifier) *Keyring {
+	k := &Keyring{verifiers: make(map[string]Verifier, len(verifiers))}
+	for _, v := range verifiers {
+		k.verifiers[v.KeyID()] = v
+	}
+	return k
+}
+
+// Add trusts the verifier, replacing the one with the same key ID, if any.
+func (k *Keyring) Add(v Verifier) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.verifiers[v.KeyID()] = v
+}
+
+// Remove stops trusting the key with the ID.
+func (k *Keyring) Remove(keyID string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.verifiers, keyID)
+}
+
+// verify checks the signature of the message made with the key with the ID.
+func (k *Keyring) verify(keyID string, message, signature []byte) error {
+	k.mu.RLock()
+	v, ok := k.verifiers[keyID]
+	k.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownSigningKey, keyID)
+	}
+	return v.Verify(message, signature)
+}
+
+// SignHeaderWith returns a copy of the version 2 header with a
+// PP2_TYPE_SIGNATURE TLV appended, authenticating the header with the
+// signer. The signature covers the whole formatted header as it would be
+// without the signature TLV. Any signature TLV the header already carries
+// is replaced. The TLV names the signing key, so that receivers can trust
+// several keys, see Keyring.
+func SignHeaderWith(header *Header, signer Signer) (*Header, error) {
+	if header.Version != 2 {
+		return nil, ErrHeaderSignatureVersion
+	}
+	keyID := signer.KeyID()
+	if len(keyID) > 255 {
+		return nil, fmt.Errorf("proxyproto: key ID of %d bytes exceeds 255 bytes", len(keyID))
+	}
+
+	h := *header
+	h.raw, h.size = nil, 0
+	h.rawTLVs = make([]byte, 0, len(header.rawTLVs))
+	for i := 0; i < len(header.rawTLVs); {
+		end, ok := tlvEnd(header.rawTLVs, i)
+		if !ok {
+			return nil, ErrTruncatedTLV
+		}
+		if PP2Type(header.rawTLVs[i]) != PP2_TYPE_SIGNATURE {
+			h.rawTLVs = append(h.rawTLVs, header.rawTLVs[i:end]...)
+		}
+		i = end
+	}
+
+	message, err := h.Format()
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signer.Sign(message)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(signature) > 0xFFFF-1-len(keyID) {
+		return nil, fmt.Errorf("proxyproto: signature of %d bytes is too long", len(signature))
+	}
+	h.rawTLVs = append(h.rawTLVs, byte(PP2_TYPE_SIGNATURE))
+	h.rawTLVs = binary.BigEndian.AppendUint16(h.rawTLVs, uint16(1+len(keyID)+len(signature)))
+	h.rawTLVs = append(h.rawTLVs, byte(len(keyID)))
+	h.rawTLVs = append(h.rawTLVs, keyID...)
+	h.rawTLVs = append(h.rawTLVs, signature...)
+	return &h, nil
+}
+
+// VerifyHeaderSignature checks the PP2_TYPE_SIGNATURE TLV of the header with
+// the verifier of the keyring matching its key ID, see SignHeaderWith. The
+// exact bytes received are checked when they were retained, e.g. with the
+// RetainRawHeader option, otherwise the header is formatted anew. It fails
+// with ErrUnknownSigningKey if the key isn't in the keyring.
+func VerifyHeaderSignature(header *Header, keyring *Keyring) error {
+	return verifyHeaderSignature(header, keyring.verify)
+}
+
+// verifyHeaderSignature locates the PP2_TYPE_SIGNATURE TLV of the header and
+// checks it with verify.
+func verifyHeaderSignature(header *Header, verify func(keyID string, message, signature []byte) error) error {
+	if header.Version != 2 {
+		return ErrMissingHeaderSignature
+	}
+
+	raw := header.raw
+	if raw == nil {
+		var err error
+		if raw, err = header.Format(); err != nil {
+			return err
+		}
+	}
+
+	// Locate the TLVs past the address block, whose size only depends on
+	// the address family.
+	if len(raw) < 16 {
+		return ErrMissingHeaderSignature
+	}
+	addrLen, ok := AddressFamilyAndProtocol(raw[13]).addrLen()
+	if !ok {
+		return ErrMissingHeaderSignature
+	}
+
+	for i := 16 + int(addrLen); i < len(raw); {
+		end, ok := tlvEnd(raw, i)
+		if !ok {
+			return ErrMissingHeaderSignature
+		}
+		if PP2Type(raw[i]) != PP2_TYPE_SIGNATURE {
+			i = end
+			continue
+		}
+
+		value := raw[i+3 : end]
+		if len(value) == 0 || len(value) < 1+int(value[0]) {
+			return ErrInvalidHeaderSignature
+		}
+		keyID, signature := string(value[1:1+value[0]]), value[1+value[0]:]
+
+		// The message is the header without the signature TLV.
+		message := make([]byte, 0, len(raw)-(end-i))
+		message = append(append(message, raw[:i]...), raw[end:]...)
+		binary.BigEndian.PutUint16(message[14:16], uint16(len(message)-16))
+		return verify(keyID, message, signature)
+	}
+	return ErrMissingHeaderSignature
+}
+
+// WithHeaderVerifier makes the connection verify the PP2_TYPE_SIGNATURE TLV
+// of the received header with the keys of the keyring before trusting its
+// addresses, when passed as option to NewConn(). Headers lacking a valid
+// signature fail the connection with ErrMissingHeaderSignature,
+// ErrInvalidHeaderSignature or ErrUnknownSigningKey. It generalizes
+// WithHeaderHMAC to several keys of any scheme, e.g. HMACKey or
+// Ed25519Verifier.
+// The raw header bytes are retained for the verification, see Header.Raw.
+func WithHeaderVerifier(keyring *Keyring) func(*Conn) {
+	return func(c *Conn) {
+		c.keyring = keyring
+		c.parseOptions.retainRaw = true
+	}
+}
@@ -0,0 +1,246 @@
+package proxyproto
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestSignHeaderWith(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	hmacKey := HMACKey{ID: "hmac-1", Key: []byte("shared secret")}
+
+	var cases = []struct {
+		name     string
+		signer   Signer
+		verifier Verifier
+	}{
+		{"hmac", hmacKey, hmacKey},
+		{"ed25519", Ed25519Signer{ID: "ed-1", Key: priv}, Ed25519Verifier{ID: "ed-1", Key: pub}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			header := &Header{
+				Version:           2,
+				Command:           PROXY,
+				TransportProtocol: TCPv4,
+				SourceAddr:        v4addr,
+				DestinationAddr:   v4addr,
+			}
+			if err := header.SetTLVs([]TLV{{Type: PP2_TYPE_UNIQUE_ID, Value: []byte("id")}}); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			keyring := NewKeyring(tc.verifier)
+
+			signed, err := SignHeaderWith(header, tc.signer)
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if err := VerifyHeaderSignature(signed, keyring); err != nil {
+				t.Fatalf("expected a valid signature, got %v", err)
+			}
+			if err := VerifyHeaderSignature(header, keyring); err != ErrMissingHeaderSignature {
+				t.Fatalf("expected %v, got %v", ErrMissingHeaderSignature, err)
+			}
+
+			// Signing again replaces the signature rather than adding one.
+			resigned, err := SignHeaderWith(signed, tc.signer)
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			tlvs, err := resigned.TLVs()
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if len(tlvs) != 2 || tlvs[1].Type != PP2_TYPE_SIGNATURE {
+				t.Fatalf("expected the signature to be replaced, got %v", tlvs)
+			}
+
+			// Tampering with the addresses of the received header is detected.
+			raw, err := signed.Format()
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			raw[16] ^= 1
+			tampered, err := read(newBufioReader(raw), parseOptions{retainRaw: true})
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if err := VerifyHeaderSignature(tampered, keyring); err != ErrInvalidHeaderSignature {
+				t.Fatalf("expected %v, got %v", ErrInvalidHeaderSignature, err)
+			}
+
+			if err := VerifyHeaderSignature(signed, NewKeyring()); !errors.Is(err, ErrUnknownSigningKey) {
+				t.Fatalf("expected %v, got %v", ErrUnknownSigningKey, err)
+			}
+		})
+	}
+
+	if _, err := SignHeaderWith(&Header{Version: 1, Command: PROXY, TransportProtocol: TCPv4, SourceAddr: v4addr, DestinationAddr: v4addr}, hmacKey); err != ErrHeaderSignatureVersion {
+		t.Fatalf("expected %v, got %v", ErrHeaderSignatureVersion, err)
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr:        v4addr,
+		DestinationAddr:   v4addr,
+	}
+	oldKey := HMACKey{ID: "old", Key: []byte("old secret")}
+	newKey := HMACKey{ID: "new", Key: []byte("new secret")}
+	signedOld, err := SignHeaderWith(header, oldKey)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	signedNew, err := SignHeaderWith(header, newKey)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	keyring := NewKeyring(oldKey)
+	if err := VerifyHeaderSignature(signedNew, keyring); !errors.Is(err, ErrUnknownSigningKey) {
+		t.Fatalf("expected %v, got %v", ErrUnknownSigningKey, err)
+	}
+
+	// Both keys are trusted while the senders switch over.
+	keyring.Add(newKey)
+	for _, signed := range []*Header{signedOld, signedNew} {
+		if err := VerifyHeaderSignature(signed, keyring); err != nil {
+			t.Fatalf("expected a valid signature, got %v", err)
+		}
+	}
+
+	keyring.Remove("old")
+	if err := VerifyHeaderSignature(signedOld, keyring); !errors.Is(err, ErrUnknownSigningKey) {
+		t.Fatalf("expected %v, got %v", ErrUnknownSigningKey, err)
+	}
+	if err := VerifyHeaderSignature(signedNew, keyring); err != nil {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+}
+
+func TestConnWithHeaderVerifier(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr:        v4addr,
+		DestinationAddr:   v4addr,
+	}
+	signed, err := SignHeaderWith(header, Ed25519Signer{ID: "ed-1", Key: priv})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	keyring := NewKeyring(Ed25519Verifier{ID: "ed-1", Key: pub})
+
+	var cases = []struct {
+		name   string
+		header *Header
+		err    error
+	}{
+		{"signed", signed, nil},
+		{"unsigned", header, ErrMissingHeaderSignature},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+
+			go func() {
+				_, _ = WriteHeaderAndPayload(client, tc.header, []byte("ping"))
+			}()
+
+			conn := NewConn(server, WithHeaderVerifier(keyring))
+			recv := make([]byte, 4)
+			_, err := io.ReadFull(conn, recv)
+			if err != tc.err {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if err == nil && conn.RemoteAddr().String() != v4addr.String() {
+				t.Fatalf("expected remote address %v, got %v", v4addr, conn.RemoteAddr())
+			}
+		})
+	}
+}
+
+func TestConfigHeaderSigner(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	key := HMACKey{ID: "hmac-1", Key: []byte("shared secret")}
+	config := &Config{HeaderSigner: key, HeaderKeyring: NewKeyring(key)}
+	pl := &Listener{Listener: l, Config: config}
+	defer pl.Close()
+
+	cliResult := make(chan error)
+	go func() {
+		d := &Dialer{Config: config}
+		conn, err := d.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			cliResult <- err
+			return
+		}
+		defer conn.Close()
+
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			cliResult <- err
+			return
+		}
+		close(cliResult)
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	recv := make([]byte, 4)
+	if _, err := io.ReadFull(conn, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := <-cliResult; err != nil {
+		t.Fatalf("client error: %v", err)
+	}
+
+	tlvs, err := conn.(*Conn).ProxyHeader().TLVs()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(tlvs) != 1 || tlvs[0].Type != PP2_TYPE_SIGNATURE {
+		t.Fatalf("expected a signature TLV, got %v", tlvs)
+	}
+}
+
+func TestDialerConflictingSigners(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer l.Close()
+
+	d := &Dialer{
+		HeaderHMACKey: []byte("shared secret"),
+		HeaderSigner:  HMACKey{ID: "hmac-1", Key: []byte("shared secret")},
+	}
+	if _, err := d.Dial("tcp", l.Addr().String()); err != ErrConflictingSigners {
+		t.Fatalf("expected %v, got %v", ErrConflictingSigners, err)
+	}
+}
@@ -0,0 +1,122 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+)
+
+// sppMagic starts the preamble of Cloudflare's Simple Proxy Protocol.
+const sppMagic = 0x56EC
+
+// sppHeaderLen is the size of a Simple Proxy Protocol preamble: the magic,
+// two IPv6 addresses and two ports.
+const sppHeaderLen = 2 + 16 + 16 + 2 + 2
+
+// ErrInvalidSPPHeader is returned when a datagram doesn't start with a valid
+// Simple Proxy Protocol preamble.
+var ErrInvalidSPPHeader = errors.New("proxyproto: invalid Simple Proxy Protocol header")
+
+// DatagramFormat is the format of the header prefixed to each datagram of a
+// proxied UDP flow.
+type DatagramFormat int
+
+const (
+	// DatagramV2 prefixes each datagram with a version 2 header.
+	DatagramV2 DatagramFormat = iota
+	// DatagramSPP prefixes each datagram with the 38 bytes preamble of the
+	// Simple Proxy Protocol of Cloudflare Spectrum, see
+	// https://developers.cloudflare.com/spectrum/reference/simple-proxy-protocol-header/.
+	// It announces the address of the client as source, and the address of
+	// the Spectrum proxy the client reached as destination.
+	DatagramSPP
+)
+
+// ParseDatagram parses the header prefixed to the datagram in the given
+// format, and returns it along with the payload following it, which shares
+// the memory of the datagram. Headers in the Simple Proxy Protocol format
+// are returned as version 2 UDP headers.
+func ParseDatagram(datagram []byte, format DatagramFormat) (*Header, []byte, error) {
+	if format == DatagramSPP {
+		return parseSPP(datagram)
+	}
+
+	reader := bufio.NewReaderSize(bytes.NewReader(datagram), max(len(datagram), 16))
+	header, err := Read(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header.Version != 2 {
+		return nil, nil, ErrUnknownProxyProtocolVersion
+	}
+	return header, datagram[header.size:], nil
+}
+
+// FormatDatagram returns the datagram made of the header, in the given
+// format, followed by the payload. Headers are written in the Simple Proxy
+// Protocol format whatever their version, IPv4 addresses being written as
+// IPv4-mapped IPv6 ones.
+func FormatDatagram(header *Header, payload []byte, format DatagramFormat) ([]byte, error) {
+	if format == DatagramSPP {
+		return formatSPP(header, payload)
+	}
+
+	buf, err := header.Format()
+	if err != nil {
+		return nil, err
+	}
+	return append(buf, payload...), nil
+}
+
+func parseSPP(datagram []byte) (*Header, []byte, error) {
+	if len(datagram) < sppHeaderLen || binary.BigEndian.Uint16(datagram) != sppMagic {
+		return nil, nil, ErrInvalidSPPHeader
+	}
+
+	sourceIP := net.IP(append([]byte(nil), datagram[2:18]...))
+	destIP := net.IP(append([]byte(nil), datagram[18:34]...))
+	transport := UDPv6
+	if sourceIP.To4() != nil && destIP.To4() != nil {
+		transport = UDPv4
+		sourceIP, destIP = sourceIP.To4(), destIP.To4()
+	}
+
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: transport,
+		SourceAddr:        &net.UDPAddr{IP: sourceIP, Port: int(binary.BigEndian.Uint16(datagram[34:36]))},
+		DestinationAddr:   &net.UDPAddr{IP: destIP, Port: int(binary.BigEndian.Uint16(datagram[36:38]))},
+		size:              sppHeaderLen,
+	}
+	return header, datagram[sppHeaderLen:], nil
+}
+
+func formatSPP(header *Header, payload []byte) ([]byte, error) {
+	sourceIP, sourcePort, sourceOK := ipPort(header.SourceAddr)
+	destIP, destPort, destOK := ipPort(header.DestinationAddr)
+	if !sourceOK || !destOK || sourceIP.To16() == nil || destIP.To16() == nil {
+		return nil, ErrInvalidAddress
+	}
+
+	buf := make([]byte, 0, sppHeaderLen+len(payload))
+	buf = binary.BigEndian.AppendUint16(buf, sppMagic)
+	buf = append(buf, sourceIP.To16()...)
+	buf = append(buf, destIP.To16()...)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(sourcePort))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(destPort))
+	return append(buf, payload...), nil
+}
+
+// ipPort returns the IP address and the port of a TCP or UDP address.
+func ipPort(addr net.Addr) (net.IP, int, bool) {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP, a.Port, true
+	case *net.TCPAddr:
+		return a.IP, a.Port, true
+	}
+	return nil, 0, false
+}
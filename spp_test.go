@@ -0,0 +1,83 @@
+package proxyproto
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestDatagramSPP(t *testing.T) {
+	// Preamble of a datagram sent by 192.0.2.1:1000 to the Spectrum proxy
+	// 198.51.100.1:53.
+	datagram := []byte{
+		0x56, 0xec,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 192, 0, 2, 1,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 198, 51, 100, 1,
+		0x03, 0xe8,
+		0x00, 0x35,
+		'p', 'i', 'n', 'g',
+	}
+
+	header, payload, err := ParseDatagram(datagram, DatagramSPP)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if header.TransportProtocol != UDPv4 {
+		t.Fatalf("expected %v, got %v", UDPv4, header.TransportProtocol)
+	}
+	if header.SourceAddr.String() != "192.0.2.1:1000" || header.DestinationAddr.String() != "198.51.100.1:53" {
+		t.Fatalf("unexpected addresses %v %v", header.SourceAddr, header.DestinationAddr)
+	}
+	if string(payload) != "ping" {
+		t.Fatalf("expected ping, got %q", payload)
+	}
+
+	formatted, err := FormatDatagram(header, payload, DatagramSPP)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.Equal(formatted, datagram) {
+		t.Fatalf("expected %x, got %x", datagram, formatted)
+	}
+
+	if _, _, err := ParseDatagram(datagram[:20], DatagramSPP); err != ErrInvalidSPPHeader {
+		t.Fatalf("expected %v, got %v", ErrInvalidSPPHeader, err)
+	}
+	if _, _, err := ParseDatagram(append([]byte{0x56, 0xed}, datagram[2:]...), DatagramSPP); err != ErrInvalidSPPHeader {
+		t.Fatalf("expected %v, got %v", ErrInvalidSPPHeader, err)
+	}
+}
+
+func TestDatagramV2(t *testing.T) {
+	header := HeaderProxyFromAddrs(2,
+		&net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1000},
+		&net.UDPAddr{IP: net.ParseIP("2001:db8::2"), Port: 53})
+
+	datagram, err := FormatDatagram(header, []byte("ping"), DatagramV2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	parsed, payload, err := ParseDatagram(datagram, DatagramV2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !parsed.EqualsTo(header) {
+		t.Fatalf("expected %v, got %v", header, parsed)
+	}
+	if string(payload) != "ping" {
+		t.Fatalf("expected ping, got %q", payload)
+	}
+
+	// The same header in the other format.
+	datagram, err = FormatDatagram(header, []byte("ping"), DatagramSPP)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	parsed, _, err = ParseDatagram(datagram, DatagramSPP)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !parsed.EqualsTo(header) {
+		t.Fatalf("expected %v, got %v", header, parsed)
+	}
+}
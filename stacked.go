@@ -0,0 +1,140 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+)
+
+// ForwardedChain is the list of the stacked headers received on a
+// connection, one per hop, ordered as an X-Forwarded-For list: from the
+// header written by the proxy farthest from the receiver, whose source
+// address is the original client as far as it knows, to the header written
+// by the proxy the connection comes from. Each header carries the addresses
+// and the TLVs of its hop.
+type ForwardedChain []*Header
+
+// Client returns the header of the hop carrying the address of the client,
+// walking the chain from the nearest hop, as X-Forwarded-For lists are: the
+// source address of each hop is the proxy which wrote the header of the hop
+// before it, which is trusted only if trusted returns true for the address.
+// The walk stops at the first untrusted source address, whose hop is
+// returned. It returns nil for an empty chain.
+func (c ForwardedChain) Client(trusted func(net.Addr) bool) *Header {
+	if len(c) == 0 {
+		return nil
+	}
+	i := len(c) - 1
+	for i > 0 && c[i].SourceAddr != nil && trusted(c[i].SourceAddr) {
+		i--
+	}
+	return c[i]
+}
+
+// ClientWithin returns the header of the hop carrying the address of the
+// client, trusting the hops proxies nearest to the receiver besides the one
+// the connection comes from, as X-Forwarded-For lists are evaluated with a
+// fixed number of trusted proxies. It returns the farthest hop if the chain
+// is shorter, and nil for an empty chain.
+func (c ForwardedChain) ClientWithin(hops int) *Header {
+	if len(c) == 0 {
+		return nil
+	}
+	return c[max(0, len(c)-1-max(hops, 0))]
+}
+
+// TrustCIDRs returns the function trusting the addresses in the allowed IP
+// addresses and ranges, in the format of StrictWhiteListPolicy, to be passed
+// to ForwardedChain.Client.
+func TrustCIDRs(allowed []string) (func(net.Addr) bool, error) {
+	a, err := parse(allowed)
+	if err != nil {
+		return nil, err
+	}
+	return func(addr net.Addr) bool {
+		ip, err := IPFromAddr(addr)
+		if err != nil {
+			return false
+		}
+		for _, allowFrom := range a {
+			if allowFrom(ip) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// WithStackedHeaders makes the connection read up to n headers stacked one
+// after the other, when passed as option to NewConn(), as sent through
+// chains of proxies which each prepend their header to the stream, header
+// of the previous hop included. The header of the connection, and the
+// checks of its options, are the first one received, written by the proxy
+// the connection comes from; the whole chain is available through
+// ForwardedChain.
+//
+// As the connection waits for the bytes following each header to tell
+// whether another one follows, it's meant for protocols where clients speak
+// first, unless ReadHeaderTimeout bounds the wait. It disables LazyTLVs.
+func WithStackedHeaders(n int) func(*Conn) {
+	return func(c *Conn) {
+		c.maxStackedHeaders = n
+	}
+}
+
+// ForwardedChain reads the header of the connection if it hasn't been read
+// yet, and returns the chain of the headers stacked by WithStackedHeaders.
+// Without the option, the chain is made of the header alone. It returns nil
+// if no header was used.
+func (p *Conn) ForwardedChain() ForwardedChain {
+	p.once.Do(func() { p.readErr = p.readHeader() })
+	if p.header == nil {
+		return nil
+	}
+	if p.chain == nil {
+		return ForwardedChain{p.header}
+	}
+	return p.chain
+}
+
+// readStackedHeaders reads the headers stacked behind the first one, up to
+// the limit set by WithStackedHeaders.
+func (p *Conn) readStackedHeaders(first *Header) (ForwardedChain, error) {
+	opts := p.parseOptions
+	opts.reuse, opts.lazyTLVs = nil, 0
+
+	received := []*Header{first}
+	for len(received) < p.maxStackedHeaders && headerFollows(p.bufReader) {
+		header, err := read(p.bufReader, opts)
+		if err != nil {
+			return nil, err
+		}
+		received = append(received, header)
+	}
+
+	chain := make(ForwardedChain, len(received))
+	for i, header := range received {
+		chain[len(chain)-1-i] = header
+	}
+	return chain, nil
+}
+
+// headerFollows reports whether the next bytes of r are a PROXY signature,
+// reading no more of them than needed to tell. Read errors, e.g. the
+// expiry of the header deadline, end the chain, and are left to the reads
+// of the payload.
+func headerFollows(r *bufio.Reader) bool {
+	for n := 1; n <= len(SIGV2); n++ {
+		b, err := r.Peek(n)
+		if err != nil {
+			return false
+		}
+		if bytes.Equal(b, SIGV1) || bytes.Equal(b, SIGV2) {
+			return true
+		}
+		if !bytes.HasPrefix(SIGV1, b) && !bytes.HasPrefix(SIGV2, b) {
+			return false
+		}
+	}
+	return false
+}
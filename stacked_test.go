@@ -0,0 +1,142 @@
+package proxyproto
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+func stackedHeaders(t *testing.T) (client, proxy1, proxy2 *net.TCPAddr, raw []byte) {
+	t.Helper()
+	client = &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 50000}
+	proxy1 = &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 40000}
+	proxy2 = &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 30000}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.9"), Port: 443}
+
+	// The nearest proxy prepends its header to the one of the farthest.
+	nearest := HeaderProxyFromAddrs(2, proxy2, dst)
+	if err := nearest.SetTLVs([]TLV{{Type: PP2_TYPE_AUTHORITY, Value: []byte("nearest")}}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var buf bytes.Buffer
+	for _, header := range []*Header{
+		HeaderProxyFromAddrs(2, proxy1, dst),
+		HeaderProxyFromAddrs(1, client, dst),
+	} {
+		if _, err := header.WriteTo(&buf); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	raw, err := nearest.Format()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return client, proxy1, proxy2, append(raw, buf.Bytes()...)
+}
+
+func TestConnForwardedChain(t *testing.T) {
+	client, proxy1, proxy2, raw := stackedHeaders(t)
+
+	server, peer := net.Pipe()
+	defer server.Close()
+	defer peer.Close()
+	go func() {
+		_, _ = peer.Write(append(raw, "ping"...))
+	}()
+
+	conn := NewConn(server, WithStackedHeaders(3))
+	recv := make([]byte, 4)
+	if _, err := io.ReadFull(conn, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(recv) != "ping" {
+		t.Fatalf("expected ping, got %q", recv)
+	}
+	if conn.RemoteAddr().String() != proxy2.String() {
+		t.Fatalf("expected remote address %v, got %v", proxy2, conn.RemoteAddr())
+	}
+
+	chain := conn.ForwardedChain()
+	if len(chain) != 3 {
+		t.Fatalf("expected 3 hops, got %d", len(chain))
+	}
+	for i, want := range []net.Addr{client, proxy1, proxy2} {
+		if chain[i].SourceAddr.String() != want.String() {
+			t.Fatalf("hop %d: expected source address %v, got %v", i, want, chain[i].SourceAddr)
+		}
+	}
+	if authority, ok := GetTLV[string](chain[2], PP2_TYPE_AUTHORITY); !ok || authority != "nearest" {
+		t.Fatalf("expected the TLVs of the nearest hop, got %q", authority)
+	}
+	if chain[2] != conn.ProxyHeader() {
+		t.Fatal("expected the header of the connection to be the nearest hop")
+	}
+
+	trusted, err := TrustCIDRs([]string{"10.0.0.0/24"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if hop := chain.Client(trusted); hop != chain[0] {
+		t.Fatalf("expected the farthest hop, got %v", hop.SourceAddr)
+	}
+	trusted, err = TrustCIDRs([]string{"10.0.0.2"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if hop := chain.Client(trusted); hop != chain[1] {
+		t.Fatalf("expected the middle hop, got %v", hop.SourceAddr)
+	}
+	for hops, want := range []*Header{chain[2], chain[1], chain[0], chain[0]} {
+		if hop := chain.ClientWithin(hops); hop != want {
+			t.Fatalf("%d hops: expected %v, got %v", hops, want.SourceAddr, hop.SourceAddr)
+		}
+	}
+}
+
+func TestConnForwardedChainLimit(t *testing.T) {
+	_, proxy1, _, raw := stackedHeaders(t)
+
+	server, peer := net.Pipe()
+	defer server.Close()
+	defer peer.Close()
+	go func() {
+		_, _ = peer.Write(raw)
+	}()
+
+	// The headers past the limit are left to the payload.
+	conn := NewConn(server, WithStackedHeaders(2))
+	chain := conn.ForwardedChain()
+	if len(chain) != 2 || chain[0].SourceAddr.String() != proxy1.String() {
+		t.Fatalf("expected 2 hops from %v, got %v", proxy1, chain)
+	}
+	recv := make([]byte, 5)
+	if _, err := io.ReadFull(conn, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.Equal(recv, SIGV1) {
+		t.Fatalf("expected the v1 header, got %q", recv)
+	}
+}
+
+func TestConnForwardedChainSingle(t *testing.T) {
+	server, peer := net.Pipe()
+	defer server.Close()
+	defer peer.Close()
+	go func() {
+		_, _ = WriteHeaderAndPayload(peer, HeaderProxyFromAddrs(2, v4addr, v4addr), []byte("PING"))
+	}()
+
+	// Payloads sharing a prefix with the signatures are left untouched.
+	conn := NewConn(server, WithStackedHeaders(3))
+	recv := make([]byte, 4)
+	if _, err := io.ReadFull(conn, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(recv) != "PING" {
+		t.Fatalf("expected PING, got %q", recv)
+	}
+	if chain := conn.ForwardedChain(); len(chain) != 1 || chain[0] != conn.ProxyHeader() {
+		t.Fatalf("expected a single hop, got %v", chain)
+	}
+}
@@ -0,0 +1,189 @@
+package proxyproto
+
+import (
+	"net"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// HeaderStats describes the shape of a received header, for capacity
+// planning and anomaly detection on proxy metadata.
+type HeaderStats struct {
+	// Version is the protocol version of the header.
+	Version byte
+	// Size is the number of bytes the header was parsed from, signature
+	// included.
+	Size int
+	// TLVCount is the number of TLVs of the header, NOOP padding included.
+	TLVCount int
+	// TLVTypes lists the types of the TLVs of the header, in order of
+	// appearance. A type appears as many times as the header carries it.
+	TLVTypes []PP2Type
+}
+
+// HeaderStatsFunc receives the stats of each header successfully parsed,
+// along with the address of the upstream which sent it.
+type HeaderStatsFunc func(upstream net.Addr, stats HeaderStats)
+
+// OnHeaderStats sets a callback receiving the stats of the header of the
+// connection once parsed, when passed as option to NewConn(). A
+// HeaderHistogram's Observe method can be used as callback.
+func OnHeaderStats(f HeaderStatsFunc) func(*Conn) {
+	return func(c *Conn) {
+		c.onHeaderStats = f
+	}
+}
+
+// headerStats returns the stats of a parsed header. A truncated TLV ends
+// the count, since the following ones can't be located.
+func headerStats(header *Header) HeaderStats {
+	stats := HeaderStats{
+		Version: header.Version,
+		Size:    header.size,
+	}
+	for i := 0; i < len(header.rawTLVs); {
+		end, ok := tlvEnd(header.rawTLVs, i)
+		if !ok {
+			break
+		}
+		stats.TLVTypes = append(stats.TLVTypes, PP2Type(header.rawTLVs[i]))
+		i = end
+	}
+	stats.TLVCount = len(stats.TLVTypes)
+	return stats
+}
+
+// DefaultHeaderSizeBuckets are the upper bounds of the header size buckets of
+// a HeaderHistogram, in bytes: a plain version 2 IPv4 header is 28 bytes, a
+// version 1 one at most 107 bytes.
+var DefaultHeaderSizeBuckets = []int{16, 28, 52, 107, 256, 512, 1024, 4096, 16384, 65551}
+
+// DefaultTLVCountBuckets are the upper bounds of the TLV count buckets of a
+// HeaderHistogram.
+var DefaultTLVCountBuckets = []int{0, 1, 2, 4, 8, 16, 32, 64}
+
+// HeaderHistogram aggregates the stats of received headers into
+// distributions of their size and TLV count, and counts the headers carrying
+// each TLV type, so that they can be exported to a metrics system. It is
+// safe for concurrent use.
+type HeaderHistogram struct {
+	sizeBuckets  []int
+	countBuckets []int
+	sizes        []atomic.Uint64
+	counts       []atomic.Uint64
+	headers      atomic.Uint64
+	sizeSum      atomic.Uint64
+
+	mu    sync.RWMutex
+	types map[PP2Type]*atomic.Uint64
+}
+
+// HeaderHistogramSnapshot is a point in time copy of a HeaderHistogram.
+// Buckets are cumulative, as in Prometheus: the i-th count is the number of
+// headers whose value is at most the i-th bound. Headers above the last
+// bound are only accounted for in Count.
+type HeaderHistogramSnapshot struct {
+	// Count is the number of headers observed.
+	Count uint64
+	// SizeSum is the sum of the sizes of the headers observed, in bytes.
+	SizeSum uint64
+	// SizeBuckets are the upper bounds of the size buckets.
+	SizeBuckets []int
+	// SizeCounts are the cumulative counts of the size buckets.
+	SizeCounts []uint64
+	// TLVCountBuckets are the upper bounds of the TLV count buckets.
+	TLVCountBuckets []int
+	// TLVCountCounts are the cumulative counts of the TLV count buckets.
+	TLVCountCounts []uint64
+	// TLVTypes is the number of headers carrying each TLV type.
+	TLVTypes map[PP2Type]uint64
+}
+
+// NewHeaderHistogram returns a HeaderHistogram with the given bucket upper
+// bounds, which must be sorted in increasing order. Nil bounds default to
+// DefaultHeaderSizeBuckets and DefaultTLVCountBuckets.
+func NewHeaderHistogram(sizeBuckets, tlvCountBuckets []int) *HeaderHistogram {
+	if sizeBuckets == nil {
+		sizeBuckets = DefaultHeaderSizeBuckets
+	}
+	if tlvCountBuckets == nil {
+		tlvCountBuckets = DefaultTLVCountBuckets
+	}
+	return &HeaderHistogram{
+		sizeBuckets:  sizeBuckets,
+		countBuckets: tlvCountBuckets,
+		sizes:        make([]atomic.Uint64, len(sizeBuckets)),
+		counts:       make([]atomic.Uint64, len(tlvCountBuckets)),
+		types:        make(map[PP2Type]*atomic.Uint64),
+	}
+}
+
+// Observe accounts for the stats of a header. It implements HeaderStatsFunc.
+func (h *HeaderHistogram) Observe(upstream net.Addr, stats HeaderStats) {
+	h.headers.Add(1)
+	h.sizeSum.Add(uint64(stats.Size))
+	if i := sort.SearchInts(h.sizeBuckets, stats.Size); i < len(h.sizes) {
+		h.sizes[i].Add(1)
+	}
+	if i := sort.SearchInts(h.countBuckets, stats.TLVCount); i < len(h.counts) {
+		h.counts[i].Add(1)
+	}
+
+	for i, tlvType := range stats.TLVTypes {
+		if slices.Contains(stats.TLVTypes[:i], tlvType) {
+			// Count headers, not occurrences.
+			continue
+		}
+		h.typeCounter(tlvType).Add(1)
+	}
+}
+
+// Snapshot returns a copy of the current distributions.
+func (h *HeaderHistogram) Snapshot() HeaderHistogramSnapshot {
+	s := HeaderHistogramSnapshot{
+		Count:           h.headers.Load(),
+		SizeSum:         h.sizeSum.Load(),
+		SizeBuckets:     h.sizeBuckets,
+		SizeCounts:      cumulate(h.sizes),
+		TLVCountBuckets: h.countBuckets,
+		TLVCountCounts:  cumulate(h.counts),
+		TLVTypes:        make(map[PP2Type]uint64),
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for tlvType, n := range h.types {
+		s.TLVTypes[tlvType] = n.Load()
+	}
+	return s
+}
+
+// typeCounter returns the counter of headers carrying the TLV type.
+func (h *HeaderHistogram) typeCounter(tlvType PP2Type) *atomic.Uint64 {
+	h.mu.RLock()
+	n, ok := h.types[tlvType]
+	h.mu.RUnlock()
+	if ok {
+		return n
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if n, ok = h.types[tlvType]; !ok {
+		n = new(atomic.Uint64)
+		h.types[tlvType] = n
+	}
+	return n
+}
+
+func cumulate(buckets []atomic.Uint64) []uint64 {
+	counts := make([]uint64, len(buckets))
+	var total uint64
+	for i := range buckets {
+		total += buckets[i].Load()
+		counts[i] = total
+	}
+	return counts
+}
@@ -0,0 +1,70 @@
+package proxyproto
+
+import (
+	"io"
+	"net"
+	"slices"
+	"testing"
+)
+
+func TestOnHeaderStats(t *testing.T) {
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr:        v4addr,
+		DestinationAddr:   v4addr,
+	}
+	if err := header.SetTLVs([]TLV{
+		{Type: PP2_TYPE_UNIQUE_ID, Value: []byte("id")},
+		{Type: PP2_TYPE_NOOP, Value: make([]byte, 3)},
+		{Type: PP2_TYPE_UNIQUE_ID, Value: []byte("id")},
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	raw, err := header.Format()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	histogram := NewHeaderHistogram([]int{16, 28, 64}, []int{0, 2, 4})
+	var stats HeaderStats
+	for _, data := range [][]byte{raw, []byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\n")} {
+		server, client := net.Pipe()
+		go func() {
+			_, _ = client.Write(append(append([]byte{}, data...), "ping"...))
+		}()
+
+		conn := NewConn(server, OnHeaderStats(func(upstream net.Addr, s HeaderStats) {
+			stats = s
+			histogram.Observe(upstream, s)
+		}))
+		if _, err := io.ReadFull(conn, make([]byte, 4)); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		server.Close()
+		client.Close()
+
+		if stats.Size != len(data) {
+			t.Fatalf("expected size %d, got %d", len(data), stats.Size)
+		}
+	}
+	if stats.Version != 1 || stats.TLVCount != 0 {
+		t.Fatalf("unexpected stats of the version 1 header %+v", stats)
+	}
+
+	s := histogram.Snapshot()
+	if s.Count != 2 || s.SizeSum != uint64(len(raw)+40) {
+		t.Fatalf("unexpected count %d and size sum %d", s.Count, s.SizeSum)
+	}
+	// The version 2 header is 28+5+3+5 bytes and the version 1 header 40.
+	if want := []uint64{0, 0, 2}; !slices.Equal(s.SizeCounts, want) {
+		t.Fatalf("expected size counts %v, got %v", want, s.SizeCounts)
+	}
+	if want := []uint64{1, 1, 2}; !slices.Equal(s.TLVCountCounts, want) {
+		t.Fatalf("expected TLV count counts %v, got %v", want, s.TLVCountCounts)
+	}
+	if s.TLVTypes[PP2_TYPE_UNIQUE_ID] != 1 || s.TLVTypes[PP2_TYPE_NOOP] != 1 || len(s.TLVTypes) != 2 {
+		t.Fatalf("unexpected TLV type counts %v", s.TLVTypes)
+	}
+}
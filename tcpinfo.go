@@ -0,0 +1,95 @@
+package proxyproto
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+// PP2_TYPE_TCP_INFO is the application specific TLV type carrying the
+// network quality of the client-facing connection of an edge proxy, as
+// sampled from TCP_INFO, see WithSourceTCPInfo. Its value holds the smoothed
+// RTT and the RTT variance in microseconds, followed by the total count of
+// retransmitted segments, each as a big endian uint32.
+const PP2_TYPE_TCP_INFO PP2Type = 0xEB
+
+// TCPInfo is the network quality of a connection, as sampled from TCP_INFO.
+type TCPInfo struct {
+	// RTT is the smoothed round-trip time.
+	RTT time.Duration
+	// RTTVar is the variance of the round-trip time.
+	RTTVar time.Duration
+	// Retransmits is the total count of retransmitted segments.
+	Retransmits uint32
+}
+
+// TLV returns the PP2_TYPE_TCP_INFO TLV carrying the info.
+func (info TCPInfo) TLV() TLV {
+	value, _ := encodeTCPInfo(info)
+	return TLV{Type: PP2_TYPE_TCP_INFO, Value: value}
+}
+
+// TCPInfo returns the info carried by the PP2_TYPE_TCP_INFO TLV of the
+// header, and whether it carries a well-formed one.
+func (header *Header) TCPInfo() (TCPInfo, bool) {
+	return decodeTLV(header.rawTLVs, PP2_TYPE_TCP_INFO, decodeTCPInfo)
+}
+
+func decodeTCPInfo(value []byte) (TCPInfo, error) {
+	if len(value) != 12 {
+		return TCPInfo{}, ErrMalformedTLV
+	}
+	return TCPInfo{
+		RTT:         time.Duration(binary.BigEndian.Uint32(value)) * time.Microsecond,
+		RTTVar:      time.Duration(binary.BigEndian.Uint32(value[4:])) * time.Microsecond,
+		Retransmits: binary.BigEndian.Uint32(value[8:]),
+	}, nil
+}
+
+func encodeTCPInfo(info TCPInfo) ([]byte, error) {
+	value := make([]byte, 0, 12)
+	value = binary.BigEndian.AppendUint32(value, uint32(info.RTT/time.Microsecond))
+	value = binary.BigEndian.AppendUint32(value, uint32(info.RTTVar/time.Microsecond))
+	value = binary.BigEndian.AppendUint32(value, info.Retransmits)
+	return value, nil
+}
+
+// sourceTCPInfoKey is the context key of the client-facing connection whose
+// TCP_INFO is sampled.
+type sourceTCPInfoKey struct{}
+
+// WithSourceTCPInfo returns a copy of ctx carrying the client-facing
+// connection on behalf of which a connection is dialed. When dialing with
+// that context, the Dialer samples the TCP_INFO of conn and appends a
+// PP2_TYPE_TCP_INFO TLV to version 2 headers, so that backends can observe
+// the network quality of the edge per connection. Connections wrapping a TCP
+// connection, e.g. a *tls.Conn, are unwrapped. Sampling is only supported on
+// Linux, elsewhere no TLV is appended.
+func WithSourceTCPInfo(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, sourceTCPInfoKey{}, conn)
+}
+
+// appendSourceTCPInfo returns a copy of the version 2 header with the
+// PP2_TYPE_TCP_INFO TLV of the client-facing connection carried by ctx, if
+// any, appended.
+func appendSourceTCPInfo(ctx context.Context, header *Header) *Header {
+	conn, _ := ctx.Value(sourceTCPInfoKey{}).(net.Conn)
+	if conn == nil || header.Version != 2 {
+		return header
+	}
+	for {
+		wrapper, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			break
+		}
+		conn = wrapper.NetConn()
+	}
+
+	info, ok := sampleTCPInfo(conn)
+	if !ok {
+		return header
+	}
+	tlv := info.TLV()
+	return withTLVs(header, appendTLV(nil, tlv.Type, tlv.Value))
+}
@@ -0,0 +1,41 @@
+//go:build linux && !386
+
+package proxyproto
+
+import (
+	"net"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// sampleTCPInfo samples the TCP_INFO of the connection, and tells whether it
+// could.
+func sampleTCPInfo(conn net.Conn) (TCPInfo, bool) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return TCPInfo{}, false
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return TCPInfo{}, false
+	}
+
+	var (
+		info  syscall.TCPInfo
+		errno syscall.Errno
+	)
+	err = raw.Control(func(fd uintptr) {
+		size := uint32(unsafe.Sizeof(info))
+		_, _, errno = syscall.Syscall6(syscall.SYS_GETSOCKOPT, fd, syscall.IPPROTO_TCP, syscall.TCP_INFO,
+			uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&size)), 0)
+	})
+	if err != nil || errno != 0 {
+		return TCPInfo{}, false
+	}
+	return TCPInfo{
+		RTT:         time.Duration(info.Rtt) * time.Microsecond,
+		RTTVar:      time.Duration(info.Rttvar) * time.Microsecond,
+		Retransmits: info.Total_retrans,
+	}, true
+}
@@ -0,0 +1,11 @@
+//go:build !linux || 386
+
+package proxyproto
+
+import "net"
+
+// sampleTCPInfo samples the TCP_INFO of the connection, which isn't
+// supported on this platform.
+func sampleTCPInfo(conn net.Conn) (TCPInfo, bool) {
+	return TCPInfo{}, false
+}
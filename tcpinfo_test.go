@@ -0,0 +1,75 @@
+package proxyproto
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestTCPInfoTLV(t *testing.T) {
+	info := TCPInfo{RTT: 1500 * time.Microsecond, RTTVar: 250 * time.Microsecond, Retransmits: 3}
+	header := HeaderProxyFromAddrs(2, v4addr, v4addr)
+	if err := header.SetTLVs([]TLV{info.TLV()}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if got, ok := header.TCPInfo(); !ok || got != info {
+		t.Fatalf("expected %+v, got %+v %v", info, got, ok)
+	}
+	if _, ok := HeaderProxyFromAddrs(2, v4addr, v4addr).TCPInfo(); ok {
+		t.Fatal("expected no TCP info")
+	}
+}
+
+func TestDialerSourceTCPInfo(t *testing.T) {
+	// The client-facing connection.
+	edge, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer edge.Close()
+	client, err := net.Dial("tcp", edge.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer client.Close()
+	src, err := edge.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer src.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pl := &Listener{Listener: l}
+	defer pl.Close()
+
+	go func() {
+		d := &Dialer{Version: 2}
+		conn, err := d.DialContext(WithSourceTCPInfo(context.Background(), src), "tcp", l.Addr().String())
+		if err != nil {
+			t.Errorf("err: %v", err)
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write([]byte("ping"))
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	header := conn.(*Conn).ProxyHeader()
+	if header == nil {
+		t.Fatal("expected a header")
+	}
+	_, ok := header.TCPInfo()
+	if supported := runtime.GOOS == "linux" && runtime.GOARCH != "386"; ok != supported {
+		t.Fatalf("expected the TCP info TLV to be sent: %v, got %v", supported, ok)
+	}
+}
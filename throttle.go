@@ -0,0 +1,87 @@
+package proxyproto
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// AcceptThrottle bounds the rate at which a listener accepts connections
+// with a token bucket, so that it degrades gracefully during connection
+// storms, letting them queue up in the kernel backlog, instead of
+// allocating header buffers as fast as connections arrive. It is safe for
+// concurrent use, and can be shared by several listeners, see
+// Listener.AcceptThrottle.
+type AcceptThrottle struct {
+	// OnThrottle, if set, is called with true when throttling engages, i.e.
+	// an accept has to wait for a token, and with false when it disengages,
+	// i.e. an accept goes through without waiting again.
+	OnThrottle func(engaged bool)
+
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu        sync.Mutex
+	tokens    float64
+	last      time.Time
+	throttled bool
+}
+
+// NewAcceptThrottle returns an AcceptThrottle allowing rate accepts per
+// second on average, and bursts of up to burst accepts.
+func NewAcceptThrottle(rate float64, burst int) *AcceptThrottle {
+	return &AcceptThrottle{
+		rate:   rate,
+		burst:  float64(max(burst, 1)),
+		tokens: float64(max(burst, 1)),
+		now:    time.Now,
+	}
+}
+
+// reserve takes a token, and returns the time to wait for it to be
+// available.
+func (t *AcceptThrottle) reserve() time.Duration {
+	t.mu.Lock()
+	now := t.now()
+	if !t.last.IsZero() {
+		t.tokens = math.Min(t.burst, t.tokens+now.Sub(t.last).Seconds()*t.rate)
+	}
+	t.last = now
+	t.tokens--
+
+	var delay time.Duration
+	if t.tokens < 0 {
+		if t.rate <= 0 {
+			delay = time.Duration(math.MaxInt64)
+		} else {
+			delay = time.Duration(-t.tokens / t.rate * float64(time.Second))
+		}
+	}
+	changed := (delay > 0) != t.throttled
+	t.throttled = delay > 0
+	onThrottle := t.OnThrottle
+	t.mu.Unlock()
+
+	if changed && onThrottle != nil {
+		onThrottle(delay > 0)
+	}
+	return delay
+}
+
+// throttle waits for the listener to be allowed to accept a connection, and
+// reports whether it was before the listener was closed.
+func (p *Listener) throttle() bool {
+	delay := p.AcceptThrottle.reserve()
+	if delay <= 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-p.doneChan():
+		return false
+	}
+}
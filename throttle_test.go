@@ -0,0 +1,57 @@
+package proxyproto
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAcceptThrottle(t *testing.T) {
+	now := time.Unix(0, 0)
+	throttle := NewAcceptThrottle(10, 2)
+	throttle.now = func() time.Time { return now }
+	var events []bool
+	throttle.OnThrottle = func(engaged bool) { events = append(events, engaged) }
+
+	// The burst goes through, then accepts are spread at the rate.
+	for i, want := range []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond} {
+		if delay := throttle.reserve(); delay != want {
+			t.Fatalf("accept %d: expected a delay of %v, got %v", i, want, delay)
+		}
+	}
+	now = now.Add(time.Second)
+	if delay := throttle.reserve(); delay != 0 {
+		t.Fatalf("expected no delay once tokens are replenished, got %v", delay)
+	}
+	if len(events) != 2 || !events[0] || events[1] {
+		t.Fatalf("expected throttling to engage then disengage, got %v", events)
+	}
+}
+
+func TestListenerAcceptThrottleClose(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	throttle := NewAcceptThrottle(0.001, 1)
+	throttle.reserve()
+	pl := &Listener{Listener: l, AcceptThrottle: throttle}
+
+	result := make(chan error)
+	go func() {
+		_, err := pl.Accept()
+		result <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	pl.Close()
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Fatalf("expected %v, got %v", net.ErrClosed, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Close to unblock a throttled Accept")
+	}
+}
@@ -0,0 +1,170 @@
+package proxyproto
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrHeaderReadTimeout is returned when the header wasn't received before
+// the read header timeout or the header deadline of a connection, telling
+// slow or stuck upstreams apart from upstreams not sending any header.
+// When nothing was received at all, the error also satisfies
+// errors.Is(err, ErrNoProxyProtocol), as it used to.
+var ErrHeaderReadTimeout = errors.New("proxyproto: timed out reading the header")
+
+// headerTimeoutError is returned when the header wasn't received before the
+// read header timeout of a connection requiring one. Besides
+// ErrHeaderReadTimeout and the error it wraps, i.e. ErrNoProxyProtocol or
+// the ParseError of a partial header, it satisfies
+// errors.Is(err, os.ErrDeadlineExceeded) and net.Error.Timeout, so that
+// generic networking code classifies it as a timeout.
+type headerTimeoutError struct {
+	err error
+}
+
+var _ net.Error = (*headerTimeoutError)(nil)
+
+func (e *headerTimeoutError) Error() string {
+	return e.err.Error() + ": read header timeout"
+}
+
+func (e *headerTimeoutError) Unwrap() []error {
+	return []error{ErrHeaderReadTimeout, e.err, os.ErrDeadlineExceeded}
+}
+
+// Timeout reports that the error is a timeout.
+func (e *headerTimeoutError) Timeout() bool { return true }
+
+// Temporary reports that the error is temporary, as timeouts are.
+func (e *headerTimeoutError) Temporary() bool { return true }
+
+// headerDeadlines splits the read deadline of a connection between its
+// header and its payload. The read deadline set by the application is held
+// back while the header is read under a header deadline, and applied once
+// the header has been read.
+type headerDeadlines struct {
+	mu sync.Mutex
+	// read is the read deadline set by the application.
+	read time.Time
+	// header is the header deadline set with Conn.SetHeaderDeadline.
+	header time.Time
+	// reading tells whether the header is being read, and bounded whether
+	// it's being read under a header deadline.
+	reading bool
+	bounded bool
+	done    bool
+	// clock, if set, enforces the header deadline with timer instead of
+	// the underlying connection, see WithClock.
+	clock Clock
+	timer ClockTimer
+}
+
+// aLongTimeAgo is a read deadline in the past, failing reads right away.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// applyHeader applies the header deadline t to conn.
+func (d *headerDeadlines) applyHeader(conn net.Conn, t time.Time) error {
+	if d.clock == nil {
+		return conn.SetReadDeadline(t)
+	}
+
+	d.stopTimer()
+	wait := t.Sub(d.clock.Now())
+	if wait <= 0 {
+		return conn.SetReadDeadline(aLongTimeAgo)
+	}
+	var timer ClockTimer
+	timer = d.clock.AfterFunc(wait, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.timer == timer {
+			_ = conn.SetReadDeadline(aLongTimeAgo)
+		}
+	})
+	d.timer = timer
+	return conn.SetReadDeadline(time.Time{})
+}
+
+// stopTimer stops the timer of the header deadline, if any.
+func (d *headerDeadlines) stopTimer() {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+}
+
+// setRead sets the read deadline, which is applied to conn unless the
+// header is being read under a header deadline.
+func (d *headerDeadlines) setRead(conn net.Conn, t time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.read = t
+	if d.bounded {
+		return nil
+	}
+	return conn.SetReadDeadline(t)
+}
+
+// setHeader sets the header deadline, which is applied to conn if the
+// header is being read. Once the header has been read, it has no effect.
+func (d *headerDeadlines) setHeader(conn net.Conn, t time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.done {
+		return nil
+	}
+	d.header = t
+	if !d.reading {
+		return nil
+	}
+	if t.IsZero() {
+		// Fall back to the read deadline.
+		d.stopTimer()
+		d.bounded = false
+		return conn.SetReadDeadline(d.read)
+	}
+	d.bounded = true
+	return d.applyHeader(conn, t)
+}
+
+// begin applies the header deadline to conn before the header is read. It
+// defaults to now plus timeout, if more than 0. Without header deadline, the
+// read deadline stays in effect.
+func (d *headerDeadlines) begin(conn net.Conn, timeout time.Duration) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.reading = true
+	t := d.header
+	if t.IsZero() && timeout > 0 {
+		if d.clock != nil {
+			t = d.clock.Now().Add(timeout)
+		} else {
+			t = time.Now().Add(timeout)
+		}
+	}
+	if t.IsZero() {
+		return nil
+	}
+	if err := d.applyHeader(conn, t); err != nil {
+		return err
+	}
+	d.bounded = true
+	return nil
+}
+
+// end restores the read deadline on conn once the header has been read, if
+// a header deadline was applied instead. It returns whether one was.
+func (d *headerDeadlines) end(conn net.Conn) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	bounded := d.bounded
+	d.reading, d.bounded, d.done = false, false, true
+	d.stopTimer()
+	if !bounded {
+		return false, nil
+	}
+	return true, conn.SetReadDeadline(d.read)
+}
@@ -0,0 +1,192 @@
+package proxyproto
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReadHeaderTimeoutError(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	conn := NewConn(server, WithPolicy(REQUIRE), SetReadHeaderTimeout(20*time.Millisecond))
+	_, err := conn.Read(make([]byte, 1))
+
+	if !errors.Is(err, ErrNoProxyProtocol) {
+		t.Fatalf("expected %v, got %v", ErrNoProxyProtocol, err)
+	}
+	if !errors.Is(err, ErrHeaderReadTimeout) {
+		t.Fatalf("expected %v, got %v", ErrHeaderReadTimeout, err)
+	}
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected the error to satisfy os.ErrDeadlineExceeded, got %v", err)
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("expected a timeout net.Error, got %v", err)
+	}
+}
+
+func TestReadHeaderTimeoutPartialHeader(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	conn := NewConn(server, WithPolicy(USE), SetReadHeaderTimeout(20*time.Millisecond))
+	go func() {
+		// The signature and the start of a header, never completed.
+		_, _ = client.Write(append(append([]byte{}, SIGV2...), 0x21, 0x11, 0x00, 0x0C))
+	}()
+	_, err := conn.Read(make([]byte, 1))
+
+	if !errors.Is(err, ErrHeaderReadTimeout) {
+		t.Fatalf("expected %v, got %v", ErrHeaderReadTimeout, err)
+	}
+	if errors.Is(err, ErrNoProxyProtocol) {
+		t.Fatalf("expected the signature to be reported as received, got %v", err)
+	}
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Reason != ReasonTimeout {
+		t.Fatalf("expected a %s ParseError, got %v", ReasonTimeout, err)
+	}
+}
+
+func TestReadDeadlineAppliesToPayload(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	conn := NewConn(server, WithPolicy(REQUIRE), SetReadHeaderTimeout(time.Second))
+	// Shorter than the time the header takes to arrive.
+	if err := conn.SetReadDeadline(time.Now().Add(20 * time.Millisecond)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		header := HeaderProxyFromAddrs(2, v4addr, v4addr)
+		_, _ = header.WriteTo(client)
+	}()
+
+	_, err := conn.Read(make([]byte, 1))
+	if conn.ProxyHeader() == nil {
+		t.Fatalf("expected the header to be read, got %v", err)
+	}
+	if errors.Is(err, ErrNoProxyProtocol) || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected the payload read to time out, got %v", err)
+	}
+}
+
+func TestSetHeaderDeadline(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	conn := NewConn(server, WithPolicy(REQUIRE), SetReadHeaderTimeout(time.Minute))
+	if err := conn.SetHeaderDeadline(time.Now().Add(20 * time.Millisecond)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	start := time.Now()
+	_, err := conn.Read(make([]byte, 1))
+	if !errors.Is(err, ErrNoProxyProtocol) || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected a header timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the header deadline to apply, took %v", elapsed)
+	}
+}
+
+func TestReadDeadlineHeldBackDuringHeader(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	conn := NewConn(server, WithPolicy(REQUIRE))
+	if err := conn.SetHeaderDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		// Set while the header is being read, in the past.
+		_ = conn.SetReadDeadline(time.Now().Add(-time.Second))
+		time.Sleep(20 * time.Millisecond)
+		header := HeaderProxyFromAddrs(2, v4addr, v4addr)
+		_, _ = header.WriteTo(client)
+	}()
+
+	_, err := conn.Read(make([]byte, 1))
+	if conn.ProxyHeader() == nil {
+		t.Fatalf("expected the header to be read, got %v", err)
+	}
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected the payload read to time out, got %v", err)
+	}
+}
+
+func TestReadDeadlineBoundsHeaderWithoutHeaderDeadline(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	conn := NewConn(server, WithPolicy(REQUIRE))
+	if err := conn.SetReadDeadline(time.Now().Add(20 * time.Millisecond)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	_, err := conn.Read(make([]byte, 1))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected the read deadline to apply, got %v", err)
+	}
+}
+
+func TestNewListenerDefaultReadHeaderTimeout(t *testing.T) {
+	saved := DefaultReadHeaderTimeout
+	defer func() { DefaultReadHeaderTimeout = saved }()
+
+	DefaultReadHeaderTimeout = 30 * time.Millisecond
+	snapshot := NewListener(nil)
+	option := NewListener(nil, WithDefaultReadHeaderTimeout(30*time.Millisecond))
+	// Not seen by the listeners created above.
+	DefaultReadHeaderTimeout = time.Hour
+
+	for name, pl := range map[string]*Listener{"snapshot": snapshot, "option": option} {
+		t.Run(name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			pl.Listener = l
+			pl.ConnPolicy = func(ConnPolicyOptions) (Policy, error) { return REQUIRE, nil }
+			defer pl.Close()
+
+			client, err := net.Dial("tcp", pl.Addr().String())
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			defer client.Close()
+
+			conn, err := pl.Accept()
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			defer conn.Close()
+
+			start := time.Now()
+			if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, ErrHeaderReadTimeout) {
+				t.Fatalf("expected %v, got %v", ErrHeaderReadTimeout, err)
+			}
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Fatalf("expected the listener default to apply, took %v", elapsed)
+			}
+		})
+	}
+}
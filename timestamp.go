@@ -0,0 +1,54 @@
+package proxyproto
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// PP2_TYPE_TIMESTAMP is the application specific TLV type carrying the time
+// the edge proxy received a connection, as a big endian count of nanoseconds
+// since the Unix epoch, see TimestampTLV.
+const PP2_TYPE_TIMESTAMP PP2Type = 0xE9
+
+// TimestampTLV returns the PP2_TYPE_TIMESTAMP TLV carrying t, e.g. the time
+// an edge proxy received the connection it announces. It's typically added
+// with Dialer.AppendTLVs.
+func TimestampTLV(t time.Time) TLV {
+	value, _ := encodeTimestamp(t)
+	return TLV{Type: PP2_TYPE_TIMESTAMP, Value: value}
+}
+
+// Timestamp returns the time carried by the PP2_TYPE_TIMESTAMP TLV of the
+// header, and whether it carries a well-formed one.
+func (header *Header) Timestamp() (time.Time, bool) {
+	return decodeTLV(header.rawTLVs, PP2_TYPE_TIMESTAMP, decodeTimestamp)
+}
+
+func decodeTimestamp(value []byte) (time.Time, error) {
+	if len(value) != 8 {
+		return time.Time{}, ErrMalformedTLV
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(value))), nil
+}
+
+func encodeTimestamp(t time.Time) ([]byte, error) {
+	return binary.BigEndian.AppendUint64(nil, uint64(t.UnixNano())), nil
+}
+
+// EdgeLatency returns the time elapsed between the reception of the
+// connection by the edge proxy, as announced by the PP2_TYPE_TIMESTAMP TLV
+// of the header, and the parsing of the header, and whether the header
+// carries a timestamp. It gives a cheap end-to-end latency signal, as long
+// as the clocks of the edge and the backend are synchronized: the latency
+// may even be negative if they drift apart.
+func (p *Conn) EdgeLatency() (time.Duration, bool) {
+	p.once.Do(func() { p.readErr = p.readHeader() })
+	if p.header == nil || !p.headerParsed {
+		return 0, false
+	}
+	ts, ok := p.header.Timestamp()
+	if !ok {
+		return 0, false
+	}
+	return p.acceptedAt.Add(p.headerLatency).Sub(ts), true
+}
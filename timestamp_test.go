@@ -0,0 +1,54 @@
+package proxyproto
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTimestampTLV(t *testing.T) {
+	received := time.Now().Add(-50 * time.Millisecond)
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr:        v4addr,
+		DestinationAddr:   v4addr,
+	}
+	if err := header.SetTLVs([]TLV{TimestampTLV(received)}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if ts, ok := header.Timestamp(); !ok || !ts.Equal(received) {
+		t.Fatalf("expected %v, got %v %v", received, ts, ok)
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	go func() {
+		_, _ = WriteHeaderAndPayload(client, header, []byte("ping"))
+	}()
+
+	conn := NewConn(server)
+	defer conn.Close()
+	latency, ok := conn.EdgeLatency()
+	if !ok {
+		t.Fatal("expected an edge latency")
+	}
+	if latency < 50*time.Millisecond || latency > time.Minute {
+		t.Fatalf("unexpected edge latency %v", latency)
+	}
+}
+
+func TestEdgeLatencyWithoutTimestamp(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	go func() {
+		_, _ = WriteHeaderAndPayload(client, HeaderProxyFromAddrs(2, v4addr, v4addr), []byte("ping"))
+	}()
+
+	conn := NewConn(server)
+	defer conn.Close()
+	if _, ok := conn.EdgeLatency(); ok {
+		t.Fatal("expected no edge latency")
+	}
+}
@@ -0,0 +1,121 @@
+package proxyproto
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+)
+
+// sourceTLSConnKey is the context key of the inbound TLS connection a
+// connection is dialed on behalf of.
+type sourceTLSConnKey struct{}
+
+// WithSourceTLSConn returns a copy of ctx carrying the inbound TLS connection
+// on behalf of which a connection is dialed, e.g. by a TLS-terminating relay.
+// When dialing with that context, the Dialer completes the handshake of conn
+// if needed, and appends to version 2 headers a PP2_TYPE_ALPN TLV holding the
+// negotiated protocol and a PP2_TYPE_SSL TLV describing the TLS session, as
+// HAProxy does. TLVs of those types already carried by the header, or
+// returned by Dialer.AppendTLVs, take precedence.
+func WithSourceTLSConn(ctx context.Context, conn *tls.Conn) context.Context {
+	return context.WithValue(ctx, sourceTLSConnKey{}, conn)
+}
+
+// sourceTLSConn returns the inbound TLS connection carried by ctx, if any.
+func sourceTLSConn(ctx context.Context) *tls.Conn {
+	conn, _ := ctx.Value(sourceTLSConnKey{}).(*tls.Conn)
+	return conn
+}
+
+// appendSourceTLSTLVs returns a copy of the version 2 header with the ALPN
+// and SSL TLVs describing the source connection appended, unless the header
+// already carries TLVs of those types.
+func appendSourceTLSTLVs(ctx context.Context, src *tls.Conn, header *Header) (*Header, error) {
+	if header.Version != 2 {
+		return header, nil
+	}
+	if err := src.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	tlvs, err := header.TLVs()
+	if err != nil {
+		return nil, err
+	}
+	var hasALPN, hasSSL bool
+	for _, tlv := range tlvs {
+		hasALPN = hasALPN || tlv.Type == PP2_TYPE_ALPN
+		hasSSL = hasSSL || tlv.Type == PP2_TYPE_SSL
+	}
+
+	var added []TLV
+	cs := src.ConnectionState()
+	if !hasALPN && cs.NegotiatedProtocol != "" {
+		added = append(added, TLV{Type: PP2_TYPE_ALPN, Value: []byte(cs.NegotiatedProtocol)})
+	}
+	if !hasSSL {
+		added = append(added, sslTLV(cs))
+	}
+	if len(added) == 0 {
+		return header, nil
+	}
+	raw, err := JoinTLVs(added)
+	if err != nil {
+		return nil, err
+	}
+	return withTLVs(header, raw), nil
+}
+
+// Bits of the client field of the PP2_TYPE_SSL TLV.
+const (
+	pp2ClientSSL      = 0x01
+	pp2ClientCertConn = 0x02
+	pp2ClientCertSess = 0x04
+)
+
+// sslTLV builds the PP2_TYPE_SSL TLV describing a TLS session. The cipher
+// is named the way crypto/tls does, i.e. after its IANA name.
+func sslTLV(cs tls.ConnectionState) TLV {
+	var client byte = pp2ClientSSL
+	var verify uint32
+	if len(cs.PeerCertificates) > 0 {
+		client |= pp2ClientCertSess
+		if !cs.DidResume {
+			client |= pp2ClientCertConn
+		}
+		// As with OpenSSL, the result is only non-zero for a certificate
+		// which failed the verification.
+		if len(cs.VerifiedChains) == 0 {
+			verify = 1
+		}
+	}
+
+	value := binary.BigEndian.AppendUint32([]byte{client}, verify)
+	value = appendTLV(value, PP2_SUBTYPE_SSL_VERSION, []byte(sslVersionName(cs.Version)))
+	value = appendTLV(value, PP2_SUBTYPE_SSL_CIPHER, []byte(tls.CipherSuiteName(cs.CipherSuite)))
+	if len(cs.PeerCertificates) > 0 && cs.PeerCertificates[0].Subject.CommonName != "" {
+		value = appendTLV(value, PP2_SUBTYPE_SSL_CN, []byte(cs.PeerCertificates[0].Subject.CommonName))
+	}
+	return TLV{Type: PP2_TYPE_SSL, Value: value}
+}
+
+// sslVersionName names a TLS version the way OpenSSL, and thus HAProxy, do.
+func sslVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLSv1"
+	case tls.VersionTLS11:
+		return "TLSv1.1"
+	case tls.VersionTLS12:
+		return "TLSv1.2"
+	case tls.VersionTLS13:
+		return "TLSv1.3"
+	}
+	return tls.VersionName(version)
+}
+
+// appendTLV appends a TLV to raw.
+func appendTLV(raw []byte, t PP2Type, value []byte) []byte {
+	raw = append(raw, byte(t))
+	raw = binary.BigEndian.AppendUint16(raw, uint16(len(value)))
+	return append(raw, value...)
+}
@@ -0,0 +1,100 @@
+package proxyproto
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+)
+
+// sourceTLSPair returns the server end of a TLS connection over a pipe,
+// having negotiated h2 with its client.
+func sourceTLSPair(t *testing.T) *tls.Conn {
+	cert, err := tls.X509KeyPair(LocalhostCert, LocalhostKey)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	c1, c2 := net.Pipe()
+	server := tls.Server(c1, &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2"}})
+	client := tls.Client(c2, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2"}})
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+
+	go client.Handshake()
+	return server
+}
+
+func dialSourceTLS(t *testing.T, header *Header, src *tls.Conn) []TLV {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pl := &Listener{Listener: l}
+	defer pl.Close()
+
+	cliResult := make(chan error)
+	go func() {
+		d := &Dialer{Header: header}
+		conn, err := d.DialContext(WithSourceTLSConn(context.Background(), src), "tcp", pl.Addr().String())
+		if err != nil {
+			cliResult <- err
+			return
+		}
+		defer conn.Close()
+		close(cliResult)
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	tlvs, err := conn.(*Conn).ProxyHeader().TLVs()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := <-cliResult; err != nil {
+		t.Fatalf("client error: %v", err)
+	}
+	return tlvs
+}
+
+func TestDialerSourceTLSConn(t *testing.T) {
+	header := HeaderProxyFromAddrs(2, v4addr, v4addr)
+	tlvs := dialSourceTLS(t, header, sourceTLSPair(t))
+
+	if len(tlvs) != 2 || tlvs[0].Type != PP2_TYPE_ALPN || string(tlvs[0].Value) != "h2" || tlvs[1].Type != PP2_TYPE_SSL {
+		t.Fatalf("unexpected TLVs: %v", tlvs)
+	}
+	ssl := tlvs[1].Value
+	if ssl[0] != pp2ClientSSL || string(ssl[1:5]) != "\x00\x00\x00\x00" {
+		t.Fatalf("unexpected SSL TLV: %x", ssl)
+	}
+	sub, err := SplitTLVs(ssl[5:])
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(sub) != 2 || sub[0].Type != PP2_SUBTYPE_SSL_VERSION || string(sub[0].Value) != "TLSv1.3" || sub[1].Type != PP2_SUBTYPE_SSL_CIPHER {
+		t.Fatalf("unexpected SSL sub-TLVs: %v", sub)
+	}
+
+	// The template header is left untouched.
+	if tlvs, _ := header.TLVs(); len(tlvs) != 0 {
+		t.Fatalf("expected template TLVs to be untouched, got %v", tlvs)
+	}
+}
+
+func TestDialerSourceTLSConnOverridden(t *testing.T) {
+	header := HeaderProxyFromAddrs(2, v4addr, v4addr)
+	if err := header.SetTLVs([]TLV{{Type: PP2_TYPE_ALPN, Value: []byte("http/1.1")}}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	tlvs := dialSourceTLS(t, header, sourceTLSPair(t))
+
+	if len(tlvs) != 2 || tlvs[0].Type != PP2_TYPE_ALPN || string(tlvs[0].Value) != "http/1.1" || tlvs[1].Type != PP2_TYPE_SSL {
+		t.Fatalf("unexpected TLVs: %v", tlvs)
+	}
+}
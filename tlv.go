@@ -75,6 +75,50 @@ func SplitTLVs(raw []byte) ([]TLV, error) {
 	return tlvs, nil
 }
 
+// skipMalformedTLVs returns raw stripped of the TLVs which are truncated or
+// whose value is malformed for their registered type, along with a warning
+// for each TLV dropped. A truncated TLV ends the vector, since the following
+// records can't be located anymore.
+func skipMalformedTLVs(raw []byte) ([]byte, []error) {
+	var valid []byte
+	var warnings []error
+	for i := 0; i < len(raw); {
+		if len(raw)-i <= 2 {
+			warnings = append(warnings, fmt.Errorf("%w: %d trailing bytes at offset %d", ErrTruncatedTLV, len(raw)-i, i))
+			break
+		}
+		tlvType := PP2Type(raw[i])
+		tlvLen := int(binary.BigEndian.Uint16(raw[i+1 : i+3]))
+		if i+3+tlvLen > len(raw) {
+			warnings = append(warnings, fmt.Errorf("%w: type %#x at offset %d", ErrTruncatedTLV, byte(tlvType), i))
+			break
+		}
+		if validTLVValue(tlvType, raw[i+3:i+3+tlvLen]) {
+			valid = append(valid, raw[i:i+3+tlvLen]...)
+		} else {
+			warnings = append(warnings, fmt.Errorf("%w: type %#x at offset %d", ErrMalformedTLV, byte(tlvType), i))
+		}
+		i += 3 + tlvLen
+	}
+	return valid, warnings
+}
+
+// validTLVValue checks the value of registered types with a fixed layout.
+func validTLVValue(tlvType PP2Type, value []byte) bool {
+	switch tlvType {
+	case PP2_TYPE_CRC32C:
+		return len(value) == 4
+	case PP2_TYPE_SSL:
+		// client (1 byte) and verify (4 bytes) fields, followed by sub-TLVs
+		if len(value) < 5 {
+			return false
+		}
+		_, err := SplitTLVs(value[5:])
+		return err == nil
+	}
+	return true
+}
+
 // JoinTLVs joins multiple Type-Length-Value records.
 func JoinTLVs(tlvs []TLV) ([]byte, error) {
 	var raw []byte
@@ -3,6 +3,8 @@ package proxyproto
 import (
 	"bufio"
 	"bytes"
+	"errors"
+	"net"
 	"testing"
 )
 
@@ -148,3 +150,50 @@ func TestJoinTLVs(t *testing.T) {
 		})
 	}
 }
+
+func TestSkipMalformedTLVs(t *testing.T) {
+	authority := []byte{byte(PP2_TYPE_AUTHORITY), 0x00, 0x04, 'h', 'o', 's', 't'}
+	badCRC := []byte{byte(PP2_TYPE_CRC32C), 0x00, 0x02, 0x01, 0x02}
+	badSSL := []byte{byte(PP2_TYPE_SSL), 0x00, 0x06, 0x01, 0x00, 0x00, 0x00, 0x00, byte(PP2_SUBTYPE_SSL_VERSION)}
+
+	tests := []struct {
+		name     string
+		tlvs     []byte
+		expected []byte
+		warnings []error
+	}{
+		{"valid", authority, authority, nil},
+		{"truncated", append(append([]byte{}, authority...), fixturePartialLenTLV...), authority, []error{ErrTruncatedTLV}},
+		{"trailing bytes", append(append([]byte{}, authority...), fixtureTwoByteTLV...), authority, []error{ErrTruncatedTLV}},
+		{"malformed CRC32C", append(append([]byte{}, badCRC...), authority...), authority, []error{ErrMalformedTLV}},
+		{"malformed SSL", append(append([]byte{}, authority...), badSSL...), authority, []error{ErrMalformedTLV}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := append(append(SIGV2, byte(PROXY), byte(TCPv4)), fixtureWithTLV(lengthV4Bytes, fixtureIPv4Address, tt.tlvs)...)
+			header, err := read(newBufioReader(raw), parseOptions{skipMalformedTLVs: true})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !header.SourceAddr.(*net.TCPAddr).IP.Equal(v4ip) {
+				t.Fatalf("expected source address to be honored, got %v", header.SourceAddr)
+			}
+			if !bytes.Equal(header.rawTLVs, tt.expected) {
+				t.Fatalf("expected TLVs %v, got %v", tt.expected, header.rawTLVs)
+			}
+			if _, err := header.TLVs(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			warnings := header.Warnings()
+			if len(warnings) != len(tt.warnings) {
+				t.Fatalf("expected warnings %v, got %v", tt.warnings, warnings)
+			}
+			for i := range warnings {
+				if !errors.Is(warnings[i], tt.warnings[i]) {
+					t.Fatalf("expected warning %v, got %v", tt.warnings[i], warnings[i])
+				}
+			}
+		})
+	}
+}
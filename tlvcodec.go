@@ -0,0 +1,135 @@
+package proxyproto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// TLVDecodeFunc decodes the value of a TLV into a T, or fails with
+// ErrMalformedTLV.
+type TLVDecodeFunc[T any] func(value []byte) (T, error)
+
+// TLVEncodeFunc encodes a T into the value of a TLV.
+type TLVEncodeFunc[T any] func(value T) ([]byte, error)
+
+// tlvCodec is the codec registered for a TLV type, with T the type of its
+// values.
+type tlvCodec[T any] struct {
+	decode TLVDecodeFunc[T]
+	encode TLVEncodeFunc[T]
+}
+
+var (
+	tlvCodecsMu sync.RWMutex
+	tlvCodecs   = make(map[PP2Type]any)
+)
+
+// RegisterTLVCodec registers the codec of the values of the TLV type, so
+// that GetTLV and NewTLV map them to and from T. It replaces the codec
+// previously registered for the type, if any. The encoder may be nil for
+// types which are only received. The registered types, e.g.
+// PP2_TYPE_AUTHORITY as a string, and the application specific ones of this
+// package are registered by default; the tlvparse package registers the
+// ones of the cloud providers.
+func RegisterTLVCodec[T any](t PP2Type, decode TLVDecodeFunc[T], encode TLVEncodeFunc[T]) {
+	tlvCodecsMu.Lock()
+	defer tlvCodecsMu.Unlock()
+	tlvCodecs[t] = &tlvCodec[T]{decode: decode, encode: encode}
+}
+
+// lookupTLVCodec returns the codec registered for the TLV type, if its
+// values are of type T.
+func lookupTLVCodec[T any](t PP2Type) (*tlvCodec[T], bool) {
+	tlvCodecsMu.RLock()
+	defer tlvCodecsMu.RUnlock()
+	codec, ok := tlvCodecs[t].(*tlvCodec[T])
+	return codec, ok
+}
+
+// GetTLV returns the value of the first TLV of type t of the header which
+// decodes into a T, with the codec registered for t. It returns false if
+// the header carries no such TLV, or if no codec of T is registered for t,
+// e.g.
+//
+//	authority, ok := proxyproto.GetTLV[string](header, proxyproto.PP2_TYPE_AUTHORITY)
+func GetTLV[T any](header *Header, t PP2Type) (T, bool) {
+	codec, ok := lookupTLVCodec[T](t)
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return decodeTLV(header.rawTLVs, t, codec.decode)
+}
+
+// decodeTLV returns the value of the first TLV of type t of raw which
+// decodes successfully.
+func decodeTLV[T any](raw []byte, t PP2Type, decode TLVDecodeFunc[T]) (T, bool) {
+	for i := 0; i < len(raw); {
+		end, ok := tlvEnd(raw, i)
+		if !ok {
+			break
+		}
+		if PP2Type(raw[i]) == t {
+			if value, err := decode(raw[i+3 : end]); err == nil {
+				return value, true
+			}
+		}
+		i = end
+	}
+	var zero T
+	return zero, false
+}
+
+// NewTLV returns the TLV of type t carrying value, encoded with the codec
+// registered for t. It fails with ErrIncompatibleTLV if no codec of T able
+// to encode is registered for t.
+func NewTLV[T any](t PP2Type, value T) (TLV, error) {
+	codec, ok := lookupTLVCodec[T](t)
+	if !ok || codec.encode == nil {
+		return TLV{}, fmt.Errorf("%w: no encoder of %T for type %#x", ErrIncompatibleTLV, value, byte(t))
+	}
+	raw, err := codec.encode(value)
+	if err != nil {
+		return TLV{}, err
+	}
+	return TLV{Type: t, Value: raw}, nil
+}
+
+func init() {
+	for _, t := range []PP2Type{PP2_TYPE_ALPN, PP2_TYPE_AUTHORITY, PP2_TYPE_NETNS} {
+		RegisterTLVCodec(t, decodeString, encodeString)
+	}
+	RegisterTLVCodec(PP2_TYPE_UNIQUE_ID, decodeBytes, encodeBytes)
+	RegisterTLVCodec(PP2_TYPE_SIGNATURE, decodeBytes, encodeBytes)
+	RegisterTLVCodec(PP2_TYPE_CRC32C, decodeCRC32C, encodeCRC32C)
+	RegisterTLVCodec(PP2_TYPE_TIMESTAMP, decodeTimestamp, encodeTimestamp)
+	RegisterTLVCodec(PP2_TYPE_TCP_INFO, decodeTCPInfo, encodeTCPInfo)
+}
+
+func decodeString(value []byte) (string, error) {
+	return string(value), nil
+}
+
+func encodeString(value string) ([]byte, error) {
+	return []byte(value), nil
+}
+
+func decodeBytes(value []byte) ([]byte, error) {
+	return append([]byte(nil), value...), nil
+}
+
+func encodeBytes(value []byte) ([]byte, error) {
+	return append([]byte(nil), value...), nil
+}
+
+func decodeCRC32C(value []byte) (uint32, error) {
+	if len(value) != 4 {
+		return 0, ErrMalformedTLV
+	}
+	return binary.BigEndian.Uint32(value), nil
+}
+
+func encodeCRC32C(value uint32) ([]byte, error) {
+	return binary.BigEndian.AppendUint32(nil, value), nil
+}
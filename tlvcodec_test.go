@@ -0,0 +1,74 @@
+package proxyproto
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGetTLV(t *testing.T) {
+	ts := time.Unix(1700000000, 42)
+	header := &Header{Version: 2, Command: PROXY, TransportProtocol: TCPv4, SourceAddr: v4addr, DestinationAddr: v4addr}
+	var tlvs []TLV
+	for _, tlv := range []func() (TLV, error){
+		func() (TLV, error) { return NewTLV(PP2_TYPE_AUTHORITY, "example.org") },
+		func() (TLV, error) { return NewTLV(PP2_TYPE_CRC32C, uint32(0xdeadbeef)) },
+		func() (TLV, error) { return NewTLV(PP2_TYPE_TIMESTAMP, ts) },
+	} {
+		tlv, err := tlv()
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		tlvs = append(tlvs, tlv)
+	}
+	// A malformed TLV is skipped in favor of the next one of its type.
+	tlvs = append([]TLV{{Type: PP2_TYPE_CRC32C, Value: []byte{1}}}, tlvs...)
+	if err := header.SetTLVs(tlvs); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if authority, ok := GetTLV[string](header, PP2_TYPE_AUTHORITY); !ok || authority != "example.org" {
+		t.Fatalf("unexpected authority %q, %v", authority, ok)
+	}
+	if crc, ok := GetTLV[uint32](header, PP2_TYPE_CRC32C); !ok || crc != 0xdeadbeef {
+		t.Fatalf("unexpected CRC32C %#x, %v", crc, ok)
+	}
+	if got, ok := GetTLV[time.Time](header, PP2_TYPE_TIMESTAMP); !ok || !got.Equal(ts) {
+		t.Fatalf("unexpected timestamp %v, %v", got, ok)
+	}
+	if _, ok := GetTLV[[]byte](header, PP2_TYPE_AUTHORITY); ok {
+		t.Fatalf("expected a mismatched type not to be found")
+	}
+	if _, ok := GetTLV[string](header, PP2_TYPE_NETNS); ok {
+		t.Fatalf("expected a missing TLV not to be found")
+	}
+	if _, err := NewTLV(PP2_TYPE_AUTHORITY, 42); !errors.Is(err, ErrIncompatibleTLV) {
+		t.Fatalf("expected %v, got %v", ErrIncompatibleTLV, err)
+	}
+}
+
+func TestRegisterTLVCodec(t *testing.T) {
+	const typ PP2Type = 0xF0
+	type point struct{ X, Y byte }
+	RegisterTLVCodec(typ,
+		func(value []byte) (point, error) {
+			if len(value) != 2 {
+				return point{}, ErrMalformedTLV
+			}
+			return point{value[0], value[1]}, nil
+		},
+		func(p point) ([]byte, error) { return []byte{p.X, p.Y}, nil },
+	)
+
+	tlv, err := NewTLV(typ, point{1, 2})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	header := &Header{Version: 2, Command: LOCAL}
+	if err := header.SetTLVs([]TLV{tlv}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if p, ok := GetTLV[point](header, typ); !ok || p != (point{1, 2}) {
+		t.Fatalf("unexpected point %+v, %v", p, ok)
+	}
+}
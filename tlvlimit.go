@@ -0,0 +1,81 @@
+package proxyproto
+
+import (
+	"fmt"
+	"net"
+)
+
+// TLVCountError is returned for headers carrying more TLVs than allowed,
+// see WithMaxTLVCount, wrapped in a ParseError unless their TLV block was
+// deferred by LazyTLVs. It matches ErrTooManyTLVs.
+type TLVCountError struct {
+	// Count is the number of TLVs of the header. TLV blocks deferred by
+	// LazyTLVs are only counted up to the first TLV past the limit.
+	Count int
+	// Max is the number of TLVs allowed.
+	Max int
+}
+
+func (e *TLVCountError) Error() string {
+	return fmt.Sprintf("%v: %d, at most %d allowed", ErrTooManyTLVs, e.Count, e.Max)
+}
+
+// Is makes the error match ErrTooManyTLVs.
+func (e *TLVCountError) Is(target error) bool {
+	return target == ErrTooManyTLVs
+}
+
+// TLVCountFunc receives the number of TLVs of the headers rejected for
+// carrying too many, along with the address of the upstream which sent
+// them, see OnTooManyTLVs.
+type TLVCountFunc func(upstream net.Addr, count int)
+
+// WithMaxTLVCount bounds the number of TLVs of the version 2 headers
+// accepted on the connection, when passed as option to NewConn(). Headers
+// carrying more, e.g. tens of thousands of empty TLVs filling a 64KB
+// header, are rejected with a TLVCountError, so that handlers walking the
+// TLVs don't amplify the cost of a cheap header. The TLVs of a block
+// deferred by LazyTLVs are counted as they're streamed.
+func WithMaxTLVCount(n int) func(*Conn) {
+	return func(c *Conn) {
+		c.parseOptions.maxTLVCount = n
+	}
+}
+
+// OnTooManyTLVs sets the hook notified of the headers rejected by
+// WithMaxTLVCount, when passed as option to NewConn().
+func OnTooManyTLVs(f TLVCountFunc) func(*Conn) {
+	return func(c *Conn) {
+		c.onTooManyTLVs = f
+	}
+}
+
+// notifyTooManyTLVs notifies the OnTooManyTLVs hook, if any, of a header
+// rejected by WithMaxTLVCount.
+func (p *Conn) notifyTooManyTLVs(err *TLVCountError) {
+	if p.onTooManyTLVs != nil {
+		p.onTooManyTLVs(p.conn.RemoteAddr(), err.Count)
+	}
+}
+
+// checkTLVCount makes sure the TLV vector carries at most limit TLVs. The
+// offset in raw of the first TLV past the limit is returned along with the
+// error.
+func checkTLVCount(raw []byte, limit int) (int, *TLVCountError) {
+	var count, offset int
+	for i := 0; i < len(raw); {
+		end, ok := tlvEnd(raw, i)
+		if !ok {
+			break
+		}
+		count++
+		if count == limit+1 {
+			offset = i
+		}
+		i = end
+	}
+	if count <= limit {
+		return 0, nil
+	}
+	return offset, &TLVCountError{Count: count, Max: limit}
+}
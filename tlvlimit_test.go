@@ -0,0 +1,94 @@
+package proxyproto
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func tlvCountHeader(t *testing.T, count int) *Header {
+	t.Helper()
+	header := HeaderProxyFromAddrs(2, v4addr, v4addr)
+	tlvs := make([]TLV, count)
+	for i := range tlvs {
+		tlvs[i] = TLV{Type: PP2_TYPE_MIN_CUSTOM + 1, Value: []byte{byte(i)}}
+	}
+	if err := header.SetTLVs(tlvs); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return header
+}
+
+func TestMaxTLVCount(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		count int
+		lazy  bool
+		fail  bool
+	}{
+		{name: "within", count: 4},
+		{name: "exceeded", count: 5, fail: true},
+		{name: "lazy within", count: 4, lazy: true},
+		{name: "lazy exceeded", count: 5, lazy: true, fail: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			raw, err := tlvCountHeader(t, tc.count).Format()
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			server, client := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+			go func() { _, _ = client.Write(raw) }()
+
+			var notified int
+			opts := []func(*Conn){
+				WithMaxTLVCount(4),
+				OnTooManyTLVs(func(upstream net.Addr, count int) { notified = count }),
+			}
+			if tc.lazy {
+				opts = append(opts, LazyTLVs(1))
+			}
+			conn := NewConn(server, opts...)
+
+			err = conn.HeaderError()
+			if tc.lazy && err == nil {
+				for err == nil {
+					_, _, err = conn.NextDeferredTLV()
+				}
+				if err == io.EOF {
+					err = nil
+				}
+			}
+			if !tc.fail {
+				if err != nil || notified != 0 {
+					t.Fatalf("expected the header to be accepted, got %v", err)
+				}
+				return
+			}
+
+			var countErr *TLVCountError
+			if !errors.Is(err, ErrTooManyTLVs) || !errors.As(err, &countErr) || countErr.Max != 4 {
+				t.Fatalf("expected %v, got %v", ErrTooManyTLVs, err)
+			}
+			if notified != countErr.Count || notified != 5 {
+				t.Fatalf("expected the hook to be notified of %d TLVs, got %d", countErr.Count, notified)
+			}
+			var pe *ParseError
+			if parsed := errors.As(err, &pe); parsed == tc.lazy || (parsed && pe.Reason != ReasonTooManyTLVs) {
+				t.Fatalf("unexpected parse error %v", err)
+			}
+		})
+	}
+}
+
+func TestConfigMaxTLVCount(t *testing.T) {
+	config := &Config{MaxTLVCount: 2}
+	if err := config.checkHeader(tlvCountHeader(t, 2)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := config.checkHeader(tlvCountHeader(t, 3)); !errors.Is(err, ErrTooManyTLVs) {
+		t.Fatalf("expected %v, got %v", ErrTooManyTLVs, err)
+	}
+}
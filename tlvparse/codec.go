@@ -0,0 +1,57 @@
+package tlvparse
+
+import (
+	"encoding/binary"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// Importing this package registers the codecs of the TLVs it parses, so
+// that their values are available through proxyproto.GetTLV:
+//
+//	PP2_TYPE_SSL    PP2SSL
+//	PP2_TYPE_AWS    string, the VPC endpoint ID
+//	PP2_TYPE_AZURE  uint32, the private endpoint LinkID
+//	PP2_TYPE_GCP    uint64, the PSC connection ID
+func init() {
+	proxyproto.RegisterTLVCodec(proxyproto.PP2_TYPE_SSL, decodeSSL, encodeSSL)
+	proxyproto.RegisterTLVCodec(PP2_TYPE_AWS, decodeAWSVPCEndpointID, encodeAWSVPCEndpointID)
+	proxyproto.RegisterTLVCodec(PP2_TYPE_AZURE, decodeAzurePrivateEndpointLinkID, encodeAzurePrivateEndpointLinkID)
+	proxyproto.RegisterTLVCodec(PP2_TYPE_GCP, decodePSCConnectionID, encodePSCConnectionID)
+}
+
+func decodeSSL(value []byte) (PP2SSL, error) {
+	return SSL(proxyproto.TLV{Type: proxyproto.PP2_TYPE_SSL, Value: value})
+}
+
+func encodeSSL(ssl PP2SSL) ([]byte, error) {
+	tlv, err := ssl.Marshal()
+	return tlv.Value, err
+}
+
+func decodeAWSVPCEndpointID(value []byte) (string, error) {
+	return AWSVPCEndpointID(proxyproto.TLV{Type: PP2_TYPE_AWS, Value: value})
+}
+
+func encodeAWSVPCEndpointID(vpce string) ([]byte, error) {
+	if !vpceRe.MatchString(vpce) {
+		return nil, proxyproto.ErrMalformedTLV
+	}
+	return append([]byte{PP2_SUBTYPE_AWS_VPCE_ID}, vpce...), nil
+}
+
+func decodeAzurePrivateEndpointLinkID(value []byte) (uint32, error) {
+	return azurePrivateEndpointLinkID(proxyproto.TLV{Type: PP2_TYPE_AZURE, Value: value})
+}
+
+func encodeAzurePrivateEndpointLinkID(linkID uint32) ([]byte, error) {
+	return binary.LittleEndian.AppendUint32([]byte{PP2_SUBTYPE_AZURE_PRIVATEENDPOINT_LINKID}, linkID), nil
+}
+
+func decodePSCConnectionID(value []byte) (uint64, error) {
+	return pscConnectionID(proxyproto.TLV{Type: PP2_TYPE_GCP, Value: value})
+}
+
+func encodePSCConnectionID(id uint64) ([]byte, error) {
+	return binary.BigEndian.AppendUint64(nil, id), nil
+}
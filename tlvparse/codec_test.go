@@ -0,0 +1,39 @@
+package tlvparse
+
+import (
+	"testing"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func TestRegisteredCodecs(t *testing.T) {
+	var tlvs []proxyproto.TLV
+	for _, tlv := range []func() (proxyproto.TLV, error){
+		func() (proxyproto.TLV, error) { return proxyproto.NewTLV(PP2_TYPE_AWS, "vpce-abc123") },
+		func() (proxyproto.TLV, error) { return proxyproto.NewTLV(PP2_TYPE_AZURE, uint32(42)) },
+		func() (proxyproto.TLV, error) { return proxyproto.NewTLV(PP2_TYPE_GCP, uint64(1<<40)) },
+	} {
+		tlv, err := tlv()
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		tlvs = append(tlvs, tlv)
+	}
+	header := &proxyproto.Header{Version: 2, Command: proxyproto.LOCAL}
+	if err := header.SetTLVs(tlvs); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if vpce, ok := proxyproto.GetTLV[string](header, PP2_TYPE_AWS); !ok || vpce != "vpce-abc123" {
+		t.Fatalf("unexpected VPC endpoint ID %q, %v", vpce, ok)
+	}
+	if linkID, ok := proxyproto.GetTLV[uint32](header, PP2_TYPE_AZURE); !ok || linkID != 42 {
+		t.Fatalf("unexpected link ID %d, %v", linkID, ok)
+	}
+	if id, ok := proxyproto.GetTLV[uint64](header, PP2_TYPE_GCP); !ok || id != 1<<40 {
+		t.Fatalf("unexpected PSC connection ID %d, %v", id, ok)
+	}
+	if FindAWSVPCEndpointID(tlvs) != "vpce-abc123" {
+		t.Fatalf("expected the encoded TLV to be parsed by FindAWSVPCEndpointID")
+	}
+}
@@ -0,0 +1,89 @@
+// Envoy's pass-through of filter state in TLVs, as configured with the rules
+// of its proxy protocol listener filter and the added TLVs of its proxy
+// protocol upstream transport socket
+// https://www.envoyproxy.io/docs/envoy/latest/api-v3/extensions/filters/listener/proxy_protocol/v3/proxy_protocol.proto
+
+package tlvparse
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// EnvoyMetadataNamespace is the default dynamic metadata namespace the proxy
+// protocol listener filter of Envoy stores the TLVs of its rules under.
+const EnvoyMetadataNamespace = "envoy.filters.listener.proxy_protocol"
+
+// ErrUnknownEnvoyKey is returned when encoding a key an EnvoyKeys doesn't map.
+var ErrUnknownEnvoyKey = errors.New("tlvparse: unknown Envoy metadata key")
+
+// EnvoyKeys maps named metadata keys to TLV types, as the rules of the proxy
+// protocol listener filter of Envoy do, e.g. {"tenant_id": 0xE1}. Envoy is
+// most commonly configured with types of the custom application range,
+// PP2_TYPE_MIN_CUSTOM to PP2_TYPE_MAX_CUSTOM, so that both ends of a
+// deployment agree on the meaning of a TLV by name rather than by number.
+type EnvoyKeys map[string]proxyproto.PP2Type
+
+// NewEnvoyKeys returns the mapping of keys to types, failing if a type is
+// mapped more than once, or isn't allowed by the spec for custom TLVs, i.e.
+// isn't an application or experiment type.
+func NewEnvoyKeys(keys map[string]proxyproto.PP2Type) (EnvoyKeys, error) {
+	names := make(map[proxyproto.PP2Type]string, len(keys))
+	for key, t := range keys {
+		if !t.App() && !t.Experiment() {
+			return nil, fmt.Errorf("tlvparse: type %#x of key %q isn't a custom type", byte(t), key)
+		}
+		if other, ok := names[t]; ok {
+			return nil, fmt.Errorf("tlvparse: type %#x mapped by both keys %q and %q", byte(t), key, other)
+		}
+		names[t] = key
+	}
+	return EnvoyKeys(keys), nil
+}
+
+// Get returns the value of the first TLV mapped by the key, and whether there
+// is one.
+func (k EnvoyKeys) Get(tlvs []proxyproto.TLV, key string) ([]byte, bool) {
+	t, ok := k[key]
+	if !ok {
+		return nil, false
+	}
+	for _, tlv := range tlvs {
+		if tlv.Type == t {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Decode returns the values of the TLVs mapped by a key, by key, as the
+// listener filter of Envoy stores them in dynamic metadata. The first TLV of
+// each type wins, TLVs of other types are left out.
+func (k EnvoyKeys) Decode(tlvs []proxyproto.TLV) map[string][]byte {
+	values := make(map[string][]byte)
+	for key := range k {
+		if value, ok := k.Get(tlvs, key); ok {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// Encode returns the TLVs carrying the values by key, ordered by type, as
+// the upstream transport socket of Envoy adds them. It fails with
+// ErrUnknownEnvoyKey for keys not mapped.
+func (k EnvoyKeys) Encode(values map[string][]byte) ([]proxyproto.TLV, error) {
+	tlvs := make([]proxyproto.TLV, 0, len(values))
+	for key, value := range values {
+		t, ok := k[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownEnvoyKey, key)
+		}
+		tlvs = append(tlvs, proxyproto.TLV{Type: t, Value: value})
+	}
+	sort.Slice(tlvs, func(i, j int) bool { return tlvs[i].Type < tlvs[j].Type })
+	return tlvs, nil
+}
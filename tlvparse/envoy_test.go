@@ -0,0 +1,63 @@
+package tlvparse
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func TestEnvoyKeys(t *testing.T) {
+	keys, err := NewEnvoyKeys(map[string]proxyproto.PP2Type{
+		"tenant_id": 0xE1,
+		"region":    0xE0,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	tlvs, err := keys.Encode(map[string][]byte{
+		"tenant_id": []byte("acme"),
+		"region":    []byte("eu-west-1"),
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := []proxyproto.TLV{
+		{Type: 0xE0, Value: []byte("eu-west-1")},
+		{Type: 0xE1, Value: []byte("acme")},
+	}
+	if !reflect.DeepEqual(tlvs, expected) {
+		t.Fatalf("expected %v, got %v", expected, tlvs)
+	}
+
+	header := &proxyproto.Header{Version: 2, Command: proxyproto.LOCAL}
+	if err := header.SetTLVs(append(tlvs, proxyproto.TLV{Type: proxyproto.PP2_TYPE_ALPN, Value: []byte("h2")})); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	received, err := header.TLVs()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if value, ok := keys.Get(received, "tenant_id"); !ok || string(value) != "acme" {
+		t.Fatalf("unexpected tenant_id %q", value)
+	}
+	values := keys.Decode(received)
+	if len(values) != 2 || string(values["region"]) != "eu-west-1" {
+		t.Fatalf("unexpected values %q", values)
+	}
+
+	if _, err := keys.Encode(map[string][]byte{"unknown": nil}); !errors.Is(err, ErrUnknownEnvoyKey) {
+		t.Fatalf("expected %v, got %v", ErrUnknownEnvoyKey, err)
+	}
+}
+
+func TestNewEnvoyKeysInvalid(t *testing.T) {
+	if _, err := NewEnvoyKeys(map[string]proxyproto.PP2Type{"a": 0xE0, "b": 0xE0}); err == nil {
+		t.Fatal("expected an error for a type mapped twice")
+	}
+	if _, err := NewEnvoyKeys(map[string]proxyproto.PP2Type{"a": proxyproto.PP2_TYPE_ALPN}); err == nil {
+		t.Fatal("expected an error for a registered type")
+	}
+}
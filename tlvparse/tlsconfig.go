@@ -0,0 +1,81 @@
+package tlvparse
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// ErrClientCertNotVerified is returned by RequireVerifiedClientCert when the
+// edge didn't verify a client certificate.
+var ErrClientCertNotVerified = errors.New("tlvparse: client certificate not verified by the edge")
+
+// SSLPolicy decides whether a TLS connection is acceptable given the SSL TLV
+// forwarded by the edge, and whether the header carried one at all. It
+// returns an error to abort the handshake. It bridges the TLS decisions of
+// the edge into the TLS policy of the backend.
+type SSLPolicy func(ssl PP2SSL, found bool) error
+
+// RequireVerifiedClientCert is an SSLPolicy requiring that the client
+// connected to the edge over TLS with a certificate the edge verified.
+func RequireVerifiedClientCert(ssl PP2SSL, found bool) error {
+	if !found || !ssl.ClientSSL() || !(ssl.ClientCertConn() || ssl.ClientCertSess()) || !ssl.Verified() {
+		return ErrClientCertNotVerified
+	}
+	return nil
+}
+
+// VerifyConnection returns a tls.Config VerifyConnection hook applying the
+// policy to the SSL TLV of the PROXY header received on conn. The conn is
+// the one the TLS connection is built upon, e.g. a *proxyproto.Conn.
+// Connections without a header are treated as carrying no SSL TLV.
+func VerifyConnection(conn net.Conn, policy SSLPolicy) func(tls.ConnectionState) error {
+	return func(tls.ConnectionState) error {
+		ssl, found := findConnSSL(conn)
+		return policy(ssl, found)
+	}
+}
+
+// GetConfigForClient returns a tls.Config GetConfigForClient hook returning
+// a copy of config whose VerifyConnection hook also applies the policy to
+// the SSL TLV of the connection, see VerifyConnection. The VerifyConnection
+// hook of config, if any, is called first.
+//
+// Set it on the tls.Config of a TLS listener wrapping a proxyproto.Listener.
+func GetConfigForClient(config *tls.Config, policy SSLPolicy) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		c := config.Clone()
+		c.GetConfigForClient = nil
+		verify := VerifyConnection(hello.Conn, policy)
+		if next := config.VerifyConnection; next != nil {
+			c.VerifyConnection = func(cs tls.ConnectionState) error {
+				if err := next(cs); err != nil {
+					return err
+				}
+				return verify(cs)
+			}
+		} else {
+			c.VerifyConnection = verify
+		}
+		return c, nil
+	}
+}
+
+// findConnSSL returns the SSL TLV of the header received on conn, if any.
+func findConnSSL(conn net.Conn) (PP2SSL, bool) {
+	c, ok := conn.(interface{ ProxyHeader() *proxyproto.Header })
+	if !ok {
+		return PP2SSL{}, false
+	}
+	header := c.ProxyHeader()
+	if header == nil {
+		return PP2SSL{}, false
+	}
+	tlvs, err := header.TLVs()
+	if err != nil {
+		return PP2SSL{}, false
+	}
+	return FindSSL(tlvs)
+}
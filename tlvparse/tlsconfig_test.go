@@ -0,0 +1,86 @@
+package tlvparse
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/pires/go-proxyproto"
+	"github.com/pires/go-proxyproto/proxyprototest"
+)
+
+func sslHeader(t *testing.T, ssl PP2SSL) *proxyproto.Header {
+	ssl.TLV = []proxyproto.TLV{{Type: proxyproto.PP2_SUBTYPE_SSL_VERSION, Value: []byte("TLSv1.3")}}
+	tlv, err := ssl.Marshal()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	header := proxyproto.HeaderProxyFromAddrs(2,
+		&net.TCPAddr{IP: net.ParseIP("10.1.1.1"), Port: 1000},
+		&net.TCPAddr{IP: net.ParseIP("20.2.2.2"), Port: 2000})
+	if err := header.SetTLVs([]proxyproto.TLV{tlv}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return header
+}
+
+func TestVerifyConnection(t *testing.T) {
+	verified := PP2SSL{Client: PP2_BITFIELD_CLIENT_SSL | PP2_BITFIELD_CLIENT_CERT_CONN}
+	tests := []struct {
+		name   string
+		header *proxyproto.Header
+		err    error
+	}{
+		{"verified", sslHeader(t, verified), nil},
+		{"not verified", sslHeader(t, PP2SSL{Client: verified.Client, Verify: 1}), ErrClientCertNotVerified},
+		{"no certificate", sslHeader(t, PP2SSL{Client: PP2_BITFIELD_CLIENT_SSL}), ErrClientCertNotVerified},
+		{"no SSL TLV", proxyproto.HeaderProxyFromAddrs(2, &net.TCPAddr{}, &net.TCPAddr{}), ErrClientCertNotVerified},
+		{"no header", nil, ErrClientCertNotVerified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := proxyprototest.Pipe(tt.header)
+			defer server.Close()
+			defer client.Close()
+
+			verify := VerifyConnection(server, RequireVerifiedClientCert)
+			if err := verify(tls.ConnectionState{}); !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, actual %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestGetConfigForClient(t *testing.T) {
+	errBase := errors.New("base")
+	base := &tls.Config{
+		ServerName:       "example.com",
+		VerifyConnection: func(tls.ConnectionState) error { return errBase },
+	}
+	getConfig := GetConfigForClient(base, RequireVerifiedClientCert)
+
+	server, client := proxyprototest.Pipe(sslHeader(t, PP2SSL{Client: PP2_BITFIELD_CLIENT_SSL}))
+	defer server.Close()
+	defer client.Close()
+
+	config, err := getConfig(&tls.ClientHelloInfo{Conn: server})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if config == base || config.ServerName != base.ServerName {
+		t.Fatalf("expected a copy of the base config")
+	}
+	if err := config.VerifyConnection(tls.ConnectionState{}); err != errBase {
+		t.Fatalf("expected the base hook to be called first, got %v", err)
+	}
+
+	base.VerifyConnection = nil
+	config, err = GetConfigForClient(base, RequireVerifiedClientCert)(&tls.ClientHelloInfo{Conn: server})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := config.VerifyConnection(tls.ConnectionState{}); err != ErrClientCertNotVerified {
+		t.Fatalf("expected %v, actual %v", ErrClientCertNotVerified, err)
+	}
+}
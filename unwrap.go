@@ -0,0 +1,62 @@
+package proxyproto
+
+import "net"
+
+// Unwrap returns the wrapped listener, so that middleware stacks can reach
+// the layers below.
+func (p *Listener) Unwrap() net.Listener {
+	return p.Listener
+}
+
+// Unwrap returns the wrapped connection, so that middleware stacks can reach
+// the layers below. It's equivalent to Raw.
+func (p *Conn) Unwrap() net.Conn {
+	return p.conn
+}
+
+// Unwrap returns the wrapped connection, so that middleware stacks can reach
+// the layers below. It's equivalent to Raw.
+func (c *ClientConn) Unwrap() net.Conn {
+	return c.conn
+}
+
+// AsConn walks the chain of wrappers of conn, down to the first
+// *proxyproto.Conn. The wrappers are followed through their Unwrap() net.Conn
+// method, or their NetConn() net.Conn one, as implemented by *tls.Conn, and
+// the connections returned by PreserveInterfaces are recognized. This
+// lets code handed a connection wrapped by TLS, logging or rate limiting
+// middleware reach the PROXY header.
+func AsConn(conn net.Conn) (*Conn, bool) {
+	for conn != nil {
+		switch c := conn.(type) {
+		case *Conn:
+			return c, true
+		case interface{ ProxyConn() *Conn }:
+			return c.ProxyConn(), true
+		case interface{ Unwrap() net.Conn }:
+			conn = c.Unwrap()
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// AsListener walks the chain of wrappers of l, down to the first
+// *proxyproto.Listener. The wrappers are followed through their
+// Unwrap() net.Listener method.
+func AsListener(l net.Listener) (*Listener, bool) {
+	for l != nil {
+		switch ll := l.(type) {
+		case *Listener:
+			return ll, true
+		case interface{ Unwrap() net.Listener }:
+			l = ll.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
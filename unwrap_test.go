@@ -0,0 +1,66 @@
+package proxyproto
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+)
+
+type middlewareConn struct{ net.Conn }
+
+func (c *middlewareConn) Unwrap() net.Conn { return c.Conn }
+
+type middlewareListener struct{ net.Listener }
+
+func (l *middlewareListener) Unwrap() net.Listener { return l.Listener }
+
+func TestAsConn(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	conn := NewConn(server)
+	if conn.Unwrap() != server {
+		t.Fatal("expected Unwrap to return the wrapped connection")
+	}
+
+	wrapped := tls.Server(&middlewareConn{conn}, &tls.Config{})
+	got, ok := AsConn(wrapped)
+	if !ok || got != conn {
+		t.Fatalf("expected to reach the proxyproto connection, got %v, %v", got, ok)
+	}
+
+	if _, ok := AsConn(&middlewareConn{server}); ok {
+		t.Fatal("expected no proxyproto connection")
+	}
+}
+
+func TestAsListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer l.Close()
+
+	pl := &Listener{Listener: l}
+	if pl.Unwrap() != l {
+		t.Fatal("expected Unwrap to return the wrapped listener")
+	}
+	if got, ok := AsListener(&middlewareListener{pl}); !ok || got != pl {
+		t.Fatalf("expected to reach the proxyproto listener, got %v, %v", got, ok)
+	}
+	if _, ok := AsListener(l); ok {
+		t.Fatal("expected no proxyproto listener")
+	}
+}
+
+func TestAsConnPreserveInterfaces(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	conn := NewConn(server)
+	if got, ok := AsConn(PreserveInterfaces(conn)); !ok || got != conn {
+		t.Fatalf("expected to reach the proxyproto connection, got %v, %v", got, ok)
+	}
+}
@@ -15,15 +15,31 @@ const (
 	separator = " "
 )
 
-func initVersion1() *Header {
-	header := new(Header)
+// ZonePolicy tells how IPv6 addresses with a zone, e.g. fe80::1%eth0, are
+// handled in version 1 headers. The spec doesn't allow zones, yet some
+// proxies emit them for link-local addresses.
+type ZonePolicy int
+
+const (
+	// ZoneStrip accepts zoned addresses and drops their zone.
+	ZoneStrip ZonePolicy = iota
+	// ZoneReject rejects zoned addresses with ErrInvalidAddress.
+	ZoneReject
+	// ZoneKeep accepts zoned addresses and keeps their zone in the Zone
+	// field of the header addresses. Zones are never written out, as
+	// neither version of the protocol can carry them.
+	ZoneKeep
+)
+
+func initVersion1(opts parseOptions) *Header {
+	header := opts.newHeader()
 	header.Version = 1
 	// Command doesn't exist in v1
 	header.Command = PROXY
 	return header
 }
 
-func parseVersion1(reader *bufio.Reader) (*Header, error) {
+func parseVersion1(reader *bufio.Reader, opts parseOptions) (*Header, error) {
 	//The header cannot be more than 107 bytes long. Per spec:
 	//
 	//   (...)
@@ -71,7 +87,7 @@ func parseVersion1(reader *bufio.Reader) (*Header, error) {
 	for {
 		b, err := reader.ReadByte()
 		if err != nil {
-			return nil, fmt.Errorf(ErrCantReadVersion1Header.Error()+": %v", err)
+			return nil, parseError(1, len(buf), truncated(fmt.Errorf("%w: %w", ErrCantReadVersion1Header, err), err))
 		}
 		buf = append(buf, b)
 		if b == '\n' {
@@ -80,19 +96,22 @@ func parseVersion1(reader *bufio.Reader) (*Header, error) {
 		}
 		if len(buf) == 107 {
 			// No delimiter in first 107 bytes
-			return nil, ErrVersion1HeaderTooLong
+			return nil, parseError(1, len(buf), ErrVersion1HeaderTooLong)
+		}
+		if len(buf) == opts.maxHeaderSize {
+			return nil, parseError(1, len(buf), ErrHeaderTooLarge)
 		}
 		if reader.Buffered() == 0 {
 			// Header was not buffered in a single read. Since we can't
 			// differentiate between genuine slow writers and DoS agents,
 			// we abort. On healthy networks, this should never happen.
-			return nil, ErrCantReadVersion1Header
+			return nil, parseError(1, len(buf), ErrCantReadVersion1Header)
 		}
 	}
 
 	// Check for CR before LF.
 	if len(buf) < 2 || buf[len(buf)-2] != '\r' {
-		return nil, ErrLineMustEndWithCrlf
+		return nil, parseError(1, len(buf)-1, ErrLineMustEndWithCrlf)
 	}
 
 	// Check full signature.
@@ -100,7 +119,7 @@ func parseVersion1(reader *bufio.Reader) (*Header, error) {
 
 	// Expect at least 2 tokens: "PROXY" and the transport protocol.
 	if len(tokens) < 2 {
-		return nil, ErrCantReadAddressFamilyAndProtocol
+		return nil, parseError(1, len(buf)-2, ErrCantReadAddressFamilyAndProtocol)
 	}
 
 	// Read address family and protocol
@@ -113,22 +132,27 @@ func parseVersion1(reader *bufio.Reader) (*Header, error) {
 	case "UNKNOWN":
 		transportProtocol = UNSPEC // doesn't exist in v1 but fits UNKNOWN
 	default:
-		return nil, ErrCantReadAddressFamilyAndProtocol
+		return nil, parseError(1, tokenOffset(tokens, 1), ErrCantReadAddressFamilyAndProtocol)
 	}
 
 	// Expect 6 tokens only when UNKNOWN is not present.
 	if transportProtocol != UNSPEC && len(tokens) < 6 {
-		return nil, ErrCantReadAddressFamilyAndProtocol
+		return nil, parseError(1, len(buf)-2, ErrCantReadAddressFamilyAndProtocol)
 	}
 
 	// When a signature is found, allocate a v1 header with Command set to PROXY.
 	// Command doesn't exist in v1 but set it for other parts of this library
 	// to rely on it for determining connection details.
-	header := initVersion1()
+	header := initVersion1(opts)
+	header.size = len(buf)
 
 	// Transport protocol has been processed already.
 	header.TransportProtocol = transportProtocol
 
+	if opts.retainRaw {
+		header.raw = buf
+	}
+
 	// When UNKNOWN, set the command to LOCAL and return early
 	if header.TransportProtocol == UNSPEC {
 		header.Command = LOCAL
@@ -136,29 +160,30 @@ func parseVersion1(reader *bufio.Reader) (*Header, error) {
 	}
 
 	// Otherwise, continue to read addresses and ports
-	sourceIP, err := parseV1IPAddress(header.TransportProtocol, tokens[2])
+	sourceIP, sourceZone, err := parseV1IPAddress(header.TransportProtocol, tokens[2], opts.zones)
 	if err != nil {
-		return nil, err
+		return nil, parseError(1, tokenOffset(tokens, 2), err)
 	}
-	destIP, err := parseV1IPAddress(header.TransportProtocol, tokens[3])
+	destIP, destZone, err := parseV1IPAddress(header.TransportProtocol, tokens[3], opts.zones)
 	if err != nil {
-		return nil, err
+		return nil, parseError(1, tokenOffset(tokens, 3), err)
 	}
 	sourcePort, err := parseV1PortNumber(tokens[4])
 	if err != nil {
-		return nil, err
+		return nil, parseError(1, tokenOffset(tokens, 4), err)
 	}
 	destPort, err := parseV1PortNumber(tokens[5])
 	if err != nil {
-		return nil, err
+		return nil, parseError(1, tokenOffset(tokens, 5), err)
 	}
-	header.SourceAddr = &net.TCPAddr{
-		IP:   sourceIP,
-		Port: sourcePort,
+	header.SourceAddr = opts.ipAddr(0, header.TransportProtocol, sourceIP, uint16(sourcePort))
+	header.DestinationAddr = opts.ipAddr(1, header.TransportProtocol, destIP, uint16(destPort))
+	if opts.zones == ZoneKeep {
+		header.SourceAddr.(*net.TCPAddr).Zone = sourceZone
+		header.DestinationAddr.(*net.TCPAddr).Zone = destZone
 	}
-	header.DestinationAddr = &net.TCPAddr{
-		IP:   destIP,
-		Port: destPort,
+	if opts.warnings && len(tokens) > 6 {
+		header.warnings = append(header.warnings, ErrVersion1TrailingFields)
 	}
 
 	return header, nil
@@ -214,6 +239,15 @@ func (header *Header) formatVersion1() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// tokenOffset returns the offset in the header of the i-th token.
+func tokenOffset(tokens []string, i int) int {
+	offset := 0
+	for _, token := range tokens[:i] {
+		offset += len(token) + len(separator)
+	}
+	return offset
+}
+
 func parseV1PortNumber(portStr string) (int, error) {
 	port, err := strconv.Atoi(portStr)
 	if err != nil || port < 0 || port > 65535 {
@@ -222,22 +256,27 @@ func parseV1PortNumber(portStr string) (int, error) {
 	return port, nil
 }
 
-func parseV1IPAddress(protocol AddressFamilyAndProtocol, addrStr string) (net.IP, error) {
+func parseV1IPAddress(protocol AddressFamilyAndProtocol, addrStr string, zones ZonePolicy) (net.IP, string, error) {
 	addr, err := netip.ParseAddr(addrStr)
 	if err != nil {
-		return nil, ErrInvalidAddress
+		return nil, "", ErrInvalidAddress
+	}
+
+	zone := addr.Zone()
+	if zone != "" && zones == ZoneReject {
+		return nil, "", ErrInvalidAddress
 	}
 
 	switch protocol {
 	case TCPv4:
 		if addr.Is4() {
-			return net.IP(addr.AsSlice()), nil
+			return net.IP(addr.AsSlice()), "", nil
 		}
 	case TCPv6:
 		if addr.Is6() || addr.Is4In6() {
-			return net.IP(addr.AsSlice()), nil
+			return net.IP(addr.AsSlice()), zone, nil
 		}
 	}
 
-	return nil, ErrInvalidAddress
+	return nil, "", ErrInvalidAddress
 }
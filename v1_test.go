@@ -105,7 +105,7 @@ var invalidParseV1Tests = []struct {
 func TestReadV1Invalid(t *testing.T) {
 	for _, tt := range invalidParseV1Tests {
 		t.Run(tt.desc, func(t *testing.T) {
-			if _, err := Read(tt.reader); err != tt.expectedError {
+			if _, err := Read(tt.reader); !errors.Is(err, tt.expectedError) {
 				t.Fatalf("expected %s, actual %v", tt.expectedError, err)
 			}
 		})
@@ -193,6 +193,51 @@ func TestParseV1Valid(t *testing.T) {
 	}
 }
 
+func TestParseV1Zones(t *testing.T) {
+	const fixture = "PROXY TCP6 fe80::1%eth0 fe80::2 1000 2000" + crlf
+
+	var cases = []struct {
+		name       string
+		zones      ZonePolicy
+		err        error
+		sourceZone string
+	}{
+		{"strip", ZoneStrip, nil, ""},
+		{"reject", ZoneReject, ErrInvalidAddress, ""},
+		{"keep", ZoneKeep, nil, "eth0"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(fixture))
+			header, err := read(reader, parseOptions{zones: tc.zones})
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if err != nil {
+				return
+			}
+
+			sourceAddr := header.SourceAddr.(*net.TCPAddr)
+			if !sourceAddr.IP.Equal(net.ParseIP("fe80::1")) || sourceAddr.Zone != tc.sourceZone {
+				t.Fatalf("unexpected source address %v", sourceAddr)
+			}
+			if zone := header.DestinationAddr.(*net.TCPAddr).Zone; zone != "" {
+				t.Fatalf("unexpected destination zone %q", zone)
+			}
+
+			// Zones are never written out.
+			buf, err := header.Format()
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if string(buf) != "PROXY TCP6 fe80::1 fe80::2 1000 2000"+crlf {
+				t.Fatalf("unexpected header %q", buf)
+			}
+		})
+	}
+}
+
 func TestWriteV1Valid(t *testing.T) {
 	for _, tt := range validParseAndWriteV1Tests {
 		if tt.skipWrite {
@@ -247,7 +292,7 @@ func TestParseVersion1Overflow(t *testing.T) {
 	reader := bufio.NewReader(ds)
 	bufSize := reader.Size()
 	ds.NBytes = bufSize * 16
-	_, _ = parseVersion1(reader)
+	_, _ = parseVersion1(reader, parseOptions{})
 	if ds.NRead > bufSize {
 		t.Fatalf("read: expected max %d bytes, actual %d\n", bufSize, ds.NRead)
 	}
@@ -60,82 +60,120 @@ type _addrUnix struct {
 	Dst [108]byte
 }
 
-func parseVersion2(reader *bufio.Reader) (header *Header, err error) {
+func parseVersion2(reader *bufio.Reader, opts parseOptions) (header *Header, err error) {
 	// Skip first 12 bytes (signature)
 	for i := 0; i < 12; i++ {
 		if _, err = reader.ReadByte(); err != nil {
-			return nil, ErrCantReadProtocolVersionAndCommand
+			return nil, parseError(2, i, truncated(ErrCantReadProtocolVersionAndCommand, err))
 		}
 	}
 
-	header = new(Header)
+	header = opts.newHeader()
 	header.Version = 2
 
 	// Read the 13th byte, protocol version and command
 	b13, err := reader.ReadByte()
 	if err != nil {
-		return nil, ErrCantReadProtocolVersionAndCommand
+		return nil, parseError(2, 12, truncated(ErrCantReadProtocolVersionAndCommand, err))
 	}
 	header.Command = ProtocolVersionAndCommand(b13)
 	if _, ok := supportedCommand[header.Command]; !ok {
-		return nil, ErrUnsupportedProtocolVersionAndCommand
+		return nil, parseError(2, 12, ErrUnsupportedProtocolVersionAndCommand)
 	}
 
 	// Read the 14th byte, address family and protocol
 	b14, err := reader.ReadByte()
 	if err != nil {
-		return nil, ErrCantReadAddressFamilyAndProtocol
+		return nil, parseError(2, 13, truncated(ErrCantReadAddressFamilyAndProtocol, err))
 	}
 	header.TransportProtocol = AddressFamilyAndProtocol(b14)
 	// UNSPEC is only supported when LOCAL is set.
 	if header.TransportProtocol == UNSPEC && header.Command != LOCAL {
-		return nil, ErrUnsupportedAddressFamilyAndProtocol
+		return nil, parseError(2, 13, ErrUnsupportedAddressFamilyAndProtocol)
 	}
 
 	// Make sure there are bytes available as specified in length
 	var length uint16
 	if err := binary.Read(io.LimitReader(reader, 2), binary.BigEndian, &length); err != nil {
-		return nil, ErrCantReadLength
+		return nil, parseError(2, 14, truncated(ErrCantReadLength, err))
 	}
 	if !header.validateLength(length) {
-		return nil, ErrInvalidLength
+		return nil, parseError(2, 14, ErrInvalidLength)
 	}
+	if opts.maxHeaderSize > 0 && 16+int(length) > opts.maxHeaderSize {
+		return nil, parseError(2, 14, ErrHeaderTooLarge)
+	}
+	header.size = 16 + int(length)
 
 	// Return early if the length is zero, which means that
 	// there's no address information and TLVs present for UNSPEC.
 	if length == 0 {
+		if opts.retainRaw {
+			header.raw = formatVersion2Raw(b13, b14, length, nil)
+		}
 		return header, nil
 	}
 
-	if _, err := reader.Peek(int(length)); err != nil {
-		return nil, ErrInvalidLength
+	// Leave a large TLV block unread, so that it's neither buffered nor
+	// bounded by the buffer, see LazyTLVs.
+	if opts.lazyTLVs > 0 && !opts.retainRaw && header.TransportProtocol.isKnown() {
+		addrLen, _ := header.TransportProtocol.addrLen()
+		if tlvLen := int(length - addrLen); tlvLen > opts.lazyTLVs {
+			header.deferredTLVs = tlvLen
+			length = addrLen
+		}
+	}
+
+	payload, err := reader.Peek(int(length))
+	if err != nil {
+		return nil, parseError(2, 16+reader.Buffered(), truncated(ErrInvalidLength, err))
+	}
+	if opts.retainRaw {
+		header.raw = formatVersion2Raw(b13, b14, length, payload)
 	}
 
 	// Length-limited reader for payload section
 	payloadReader := io.LimitReader(reader, int64(length)).(*io.LimitedReader)
 
-	// Read addresses and ports for protocols other than UNSPEC.
-	// Ignore address information for UNSPEC, and skip straight to read TLVs,
-	// since the length is greater than zero.
-	if header.TransportProtocol != UNSPEC {
+	// Keep the address block of an unknown address family or transport
+	// protocol as is. When the family is known, the TLVs following the block
+	// can still be told apart, e.g. those of LOCAL health checks. Otherwise,
+	// the block can't be told apart from the TLVs, so the whole payload is
+	// kept.
+	if !header.TransportProtocol.isKnown() {
+		addrLen, ok := header.TransportProtocol.addrLen()
+		if !ok || int64(addrLen) > payloadReader.N {
+			addrLen = uint16(payloadReader.N)
+		}
+		header.rawAddresses = make([]byte, addrLen)
+		if _, err = io.ReadFull(payloadReader, header.rawAddresses); err != nil {
+			return nil, parseError(2, 16, err)
+		}
+		if payloadReader.N == 0 {
+			return header, nil
+		}
+	} else if header.TransportProtocol != UNSPEC {
+		// Read addresses and ports for protocols other than UNSPEC.
+		// Ignore address information for UNSPEC, and skip straight to read TLVs,
+		// since the length is greater than zero.
 		if header.TransportProtocol.IsIPv4() {
 			var addr _addr4
 			if err := binary.Read(payloadReader, binary.BigEndian, &addr); err != nil {
-				return nil, ErrInvalidAddress
+				return nil, parseError(2, 16, ErrInvalidAddress)
 			}
-			header.SourceAddr = newIPAddr(header.TransportProtocol, addr.Src[:], addr.SrcPort)
-			header.DestinationAddr = newIPAddr(header.TransportProtocol, addr.Dst[:], addr.DstPort)
+			header.SourceAddr = opts.ipAddr(0, header.TransportProtocol, addr.Src[:], addr.SrcPort)
+			header.DestinationAddr = opts.ipAddr(1, header.TransportProtocol, addr.Dst[:], addr.DstPort)
 		} else if header.TransportProtocol.IsIPv6() {
 			var addr _addr6
 			if err := binary.Read(payloadReader, binary.BigEndian, &addr); err != nil {
-				return nil, ErrInvalidAddress
+				return nil, parseError(2, 16, ErrInvalidAddress)
 			}
-			header.SourceAddr = newIPAddr(header.TransportProtocol, addr.Src[:], addr.SrcPort)
-			header.DestinationAddr = newIPAddr(header.TransportProtocol, addr.Dst[:], addr.DstPort)
+			header.SourceAddr = opts.ipAddr(0, header.TransportProtocol, addr.Src[:], addr.SrcPort)
+			header.DestinationAddr = opts.ipAddr(1, header.TransportProtocol, addr.Dst[:], addr.DstPort)
 		} else if header.TransportProtocol.IsUnix() {
 			var addr _addrUnix
 			if err := binary.Read(payloadReader, binary.BigEndian, &addr); err != nil {
-				return nil, ErrInvalidAddress
+				return nil, parseError(2, 16, ErrInvalidAddress)
 			}
 
 			network := "unix"
@@ -155,9 +193,21 @@ func parseVersion2(reader *bufio.Reader) (header *Header, err error) {
 	}
 
 	// Copy bytes for optional Type-Length-Value vector
-	header.rawTLVs = make([]byte, payloadReader.N) // Allocate minimum size slice
+	if opts.reuse != nil && int64(cap(header.rawTLVs)) >= payloadReader.N {
+		header.rawTLVs = header.rawTLVs[:payloadReader.N]
+	} else {
+		header.rawTLVs = make([]byte, payloadReader.N) // Allocate minimum size slice
+	}
 	if _, err = io.ReadFull(payloadReader, header.rawTLVs); err != nil && err != io.EOF {
-		return nil, err
+		return nil, parseError(2, 16+int(length)-len(header.rawTLVs), err)
+	}
+	if opts.skipMalformedTLVs && len(header.rawTLVs) > 0 {
+		header.rawTLVs, header.warnings = skipMalformedTLVs(header.rawTLVs)
+	}
+	if opts.maxTLVCount > 0 {
+		if offset, err := checkTLVCount(header.rawTLVs, opts.maxTLVCount); err != nil {
+			return nil, parseError(2, 16+int(length)-len(header.rawTLVs)+offset, err)
+		}
 	}
 
 	return header, nil
@@ -167,15 +217,26 @@ func (header *Header) formatVersion2() ([]byte, error) {
 	var buf bytes.Buffer
 	buf.Write(SIGV2)
 	buf.WriteByte(header.Command.toByte())
-	buf.WriteByte(header.TransportProtocol.toByte())
-	if header.TransportProtocol.IsUnspec() {
+	if header.rawAddresses != nil {
+		// Pass through an address block which couldn't be interpreted, along
+		// with its original address family and protocol
+		buf.WriteByte(byte(header.TransportProtocol))
+		hdrLen, err := addTLVLen(lengthUnspecBytes, len(header.rawAddresses)+len(header.rawTLVs))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(hdrLen)
+		buf.Write(header.rawAddresses)
+	} else if header.TransportProtocol.IsUnspec() {
 		// For UNSPEC, write no addresses and ports but only TLVs if they are present
+		buf.WriteByte(header.TransportProtocol.toByte())
 		hdrLen, err := addTLVLen(lengthUnspecBytes, len(header.rawTLVs))
 		if err != nil {
 			return nil, err
 		}
 		buf.Write(hdrLen)
 	} else {
+		buf.WriteByte(header.TransportProtocol.toByte())
 		var addrSrc, addrDst []byte
 		if header.TransportProtocol.IsIPv4() {
 			hdrLen, err := addTLVLen(lengthV4Bytes, len(header.rawTLVs))
@@ -229,7 +290,38 @@ func (header *Header) formatVersion2() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// formatVersion2Raw reassembles the bytes of a version 2 header from its
+// already consumed fixed part and its payload.
+func formatVersion2Raw(b13, b14 byte, length uint16, payload []byte) []byte {
+	raw := make([]byte, 0, 16+len(payload))
+	raw = append(raw, SIGV2...)
+	raw = append(raw, b13, b14)
+	raw = binary.BigEndian.AppendUint16(raw, length)
+	return append(raw, payload...)
+}
+
+// addrLen returns the length of the address block of the address family,
+// whatever the transport protocol, and whether the family is known.
+func (ap AddressFamilyAndProtocol) addrLen() (uint16, bool) {
+	switch ap & 0xF0 {
+	case 0x00:
+		return lengthUnspec, true
+	case 0x10:
+		return lengthV4, true
+	case 0x20:
+		return lengthV6, true
+	case 0x30:
+		return lengthUnix, true
+	}
+	return 0, false
+}
+
 func (header *Header) validateLength(length uint16) bool {
+	if !header.TransportProtocol.isKnown() {
+		// Addresses of unknown families are only acceptable when they are
+		// to be ignored anyway.
+		return header.Command.IsLocal()
+	}
 	if header.TransportProtocol.IsIPv4() {
 		return length >= lengthV4
 	} else if header.TransportProtocol.IsIPv6() {
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	iorand "crypto/rand"
 	"encoding/binary"
+	"errors"
 	"math/rand"
 	"reflect"
 	"testing"
@@ -153,7 +154,7 @@ var invalidParseV2Tests = []struct {
 func TestParseV2Invalid(t *testing.T) {
 	for _, tt := range invalidParseV2Tests {
 		t.Run(tt.desc, func(t *testing.T) {
-			if _, err := Read(tt.reader); err != tt.expectedError {
+			if _, err := Read(tt.reader); !errors.Is(err, tt.expectedError) {
 				t.Fatalf("expected %s, actual %s", tt.expectedError, err.Error())
 			}
 		})
@@ -520,3 +521,91 @@ func fixtureWithTLV(cur []byte, addr []byte, tlv []byte) []byte {
 
 	return append(append(tlen, addr...), tlv...)
 }
+
+func TestParseV2RawAddresses(t *testing.T) {
+	unknownFamily := AddressFamilyAndProtocol(0x41)
+	addresses := []byte{0x01, 0x02, 0x03, 0x04, 0x05}
+	raw := append(append(append(SIGV2, byte(LOCAL), byte(unknownFamily)), 0x00, byte(len(addresses))), addresses...)
+
+	header, err := Read(newBufioReader(append(raw, arbitraryTailBytes...)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if header.TransportProtocol != unknownFamily {
+		t.Fatalf("expected transport protocol %#x, got %#x", unknownFamily, header.TransportProtocol)
+	}
+	if !bytes.Equal(header.RawAddresses(), addresses) {
+		t.Fatalf("expected raw addresses %v, got %v", addresses, header.RawAddresses())
+	}
+	if header.SourceAddr != nil || header.DestinationAddr != nil {
+		t.Fatal("expected no interpreted addresses")
+	}
+
+	formatted, err := header.Format()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(formatted, raw) {
+		t.Fatalf("expected formatted header %v, got %v", raw, formatted)
+	}
+
+	// Addresses of unknown families can't be trusted for PROXY.
+	raw[12] = byte(PROXY)
+	if _, err := Read(newBufioReader(raw)); !errors.Is(err, ErrInvalidLength) {
+		t.Fatalf("expected %v, got %v", ErrInvalidLength, err)
+	}
+}
+
+func TestParseV2LocalUnknownTransportTLVs(t *testing.T) {
+	// AF_INET with an unspecified transport protocol, as sent by some
+	// health checkers.
+	inetUnspec := AddressFamilyAndProtocol(0x10)
+	addresses := append(append([]byte{}, addressesIPv4...), 0x03, 0xe8, 0x07, 0xd0)
+	tlv := []byte{byte(PP2_TYPE_UNIQUE_ID), 0x00, 0x02, 'i', 'd'}
+	raw := append(append(append(SIGV2, byte(LOCAL), byte(inetUnspec)), 0x00, byte(len(addresses)+len(tlv))), addresses...)
+	raw = append(raw, tlv...)
+
+	header, err := Read(newBufioReader(raw))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(header.RawAddresses(), addresses) {
+		t.Fatalf("expected raw addresses %v, got %v", addresses, header.RawAddresses())
+	}
+	tlvs, err := header.TLVs()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tlvs) != 1 || tlvs[0].Type != PP2_TYPE_UNIQUE_ID || string(tlvs[0].Value) != "id" {
+		t.Fatalf("expected the UNIQUE_ID TLV, got %v", tlvs)
+	}
+
+	formatted, err := header.Format()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(formatted, raw) {
+		t.Fatalf("expected formatted header %v, got %v", raw, formatted)
+	}
+}
+
+func TestParseV2UnspecRawAddresses(t *testing.T) {
+	addresses := append(append([]byte{}, addressesIPv4...), 0xff)
+	raw := append(append(append(SIGV2, byte(LOCAL), byte(UNSPEC)), 0x00, byte(len(addresses))), addresses...)
+
+	header, err := Read(newBufioReader(raw))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(header.RawAddresses(), addresses) {
+		t.Fatalf("expected raw addresses %v, got %v", addresses, header.RawAddresses())
+	}
+
+	header, err = Read(newBufioReader(append(append(SIGV2, byte(LOCAL), byte(UNSPEC)), fixtureUnspecTLV...)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := header.TLVs(); err == nil && header.RawAddresses() != nil {
+		t.Fatalf("expected no raw addresses for valid TLVs, got %v", header.RawAddresses())
+	}
+}
@@ -0,0 +1,189 @@
+package proxyproto
+
+import (
+	"io"
+	"net"
+	"syscall"
+)
+
+// closeWriter is implemented by connections which can shut down their
+// writing side, e.g. *net.TCPConn and *net.UnixConn.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// PreserveInterfaces returns conn as a net.Conn implementing the optional
+// io.ReaderFrom, io.WriterTo, syscall.Conn and CloseWrite() error interfaces
+// only when the underlying connection does. While *Conn always implements
+// io.ReaderFrom and io.WriterTo, and never the others, the returned conn lets
+// feature detection, e.g. by io.Copy, TLS or HTTP libraries, behave as it
+// would on the underlying connection.
+//
+// The returned conn has a ProxyConn() *Conn method giving access to conn.
+// Beware that reading through the syscall.Conn bypasses the bytes already
+// buffered by conn.
+func PreserveInterfaces(conn *Conn) net.Conn {
+	const (
+		hasReaderFrom = 1 << iota
+		hasWriterTo
+		hasSyscallConn
+		hasCloseWriter
+	)
+
+	var mask int
+	if _, ok := conn.conn.(io.ReaderFrom); ok {
+		mask |= hasReaderFrom
+	}
+	if _, ok := conn.conn.(io.WriterTo); ok {
+		mask |= hasWriterTo
+	}
+	sc, ok := conn.conn.(syscall.Conn)
+	if ok {
+		mask |= hasSyscallConn
+	}
+	cw, ok := conn.conn.(closeWriter)
+	if ok {
+		mask |= hasCloseWriter
+	}
+
+	w := wrappedConn{conn}
+	switch mask {
+	case 0:
+		return w
+	case hasReaderFrom:
+		return struct {
+			wrappedConn
+			readerFrom
+		}{w, readerFrom{conn}}
+	case hasWriterTo:
+		return struct {
+			wrappedConn
+			writerTo
+		}{w, writerTo{conn}}
+	case hasReaderFrom | hasWriterTo:
+		return struct {
+			wrappedConn
+			readerFrom
+			writerTo
+		}{w, readerFrom{conn}, writerTo{conn}}
+	case hasSyscallConn:
+		return struct {
+			wrappedConn
+			syscallConn
+		}{w, syscallConn{sc}}
+	case hasReaderFrom | hasSyscallConn:
+		return struct {
+			wrappedConn
+			readerFrom
+			syscallConn
+		}{w, readerFrom{conn}, syscallConn{sc}}
+	case hasWriterTo | hasSyscallConn:
+		return struct {
+			wrappedConn
+			writerTo
+			syscallConn
+		}{w, writerTo{conn}, syscallConn{sc}}
+	case hasReaderFrom | hasWriterTo | hasSyscallConn:
+		return struct {
+			wrappedConn
+			readerFrom
+			writerTo
+			syscallConn
+		}{w, readerFrom{conn}, writerTo{conn}, syscallConn{sc}}
+	case hasCloseWriter:
+		return struct {
+			wrappedConn
+			closeWriteConn
+		}{w, closeWriteConn{cw}}
+	case hasReaderFrom | hasCloseWriter:
+		return struct {
+			wrappedConn
+			readerFrom
+			closeWriteConn
+		}{w, readerFrom{conn}, closeWriteConn{cw}}
+	case hasWriterTo | hasCloseWriter:
+		return struct {
+			wrappedConn
+			writerTo
+			closeWriteConn
+		}{w, writerTo{conn}, closeWriteConn{cw}}
+	case hasReaderFrom | hasWriterTo | hasCloseWriter:
+		return struct {
+			wrappedConn
+			readerFrom
+			writerTo
+			closeWriteConn
+		}{w, readerFrom{conn}, writerTo{conn}, closeWriteConn{cw}}
+	case hasSyscallConn | hasCloseWriter:
+		return struct {
+			wrappedConn
+			syscallConn
+			closeWriteConn
+		}{w, syscallConn{sc}, closeWriteConn{cw}}
+	case hasReaderFrom | hasSyscallConn | hasCloseWriter:
+		return struct {
+			wrappedConn
+			readerFrom
+			syscallConn
+			closeWriteConn
+		}{w, readerFrom{conn}, syscallConn{sc}, closeWriteConn{cw}}
+	case hasWriterTo | hasSyscallConn | hasCloseWriter:
+		return struct {
+			wrappedConn
+			writerTo
+			syscallConn
+			closeWriteConn
+		}{w, writerTo{conn}, syscallConn{sc}, closeWriteConn{cw}}
+	case hasReaderFrom | hasWriterTo | hasSyscallConn | hasCloseWriter:
+		return struct {
+			wrappedConn
+			readerFrom
+			writerTo
+			syscallConn
+			closeWriteConn
+		}{w, readerFrom{conn}, writerTo{conn}, syscallConn{sc}, closeWriteConn{cw}}
+	}
+	panic("unreachable")
+}
+
+// wrappedConn exposes the net.Conn methods of a *Conn only.
+type wrappedConn struct {
+	net.Conn
+}
+
+// ProxyConn returns the wrapped proxyproto.Conn.
+func (w wrappedConn) ProxyConn() *Conn {
+	return w.Conn.(*Conn)
+}
+
+type readerFrom struct {
+	c *Conn
+}
+
+func (r readerFrom) ReadFrom(src io.Reader) (int64, error) {
+	return r.c.ReadFrom(src)
+}
+
+type writerTo struct {
+	c *Conn
+}
+
+func (w writerTo) WriteTo(dst io.Writer) (int64, error) {
+	return w.c.WriteTo(dst)
+}
+
+type syscallConn struct {
+	sc syscall.Conn
+}
+
+func (s syscallConn) SyscallConn() (syscall.RawConn, error) {
+	return s.sc.SyscallConn()
+}
+
+type closeWriteConn struct {
+	cw closeWriter
+}
+
+func (c closeWriteConn) CloseWrite() error {
+	return c.cw.CloseWrite()
+}
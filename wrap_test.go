@@ -0,0 +1,91 @@
+package proxyproto
+
+import (
+	"io"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestPreserveInterfaces(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{Listener: l, PreserveInterfaces: true}
+	defer pl.Close()
+
+	cliResult := make(chan error)
+	go func() {
+		conn, err := net.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			cliResult <- err
+			return
+		}
+		defer conn.Close()
+
+		if _, err := conn.Write([]byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\nping")); err != nil {
+			cliResult <- err
+			return
+		}
+		close(cliResult)
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	if _, ok := conn.(io.ReaderFrom); !ok {
+		t.Fatal("expected io.ReaderFrom")
+	}
+	if _, ok := conn.(io.WriterTo); !ok {
+		t.Fatal("expected io.WriterTo")
+	}
+	if _, ok := conn.(syscall.Conn); !ok {
+		t.Fatal("expected syscall.Conn")
+	}
+	if _, ok := conn.(closeWriter); !ok {
+		t.Fatal("expected CloseWrite")
+	}
+
+	recv := make([]byte, 4)
+	if _, err := io.ReadFull(conn, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(recv) != "ping" {
+		t.Fatalf("expected %q, got %q", "ping", recv)
+	}
+	if addr := conn.RemoteAddr().String(); addr != "10.1.1.1:1000" {
+		t.Fatalf("unexpected remote address %v", addr)
+	}
+	pConn := conn.(interface{ ProxyConn() *Conn }).ProxyConn()
+	if pConn.ProxyHeader() == nil {
+		t.Fatal("expected a header")
+	}
+	if err := <-cliResult; err != nil {
+		t.Fatalf("client error: %v", err)
+	}
+}
+
+func TestPreserveInterfacesPipe(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	conn := PreserveInterfaces(NewConn(server))
+	if _, ok := conn.(io.ReaderFrom); ok {
+		t.Fatal("unexpected io.ReaderFrom")
+	}
+	if _, ok := conn.(io.WriterTo); ok {
+		t.Fatal("unexpected io.WriterTo")
+	}
+	if _, ok := conn.(syscall.Conn); ok {
+		t.Fatal("unexpected syscall.Conn")
+	}
+	if _, ok := conn.(closeWriter); ok {
+		t.Fatal("unexpected CloseWrite")
+	}
+}
@@ -0,0 +1,71 @@
+package proxyproto
+
+import (
+	"fmt"
+	"io"
+)
+
+// Writer writes PROXY headers, and the payload following them, to any
+// io.Writer, e.g. to build test fixtures, generate capture files, or speak
+// the protocol over transports which aren't a net.Conn.
+type Writer struct {
+	w       io.Writer
+	version byte
+	tlvs    []TLV
+}
+
+// WriterVersion makes the Writer write headers of the given protocol
+// version, whatever the version they were built with, when passed as option
+// to NewWriter(). Version 1 headers can't carry TLVs.
+func WriterVersion(version byte) func(*Writer) {
+	return func(w *Writer) {
+		w.version = version
+	}
+}
+
+// WriterTLVs makes the Writer append the TLVs to the ones of every header
+// written, when passed as option to NewWriter().
+func WriterTLVs(tlvs ...TLV) func(*Writer) {
+	return func(w *Writer) {
+		w.tlvs = append(w.tlvs, tlvs...)
+	}
+}
+
+// NewWriter returns a Writer writing to w.
+func NewWriter(w io.Writer, opts ...func(*Writer)) *Writer {
+	writer := &Writer{w: w}
+	for _, opt := range opts {
+		opt(writer)
+	}
+	return writer
+}
+
+// WriteHeader writes the header, as altered by the options of the Writer,
+// and returns the number of bytes written. The header itself is left
+// untouched.
+func (w *Writer) WriteHeader(header *Header) (int64, error) {
+	if w.version != 0 || len(w.tlvs) > 0 {
+		h := *header
+		h.raw, h.size = nil, 0
+		if w.version != 0 {
+			h.Version = w.version
+		}
+		header = &h
+		if len(w.tlvs) > 0 {
+			if h.Version != 2 {
+				return 0, fmt.Errorf("proxyproto: version %d headers can't carry TLVs", h.Version)
+			}
+			raw, err := JoinTLVs(w.tlvs)
+			if err != nil {
+				return 0, err
+			}
+			header = withTLVs(&h, raw)
+		}
+	}
+	return header.WriteTo(w.w)
+}
+
+// Write writes payload bytes, e.g. following a header.
+func (w *Writer) Write(b []byte) (int, error) {
+	return w.w.Write(b)
+}
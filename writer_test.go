@@ -0,0 +1,51 @@
+package proxyproto
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	header := HeaderProxyFromAddrs(1, v4addr, v4addr)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WriterVersion(2), WriterTLVs(TLV{Type: PP2_TYPE_AUTHORITY, Value: []byte("example.org")}))
+	if _, err := w.WriteHeader(header); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := w.Write([]byte("ping")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	r := NewReader(&buf)
+	got, err := r.Header()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if got.Version != 2 || got.SourceAddr.String() != v4addr.String() || got.DestinationAddr.String() != v4addr.String() {
+		t.Fatalf("unexpected header: %v", got)
+	}
+	tlvs, err := got.TLVs()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(tlvs) != 1 || tlvs[0].Type != PP2_TYPE_AUTHORITY || string(tlvs[0].Value) != "example.org" {
+		t.Fatalf("unexpected TLVs: %v", tlvs)
+	}
+	if payload, _ := io.ReadAll(r); string(payload) != "ping" {
+		t.Fatalf("expected payload %q, got %q", "ping", payload)
+	}
+
+	// The header itself is left untouched.
+	if header.Version != 1 {
+		t.Fatalf("expected the header to be untouched, got version %d", header.Version)
+	}
+}
+
+func TestWriterVersion1TLVs(t *testing.T) {
+	w := NewWriter(io.Discard, WriterTLVs(TLV{Type: PP2_TYPE_AUTHORITY, Value: []byte("example.org")}))
+	if _, err := w.WriteHeader(HeaderProxyFromAddrs(1, v4addr, v4addr)); err == nil {
+		t.Fatal("expected an error")
+	}
+}